@@ -0,0 +1,16 @@
+package cmd
+
+import "github.com/urfave/cli"
+
+// All creates a command running the http server, the worker and its cleaner in a single process.
+// With STORE_BACKEND=memory and QUEUE_BACKEND=memory it runs without any external service.
+func (a *ApplicationContext) All() cli.Command {
+	return cli.Command{
+		Name:  "all",
+		Usage: "serve http request and run the worker in a single process",
+		Flags: workerFlags,
+		Action: func(c *cli.Context) error {
+			return a.run(append([]component{a.httpComponent()}, a.workerComponents()...)...)
+		},
+	}
+}
@@ -10,28 +10,84 @@ import (
 )
 
 type ApplicationContext struct {
-	ctx        context.Context
-	cfg        config.Config
-	jobStore   jobs.Store
-	jobSvc     jobs.Service
-	jobHandler *jobs.HTTPHandler
-	jobWorker  jobs.Worker
+	ctx          context.Context
+	cfg          config.Config
+	jobStore     jobs.Store
+	jobSvc       jobs.Service
+	jobHandler   *jobs.HTTPHandler
+	jobWorker    jobs.Worker
+	workerServer *jobs.WorkerServer
+	queueAdmin   jobs.QueueAdmin
+	settings     jobs.SettingsStore
+	maintenance  *jobs.Maintenance
+
+	cleanup func() `wire:"-"`
+}
+
+// NewApplication creates an application without dependencies, they are built by the commands which need them.
+func NewApplication(ctx context.Context) *ApplicationContext {
+	return &ApplicationContext{ctx: ctx}
 }
 
 func (a *ApplicationContext) Commands() *cli.App {
 	app := cli.NewApp()
-	app.Before = func(c *cli.Context) error {
-		if err := a.Migrate(); err != nil {
-			return err
-		}
+	app.Flags = []cli.Flag{configFileFlag}
+	app.Commands = []cli.Command{
+		a.withDependencies(a.Serve()),
+		a.withDependencies(a.Worker()),
+		a.withDependencies(a.All()),
+		a.withDependencies(a.Jobs()),
+		a.withDependencies(a.Queue()),
+		a.withDependencies(a.Maintenance()),
+		a.Migrate(),
+		a.Config(),
+	}
 
-		return nil
+	return app
+}
+
+// Close releases the dependencies built for the command.
+func (a *ApplicationContext) Close() {
+	if a.cleanup != nil {
+		a.cleanup()
+		a.cleanup = nil
 	}
+}
 
-	app.Commands = []cli.Command{
-		a.Serve(),
-		a.Worker(),
+func (a *ApplicationContext) withDependencies(command cli.Command) cli.Command {
+	command.Before = a.initDependencies
+	return command
+}
+
+// initDependencies prepares the database schema and builds the dependencies of the application on it.
+// The schema is checked first, so no queue or store is opened against a database this binary does not expect.
+func (a *ApplicationContext) initDependencies(c *cli.Context) error {
+	if err := a.initConfig(c); err != nil {
+		return err
 	}
 
-	return app
+	if err := a.prepareSchema(); err != nil {
+		return err
+	}
+
+	app, cleanup, err := InitApplication(a.ctx, c)
+	if err != nil {
+		return err
+	}
+
+	*a = *app
+	a.cleanup = cleanup
+
+	return nil
+}
+
+// initConfig loads the configuration only, for commands which must not depend on the database schema.
+func (a *ApplicationContext) initConfig(c *cli.Context) error {
+	cfg, err := ProvideConfig(c)
+	if err != nil {
+		return err
+	}
+
+	a.cfg = cfg
+	return nil
 }
@@ -0,0 +1,116 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/joho/godotenv"
+	"github.com/urfave/cli"
+	"gopkg.in/yaml.v3"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+const outputYAML = "yaml"
+
+var configFileFlag = cli.StringFlag{
+	Name:   "config, c",
+	EnvVar: "CONFIG_FILE",
+	Usage:  "YAML file of settings, the environment overrides them",
+}
+
+// loadConfig loads the config of the --config file of c under the environment and the .env file, without validating it.
+func loadConfig(c *cli.Context) (config.Config, error) {
+	godotenv.Load()
+
+	var file string
+	if c != nil {
+		file = c.GlobalString("config")
+	}
+
+	return config.Load(file)
+}
+
+// Config creates the commands to inspect the configuration, they neither need the database nor a valid config.
+func (a *ApplicationContext) Config() cli.Command {
+	return cli.Command{
+		Name:  "config",
+		Usage: "inspect the configuration",
+		Subcommands: []cli.Command{
+			{
+				Name:  "check",
+				Usage: "validate the configuration and list its problems",
+				Action: func(c *cli.Context) error {
+					cfg, err := loadConfig(c)
+					if err != nil {
+						return err
+					}
+
+					var problems config.ValidationError
+					if err := cfg.Validate(); errors.As(err, &problems) {
+						for _, problem := range problems {
+							fmt.Fprintln(os.Stderr, problem)
+						}
+
+						return fmt.Errorf("config is invalid, %d problems", len(problems))
+					} else if err != nil {
+						return err
+					}
+
+					for _, warning := range cfg.Warnings() {
+						fmt.Fprintln(os.Stderr, "warning:", warning)
+					}
+
+					fmt.Println("config is valid")
+					return nil
+				},
+			},
+			{
+				Name:  "print",
+				Usage: "print the effective configuration, it can be used as a --config file",
+				Flags: []cli.Flag{
+					cli.BoolFlag{Name: "redact", Usage: "hide the values of the secrets, e.g. passwords and API keys"},
+					cli.StringFlag{Name: "output, o", Value: outputYAML, Usage: "output format: yaml, table or json"},
+				},
+				Action: func(c *cli.Context) error {
+					cfg, err := loadConfig(c)
+					if err != nil {
+						return err
+					}
+
+					return printSettings(c, cfg.Settings(c.Bool("redact")))
+				},
+			},
+		},
+	}
+}
+
+func printSettings(c *cli.Context, settings []config.Setting) error {
+	if c.String("output") == outputYAML {
+		doc := &yaml.Node{Kind: yaml.MappingNode}
+		for _, setting := range settings {
+			doc.Content = append(doc.Content,
+				&yaml.Node{Kind: yaml.ScalarNode, Value: setting.Key},
+				&yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: setting.Value},
+			)
+		}
+
+		encoder := yaml.NewEncoder(os.Stdout)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(doc); err != nil {
+			return err
+		}
+
+		return encoder.Close()
+	}
+
+	values := make(map[string]string, len(settings))
+	rows := make([][]string, 0, len(settings))
+	for _, setting := range settings {
+		values[setting.Key] = setting.Value
+		rows = append(rows, []string{setting.Key, setting.Value})
+	}
+
+	return printOutput(c, values, []string{"KEY", "VALUE"}, rows)
+}
@@ -0,0 +1,172 @@
+package cmd
+
+import (
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+)
+
+var tenantFlag = cli.StringFlag{
+	Name:  "tenant",
+	Value: jobs.DefaultTenantId,
+	Usage: "tenant of the jobs",
+}
+
+// Jobs creates the commands to inspect and operate jobs
+func (a *ApplicationContext) Jobs() cli.Command {
+	return cli.Command{
+		Name:  "jobs",
+		Usage: "inspect and operate jobs",
+		Subcommands: []cli.Command{
+			{
+				Name:      "get",
+				Usage:     "get a job",
+				ArgsUsage: "<job-id>",
+				Flags:     []cli.Flag{tenantFlag, outputFlag},
+				Action: a.jobAction(func(c *cli.Context, jobId int) (jobs.Job, error) {
+					return a.jobSvc.GetJobByID(a.ctx, c.String("tenant"), jobId)
+				}),
+			},
+			{
+				Name:  "list",
+				Usage: "list the latest jobs",
+				Flags: []cli.Flag{
+					tenantFlag,
+					outputFlag,
+					cli.StringFlag{Name: "status", Usage: "only jobs in this status"},
+					cli.StringFlag{Name: "type", Usage: "only jobs of this type"},
+					cli.IntFlag{Name: "object-id", Usage: "only jobs of this object"},
+					cli.IntFlag{Name: "limit", Value: 20, Usage: "max number of jobs"},
+				},
+				Action: func(c *cli.Context) error {
+					status := jobs.JobStatus(c.String("status"))
+					if status != "" && !jobs.IsValidJobStatus(status) {
+						return errors.Errorf("unknown status %s", status)
+					}
+
+					result, err := a.jobStore.ListJobs(a.ctx, jobs.JobFilter{
+						TenantId: c.String("tenant"),
+						Status:   status,
+						Type:     c.String("type"),
+						ObjectId: c.Int("object-id"),
+						Limit:    c.Int("limit"),
+					})
+					if err != nil {
+						return err
+					}
+
+					return printJobs(c, result)
+				},
+			},
+			{
+				Name:      "retry",
+				Usage:     "reset a failed job and publish it again",
+				ArgsUsage: "<job-id>",
+				Flags:     []cli.Flag{tenantFlag, outputFlag},
+				Action: a.jobAction(func(c *cli.Context, jobId int) (jobs.Job, error) {
+					return a.jobSvc.RetryJob(a.ctx, c.String("tenant"), jobId)
+				}),
+			},
+			{
+				Name:      "cancel",
+				Usage:     "cancel a job which was not claimed yet",
+				ArgsUsage: "<job-id>",
+				Flags:     []cli.Flag{tenantFlag, outputFlag},
+				Action: a.jobAction(func(c *cli.Context, jobId int) (jobs.Job, error) {
+					return a.jobSvc.CancelJob(a.ctx, c.String("tenant"), jobId)
+				}),
+			},
+			{
+				Name:      "requeue",
+				Usage:     "publish a created job to the queue again",
+				ArgsUsage: "<job-id>",
+				Flags:     []cli.Flag{tenantFlag, outputFlag},
+				Action: a.jobAction(func(c *cli.Context, jobId int) (jobs.Job, error) {
+					return a.jobSvc.RequeueJob(a.ctx, c.String("tenant"), jobId)
+				}),
+			},
+		},
+	}
+}
+
+// jobAction parses the job id argument, runs fn and prints the returned job
+func (a *ApplicationContext) jobAction(fn func(c *cli.Context, jobId int) (jobs.Job, error)) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		jobId, err := strconv.Atoi(c.Args().First())
+		if err != nil {
+			return errors.New("job id is required")
+		}
+
+		job, err := fn(c, jobId)
+		if err != nil {
+			return err
+		}
+
+		return printJobs(c, []jobs.Job{job})
+	}
+}
+
+func printJobs(c *cli.Context, result []jobs.Job) error {
+	var value interface{} = result
+	if len(result) == 1 && c.Command.Name != "list" {
+		value = result[0]
+	}
+
+	header := []string{"ID", "TENANT", "OBJECT", "TYPE", "STATUS", "CREATED", "START", "END", "WAIT", "RUN", "ATTEMPTS", "WORKER", "ERROR"}
+	rows := make([][]string, 0, len(result))
+	for _, job := range result {
+		rows = append(rows, []string{
+			strconv.Itoa(job.Id),
+			job.TenantId,
+			strconv.Itoa(job.ObjectId),
+			job.Type,
+			string(job.Status),
+			formatTime(&job.CreatedAt),
+			formatTime(job.StartTime),
+			formatTime(job.EndTime),
+			formatDuration(job.QueueWait()),
+			formatDuration(job.RunTime()),
+			strconv.Itoa(job.Attempts),
+			formatString(job.WorkerId),
+			formatJobError(job.Error),
+		})
+	}
+
+	return printOutput(c, value, header, rows)
+}
+
+func formatJobError(jobErr *jobs.JobError) string {
+	if jobErr == nil {
+		return "-"
+	}
+
+	return jobErr.Code + ": " + jobErr.Message
+}
+
+func formatDuration(d time.Duration, ok bool) string {
+	if !ok {
+		return "-"
+	}
+
+	return d.String()
+}
+
+func formatString(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+
+	return t.Format(time.RFC3339)
+}
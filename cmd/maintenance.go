@@ -0,0 +1,75 @@
+package cmd
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+)
+
+// Maintenance creates a command archiving and purging the old jobs and managing the partitions of the jobs table.
+func (a *ApplicationContext) Maintenance() cli.Command {
+	return cli.Command{
+		Name:  "maintenance",
+		Usage: "archive and purge the old jobs, create and drop the partitions of the jobs table",
+		Flags: []cli.Flag{
+			outputFlag,
+			cli.BoolFlag{Name: "loop", Usage: "run every RETENTION_INTERVAL minutes until stopped"},
+		},
+		Action: func(c *cli.Context) error {
+			if c.Bool("loop") {
+				return a.run(a.maintenanceComponent())
+			}
+
+			report, err := a.maintenance.Run(a.ctx)
+			if printErr := printMaintenanceReport(c, report); printErr != nil && err == nil {
+				err = printErr
+			}
+
+			return err
+		},
+	}
+}
+
+func (a *ApplicationContext) maintenanceComponent() component {
+	ctx, cancel := context.WithCancel(a.ctx)
+	return component{
+		name: "maintenance",
+		run: func() error {
+			a.maintenance.Loop(ctx, time.Duration(a.cfg.RetentionIntervalMinutes)*time.Minute)
+			return nil
+		},
+		stop: func(ctx context.Context) error {
+			cancel()
+			return nil
+		},
+	}
+}
+
+func printMaintenanceReport(c *cli.Context, report jobs.MaintenanceReport) error {
+	statuses := make([]string, 0, len(report.Purged))
+	for status := range report.Purged {
+		statuses = append(statuses, string(status))
+	}
+	sort.Strings(statuses)
+
+	rows := [][]string{
+		{"created partitions", strings.Join(report.CreatedPartitions, ",")},
+		{"archived", strconv.Itoa(report.Archived)},
+	}
+
+	for _, status := range statuses {
+		rows = append(rows, []string{"purged " + status, strconv.Itoa(report.Purged[jobs.JobStatus(status)])})
+	}
+
+	rows = append(rows,
+		[]string{"deleted artifacts", strconv.Itoa(report.DeletedArtifacts)},
+		[]string{"dropped partitions", strings.Join(report.DroppedPartitions, ",")},
+	)
+	return printOutput(c, report, []string{"ACTION", "RESULT"}, rows)
+}
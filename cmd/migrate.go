@@ -2,22 +2,178 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 
 	_ "github.com/lib/pq"
+	migrate "github.com/rubenv/sql-migrate"
+	"github.com/urfave/cli"
+
 	migration "github.com/tuyentv96/hasty-challenge/db"
 )
 
-func (a *ApplicationContext) Migrate() error {
-	dataSource := fmt.Sprintf("postgresql://%s:%s@%s/%s?sslmode=disable",
-		a.cfg.SQLUser,
-		a.cfg.SQLPassword,
-		a.cfg.SQLAddress,
-		a.cfg.SQLName,
-	)
+var (
+	limitFlag = cli.IntFlag{
+		Name:  "limit",
+		Usage: "max number of migrations, 0 means all of them",
+	}
+	dryRunFlag = cli.BoolFlag{
+		Name:  "dry-run",
+		Usage: "print the migrations without applying them",
+	}
+)
+
+// Migrate creates the commands to manage the database schema
+func (a *ApplicationContext) Migrate() cli.Command {
+	return cli.Command{
+		Name:   "migrate",
+		Usage:  "manage the database schema",
+		Before: a.initConfig,
+		Subcommands: []cli.Command{
+			{
+				Name:  "up",
+				Usage: "apply pending migrations",
+				Flags: []cli.Flag{limitFlag, dryRunFlag},
+				Action: a.migrateAction(func(c *cli.Context, migrator *migration.Migrator) error {
+					return a.migrate(c, migrator, migrate.Up, c.Int("limit"))
+				}),
+			},
+			{
+				Name:  "down",
+				Usage: "roll back applied migrations, the last one by default",
+				Flags: []cli.Flag{
+					cli.IntFlag{Name: "limit", Value: 1, Usage: "max number of migrations, 0 means all of them"},
+					dryRunFlag,
+				},
+				Action: a.migrateAction(func(c *cli.Context, migrator *migration.Migrator) error {
+					return a.migrate(c, migrator, migrate.Down, c.Int("limit"))
+				}),
+			},
+			{
+				Name:  "redo",
+				Usage: "roll back the last applied migration and apply it again",
+				Flags: []cli.Flag{dryRunFlag},
+				Action: a.migrateAction(func(c *cli.Context, migrator *migration.Migrator) error {
+					if c.Bool("dry-run") {
+						planned, err := migrator.PlanRedo()
+						if err != nil {
+							return err
+						}
+
+						printPlannedMigrations(planned)
+						return nil
+					}
+
+					id, err := migrator.Redo()
+					if err != nil {
+						return err
+					}
+
+					if id == "" {
+						fmt.Println("Nothing to do")
+					} else {
+						fmt.Printf("Redone migration %s\n", id)
+					}
+
+					return nil
+				}),
+			},
+			{
+				Name:  "status",
+				Usage: "list migrations and whether they were applied",
+				Flags: []cli.Flag{outputFlag},
+				Action: a.migrateAction(func(c *cli.Context, migrator *migration.Migrator) error {
+					statuses, err := migrator.Status()
+					if err != nil {
+						return err
+					}
+
+					rows := make([][]string, 0, len(statuses))
+					for _, status := range statuses {
+						rows = append(rows, []string{
+							status.Id,
+							strconv.FormatBool(status.Applied),
+							formatTime(status.AppliedAt),
+							strconv.FormatBool(status.Unknown),
+						})
+					}
+
+					return printOutput(c, statuses, []string{"MIGRATION", "APPLIED", "APPLIED AT", "UNKNOWN"}, rows)
+				}),
+			},
+		},
+	}
+}
+
+func (a *ApplicationContext) migrate(c *cli.Context, migrator *migration.Migrator, direction migrate.MigrationDirection, limit int) error {
+	if c.Bool("dry-run") {
+		planned, err := migrator.Plan(direction, limit)
+		if err != nil {
+			return err
+		}
+
+		printPlannedMigrations(planned)
+		return nil
+	}
+
+	var count int
+	var err error
+	if direction == migrate.Down {
+		count, err = migrator.Down(limit)
+	} else {
+		count, err = migrator.Up(limit)
+	}
 
-	if err := migration.Migrate(dataSource); err != nil {
+	if err != nil {
 		return err
 	}
 
+	fmt.Printf("Applied %d migrations\n", count)
 	return nil
 }
+
+// migrateAction opens a migrator for fn and closes it afterwards
+func (a *ApplicationContext) migrateAction(fn func(c *cli.Context, migrator *migration.Migrator) error) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		migrator, err := migration.NewMigrator(a.dataSource())
+		if err != nil {
+			return err
+		}
+		defer migrator.Close()
+
+		return fn(c, migrator)
+	}
+}
+
+func printPlannedMigrations(planned []migration.PlannedMigration) {
+	migration.WritePlannedMigrations(os.Stdout, planned)
+}
+
+// prepareSchema migrates the database when SQL_AUTO_MIGRATE is set, otherwise it makes sure the schema is the one this binary expects.
+func (a *ApplicationContext) prepareSchema() error {
+	if !a.cfg.UsesPostgres() {
+		return nil
+	}
+
+	migrator, err := migration.NewMigrator(a.dataSource())
+	if err != nil {
+		return err
+	}
+	defer migrator.Close()
+
+	if a.cfg.SQLAutoMigrate {
+		_, err := migrator.Up(0)
+		return err
+	}
+
+	return migrator.CheckVersion()
+}
+
+func (a *ApplicationContext) dataSource() string {
+	return fmt.Sprintf("postgresql://%s:%s@%s/%s?sslmode=disable",
+		a.cfg.SQLUser,
+		a.cfg.SQLPassword,
+		a.cfg.SQLAddress,
+		a.cfg.SQLName,
+	)
+}
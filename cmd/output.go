@@ -0,0 +1,53 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/urfave/cli"
+)
+
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+)
+
+var outputFlag = cli.StringFlag{
+	Name:  "output, o",
+	Value: outputTable,
+	Usage: "output format: table or json",
+}
+
+// printOutput writes value as indented JSON or, by default, as a table of the given header and rows.
+func printOutput(c *cli.Context, value interface{}, header []string, rows [][]string) error {
+	switch c.String("output") {
+	case outputJSON:
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(value)
+	case outputTable:
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		printRow(w, header)
+		for _, row := range rows {
+			printRow(w, row)
+		}
+
+		return w.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", c.String("output"))
+	}
+}
+
+func printRow(w *tabwriter.Writer, row []string) {
+	for i, cell := range row {
+		if i > 0 {
+			fmt.Fprint(w, "\t")
+		}
+
+		fmt.Fprint(w, cell)
+	}
+
+	fmt.Fprintln(w)
+}
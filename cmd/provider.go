@@ -1,28 +1,35 @@
 package cmd
 
 import (
+	"fmt"
+	"time"
+
 	"github.com/adjust/rmq/v5"
 	"github.com/benbjohnson/clock"
 	"github.com/go-pg/pg/v9"
 	"github.com/go-redis/redis/v8"
-	"github.com/joho/godotenv"
-	"github.com/kelseyhightower/envconfig"
 	"github.com/sirupsen/logrus"
+	"github.com/urfave/cli"
 
 	"github.com/tuyentv96/hasty-challenge/config"
 	"github.com/tuyentv96/hasty-challenge/jobs"
+	"github.com/tuyentv96/hasty-challenge/jobs/memory"
 	"github.com/tuyentv96/hasty-challenge/utils"
 )
 
-func ProvideConfig() (config.Config, error) {
-	cfg := config.Config{}
-	godotenv.Load()
-
-	err := envconfig.Process("", &cfg)
+// ProvideConfig loads the config from the environment and the --config file, the flags of the command c override it.
+func ProvideConfig(c *cli.Context) (config.Config, error) {
+	cfg, err := loadConfig(c)
 	if err != nil {
 		return cfg, err
 	}
 
+	applyWorkerFlags(c, &cfg)
+
+	if err := cfg.Validate(); err != nil {
+		return cfg, err
+	}
+
 	return cfg, nil
 }
 
@@ -38,19 +45,25 @@ func ProvideLogger(cfg config.Config) *logrus.Entry {
 }
 
 func ProvideClock() clock.Clock {
-	return clock.New()
+	return utils.NewClock()
 }
 
 func ProvideRandom() utils.Random {
 	return utils.NewRandomImpl()
 }
 
+// ProvidePostgres returns a nil db when neither the store nor the queue use Postgres.
 func ProvidePostgres(cfg config.Config) (*pg.DB, error) {
+	if !cfg.UsesPostgres() {
+		return nil, nil
+	}
+
 	db := pg.Connect(&pg.Options{
-		Addr:     cfg.SQLConfig.SQLAddress,
-		User:     cfg.SQLConfig.SQLUser,
-		Password: cfg.SQLConfig.SQLPassword,
-		Database: cfg.SQLConfig.SQLName,
+		Addr:      cfg.SQLConfig.SQLAddress,
+		User:      cfg.SQLConfig.SQLUser,
+		Password:  cfg.SQLConfig.SQLPassword,
+		Database:  cfg.SQLConfig.SQLName,
+		OnConnect: utils.SetSessionUTC,
 	})
 
 	if _, err := db.ExecOne("SELECT 1"); err != nil {
@@ -60,24 +73,125 @@ func ProvidePostgres(cfg config.Config) (*pg.DB, error) {
 	return db, nil
 }
 
-func ProvideTransactioner(db *pg.DB) utils.Transactioner {
+func ProvideTransactioner(cfg config.Config, db *pg.DB) utils.Transactioner {
+	if cfg.StoreBackend == config.StoreBackendMemory {
+		return memory.NewTransactioner()
+	}
+
 	return utils.NewTransaction(db)
 }
 
-func ProvideJobSvc(jobStore jobs.Store, queue rmq.Queue, clock clock.Clock) jobs.Service {
-	return jobs.NewService(jobStore, queue, clock)
+func ProvideJobSvc(jobStore jobs.Store, queues *jobs.JobQueues, clock clock.Clock) jobs.Service {
+	return jobs.NewService(jobStore, queues, clock)
 }
 
-func ProvideJobStore(db *pg.DB) jobs.Store {
+func ProvideJobStore(cfg config.Config, db *pg.DB) jobs.Store {
+	if cfg.StoreBackend == config.StoreBackendMemory {
+		return memory.NewStore()
+	}
+
 	return jobs.NewJobStore(db)
 }
 
-func ProvideJobHandler(cfg config.Config, jobSvc jobs.Service) *jobs.HTTPHandler {
-	return jobs.NewHTTPHandler(cfg, jobSvc)
+func ProvideRateLimiter(redisClient *redis.Client, clock clock.Clock) jobs.RateLimiter {
+	return jobs.NewRedisRateLimiter(redisClient, clock)
+}
+
+func ProvideQueueAdmin(broker jobs.Broker, settings jobs.SettingsStore) jobs.QueueAdmin {
+	return jobs.NewJobQueueAdmin(broker, jobs.QueueName, settings)
+}
+
+func ProvideJobHandler(cfg config.Config, logger *logrus.Entry, jobSvc jobs.Service, limiter jobs.RateLimiter, queueAdmin jobs.QueueAdmin, workers jobs.WorkerRegistry, logs jobs.JobLogStore, artifacts jobs.ArtifactStore, settings jobs.SettingsStore, checks jobs.HealthChecks) *jobs.HTTPHandler {
+	return jobs.NewHTTPHandler(cfg, logger, jobSvc, limiter, queueAdmin, workers, logs, artifacts, settings, checks)
+}
+
+func ProvideHealthChecks(cfg config.Config, db *pg.DB, redisClient *redis.Client, broker jobs.Broker) jobs.HealthChecks {
+	// a nil *pg.DB would be a non-nil orm.DB
+	if db == nil {
+		return jobs.NewHealthChecks(cfg, nil, redisClient, broker)
+	}
+
+	return jobs.NewHealthChecks(cfg, db, redisClient, broker)
+}
+
+func ProvideJobLogStore(cfg config.Config, db *pg.DB) jobs.JobLogStore {
+	if cfg.StoreBackend == config.StoreBackendMemory {
+		return memory.NewJobLogStore()
+	}
+
+	return jobs.NewJobLogStore(db)
+}
+
+func ProvideArtifactStore(cfg config.Config, clock clock.Clock) (jobs.ArtifactStore, error) {
+	if cfg.ArtifactBackend == config.ArtifactBackendS3 {
+		return jobs.NewS3ArtifactStore(cfg.ArtifactConfig, clock)
+	}
+
+	return jobs.NewLocalArtifactStore(cfg.ArtifactDir), nil
+}
+
+func ProvideWorkerRegistry(cfg config.Config, db *pg.DB) jobs.WorkerRegistry {
+	if cfg.StoreBackend == config.StoreBackendMemory {
+		return memory.NewWorkerRegistry()
+	}
+
+	return jobs.NewWorkerRegistry(db)
+}
+
+func ProvideSettingsStore(cfg config.Config, db *pg.DB) jobs.SettingsStore {
+	if cfg.StoreBackend == config.StoreBackendMemory {
+		return memory.NewSettingsStore()
+	}
+
+	return jobs.NewSettingsStore(db)
+}
+
+func ProvideSemaphore(cfg config.Config, logger *logrus.Entry, redisClient *redis.Client, clock clock.Clock) jobs.Semaphore {
+	// Without Redis the limits are enforced by each worker process, see config.Warnings
+	if !cfg.QueueConfig.UsesRedis() {
+		for _, warning := range cfg.Warnings() {
+			logger.Warn(warning)
+		}
+
+		return jobs.NewLocalSemaphore()
+	}
+
+	// The slots are renewed while their jobs run whatever the live job timeout, the lease only matters when a worker dies
+	return jobs.NewRedisSemaphore(redisClient, clock, time.Minute)
+}
+
+func ProvideJobWorker(cfg config.Config, logger *logrus.Entry, jobSvc jobs.Service, broker jobs.Broker, queues *jobs.JobQueues, workers jobs.WorkerRegistry, clock clock.Clock, random utils.Random, transactioner utils.Transactioner, semaphore jobs.Semaphore, logs jobs.JobLogStore, artifacts jobs.ArtifactStore, settings jobs.SettingsStore) jobs.Worker {
+	return jobs.NewWorker(cfg, logger, jobSvc, broker, queues, workers, clock, random, transactioner, semaphore, logs, artifacts, settings)
+}
+
+func ProvideWorkerServer(cfg config.Config, logger *logrus.Entry, worker jobs.Worker, checks jobs.HealthChecks) *jobs.WorkerServer {
+	return jobs.NewWorkerServer(cfg, logger, worker, checks)
+}
+
+func ProvideJobArchive(cfg config.Config, db *pg.DB, clock clock.Clock) jobs.JobArchive {
+	if cfg.ArchiveTarget == config.ArchiveTargetFile {
+		return jobs.NewFileArchive(cfg.ArchiveDir, clock)
+	}
+
+	// the table archive needs the postgres store, see config.Validate
+	if cfg.StoreBackend == config.StoreBackendMemory {
+		return nil
+	}
+
+	return jobs.NewTableArchive(db)
+}
+
+// ProvideJobPartitioner returns a nil partitioner for the memory store, it has no partitions.
+func ProvideJobPartitioner(cfg config.Config, db *pg.DB) jobs.JobPartitioner {
+	if cfg.StoreBackend == config.StoreBackendMemory {
+		return nil
+	}
+
+	return jobs.NewJobPartitions(db)
 }
 
-func ProvideJobWorker(cfg config.Config, logger *logrus.Entry, jobSvc jobs.Service, connection rmq.Connection, queue rmq.Queue, clock clock.Clock, random utils.Random, transactioner utils.Transactioner) jobs.Worker {
-	return jobs.NewWorker(cfg, logger, jobSvc, connection, queue, clock, random, transactioner)
+func ProvideMaintenance(cfg config.Config, logger *logrus.Entry, jobStore jobs.Store, transactioner utils.Transactioner, archive jobs.JobArchive, partitions jobs.JobPartitioner, artifacts jobs.ArtifactStore, clock clock.Clock) *jobs.Maintenance {
+	return jobs.NewMaintenance(cfg.RetentionConfig, logger, jobStore, transactioner, archive, partitions, artifacts, clock)
 }
 
 func ProvideRedis(cfg config.Config) *redis.Client {
@@ -87,31 +201,43 @@ func ProvideRedis(cfg config.Config) *redis.Client {
 	})
 }
 
-func ProvideRmqConnection(redisClient *redis.Client) (rmq.Connection, func(), error) {
+func ProvideBroker(cfg config.Config, logger *logrus.Entry, db *pg.DB, redisClient *redis.Client) (jobs.Broker, func(), error) {
+	switch cfg.QueueConfig.QueueBackend {
+	case config.QueueBackendPostgres:
+		return jobs.NewPostgresBroker(db, logger, jobs.QueueName), func() {}, nil
+	case config.QueueBackendMemory:
+		return memory.NewBroker(jobs.QueueName), func() {}, nil
+	case config.QueueBackendRedis:
+		return provideRmqBroker(redisClient)
+	case config.QueueBackendRedisStreams:
+		return jobs.NewRedisStreamBroker(redisClient, logger, jobs.QueueName), func() {}, nil
+	default:
+		return nil, func() {}, fmt.Errorf("unknown queue backend %q", cfg.QueueConfig.QueueBackend)
+	}
+}
+
+func provideRmqBroker(redisClient *redis.Client) (jobs.Broker, func(), error) {
 	closeChan := make(chan bool)
 	errChan := make(chan error, 10)
 	go rmqLogErrors(errChan, closeChan)
 
 	conn, err := rmq.OpenConnectionWithRedisClient(jobs.QueueName, redisClient, errChan)
 	if err != nil {
+		close(closeChan)
 		return nil, func() {}, err
 	}
 
-	return conn, func() {
+	return jobs.NewRmqBroker(conn, redisClient), func() {
 		close(closeChan)
 		conn.StopAllConsuming()
 	}, nil
 }
 
-func ProvideRedisQueue(conn rmq.Connection) (rmq.Queue, func(), error) {
-	queue, err := conn.OpenQueue(jobs.QueueName)
-	if err != nil {
-		return nil, func() {}, err
+func ProvideQueues(broker jobs.Broker) (*jobs.JobQueues, func()) {
+	queues := jobs.NewJobQueues(broker, jobs.QueueName)
+	return queues, func() {
+		queues.StopConsuming()
 	}
-
-	return queue, func() {
-		queue.StopConsuming()
-	}, nil
 }
 
 func rmqLogErrors(errChan <-chan error, closeChan <-chan bool) {
@@ -0,0 +1,152 @@
+package cmd
+
+import (
+	"fmt"
+	"math"
+	"os/user"
+	"strconv"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/urfave/cli"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+)
+
+// Queue creates the commands to inspect and operate queues
+func (a *ApplicationContext) Queue() cli.Command {
+	return cli.Command{
+		Name:  "queue",
+		Usage: "inspect and operate queues",
+		Subcommands: []cli.Command{
+			{
+				Name:  "stats",
+				Usage: "ready, rejected and unacked counts of every queue",
+				Flags: []cli.Flag{outputFlag},
+				Action: func(c *cli.Context) error {
+					stats, err := a.queueAdmin.QueueStats(a.ctx)
+					if err != nil {
+						return err
+					}
+
+					header := []string{"QUEUE", "TYPE", "PRIORITY", "PAUSED", "READY", "REJECTED", "UNACKED", "CONSUMERS", "CONNECTIONS"}
+					rows := make([][]string, 0, len(stats))
+					for _, stat := range stats {
+						connections := make([]string, 0, len(stat.Connections))
+						for _, connection := range stat.Connections {
+							connections = append(connections, connection.Name)
+						}
+
+						rows = append(rows, []string{
+							stat.Name,
+							stat.Type,
+							stat.Priority,
+							strconv.FormatBool(stat.Paused),
+							strconv.FormatInt(stat.Ready, 10),
+							strconv.FormatInt(stat.Rejected, 10),
+							strconv.FormatInt(stat.Unacked, 10),
+							strconv.FormatInt(stat.Consumers, 10),
+							strings.Join(connections, ","),
+						})
+					}
+
+					return printOutput(c, stats, header, rows)
+				},
+			},
+			{
+				Name:      "purge",
+				Usage:     "delete the ready or rejected deliveries of a queue",
+				ArgsUsage: "<queue>",
+				Flags: []cli.Flag{
+					outputFlag,
+					cli.BoolFlag{Name: "rejected", Usage: "purge the rejected list instead of the ready list"},
+				},
+				Action: a.queueAction(func(c *cli.Context, queue string) (int64, error) {
+					if c.Bool("rejected") {
+						return a.queueAdmin.PurgeRejected(a.ctx, queue)
+					}
+
+					return a.queueAdmin.PurgeReady(a.ctx, queue)
+				}),
+			},
+			{
+				Name:      "return-rejected",
+				Usage:     "move rejected deliveries of a queue back to ready",
+				ArgsUsage: "<queue>",
+				Flags: []cli.Flag{
+					outputFlag,
+					cli.Int64Flag{Name: "max", Value: math.MaxInt64, Usage: "max number of deliveries"},
+				},
+				Action: a.queueAction(func(c *cli.Context, queue string) (int64, error) {
+					return a.queueAdmin.ReturnRejected(a.ctx, queue, c.Int64("max"))
+				}),
+			},
+			{
+				Name:      "pause",
+				Usage:     "stop the workers from running the jobs of a queue, they are still accepted",
+				ArgsUsage: "<queue>",
+				Flags:     []cli.Flag{outputFlag},
+				Action:    a.pauseQueueAction(true),
+			},
+			{
+				Name:      "resume",
+				Usage:     "let the workers run the jobs of a paused queue again",
+				ArgsUsage: "<queue>",
+				Flags:     []cli.Flag{outputFlag},
+				Action:    a.pauseQueueAction(false),
+			},
+		},
+	}
+}
+
+// pauseQueueAction pauses or resumes the queue argument on behalf of the user of the shell
+func (a *ApplicationContext) pauseQueueAction(paused bool) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		queue := c.Args().First()
+		if queue == "" {
+			return errors.New("queue name is required")
+		}
+
+		if _, err := jobs.PauseQueue(a.ctx, a.settings, queue, paused, cliUser()); err != nil {
+			return err
+		}
+
+		result := jobs.QueuePauseResult{
+			Queue:  queue,
+			Paused: paused,
+		}
+
+		return printOutput(c, result, []string{"QUEUE", "PAUSED"}, [][]string{{queue, strconv.FormatBool(paused)}})
+	}
+}
+
+// queueAction runs fn on the queue argument and prints the number of affected deliveries
+func (a *ApplicationContext) queueAction(fn func(c *cli.Context, queue string) (int64, error)) cli.ActionFunc {
+	return func(c *cli.Context) error {
+		queue := c.Args().First()
+		if queue == "" {
+			return errors.New("queue name is required")
+		}
+
+		count, err := fn(c, queue)
+		if err != nil {
+			return err
+		}
+
+		result := jobs.QueueActionResult{
+			Queue: queue,
+			Count: count,
+		}
+
+		return printOutput(c, result, []string{"QUEUE", "COUNT"}, [][]string{{queue, fmt.Sprint(count)}})
+	}
+}
+
+// cliUser names the user of the shell as the author of the changes made by the commands, e.g. cli:alice
+func cliUser() string {
+	if current, err := user.Current(); err == nil && current.Username != "" {
+		return "cli:" + current.Username
+	}
+
+	return "cli"
+}
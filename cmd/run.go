@@ -0,0 +1,98 @@
+package cmd
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// shutdownTimeout bounds the time pending HTTP requests get to complete
+const shutdownTimeout = 30 * time.Second
+
+// component is a long running part of the application, stop makes run return
+type component struct {
+	name string
+	run  func() error
+	stop func(ctx context.Context) error
+}
+
+// run starts the components until the application context is done or one of them returns.
+// The components are then stopped in order, so the API stops taking jobs before the worker finishes its running jobs.
+func (a *ApplicationContext) run(components ...component) error {
+	errs := make(chan error, len(components))
+	for _, c := range components {
+		go func(c component) {
+			err := c.run()
+			if err != nil {
+				err = errors.Wrapf(err, "%s failed", c.name)
+			}
+
+			errs <- err
+		}(c)
+	}
+
+	var err error
+	select {
+	case <-a.ctx.Done():
+	case err = <-errs:
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+
+	for _, c := range components {
+		if stopErr := c.stop(ctx); stopErr != nil && err == nil {
+			err = errors.Wrapf(stopErr, "failed to stop %s", c.name)
+		}
+	}
+
+	return err
+}
+
+func (a *ApplicationContext) httpComponent() component {
+	return component{
+		name: "http server",
+		run:  a.jobHandler.Serve,
+		stop: a.jobHandler.Shutdown,
+	}
+}
+
+func (a *ApplicationContext) workerComponent() component {
+	return component{
+		name: "worker",
+		run:  a.jobWorker.Start,
+		stop: func(ctx context.Context) error {
+			a.jobWorker.Stop()
+			return nil
+		},
+	}
+}
+
+// workerComponents are the worker, its cleaner and its admin server unless WORKER_HTTP_PORT disables it
+func (a *ApplicationContext) workerComponents() []component {
+	components := []component{a.workerComponent(), a.cleanerComponent()}
+	if a.cfg.WorkerHTTPPort > 0 {
+		components = append(components, component{
+			name: "worker http server",
+			run:  a.workerServer.Serve,
+			stop: a.workerServer.Shutdown,
+		})
+	}
+
+	return components
+}
+
+// cleanerComponent returns the unacked deliveries of dead workers to the queue, it is stopped with the worker
+func (a *ApplicationContext) cleanerComponent() component {
+	return component{
+		name: "cleaner",
+		run: func() error {
+			a.jobWorker.RunCleaner()
+			return nil
+		},
+		stop: func(ctx context.Context) error {
+			return nil
+		},
+	}
+}
@@ -8,8 +8,7 @@ func (a *ApplicationContext) Serve() cli.Command {
 		Name:  "serve",
 		Usage: "serve http request",
 		Action: func(c *cli.Context) error {
-			a.jobHandler.Serve()
-			return nil
+			return a.run(a.httpComponent())
 		},
 	}
 }
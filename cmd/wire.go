@@ -6,6 +6,7 @@ import (
 	"context"
 
 	"github.com/google/wire"
+	"github.com/urfave/cli"
 )
 
 var ApplicationSet = wire.NewSet(
@@ -16,16 +17,28 @@ var ApplicationSet = wire.NewSet(
 	ProvidePostgres,
 	ProvideTransactioner,
 	ProvideRedis,
-	ProvideRmqConnection,
-	ProvideRedisQueue,
+	ProvideBroker,
+	ProvideQueues,
+	ProvideSemaphore,
+	ProvideRateLimiter,
+	ProvideQueueAdmin,
+	ProvideWorkerRegistry,
+	ProvideJobLogStore,
+	ProvideArtifactStore,
+	ProvideSettingsStore,
+	ProvideHealthChecks,
+	ProvideJobArchive,
+	ProvideJobPartitioner,
+	ProvideMaintenance,
 
 	ProvideJobSvc,
 	ProvideJobStore,
 	ProvideJobHandler,
 	ProvideJobWorker,
+	ProvideWorkerServer,
 )
 
-func InitApplication(ctx context.Context) (*ApplicationContext, func(), error) {
+func InitApplication(ctx context.Context, c *cli.Context) (*ApplicationContext, func(), error) {
 	wire.Build(
 		ApplicationSet,
 		wire.Struct(new(ApplicationContext), "*"),
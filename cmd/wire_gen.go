@@ -8,6 +8,7 @@ package cmd
 import (
 	"context"
 	"github.com/google/wire"
+	"github.com/urfave/cli"
 )
 
 import (
@@ -16,8 +17,8 @@ import (
 
 // Injectors from wire.go:
 
-func InitApplication(ctx context.Context) (*ApplicationContext, func(), error) {
-	config, err := ProvideConfig()
+func InitApplication(ctx context.Context, c *cli.Context) (*ApplicationContext, func(), error) {
+	config, err := ProvideConfig(c)
 	if err != nil {
 		return nil, nil, err
 	}
@@ -25,31 +26,48 @@ func InitApplication(ctx context.Context) (*ApplicationContext, func(), error) {
 	if err != nil {
 		return nil, nil, err
 	}
-	store := ProvideJobStore(db)
+	store := ProvideJobStore(config, db)
+	entry := ProvideLogger(config)
 	client := ProvideRedis(config)
-	connection, cleanup, err := ProvideRmqConnection(client)
+	broker, cleanup, err := ProvideBroker(config, entry, db, client)
 	if err != nil {
 		return nil, nil, err
 	}
-	queue, cleanup2, err := ProvideRedisQueue(connection)
+	jobQueues, cleanup2 := ProvideQueues(broker)
+	clock := ProvideClock()
+	service := ProvideJobSvc(store, jobQueues, clock)
+	rateLimiter := ProvideRateLimiter(client, clock)
+	settingsStore := ProvideSettingsStore(config, db)
+	queueAdmin := ProvideQueueAdmin(broker, settingsStore)
+	workerRegistry := ProvideWorkerRegistry(config, db)
+	jobLogStore := ProvideJobLogStore(config, db)
+	artifactStore, err := ProvideArtifactStore(config, clock)
 	if err != nil {
+		cleanup2()
 		cleanup()
 		return nil, nil, err
 	}
-	clock := ProvideClock()
-	service := ProvideJobSvc(store, queue, clock)
-	httpHandler := ProvideJobHandler(config, service)
-	entry := ProvideLogger(config)
+	healthChecks := ProvideHealthChecks(config, db, client, broker)
+	httpHandler := ProvideJobHandler(config, entry, service, rateLimiter, queueAdmin, workerRegistry, jobLogStore, artifactStore, settingsStore, healthChecks)
 	random := ProvideRandom()
-	transactioner := ProvideTransactioner(db)
-	worker := ProvideJobWorker(config, entry, service, connection, queue, clock, random, transactioner)
+	transactioner := ProvideTransactioner(config, db)
+	semaphore := ProvideSemaphore(config, entry, client, clock)
+	worker := ProvideJobWorker(config, entry, service, broker, jobQueues, workerRegistry, clock, random, transactioner, semaphore, jobLogStore, artifactStore, settingsStore)
+	workerServer := ProvideWorkerServer(config, entry, worker, healthChecks)
+	jobArchive := ProvideJobArchive(config, db, clock)
+	jobPartitioner := ProvideJobPartitioner(config, db)
+	maintenance := ProvideMaintenance(config, entry, store, transactioner, jobArchive, jobPartitioner, artifactStore, clock)
 	applicationContext := &ApplicationContext{
-		ctx:        ctx,
-		cfg:        config,
-		jobStore:   store,
-		jobSvc:     service,
-		jobHandler: httpHandler,
-		jobWorker:  worker,
+		ctx:          ctx,
+		cfg:          config,
+		jobStore:     store,
+		jobSvc:       service,
+		jobHandler:   httpHandler,
+		jobWorker:    worker,
+		workerServer: workerServer,
+		queueAdmin:   queueAdmin,
+		settings:     settingsStore,
+		maintenance:  maintenance,
 	}
 	return applicationContext, func() {
 		cleanup2()
@@ -68,11 +86,23 @@ var ApplicationSet = wire.NewSet(
 
 	ProvideTransactioner,
 	ProvideRedis,
-	ProvideRmqConnection,
-	ProvideRedisQueue,
+	ProvideBroker,
+	ProvideQueues,
+	ProvideSemaphore,
+	ProvideRateLimiter,
+	ProvideQueueAdmin,
+	ProvideWorkerRegistry,
+	ProvideJobLogStore,
+	ProvideArtifactStore,
+	ProvideSettingsStore,
+	ProvideHealthChecks,
+	ProvideJobArchive,
+	ProvideJobPartitioner,
+	ProvideMaintenance,
 
 	ProvideJobSvc,
 	ProvideJobStore,
 	ProvideJobHandler,
 	ProvideJobWorker,
+	ProvideWorkerServer,
 )
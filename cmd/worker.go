@@ -1,14 +1,57 @@
 package cmd
 
-import "github.com/urfave/cli"
+import (
+	"strings"
+
+	"github.com/urfave/cli"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+var workerFlags = []cli.Flag{
+	cli.StringFlag{
+		Name:  "types",
+		Usage: "comma separated job types served by the worker, overrides WORKER_TYPES",
+	},
+	cli.StringFlag{
+		Name:  "labels",
+		Usage: "comma separated capabilities of the host, they add the job types of JOB_TYPE_LABELS, overrides WORKER_LABELS",
+	},
+}
 
 func (a *ApplicationContext) Worker() cli.Command {
 	return cli.Command{
 		Name:  "worker",
 		Usage: "worker",
+		Flags: workerFlags,
 		Action: func(c *cli.Context) error {
-			go a.jobWorker.RunCleaner()
-			return a.jobWorker.Start()
+			return a.run(a.workerComponents()...)
 		},
 	}
 }
+
+// applyWorkerFlags overrides the worker config with the flags of the command
+func applyWorkerFlags(c *cli.Context, cfg *config.Config) {
+	if c == nil {
+		return
+	}
+
+	if c.IsSet("types") {
+		cfg.WorkerTypes = splitList(c.String("types"))
+	}
+
+	if c.IsSet("labels") {
+		cfg.WorkerLabels = splitList(c.String("labels"))
+	}
+}
+
+func splitList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+
+	return values
+}
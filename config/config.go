@@ -1,31 +1,311 @@
 package config
 
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
 type Config struct {
 	SQLConfig
+	StoreConfig
 	HTTPConfig
 	RedisConfig
+	QueueConfig
 	LoggerConfig
 	JobConfig
+	WorkerConfig
+	RetentionConfig
+	AuthConfig
+	RateLimitConfig
+	ArtifactConfig
+}
+
+// UsesPostgres tells whether the store or the queue is backed by Postgres.
+func (c Config) UsesPostgres() bool {
+	return c.StoreBackend == StoreBackendPostgres || c.QueueBackend == QueueBackendPostgres
+}
+
+// ValidationError lists every problem of a config.
+type ValidationError []string
+
+func (e ValidationError) Error() string {
+	return "invalid config: " + strings.Join(e, "; ")
+}
+
+// Validate checks the settings make sense together, it returns a ValidationError of all the problems found.
+func (c Config) Validate() error {
+	var problems ValidationError
+	problem := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	switch c.StoreBackend {
+	case StoreBackendPostgres, StoreBackendMemory:
+	default:
+		problem("STORE_BACKEND: unknown store backend %q, expected postgres or memory", c.StoreBackend)
+	}
+
+	switch c.QueueBackend {
+	case QueueBackendRedis, QueueBackendRedisStreams, QueueBackendPostgres, QueueBackendMemory:
+	default:
+		problem("QUEUE_BACKEND: unknown queue backend %q, expected redis, redis-streams, postgres or memory", c.QueueBackend)
+	}
+
+	if c.HTTPPort <= 0 || c.HTTPPort > 65535 {
+		problem("HTTP_PORT: %d is not a port, expected 1 to 65535", c.HTTPPort)
+	}
+
+	if _, err := c.TrustedProxies(); err != nil {
+		problem("HTTP_TRUSTED_PROXIES: %s", err)
+	}
+
+	if c.WorkerHTTPPort < 0 || c.WorkerHTTPPort > 65535 {
+		problem("WORKER_HTTP_PORT: %d is not a port, expected 1 to 65535 or 0 to disable it", c.WorkerHTTPPort)
+	}
+
+	if c.RedisPollIntervalMs <= 0 {
+		problem("REDIS_POLL_INTERVAL: must be positive, got %d", c.RedisPollIntervalMs)
+	}
+
+	if c.QueuePollIntervalMs < 0 {
+		problem("QUEUE_POLL_INTERVAL: must not be negative, got %d", c.QueuePollIntervalMs)
+	}
+
+	if !isLoggerLevel(c.Level) {
+		problem("LOGGER_LEVEL: unknown level %q, expected trace, debug, info, warn, error, fatal or panic", c.Level)
+	}
+
+	if c.JobPrefetch <= 0 {
+		problem("JOB_PREFETCH: must be positive, got %d", c.JobPrefetch)
+	}
+
+	if c.TimeoutInSeconds <= 0 {
+		problem("JOB_TIMEOUT: must be positive, got %d", c.TimeoutInSeconds)
+	}
+
+	for tenant, timeout := range c.TenantTimeoutInSeconds {
+		if timeout <= 0 {
+			problem("JOB_TENANT_TIMEOUT: timeout of tenant %s must be positive, got %d", tenant, timeout)
+		}
+	}
+
+	for tenant, limit := range c.TenantConcurrency {
+		if limit < 0 {
+			problem("JOB_TENANT_CONCURRENCY: limit of tenant %s must not be negative, got %d", tenant, limit)
+		}
+	}
+
+	for jobType, limit := range c.TypeConcurrency {
+		if limit < 0 {
+			problem("JOB_TYPE_CONCURRENCY: limit of type %s must not be negative, got %d", jobType, limit)
+		}
+	}
+
+	if c.ObjectConcurrency < 0 {
+		problem("JOB_OBJECT_CONCURRENCY: must not be negative, got %d", c.ObjectConcurrency)
+	}
+
+	for priority, weight := range c.PriorityWeights {
+		if weight <= 0 {
+			problem("JOB_PRIORITY_WEIGHTS: weight of priority %s must be positive, got %d", priority, weight)
+		}
+	}
+
+	if c.JobLogMaxBytes < 0 {
+		problem("JOB_LOG_MAX_BYTES: must not be negative, got %d", c.JobLogMaxBytes)
+	}
+
+	switch c.ArchiveTarget {
+	case ArchiveTargetTable:
+		if c.ArchiveAfterDays > 0 && c.StoreBackend != StoreBackendPostgres {
+			problem("RETENTION_ARCHIVE_TARGET: archive target %s requires the postgres store backend", c.ArchiveTarget)
+		}
+	case ArchiveTargetFile:
+	default:
+		problem("RETENTION_ARCHIVE_TARGET: unknown archive target %q, expected table or file", c.ArchiveTarget)
+	}
+
+	if c.ArchiveAfterDays < 0 {
+		problem("RETENTION_ARCHIVE_AFTER_DAYS: must not be negative, got %d", c.ArchiveAfterDays)
+	}
+
+	for status, days := range c.PurgeAfterDays {
+		if days <= 0 {
+			problem("RETENTION_PURGE_AFTER_DAYS: purge days of status %s must be positive, got %d", status, days)
+		}
+	}
+
+	if c.RetentionBatchSize <= 0 {
+		problem("RETENTION_BATCH_SIZE: must be positive, got %d", c.RetentionBatchSize)
+	}
+
+	if c.PartitionMonthsAhead < 0 {
+		problem("RETENTION_PARTITION_MONTHS_AHEAD: must not be negative, got %d", c.PartitionMonthsAhead)
+	}
+
+	if c.RetentionIntervalMinutes <= 0 {
+		problem("RETENTION_INTERVAL: must be positive, got %d", c.RetentionIntervalMinutes)
+	}
+
+	if c.RateLimit.Limit < 0 || c.RateLimit.Window < 0 {
+		problem("RATE_LIMIT: limit and window must not be negative, got %s", c.RateLimit)
+	}
+
+	for route, limit := range c.RateLimitRoutes {
+		if limit.Limit < 0 || limit.Window < 0 {
+			problem("RATE_LIMIT_ROUTES: limit and window of %s must not be negative, got %s", route, limit)
+		}
+	}
+
+	switch c.ArtifactBackend {
+	case ArtifactBackendLocal:
+	case ArtifactBackendS3:
+		required := []struct {
+			key   string
+			value string
+		}{
+			{"ARTIFACT_S3_ENDPOINT", c.ArtifactS3Endpoint},
+			{"ARTIFACT_S3_BUCKET", c.ArtifactS3Bucket},
+			{"ARTIFACT_S3_ACCESS_KEY", c.ArtifactS3AccessKey},
+			{"ARTIFACT_S3_SECRET_KEY", c.ArtifactS3SecretKey},
+		}
+
+		for _, r := range required {
+			if r.value == "" {
+				problem("%s: required with the s3 artifact backend", r.key)
+			}
+		}
+	default:
+		problem("ARTIFACT_BACKEND: unknown artifact backend %q, expected local or s3", c.ArtifactBackend)
+	}
+
+	if c.UsesPostgres() {
+		required := []struct {
+			key   string
+			value string
+		}{
+			{"SQL_NAME", c.SQLName},
+			{"SQL_ADDRESS", c.SQLAddress},
+			{"SQL_USER", c.SQLUser},
+			{"SQL_PASSWORD", c.SQLPassword},
+		}
+
+		for _, r := range required {
+			if r.value == "" {
+				problem("%s: required with the postgres store or queue backend", r.key)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return problems
+	}
+
+	return nil
+}
+
+// Warnings lists the settings which are valid but may not work as expected, they do not fail Validate.
+func (c Config) Warnings() []string {
+	var warnings []string
+	// the memory queue is consumed by a single process, its local limits are those of the fleet
+	if c.QueueBackend == QueueBackendPostgres && c.HasConcurrencyLimits() {
+		warnings = append(warnings, "JOB_*_CONCURRENCY: the postgres queue backend does not use Redis, the concurrency limits are enforced by each worker process instead of the whole fleet")
+	}
+
+	return warnings
+}
+
+func isLoggerLevel(level string) bool {
+	switch strings.ToLower(level) {
+	case "trace", "debug", "info", "warn", "warning", "error", "fatal", "panic":
+		return true
+	}
+
+	return false
 }
 
 type HTTPConfig struct {
 	HTTPPort   int  `envconfig:"HTTP_PORT" default:"3000"`
 	HTTPLogger bool `envconfig:"HTTP_LOGGER" default:"true"`
+	// HTTPTrustedProxies are the CIDRs of the proxies whose X-Forwarded-For is trusted, e.g. 10.0.0.0/8.
+	// Without them the IP of a caller is the address of its connection.
+	HTTPTrustedProxies []string `envconfig:"HTTP_TRUSTED_PROXIES"`
+}
+
+// TrustedProxies parses HTTPTrustedProxies, see Validate.
+func (c HTTPConfig) TrustedProxies() ([]*net.IPNet, error) {
+	proxies := make([]*net.IPNet, 0, len(c.HTTPTrustedProxies))
+	for _, cidr := range c.HTTPTrustedProxies {
+		_, proxy, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+
+		proxies = append(proxies, proxy)
+	}
+
+	return proxies, nil
 }
 
+// SQLConfig is required unless neither the store nor the queue use Postgres, see Validate.
 type SQLConfig struct {
-	SQLName     string `envconfig:"SQL_NAME" required:"true"`
-	SQLAddress  string `envconfig:"SQL_ADDRESS" required:"true"`
-	SQLUser     string `envconfig:"SQL_USER" required:"true"`
-	SQLPassword string `envconfig:"SQL_PASSWORD" required:"true"`
+	SQLName     string `envconfig:"SQL_NAME"`
+	SQLAddress  string `envconfig:"SQL_ADDRESS"`
+	SQLUser     string `envconfig:"SQL_USER"`
+	SQLPassword string `envconfig:"SQL_PASSWORD" secret:"true"`
+	// SQLAutoMigrate applies pending migrations on start instead of checking the schema is up to date
+	SQLAutoMigrate bool `envconfig:"SQL_AUTO_MIGRATE" default:"false"`
+}
+
+const (
+	StoreBackendPostgres = "postgres"
+	StoreBackendMemory   = "memory"
+)
+
+type StoreConfig struct {
+	// StoreBackend is either postgres or memory, jobs in memory are lost when the process exits
+	StoreBackend string `envconfig:"STORE_BACKEND" default:"postgres"`
 }
 
 type RedisConfig struct {
 	RedisAddress        string `envconfig:"REDIS_ADDRESS" default:"localhost:6379"`
-	RedisPassword       string `envconfig:"REDIS_PASSWORD"`
+	RedisPassword       string `envconfig:"REDIS_PASSWORD" secret:"true"`
 	RedisPollIntervalMs int    `envconfig:"REDIS_POLL_INTERVAL" default:"1000"`
 }
 
+const (
+	QueueBackendRedis        = "redis"
+	QueueBackendRedisStreams = "redis-streams"
+	QueueBackendPostgres     = "postgres"
+	QueueBackendMemory       = "memory"
+)
+
+type QueueConfig struct {
+	// QueueBackend is either redis, redis-streams, postgres or memory. redis-streams needs Redis 6.2,
+	// postgres allows to run without Redis, memory only works within a single process
+	QueueBackend        string `envconfig:"QUEUE_BACKEND" default:"redis"`
+	QueuePollIntervalMs int    `envconfig:"QUEUE_POLL_INTERVAL"`
+}
+
+// UsesRedis tells whether the queue is backed by Redis.
+func (c QueueConfig) UsesRedis() bool {
+	return c.QueueBackend == QueueBackendRedis || c.QueueBackend == QueueBackendRedisStreams
+}
+
+// PollInterval returns how often consumers poll the queue, falling back to REDIS_POLL_INTERVAL.
+func (c QueueConfig) PollInterval(redis RedisConfig) time.Duration {
+	if c.QueuePollIntervalMs > 0 {
+		return time.Duration(c.QueuePollIntervalMs) * time.Millisecond
+	}
+
+	return time.Duration(redis.RedisPollIntervalMs) * time.Millisecond
+}
+
 type LoggerConfig struct {
 	Level string `envconfig:"LOGGER_LEVEL" default:"info"`
 }
@@ -33,4 +313,204 @@ type LoggerConfig struct {
 type JobConfig struct {
 	JobPrefetch      int64 `envconfig:"JOB_PREFETCH" default:"10"`
 	TimeoutInSeconds int   `envconfig:"JOB_TIMEOUT" default:"20"`
+
+	// Per-tenant overrides, e.g. JOB_TENANT_TIMEOUT="team-a:60,team-b:10"
+	TenantTimeoutInSeconds map[string]int `envconfig:"JOB_TENANT_TIMEOUT"`
+	TenantConcurrency      map[string]int `envconfig:"JOB_TENANT_CONCURRENCY"`
+
+	// Fleet-wide limits of running jobs per job type, e.g. JOB_TYPE_CONCURRENCY="report:2,export:5"
+	TypeConcurrency map[string]int `envconfig:"JOB_TYPE_CONCURRENCY"`
+	// ObjectConcurrency limits the running jobs of the same object_id, 0 disables the limit
+	ObjectConcurrency int `envconfig:"JOB_OBJECT_CONCURRENCY" default:"1"`
+
+	// PriorityWeights is how often a worker picks a job of each priority when all of them are waiting,
+	// e.g. JOB_PRIORITY_WEIGHTS="high:6,normal:3,low:1" runs 6 high priority jobs for every low priority one
+	PriorityWeights map[string]int `envconfig:"JOB_PRIORITY_WEIGHTS" default:"high:6,normal:3,low:1"`
+
+	// TypeLabels maps a job type to the label a worker needs to serve it, e.g. JOB_TYPE_LABELS="report:large-cache"
+	TypeLabels map[string]string `envconfig:"JOB_TYPE_LABELS"`
+
+	// JobLogMaxBytes caps the log messages kept per attempt of a job, 0 disables the capture
+	JobLogMaxBytes int `envconfig:"JOB_LOG_MAX_BYTES" default:"65536"`
+}
+
+// HasConcurrencyLimits tells whether a limit of JOB_TENANT_CONCURRENCY, JOB_TYPE_CONCURRENCY or JOB_OBJECT_CONCURRENCY applies.
+func (c JobConfig) HasConcurrencyLimits() bool {
+	for _, limit := range c.TenantConcurrency {
+		if limit > 0 {
+			return true
+		}
+	}
+
+	for _, limit := range c.TypeConcurrency {
+		if limit > 0 {
+			return true
+		}
+	}
+
+	return c.ObjectConcurrency > 0
+}
+
+// TenantTimeout returns the job timeout of a tenant, falling back to JOB_TIMEOUT.
+func (c JobConfig) TenantTimeout(tenantId string) int {
+	if timeout, ok := c.TenantTimeoutInSeconds[tenantId]; ok && timeout > 0 {
+		return timeout
+	}
+
+	return c.TimeoutInSeconds
+}
+
+// WorkerConfig selects the job types of a worker, the --types and --labels flags of the worker command override it.
+type WorkerConfig struct {
+	// WorkerTypes are the job types the worker serves, the default type when empty
+	WorkerTypes []string `envconfig:"WORKER_TYPES"`
+	// WorkerLabels are the capabilities of the host, they add the job types of JOB_TYPE_LABELS
+	WorkerLabels []string `envconfig:"WORKER_LABELS"`
+	// WorkerHTTPPort is the port of the health checks and metrics of a worker, 0 disables them
+	WorkerHTTPPort int `envconfig:"WORKER_HTTP_PORT" default:"3001"`
+}
+
+const (
+	ArchiveTargetTable = "table"
+	ArchiveTargetFile  = "file"
+)
+
+// RetentionConfig controls the maintenance of the jobs table, it runs with the maintenance command.
+type RetentionConfig struct {
+	// ArchiveAfterDays moves the finished jobs created more days ago to the archive, 0 disables the archival
+	ArchiveAfterDays int `envconfig:"RETENTION_ARCHIVE_AFTER_DAYS" default:"0"`
+	// ArchiveTarget is either table, for the jobs_archive table, or file for NDJSON files in ArchiveDir
+	ArchiveTarget string `envconfig:"RETENTION_ARCHIVE_TARGET" default:"table"`
+	ArchiveDir    string `envconfig:"RETENTION_ARCHIVE_DIR" default:"archive"`
+	// PurgeAfterDays deletes the jobs of a finished status created more days ago without archiving them,
+	// e.g. RETENTION_PURGE_AFTER_DAYS="success:7,cancelled:1"
+	PurgeAfterDays map[string]int `envconfig:"RETENTION_PURGE_AFTER_DAYS"`
+	// RetentionBatchSize bounds the jobs archived or purged per transaction
+	RetentionBatchSize int `envconfig:"RETENTION_BATCH_SIZE" default:"1000"`
+	// PartitionMonthsAhead is the number of monthly partitions of the jobs table created ahead of the current month
+	PartitionMonthsAhead int `envconfig:"RETENTION_PARTITION_MONTHS_AHEAD" default:"3"`
+	// RetentionIntervalMinutes is the time between two runs of the maintenance --loop command
+	RetentionIntervalMinutes int `envconfig:"RETENTION_INTERVAL" default:"60"`
+}
+
+const (
+	ArtifactBackendLocal = "local"
+	ArtifactBackendS3    = "s3"
+)
+
+// ArtifactConfig selects where the files attached to jobs are kept, they are deleted with their jobs by the maintenance.
+type ArtifactConfig struct {
+	// ArtifactBackend is either local, for files in ArtifactDir, or s3 for a bucket of an S3 compatible storage, e.g. MinIO
+	ArtifactBackend string `envconfig:"ARTIFACT_BACKEND" default:"local"`
+	// ArtifactDir must be shared by the workers and the API with the local backend
+	ArtifactDir string `envconfig:"ARTIFACT_DIR" default:"artifacts"`
+	// ArtifactS3Endpoint is the URL of the storage, e.g. https://s3.eu-west-1.amazonaws.com or http://localhost:9000
+	ArtifactS3Endpoint  string `envconfig:"ARTIFACT_S3_ENDPOINT"`
+	ArtifactS3Region    string `envconfig:"ARTIFACT_S3_REGION" default:"us-east-1"`
+	ArtifactS3Bucket    string `envconfig:"ARTIFACT_S3_BUCKET"`
+	ArtifactS3AccessKey string `envconfig:"ARTIFACT_S3_ACCESS_KEY" secret:"true"`
+	ArtifactS3SecretKey string `envconfig:"ARTIFACT_S3_SECRET_KEY" secret:"true"`
+}
+
+type AuthConfig struct {
+	// APIKeys maps an API key to its tenant, e.g. API_KEYS="key-a:team-a,key-b:team-b".
+	// When empty, authentication is disabled and every request belongs to the default tenant.
+	APIKeys map[string]string `envconfig:"API_KEYS" secret:"true"`
+	// AdminAPIKeys maps a key of the admin API to the name of its owner, e.g. ADMIN_API_KEYS="key-x:alice".
+	// When empty, the admin API is disabled.
+	AdminAPIKeys map[string]string `envconfig:"ADMIN_API_KEYS" secret:"true"`
+}
+
+type RateLimitConfig struct {
+	// RateLimit is the default limit of every route, e.g. RATE_LIMIT="100/1m". Empty disables it.
+	RateLimit RateLimit `envconfig:"RATE_LIMIT"`
+	// RateLimitRoutes overrides the limit per route, e.g. RATE_LIMIT_ROUTES="POST /v1/jobs=10/1s,GET /v1/jobs/:id=50/1s".
+	RateLimitRoutes RateLimitRoutes `envconfig:"RATE_LIMIT_ROUTES"`
+}
+
+// RouteRateLimit returns the limit of a route, falling back to RATE_LIMIT.
+func (c RateLimitConfig) RouteRateLimit(method, path string) RateLimit {
+	if limit, ok := c.RateLimitRoutes[method+" "+path]; ok {
+		return limit
+	}
+
+	return c.RateLimit
+}
+
+// RateLimit allows Limit requests per Window, it is written as "<limit>/<window>", e.g. "10/1s".
+type RateLimit struct {
+	Limit  int
+	Window time.Duration
+}
+
+// String formats r as RATE_LIMIT, empty when it is disabled.
+func (r RateLimit) String() string {
+	if r.Limit == 0 && r.Window == 0 {
+		return ""
+	}
+
+	return fmt.Sprintf("%d/%s", r.Limit, r.Window)
+}
+
+func (r RateLimit) Enabled() bool {
+	return r.Limit > 0 && r.Window > 0
+}
+
+func (r *RateLimit) Decode(value string) error {
+	parts := strings.SplitN(strings.TrimSpace(value), "/", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid rate limit %q, expected <limit>/<window>", value)
+	}
+
+	limit, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return fmt.Errorf("invalid rate limit %q: %w", value, err)
+	}
+
+	window, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return fmt.Errorf("invalid rate limit %q: %w", value, err)
+	}
+
+	r.Limit = limit
+	r.Window = window
+	return nil
+}
+
+// RateLimitRoutes maps "<METHOD> <path>" of a route to its limit.
+type RateLimitRoutes map[string]RateLimit
+
+// String formats r as RATE_LIMIT_ROUTES, sorted by route.
+func (r RateLimitRoutes) String() string {
+	rules := make([]string, 0, len(r))
+	for route, limit := range r {
+		rules = append(rules, route+"="+limit.String())
+	}
+	sort.Strings(rules)
+
+	return strings.Join(rules, ",")
+}
+
+func (r *RateLimitRoutes) Decode(value string) error {
+	routes := RateLimitRoutes{}
+	for _, rule := range strings.Split(value, ",") {
+		if strings.TrimSpace(rule) == "" {
+			continue
+		}
+
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			return fmt.Errorf("invalid route rate limit %q, expected <METHOD> <path>=<limit>/<window>", rule)
+		}
+
+		var limit RateLimit
+		if err := limit.Decode(parts[1]); err != nil {
+			return err
+		}
+
+		routes[strings.Join(strings.Fields(parts[0]), " ")] = limit
+	}
+
+	*r = routes
+	return nil
 }
@@ -0,0 +1,216 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/kelseyhightower/envconfig"
+	"gopkg.in/yaml.v3"
+)
+
+// Load reads the config from the environment, the settings of file apply to the keys the environment does not set.
+// file may be empty. The config is not validated, see Validate.
+func Load(file string) (Config, error) {
+	cfg := Config{}
+	if file != "" {
+		if err := loadFile(file); err != nil {
+			return cfg, err
+		}
+	}
+
+	if err := envconfig.Process("", &cfg); err != nil {
+		return cfg, err
+	}
+
+	return cfg, nil
+}
+
+// loadFile sets the env vars of the settings of a YAML file unless they are set already, like a .env file.
+// A setting is either its env name, e.g. JOB_PREFETCH: 10, or nested in sections, e.g. job: {prefetch: 10}.
+func loadFile(file string) error {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".yaml", ".yml":
+	default:
+		return fmt.Errorf("config file %s: unsupported format, expected a .yaml or .yml file", file)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("config file %s: %w", file, err)
+	}
+
+	var doc map[string]interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("config file %s: %w", file, err)
+	}
+
+	values := make(map[string]string)
+	if err := flattenSettings("", "", doc, settingTypes(), values); err != nil {
+		return fmt.Errorf("config file %s: %w", file, err)
+	}
+
+	for key, value := range values {
+		if _, ok := os.LookupEnv(key); ok {
+			continue
+		}
+
+		if err := os.Setenv(key, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// flattenSettings turns the sections of doc into env names, a value of a setting is formatted as in its env var.
+func flattenSettings(path, prefix string, doc map[string]interface{}, types map[string]reflect.Type, values map[string]string) error {
+	for name, value := range doc {
+		settingPath := strings.TrimPrefix(path+"."+name, ".")
+		key := strings.ToUpper(strings.TrimPrefix(prefix+"_"+name, "_"))
+
+		section, isSection := value.(map[string]interface{})
+		typ, isSetting := types[key]
+		// e.g. rate_limit: {routes: ...} is the section of RATE_LIMIT_ROUTES rather than the value of RATE_LIMIT
+		if isSection && (!isSetting || typ.Kind() != reflect.Map) {
+			if err := flattenSettings(settingPath, key, section, types, values); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !isSetting {
+			return fmt.Errorf("unknown setting %s", settingPath)
+		}
+
+		formatted, err := formatFileValue(value, typ)
+		if err != nil {
+			return fmt.Errorf("setting %s: %w", settingPath, err)
+		}
+
+		values[key] = formatted
+	}
+
+	return nil
+}
+
+func formatFileValue(value interface{}, typ reflect.Type) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case []interface{}:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			items = append(items, fmt.Sprint(item))
+		}
+
+		return strings.Join(items, ","), nil
+	case map[string]interface{}:
+		separator := ":"
+		if typ == reflect.TypeOf(RateLimitRoutes{}) {
+			separator = "="
+		}
+
+		items := make([]string, 0, len(v))
+		for key, item := range v {
+			items = append(items, key+separator+fmt.Sprint(item))
+		}
+		sort.Strings(items)
+
+		return strings.Join(items, ","), nil
+	default:
+		return fmt.Sprint(v), nil
+	}
+}
+
+// Setting is a key of the config, the name of its env var, with its value formatted as in the env.
+type Setting struct {
+	Key   string
+	Value string
+	// Secret settings are redacted when printed
+	Secret bool
+}
+
+const redacted = "REDACTED"
+
+// Settings lists the settings of c sorted by key, the values of the secrets are replaced when redact is set.
+func (c Config) Settings(redact bool) []Setting {
+	var settings []Setting
+	walkSettings(reflect.ValueOf(c), func(field reflect.StructField, value reflect.Value) {
+		setting := Setting{
+			Key:    field.Tag.Get("envconfig"),
+			Value:  formatSetting(value),
+			Secret: field.Tag.Get("secret") == "true",
+		}
+
+		if redact && setting.Secret && setting.Value != "" {
+			setting.Value = redacted
+		}
+
+		settings = append(settings, setting)
+	})
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Key < settings[j].Key
+	})
+
+	return settings
+}
+
+// settingTypes returns the type of every setting by its key.
+func settingTypes() map[string]reflect.Type {
+	types := make(map[string]reflect.Type)
+	walkSettings(reflect.ValueOf(Config{}), func(field reflect.StructField, value reflect.Value) {
+		types[field.Tag.Get("envconfig")] = field.Type
+	})
+
+	return types
+}
+
+// walkSettings calls fn with the fields of the config sections of v which have an env var.
+func walkSettings(v reflect.Value, fn func(field reflect.StructField, value reflect.Value)) {
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Anonymous && field.Type.Kind() == reflect.Struct {
+			walkSettings(v.Field(i), fn)
+			continue
+		}
+
+		if field.Tag.Get("envconfig") != "" {
+			fn(field, v.Field(i))
+		}
+	}
+}
+
+// formatSetting formats value as its env var, e.g. a map as key:value pairs.
+func formatSetting(value reflect.Value) string {
+	if stringer, ok := value.Interface().(fmt.Stringer); ok {
+		return stringer.String()
+	}
+
+	switch value.Kind() {
+	case reflect.Slice:
+		items := make([]string, 0, value.Len())
+		for i := 0; i < value.Len(); i++ {
+			items = append(items, fmt.Sprint(value.Index(i).Interface()))
+		}
+
+		return strings.Join(items, ",")
+	case reflect.Map:
+		items := make([]string, 0, value.Len())
+		for _, key := range value.MapKeys() {
+			items = append(items, fmt.Sprintf("%v:%v", key.Interface(), value.MapIndex(key).Interface()))
+		}
+		sort.Strings(items)
+
+		return strings.Join(items, ",")
+	case reflect.Bool:
+		return strconv.FormatBool(value.Bool())
+	default:
+		return fmt.Sprint(value.Interface())
+	}
+}
@@ -3,7 +3,11 @@ package migration
 import (
 	"database/sql"
 	"embed"
+	"fmt"
+	"io"
 	"log"
+	"strings"
+	"time"
 
 	_ "github.com/lib/pq"
 	migrate "github.com/rubenv/sql-migrate"
@@ -12,27 +16,265 @@ import (
 //go:embed migrations/*.sql
 var migrationsFS embed.FS
 
-const driver = "postgres"
+const (
+	driver = "postgres"
+	// migrationTable is the table where sql-migrate records the applied migrations
+	migrationTable = "gorp_migrations"
+)
 
-func Migrate(dataSource string) error {
+var migrationSource = &migrate.EmbedFileSystemMigrationSource{
+	FileSystem: migrationsFS,
+	Root:       "migrations",
+}
+
+// MigrationStatus tells whether an embedded migration was applied to the database
+type MigrationStatus struct {
+	Id        string     `json:"id"`
+	Applied   bool       `json:"applied"`
+	AppliedAt *time.Time `json:"applied_at"`
+	// Unknown is true for a migration applied to the database but not embedded in this binary
+	Unknown bool `json:"unknown"`
+}
+
+// PlannedMigration is a migration that would be applied, with its queries in the planned direction
+type PlannedMigration struct {
+	Id        string   `json:"id"`
+	Direction string   `json:"direction"`
+	Queries   []string `json:"queries"`
+}
+
+type Migrator struct {
+	db *sql.DB
+}
+
+func NewMigrator(dataSource string) (*Migrator, error) {
 	db, err := sql.Open(driver, dataSource)
 	if err != nil {
 		log.Printf("migration: Could not open sql: %s\n", err)
+		return nil, err
+	}
+
+	return &Migrator{db: db}, nil
+}
+
+func (m *Migrator) Close() error {
+	return m.db.Close()
+}
+
+// Up applies at most limit pending migrations, all of them when limit is 0.
+func (m *Migrator) Up(limit int) (int, error) {
+	return migrate.ExecMax(m.db, driver, migrationSource, migrate.Up, limit)
+}
+
+// Down rolls back at most limit applied migrations, all of them when limit is 0.
+func (m *Migrator) Down(limit int) (int, error) {
+	return migrate.ExecMax(m.db, driver, migrationSource, migrate.Down, limit)
+}
+
+// Redo rolls back the last applied migration and applies it again in one transaction, a failure leaves it applied.
+func (m *Migrator) Redo() (string, error) {
+	planned, _, err := migrate.PlanMigration(m.db, driver, migrationSource, migrate.Down, 1)
+	if err != nil || len(planned) == 0 {
+		return "", err
+	}
+
+	migration := planned[0].Migration
+	if migration.DisableTransactionDown || migration.DisableTransactionUp {
+		return "", fmt.Errorf("migration: %s runs without a transaction, roll it back and apply it with down and up", migration.Id)
+	}
+
+	tx, err := m.db.Begin()
+	if err != nil {
+		return "", err
+	}
+
+	if err := redo(tx, migration); err != nil {
+		_ = tx.Rollback()
+		return "", fmt.Errorf("migration: failed to redo %s, it is still applied: %w", migration.Id, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return "", err
+	}
+
+	return migration.Id, nil
+}
+
+// redo runs the down then the up queries of the migration in tx, and records the time it was applied again.
+func redo(tx *sql.Tx, migration *migrate.Migration) error {
+	queries := append(append([]string{}, migration.Down...), migration.Up...)
+	for _, query := range queries {
+		if _, err := tx.Exec(query); err != nil {
+			return err
+		}
+	}
+
+	_, err := tx.Exec(`UPDATE `+migrationTable+` SET applied_at = $1 WHERE id = $2`, time.Now(), migration.Id)
+	return err
+}
+
+// Plan returns the migrations Up or Down would apply, without applying them.
+func (m *Migrator) Plan(direction migrate.MigrationDirection, limit int) ([]PlannedMigration, error) {
+	migrations, _, err := migrate.PlanMigration(m.db, driver, migrationSource, direction, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]PlannedMigration, 0, len(migrations))
+	for _, migration := range migrations {
+		result = append(result, PlannedMigration{
+			Id:        migration.Id,
+			Direction: directionName(direction),
+			Queries:   migration.Queries,
+		})
+	}
+
+	return result, nil
+}
+
+// PlanRedo returns the migrations Redo would apply: the last applied one rolled back, then applied again.
+func (m *Migrator) PlanRedo() ([]PlannedMigration, error) {
+	planned, err := m.Plan(migrate.Down, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	migrations, err := migrationSource.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	return redoPlan(planned, migrations)
+}
+
+// redoPlan follows the planned roll back with the up queries of the same migration.
+func redoPlan(down []PlannedMigration, migrations []*migrate.Migration) ([]PlannedMigration, error) {
+	if len(down) == 0 {
+		return down, nil
+	}
+
+	for _, migration := range migrations {
+		if migration.Id == down[0].Id {
+			return []PlannedMigration{down[0], {
+				Id:        migration.Id,
+				Direction: directionName(migrate.Up),
+				Queries:   migration.Up,
+			}}, nil
+		}
+	}
+
+	return nil, fmt.Errorf("migration: %s is not embedded in this binary", down[0].Id)
+}
+
+// WritePlannedMigrations writes the migrations that would be applied with their queries, for a dry run.
+func WritePlannedMigrations(w io.Writer, planned []PlannedMigration) {
+	if len(planned) == 0 {
+		fmt.Fprintln(w, "Nothing to do")
+		return
+	}
+
+	for _, m := range planned {
+		fmt.Fprintf(w, "==> Would apply migration %s (%s)\n", m.Id, m.Direction)
+		for _, query := range m.Queries {
+			fmt.Fprintln(w, query)
+		}
+	}
+}
+
+// Status lists the embedded migrations followed by the unknown migrations applied to the database.
+func (m *Migrator) Status() ([]MigrationStatus, error) {
+	migrations, err := migrationSource.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := migrate.GetMigrationRecords(m.db, driver)
+	if err != nil {
+		return nil, err
+	}
+
+	applied := make(map[string]time.Time, len(records))
+	for _, record := range records {
+		applied[record.Id] = record.AppliedAt
+	}
+
+	result := make([]MigrationStatus, 0, len(migrations))
+	for _, migration := range migrations {
+		status := MigrationStatus{Id: migration.Id}
+		if appliedAt, ok := applied[migration.Id]; ok {
+			status.Applied = true
+			status.AppliedAt = &appliedAt
+			delete(applied, migration.Id)
+		}
+
+		result = append(result, status)
+	}
+
+	for _, record := range records {
+		if _, ok := applied[record.Id]; ok {
+			appliedAt := record.AppliedAt
+			result = append(result, MigrationStatus{
+				Id:        record.Id,
+				Applied:   true,
+				AppliedAt: &appliedAt,
+				Unknown:   true,
+			})
+		}
+	}
+
+	return result, nil
+}
+
+// CheckVersion returns an error when migrations embedded in this binary were not applied to the database.
+func (m *Migrator) CheckVersion() error {
+	statuses, err := m.Status()
+	if err != nil {
+		return err
+	}
+
+	var pending, unknown []string
+	for _, status := range statuses {
+		if status.Unknown {
+			unknown = append(unknown, status.Id)
+		} else if !status.Applied {
+			pending = append(pending, status.Id)
+		}
+	}
+
+	// A newer binary may have migrated the database during a rollout, its migrations must stay backward compatible
+	if len(unknown) > 0 {
+		log.Printf("migration: database has migrations unknown to this binary: %s\n", strings.Join(unknown, ", "))
+	}
+
+	if len(pending) > 0 {
+		return fmt.Errorf("migration: database schema is outdated, pending migrations: %s", strings.Join(pending, ", "))
+	}
+
+	return nil
+}
+
+func directionName(direction migrate.MigrationDirection) string {
+	if direction == migrate.Down {
+		return "down"
+	}
+
+	return "up"
+}
+
+// Migrate applies every pending migration.
+func Migrate(dataSource string) error {
+	migrator, err := NewMigrator(dataSource)
+	if err != nil {
 		return err
 	}
 
 	defer func() {
-		if err := db.Close(); err != nil {
+		if err := migrator.Close(); err != nil {
 			log.Printf("migration: failed to close sql db: %s\n", err)
 		}
 	}()
 
-	migrationSource := &migrate.EmbedFileSystemMigrationSource{
-		FileSystem: migrationsFS,
-		Root:       "migrations",
-	}
-
-	_, err = migrate.Exec(db, driver, migrationSource, migrate.Up)
+	_, err = migrator.Up(0)
 	if err != nil {
 		log.Printf("migration: Could not migrate up: %s\n", err)
 		return err
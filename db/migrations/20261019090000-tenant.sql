@@ -0,0 +1,6 @@
+
+-- +migrate Up
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "tenant_id" text NOT NULL DEFAULT 'default';
+
+-- +migrate Down
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "tenant_id";
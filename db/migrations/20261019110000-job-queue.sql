@@ -0,0 +1,23 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS "job_queue" (
+"id" bigserial PRIMARY KEY,
+"queue" text NOT NULL,
+"payload" text NOT NULL,
+"status" text NOT NULL DEFAULT 'ready',
+"connection" text,
+"created_at" timestamp(6) NOT NULL DEFAULT timezone('utc'::text, now())
+);
+
+CREATE INDEX IF NOT EXISTS "job_queue_queue_status_id_idx" ON "job_queue" ("queue", "status", "id");
+
+CREATE TABLE IF NOT EXISTS "job_queue_consumers" (
+"connection" text NOT NULL,
+"queue" text NOT NULL,
+"consumers" text[] NOT NULL DEFAULT '{}',
+"heartbeat_at" timestamp(6) NOT NULL,
+PRIMARY KEY ("connection", "queue")
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS "job_queue_consumers";
+DROP TABLE IF EXISTS "job_queue";
@@ -0,0 +1,6 @@
+
+-- +migrate Up
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "priority" text NOT NULL DEFAULT 'normal';
+
+-- +migrate Down
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "priority";
@@ -0,0 +1,12 @@
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS "job_workers" (
+"id" text PRIMARY KEY,
+"hostname" text NOT NULL,
+"types" text[] NOT NULL DEFAULT '{}',
+"labels" text[] NOT NULL DEFAULT '{}',
+"started_at" timestamp(6) NOT NULL,
+"heartbeat_at" timestamp(6) NOT NULL
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS "job_workers";
@@ -0,0 +1,5 @@
+-- +migrate Up
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "error_detail" text;
+
+-- +migrate Down
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "error_detail";
@@ -0,0 +1,34 @@
+
+-- +migrate Up
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "attempts" integer NOT NULL DEFAULT 0;
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "error" jsonb;
+
+UPDATE "jobs" SET "attempts" = 1 WHERE "start_time" IS NOT NULL OR "status" = 'failed';
+
+UPDATE "jobs" SET "error" = jsonb_build_object(
+    'code', CASE
+        WHEN "error_detail" IS NOT NULL THEN 'panic'
+        WHEN "message" = 'job exceed timeout' THEN 'timeout'
+        ELSE 'handler_error'
+    END,
+    'message', "message",
+    'retryable', "message" = 'job exceed timeout',
+    'attempt', "attempts"
+) || CASE WHEN "error_detail" IS NOT NULL THEN jsonb_build_object('details', jsonb_build_object('stack', "error_detail")) ELSE '{}'::jsonb END
+WHERE "message" IS NOT NULL AND "message" <> '';
+
+UPDATE "jobs" SET "error" = jsonb_build_object('code', 'cancelled', 'message', 'job was cancelled', 'retryable', false, 'attempt', "attempts")
+WHERE "status" = 'cancelled' AND "error" IS NULL;
+
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "message";
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "error_detail";
+
+-- +migrate Down
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "message" text;
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "error_detail" text;
+
+UPDATE "jobs" SET "message" = "error"->>'message', "error_detail" = "error"->'details'->>'stack'
+WHERE "error" IS NOT NULL AND "error"->>'code' <> 'cancelled';
+
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "error";
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "attempts";
@@ -0,0 +1,8 @@
+
+-- +migrate Up
+ALTER TABLE "jobs" ADD CONSTRAINT "jobs_status_check" CHECK ("status" IN (
+    'created', 'scheduled', 'queued', 'running', 'retrying', 'success', 'failed', 'timed_out', 'cancelled', 'expired'
+));
+
+-- +migrate Down
+ALTER TABLE "jobs" DROP CONSTRAINT IF EXISTS "jobs_status_check";
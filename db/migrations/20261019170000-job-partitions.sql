@@ -0,0 +1,41 @@
+
+-- +migrate Up
+ALTER TABLE "jobs" RENAME TO "jobs_unpartitioned";
+ALTER INDEX "jobs_pkey" RENAME TO "jobs_unpartitioned_pkey";
+
+-- The primary key of a partitioned table must include the partition key, ids still come from jobs_id_seq
+CREATE TABLE "jobs" (LIKE "jobs_unpartitioned" INCLUDING DEFAULTS INCLUDING CONSTRAINTS) PARTITION BY RANGE ("created_at");
+ALTER TABLE "jobs" ADD PRIMARY KEY ("id", "created_at");
+ALTER SEQUENCE "jobs_id_seq" OWNED BY "jobs"."id";
+
+-- GetJobByObjectId looks up the recent jobs of an object
+CREATE INDEX IF NOT EXISTS "jobs_tenant_object_created_idx" ON "jobs" ("tenant_id", "object_id", "created_at");
+
+CREATE TABLE "jobs_default" PARTITION OF "jobs" DEFAULT;
+
+-- One partition per month from the oldest job to 3 months ahead, the maintenance command creates the next ones
+-- +migrate StatementBegin
+DO $$
+DECLARE
+    m timestamp := date_trunc('month', coalesce((SELECT min("created_at") FROM "jobs_unpartitioned"), timezone('utc'::text, now())));
+BEGIN
+    WHILE m < date_trunc('month', timezone('utc'::text, now())) + interval '4 months' LOOP
+        EXECUTE format('CREATE TABLE IF NOT EXISTS %I PARTITION OF "jobs" FOR VALUES FROM (%L) TO (%L)',
+            'jobs_p' || to_char(m, 'YYYYMM'), m, m + interval '1 month');
+        m := m + interval '1 month';
+    END LOOP;
+END
+$$;
+-- +migrate StatementEnd
+
+INSERT INTO "jobs" SELECT * FROM "jobs_unpartitioned";
+DROP TABLE "jobs_unpartitioned";
+
+-- +migrate Down
+CREATE TABLE "jobs_unpartitioned" (LIKE "jobs" INCLUDING DEFAULTS INCLUDING CONSTRAINTS);
+INSERT INTO "jobs_unpartitioned" SELECT * FROM "jobs";
+ALTER SEQUENCE "jobs_id_seq" OWNED BY "jobs_unpartitioned"."id";
+
+DROP TABLE "jobs";
+ALTER TABLE "jobs_unpartitioned" RENAME TO "jobs";
+ALTER TABLE "jobs" ADD PRIMARY KEY ("id");
@@ -0,0 +1,16 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS "jobs_archive" (
+"id" integer NOT NULL,
+"tenant_id" text NOT NULL,
+"status" text NOT NULL,
+"created_at" timestamp(6) NOT NULL,
+"archived_at" timestamp(6) NOT NULL DEFAULT timezone('utc'::text, now()),
+"job" jsonb NOT NULL,
+PRIMARY KEY ("id", "created_at")
+);
+
+CREATE INDEX IF NOT EXISTS "jobs_archive_tenant_id_idx" ON "jobs_archive" ("tenant_id", "id");
+
+-- +migrate Down
+DROP TABLE IF EXISTS "jobs_archive";
@@ -0,0 +1,138 @@
+
+-- +migrate Up
+-- The timestamp columns hold UTC times, they are converted with AT TIME ZONE 'UTC' whatever the time zone of the session is.
+-- created_at is the partition key of jobs and cannot change its type, so jobs is rebuilt with the same partitions.
+CREATE TEMP TABLE "jobs_partition_months" ON COMMIT DROP AS
+SELECT to_date(substr(c.relname, length('jobs_p') + 1), 'YYYYMM')::timestamp AS "month"
+FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = '"jobs"'::regclass AND c.relname LIKE 'jobs\_p%';
+
+CREATE TEMP TABLE "jobs_timestamp" ON COMMIT DROP AS SELECT * FROM "jobs";
+
+ALTER SEQUENCE "jobs_id_seq" OWNED BY NONE;
+DROP TABLE "jobs";
+
+CREATE TABLE "jobs" (
+"id" integer NOT NULL DEFAULT nextval('jobs_id_seq'::regclass),
+"object_id" integer NOT NULL,
+"status" text NOT NULL,
+"start_time" timestamptz(6),
+"end_time" timestamptz(6),
+"created_at" timestamptz(6) NOT NULL DEFAULT now(),
+"tenant_id" text NOT NULL DEFAULT 'default',
+"type" text NOT NULL DEFAULT 'default',
+"priority" text NOT NULL DEFAULT 'normal',
+"attempts" integer NOT NULL DEFAULT 0,
+"error" jsonb,
+CONSTRAINT "jobs_status_check" CHECK ("status" IN (
+    'created', 'scheduled', 'queued', 'running', 'retrying', 'success', 'failed', 'timed_out', 'cancelled', 'expired'
+)),
+PRIMARY KEY ("id", "created_at")
+) PARTITION BY RANGE ("created_at");
+ALTER SEQUENCE "jobs_id_seq" OWNED BY "jobs"."id";
+
+CREATE INDEX IF NOT EXISTS "jobs_tenant_object_created_idx" ON "jobs" ("tenant_id", "object_id", "created_at");
+
+CREATE TABLE "jobs_default" PARTITION OF "jobs" DEFAULT;
+
+-- +migrate StatementBegin
+DO $$
+DECLARE
+    m timestamp;
+BEGIN
+    FOR m IN SELECT "month" FROM "jobs_partition_months" LOOP
+        EXECUTE format('CREATE TABLE IF NOT EXISTS %I PARTITION OF "jobs" FOR VALUES FROM (%L) TO (%L)',
+            'jobs_p' || to_char(m, 'YYYYMM'), m AT TIME ZONE 'UTC', (m + interval '1 month') AT TIME ZONE 'UTC');
+    END LOOP;
+END
+$$;
+-- +migrate StatementEnd
+
+INSERT INTO "jobs" ("id", "object_id", "status", "start_time", "end_time", "created_at", "tenant_id", "type", "priority", "attempts", "error")
+SELECT "id", "object_id", "status", "start_time" AT TIME ZONE 'UTC', "end_time" AT TIME ZONE 'UTC', "created_at" AT TIME ZONE 'UTC',
+    "tenant_id", "type", "priority", "attempts", "error"
+FROM "jobs_timestamp";
+
+ALTER TABLE "jobs_archive"
+    ALTER COLUMN "created_at" TYPE timestamptz(6) USING "created_at" AT TIME ZONE 'UTC',
+    ALTER COLUMN "archived_at" TYPE timestamptz(6) USING "archived_at" AT TIME ZONE 'UTC',
+    ALTER COLUMN "archived_at" SET DEFAULT now();
+
+ALTER TABLE "job_queue"
+    ALTER COLUMN "created_at" TYPE timestamptz(6) USING "created_at" AT TIME ZONE 'UTC',
+    ALTER COLUMN "created_at" SET DEFAULT now();
+
+ALTER TABLE "job_queue_consumers"
+    ALTER COLUMN "heartbeat_at" TYPE timestamptz(6) USING "heartbeat_at" AT TIME ZONE 'UTC';
+
+ALTER TABLE "job_workers"
+    ALTER COLUMN "started_at" TYPE timestamptz(6) USING "started_at" AT TIME ZONE 'UTC',
+    ALTER COLUMN "heartbeat_at" TYPE timestamptz(6) USING "heartbeat_at" AT TIME ZONE 'UTC';
+
+-- +migrate Down
+ALTER TABLE "job_workers"
+    ALTER COLUMN "started_at" TYPE timestamp(6) USING "started_at" AT TIME ZONE 'UTC',
+    ALTER COLUMN "heartbeat_at" TYPE timestamp(6) USING "heartbeat_at" AT TIME ZONE 'UTC';
+
+ALTER TABLE "job_queue_consumers"
+    ALTER COLUMN "heartbeat_at" TYPE timestamp(6) USING "heartbeat_at" AT TIME ZONE 'UTC';
+
+ALTER TABLE "job_queue"
+    ALTER COLUMN "created_at" TYPE timestamp(6) USING "created_at" AT TIME ZONE 'UTC',
+    ALTER COLUMN "created_at" SET DEFAULT timezone('utc'::text, now());
+
+ALTER TABLE "jobs_archive"
+    ALTER COLUMN "created_at" TYPE timestamp(6) USING "created_at" AT TIME ZONE 'UTC',
+    ALTER COLUMN "archived_at" TYPE timestamp(6) USING "archived_at" AT TIME ZONE 'UTC',
+    ALTER COLUMN "archived_at" SET DEFAULT timezone('utc'::text, now());
+
+CREATE TEMP TABLE "jobs_partition_months" ON COMMIT DROP AS
+SELECT to_date(substr(c.relname, length('jobs_p') + 1), 'YYYYMM')::timestamp AS "month"
+FROM pg_inherits i JOIN pg_class c ON c.oid = i.inhrelid
+WHERE i.inhparent = '"jobs"'::regclass AND c.relname LIKE 'jobs\_p%';
+
+CREATE TEMP TABLE "jobs_timestamptz" ON COMMIT DROP AS SELECT * FROM "jobs";
+
+ALTER SEQUENCE "jobs_id_seq" OWNED BY NONE;
+DROP TABLE "jobs";
+
+CREATE TABLE "jobs" (
+"id" integer NOT NULL DEFAULT nextval('jobs_id_seq'::regclass),
+"object_id" integer NOT NULL,
+"status" text NOT NULL,
+"start_time" timestamp(6),
+"end_time" timestamp(6),
+"created_at" timestamp(6) NOT NULL DEFAULT timezone('utc'::text, now()),
+"tenant_id" text NOT NULL DEFAULT 'default',
+"type" text NOT NULL DEFAULT 'default',
+"priority" text NOT NULL DEFAULT 'normal',
+"attempts" integer NOT NULL DEFAULT 0,
+"error" jsonb,
+CONSTRAINT "jobs_status_check" CHECK ("status" IN (
+    'created', 'scheduled', 'queued', 'running', 'retrying', 'success', 'failed', 'timed_out', 'cancelled', 'expired'
+)),
+PRIMARY KEY ("id", "created_at")
+) PARTITION BY RANGE ("created_at");
+ALTER SEQUENCE "jobs_id_seq" OWNED BY "jobs"."id";
+
+CREATE INDEX IF NOT EXISTS "jobs_tenant_object_created_idx" ON "jobs" ("tenant_id", "object_id", "created_at");
+
+CREATE TABLE "jobs_default" PARTITION OF "jobs" DEFAULT;
+
+-- +migrate StatementBegin
+DO $$
+DECLARE
+    m timestamp;
+BEGIN
+    FOR m IN SELECT "month" FROM "jobs_partition_months" LOOP
+        EXECUTE format('CREATE TABLE IF NOT EXISTS %I PARTITION OF "jobs" FOR VALUES FROM (%L) TO (%L)',
+            'jobs_p' || to_char(m, 'YYYYMM'), m, m + interval '1 month');
+    END LOOP;
+END
+$$;
+-- +migrate StatementEnd
+
+INSERT INTO "jobs" ("id", "object_id", "status", "start_time", "end_time", "created_at", "tenant_id", "type", "priority", "attempts", "error")
+SELECT "id", "object_id", "status", "start_time" AT TIME ZONE 'UTC', "end_time" AT TIME ZONE 'UTC', "created_at" AT TIME ZONE 'UTC',
+    "tenant_id", "type", "priority", "attempts", "error"
+FROM "jobs_timestamptz";
@@ -0,0 +1,13 @@
+
+-- +migrate Up
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "published_at" timestamptz(6);
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "worker_id" text;
+ALTER TABLE "jobs" ADD COLUMN IF NOT EXISTS "hostname" text;
+
+-- Jobs were published when they were created
+UPDATE "jobs" SET "published_at" = "created_at" WHERE "status" <> 'created' OR "start_time" IS NOT NULL;
+
+-- +migrate Down
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "hostname";
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "worker_id";
+ALTER TABLE "jobs" DROP COLUMN IF EXISTS "published_at";
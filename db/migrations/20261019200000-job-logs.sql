@@ -0,0 +1,17 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS "job_logs" (
+"id" bigserial PRIMARY KEY,
+"tenant_id" text NOT NULL,
+"job_id" integer NOT NULL,
+"attempt" integer NOT NULL DEFAULT 0,
+"level" text NOT NULL,
+"message" text NOT NULL,
+"fields" jsonb,
+"created_at" timestamptz(6) NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS "job_logs_job_id_idx" ON "job_logs" ("job_id", "id");
+
+-- +migrate Down
+DROP TABLE IF EXISTS "job_logs";
@@ -0,0 +1,11 @@
+
+-- +migrate Up
+CREATE TABLE IF NOT EXISTS "settings" (
+"key" text PRIMARY KEY,
+"value" jsonb NOT NULL,
+"updated_by" text NOT NULL DEFAULT '',
+"updated_at" timestamptz(6) NOT NULL DEFAULT now()
+);
+
+-- +migrate Down
+DROP TABLE IF EXISTS "settings";
@@ -0,0 +1,43 @@
+package migration
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedoPlan(t *testing.T) {
+	migrations, err := migrationSource.FindMigrations()
+	require.NoError(t, err)
+	last := migrations[len(migrations)-1]
+	down := []PlannedMigration{{Id: last.Id, Direction: "down", Queries: last.Down}}
+
+	t.Run("the rolled back migration is applied again", func(t *testing.T) {
+		planned, err := redoPlan(down, migrations)
+		require.NoError(t, err)
+		require.Len(t, planned, 2)
+		assert.Equal(t, PlannedMigration{Id: last.Id, Direction: "up", Queries: last.Up}, planned[1])
+
+		var out bytes.Buffer
+		WritePlannedMigrations(&out, planned)
+		assert.Contains(t, out.String(), "==> Would apply migration "+last.Id+" (down)\n"+last.Down[0])
+		assert.Contains(t, out.String(), "==> Would apply migration "+last.Id+" (up)\n"+last.Up[0])
+		assert.NotContains(t, out.String(), "-- the up queries of")
+	})
+
+	t.Run("nothing applied", func(t *testing.T) {
+		planned, err := redoPlan(nil, migrations)
+		require.NoError(t, err)
+
+		var out bytes.Buffer
+		WritePlannedMigrations(&out, planned)
+		assert.Equal(t, "Nothing to do\n", out.String())
+	})
+
+	t.Run("migration unknown to this binary", func(t *testing.T) {
+		_, err := redoPlan([]PlannedMigration{{Id: "20000101000000-unknown.sql", Direction: "down"}}, migrations)
+		assert.Error(t, err)
+	})
+}
@@ -20,4 +20,5 @@ require (
 	github.com/stretchr/testify v1.7.0
 	github.com/urfave/cli v1.22.5
 	github.com/ziutek/mymysql v1.5.4 // indirect
+	gopkg.in/yaml.v3 v3.0.0-20210107192922-496545a6307b
 )
@@ -0,0 +1,142 @@
+package jobs
+
+import (
+	"errors"
+	"expvar"
+	"math"
+	"net/http"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+type QueueActionResult struct {
+	Queue string `json:"queue"`
+	Count int64  `json:"count"`
+}
+
+type QueuePauseResult struct {
+	Queue  string `json:"queue"`
+	Paused bool   `json:"paused"`
+}
+
+func (a *HTTPHandler) initAdminRoutes() {
+	// The admin API is disabled until admin keys are configured
+	if len(a.config.AdminAPIKeys) == 0 {
+		return
+	}
+
+	admin := a.routes.Group("/admin", AdminMiddleware(a.config.AdminAPIKeys))
+	admin.GET("/queues", a.GetQueuesHandler)
+	admin.POST("/queues/:name/purge-ready", a.PurgeReadyHandler)
+	admin.POST("/queues/:name/purge-rejected", a.PurgeRejectedHandler)
+	admin.POST("/queues/:name/return-rejected", a.ReturnRejectedHandler)
+	admin.POST("/queues/:name/pause", a.PauseQueueHandler)
+	admin.POST("/queues/:name/resume", a.ResumeQueueHandler)
+	admin.GET("/connections", a.GetConnectionsHandler)
+	admin.GET("/workers", a.GetWorkersHandler)
+	admin.GET("/settings", a.GetSettingsHandler)
+	admin.PUT("/settings/:key", a.PutSettingHandler)
+	admin.DELETE("/settings/:key", a.ResetSettingHandler)
+	admin.GET("/metrics", echo.WrapHandler(expvar.Handler()))
+}
+
+func (a *HTTPHandler) GetQueuesHandler(ctx echo.Context) error {
+	stats, err := a.queueAdmin.QueueStats(ctx.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return ctx.JSON(http.StatusOK, stats)
+}
+
+func (a *HTTPHandler) GetConnectionsHandler(ctx echo.Context) error {
+	connections, err := a.queueAdmin.Connections(ctx.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return ctx.JSON(http.StatusOK, connections)
+}
+
+// GetWorkersHandler lists the worker fleet with the job types and labels of every worker.
+func (a *HTTPHandler) GetWorkersHandler(ctx echo.Context) error {
+	workers, err := a.workers.Workers(ctx.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return ctx.JSON(http.StatusOK, workers)
+}
+
+func (a *HTTPHandler) PurgeReadyHandler(ctx echo.Context) error {
+	queue := ctx.Param("name")
+	count, err := a.queueAdmin.PurgeReady(ctx.Request().Context(), queue)
+	return a.queueActionResponse(ctx, "purge ready", queue, count, err)
+}
+
+func (a *HTTPHandler) PurgeRejectedHandler(ctx echo.Context) error {
+	queue := ctx.Param("name")
+	count, err := a.queueAdmin.PurgeRejected(ctx.Request().Context(), queue)
+	return a.queueActionResponse(ctx, "purge rejected", queue, count, err)
+}
+
+// ReturnRejectedHandler moves rejected deliveries back to ready, at most "max" of them when the query param is set.
+func (a *HTTPHandler) ReturnRejectedHandler(ctx echo.Context) error {
+	max := int64(math.MaxInt64)
+	if value := ctx.QueryParam("max"); value != "" {
+		var err error
+		max, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || max <= 0 {
+			return echo.NewHTTPError(http.StatusBadRequest, "failed to parse max")
+		}
+	}
+
+	queue := ctx.Param("name")
+	count, err := a.queueAdmin.ReturnRejected(ctx.Request().Context(), queue, max)
+	return a.queueActionResponse(ctx, "return rejected", queue, count, err)
+}
+
+// PauseQueueHandler stops the workers from running the jobs of a queue, they are still accepted and wait in the queue.
+func (a *HTTPHandler) PauseQueueHandler(ctx echo.Context) error {
+	return a.pauseQueue(ctx, true)
+}
+
+// ResumeQueueHandler lets the workers run the jobs of a paused queue again.
+func (a *HTTPHandler) ResumeQueueHandler(ctx echo.Context) error {
+	return a.pauseQueue(ctx, false)
+}
+
+func (a *HTTPHandler) pauseQueue(ctx echo.Context, paused bool) error {
+	queue := ctx.Param("name")
+	admin := AdminFromContext(ctx)
+	if _, err := PauseQueue(ctx.Request().Context(), a.settings, queue, paused, admin); err != nil {
+		if errors.Is(err, ErrQueueNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, ErrQueueNotFound.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	a.logger.WithField("admin", admin).Infof("queue %s paused: %t", queue, paused)
+	return ctx.JSON(http.StatusOK, QueuePauseResult{
+		Queue:  queue,
+		Paused: paused,
+	})
+}
+
+func (a *HTTPHandler) queueActionResponse(ctx echo.Context, action string, queue string, count int64, err error) error {
+	if err != nil {
+		if errors.Is(err, ErrQueueNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, ErrQueueNotFound.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	a.logger.WithField("admin", AdminFromContext(ctx)).Infof("%s of queue %s: %d deliveries", action, queue, count)
+	return ctx.JSON(http.StatusOK, QueueActionResult{
+		Queue: queue,
+		Count: count,
+	})
+}
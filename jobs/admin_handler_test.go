@@ -0,0 +1,238 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+func initTestAdminHandler(t *testing.T, queueName string) *HTTPHandler {
+	cfg := config.Config{
+		AuthConfig: config.AuthConfig{
+			AdminAPIKeys: map[string]string{"admin-key": "alice"},
+		},
+	}
+
+	svc := initTestService(t, queueName, initTestClock())
+	return initTestHandler(cfg, svc)
+}
+
+func TestAdminHandlerAuth(t *testing.T) {
+	t.Run("admin api is disabled without admin keys", func(t *testing.T) {
+		svc := initTestService(t, gofakeit.UUID(), initTestClock())
+		handler := initTestHandler(config.Config{}, svc)
+
+		tr := testRequest{method: http.MethodGet, uri: "/admin/queues"}
+		rec := tr.do(handler)
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("invalid admin key", func(t *testing.T) {
+		handler := initTestAdminHandler(t, gofakeit.UUID())
+
+		tr := testRequest{
+			method:  http.MethodGet,
+			uri:     "/admin/queues",
+			headers: map[string]string{"X-API-Key": "key-a"},
+		}
+		rec := tr.do(handler)
+		assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	})
+}
+
+func TestAdminHandlerQueues(t *testing.T) {
+	ctx := context.Background()
+	queueName := gofakeit.UUID()
+	handler := initTestAdminHandler(t, queueName)
+
+	svc := initTestService(t, queueName, initTestClock())
+	_, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+	require.NoError(t, err)
+
+	headers := map[string]string{"X-API-Key": "admin-key"}
+
+	tr := testRequest{method: http.MethodGet, uri: "/admin/queues", headers: headers}
+	rec := tr.do(handler)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var stats []QueueStats
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &stats))
+
+	var found bool
+	for _, stat := range stats {
+		if stat.Name == queueName {
+			found = true
+			assert.Equal(t, int64(1), stat.Ready)
+		}
+	}
+	assert.True(t, found)
+
+	testcases := []struct {
+		name       string
+		uri        string
+		statusCode int
+		count      int64
+	}{
+		{
+			name:       "purge ready",
+			uri:        fmt.Sprintf("/admin/queues/%s/purge-ready", queueName),
+			statusCode: http.StatusOK,
+			count:      1,
+		},
+		{
+			name:       "purge rejected",
+			uri:        fmt.Sprintf("/admin/queues/%s/purge-rejected", queueName),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "return rejected",
+			uri:        fmt.Sprintf("/admin/queues/%s/return-rejected?max=10", queueName),
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "return rejected with invalid max",
+			uri:        fmt.Sprintf("/admin/queues/%s/return-rejected?max=abc", queueName),
+			statusCode: http.StatusBadRequest,
+		},
+		{
+			name:       "unknown queue",
+			uri:        fmt.Sprintf("/admin/queues/%s/purge-ready", gofakeit.UUID()),
+			statusCode: http.StatusNotFound,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := testRequest{method: http.MethodPost, uri: tc.uri, headers: headers}
+			rec := tr.do(handler)
+			require.Equal(t, tc.statusCode, rec.Code)
+
+			if tc.statusCode == http.StatusOK {
+				var result QueueActionResult
+				require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+				assert.Equal(t, queueName, result.Queue)
+				assert.Equal(t, tc.count, result.Count)
+			}
+		})
+	}
+}
+
+func TestAdminHandlerConnections(t *testing.T) {
+	handler := initTestAdminHandler(t, gofakeit.UUID())
+
+	tr := testRequest{
+		method:  http.MethodGet,
+		uri:     "/admin/connections",
+		headers: map[string]string{"X-API-Key": "admin-key"},
+	}
+	rec := tr.do(handler)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var connections []ConnectionInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &connections))
+	assert.NotEmpty(t, connections)
+}
+
+func TestAdminHandlerWorkers(t *testing.T) {
+	handler := initTestAdminHandler(t, gofakeit.UUID())
+
+	tr := testRequest{
+		method:  http.MethodGet,
+		uri:     "/admin/workers",
+		headers: map[string]string{"X-API-Key": "admin-key"},
+	}
+	rec := tr.do(handler)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var workers []WorkerInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &workers))
+
+	var worker WorkerInfo
+	for _, w := range workers {
+		if w.Id == "test-worker" {
+			worker = w
+		}
+	}
+
+	assert.True(t, worker.Active)
+	assert.Contains(t, worker.Types, "report")
+}
+
+func TestAdminHandlerMetrics(t *testing.T) {
+	handler := initTestAdminHandler(t, gofakeit.UUID())
+	countPanic("report")
+	setQueuePaused("job-queue.report", true)
+
+	tr := testRequest{
+		method:  http.MethodGet,
+		uri:     "/admin/metrics",
+		headers: map[string]string{"X-API-Key": "admin-key"},
+	}
+	rec := tr.do(handler)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var vars struct {
+		Jobs struct {
+			Panics       int64            `json:"panics"`
+			PanicsByType map[string]int64 `json:"panics_by_type"`
+			PausedQueues map[string]int64 `json:"paused_queues"`
+		} `json:"jobs"`
+	}
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &vars))
+	assert.Positive(t, vars.Jobs.Panics)
+	assert.Positive(t, vars.Jobs.PanicsByType["report"])
+	assert.EqualValues(t, 1, vars.Jobs.PausedQueues["job-queue.report"])
+}
+
+func TestAdminHandlerPauseQueue(t *testing.T) {
+	handler := initTestAdminHandler(t, gofakeit.UUID())
+	headers := map[string]string{"X-API-Key": "admin-key"}
+	queue := JobQueueName(QueueName, "report", JobPriorityHigh)
+	t.Cleanup(func() {
+		_, _ = testSettings.PutSetting(context.Background(), Setting{Key: SettingPausedQueues, UpdatedBy: "test"})
+	})
+
+	health := func(t *testing.T) Health {
+		tr := testRequest{method: http.MethodGet, uri: "/health"}
+		rec := tr.do(handler)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var health Health
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &health))
+		return health
+	}
+
+	tr := testRequest{method: http.MethodPost, uri: fmt.Sprintf("/admin/queues/%s/pause", queue), headers: headers}
+	rec := tr.do(handler)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var result QueuePauseResult
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, QueuePauseResult{Queue: queue, Paused: true}, result)
+	assert.Contains(t, health(t).PausedQueues, queue)
+
+	settings, err := testSettings.Settings(context.Background())
+	require.NoError(t, err)
+	for _, setting := range settings {
+		if setting.Key == SettingPausedQueues {
+			assert.Equal(t, "alice", setting.UpdatedBy)
+		}
+	}
+
+	tr = testRequest{method: http.MethodPost, uri: fmt.Sprintf("/admin/queues/%s/resume", queue), headers: headers}
+	rec = tr.do(handler)
+	require.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, health(t).PausedQueues, queue)
+
+	tr = testRequest{method: http.MethodPost, uri: "/admin/queues/other-queue/pause", headers: headers}
+	rec = tr.do(handler)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
@@ -0,0 +1,118 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/go-pg/pg/v9/orm"
+
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+// JobArchive keeps the jobs the maintenance moves out of the jobs table.
+// Archive runs in the transaction deleting the jobs, they are deleted only when it succeeds.
+type JobArchive interface {
+	Archive(ctx context.Context, jobs []Job) error
+}
+
+// TableArchive inserts the jobs into the jobs_archive table, a job is stored as JSON so the archive survives schema changes.
+type TableArchive struct {
+	db orm.DB
+}
+
+func NewTableArchive(db orm.DB) *TableArchive {
+	return &TableArchive{
+		db: db,
+	}
+}
+
+type archivedJob struct {
+	tableName struct{} `pg:"jobs_archive"`
+
+	Id        int       `pg:"id"`
+	TenantId  string    `pg:"tenant_id"`
+	Status    JobStatus `pg:"status"`
+	CreatedAt time.Time `pg:"created_at"`
+	Job       Job       `pg:"job,type:jsonb"`
+}
+
+func (a *TableArchive) Archive(ctx context.Context, jobs []Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	rows := make([]archivedJob, 0, len(jobs))
+	for _, job := range jobs {
+		rows = append(rows, archivedJob{
+			Id:        job.Id,
+			TenantId:  job.TenantId,
+			Status:    job.Status,
+			CreatedAt: job.CreatedAt,
+			Job:       job,
+		})
+	}
+
+	_, err := utils.TransactionFromContext(ctx, a.db).ModelContext(ctx, &rows).Insert()
+	return err
+}
+
+// FileArchive writes the jobs as NDJSON, one file per archived batch in dir.
+type FileArchive struct {
+	dir   string
+	clock clock.Clock
+}
+
+func NewFileArchive(dir string, clock clock.Clock) *FileArchive {
+	return &FileArchive{
+		dir:   dir,
+		clock: utils.UTCClock(clock),
+	}
+}
+
+// Archive names the file after the archival time and the first job, e.g. jobs-20261019T120000Z-42.ndjson.
+// The file is complete once it has its name, a failed archival leaves a temporary file behind at worst.
+func (a *FileArchive) Archive(ctx context.Context, jobs []Job) error {
+	if len(jobs) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(a.dir, 0o755); err != nil {
+		return err
+	}
+
+	name := filepath.Join(a.dir, fmt.Sprintf("jobs-%s-%d.ndjson", a.clock.Now().Format("20060102T150405Z"), jobs[0].Id))
+	file, err := os.CreateTemp(a.dir, ".jobs-*.ndjson")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	w := bufio.NewWriter(file)
+	encoder := json.NewEncoder(w)
+	for _, job := range jobs {
+		if err := encoder.Encode(job); err != nil {
+			return err
+		}
+	}
+
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(file.Name(), name)
+}
@@ -0,0 +1,91 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"path"
+	"strings"
+	"time"
+)
+
+// maxArtifactNameLength bounds the name of an artifact, it is a file name of the local store and part of an S3 key
+const maxArtifactNameLength = 255
+
+// Artifact is a file produced by a job, e.g. a report or an export.
+type Artifact struct {
+	Name        string    `json:"name"`
+	Size        int64     `json:"size"`
+	ContentType string    `json:"content_type"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// ArtifactStore keeps the artifacts of jobs under <tenant>/<job id>/<name>, they are deleted with their job
+// by the maintenance.
+type ArtifactStore interface {
+	// PutArtifact stores content as the artifact name of a job, replacing the artifact of the same name
+	PutArtifact(ctx context.Context, tenantId string, jobId int, name string, content io.Reader) (Artifact, error)
+	// ListArtifacts returns the artifacts of a job sorted by name
+	ListArtifacts(ctx context.Context, tenantId string, jobId int) ([]Artifact, error)
+	// OpenArtifact returns the content of an artifact, ErrArtifactNotFound when the job has no artifact of that name.
+	// The caller closes the content.
+	OpenArtifact(ctx context.Context, tenantId string, jobId int, name string) (io.ReadCloser, Artifact, error)
+	// DeleteArtifacts deletes the artifacts of a job and returns how many there were
+	DeleteArtifacts(ctx context.Context, tenantId string, jobId int) (int, error)
+}
+
+// ValidateArtifactName rejects the names which are not a plain file name, they could escape the directory of the job.
+// Names starting with a dot are reserved to the temporary files of the stores.
+func ValidateArtifactName(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("%w: empty name", ErrInvalidArtifactName)
+	case strings.HasPrefix(name, "."):
+		return fmt.Errorf("%w: %q starts with a dot", ErrInvalidArtifactName, name)
+	case len(name) > maxArtifactNameLength:
+		return fmt.Errorf("%w: longer than %d bytes", ErrInvalidArtifactName, maxArtifactNameLength)
+	case strings.ContainsAny(name, "/\\\x00"):
+		return fmt.Errorf("%w: %q contains a path separator", ErrInvalidArtifactName, name)
+	}
+
+	return nil
+}
+
+// artifactContentType guesses the content type of an artifact from the extension of its name.
+func artifactContentType(name string) string {
+	if contentType := mime.TypeByExtension(path.Ext(name)); contentType != "" {
+		return contentType
+	}
+
+	return "application/octet-stream"
+}
+
+type jobArtifactsKey struct{}
+
+// jobArtifacts is what AttachArtifact needs to know about the job run with a context
+type jobArtifacts struct {
+	store    ArtifactStore
+	tenantId string
+	jobId    int
+}
+
+// WithJobArtifacts returns a copy of ctx to which AttachArtifact attaches the artifacts of job.
+func WithJobArtifacts(ctx context.Context, store ArtifactStore, job Job) context.Context {
+	return context.WithValue(ctx, jobArtifactsKey{}, jobArtifacts{
+		store:    store,
+		tenantId: job.TenantId,
+		jobId:    job.Id,
+	})
+}
+
+// AttachArtifact stores content as an artifact of the job run with ctx, it is then served by
+// GET /v1/jobs/:id/artifacts/:name. Artifacts are not rolled back with the transaction of the job.
+func AttachArtifact(ctx context.Context, name string, content io.Reader) (Artifact, error) {
+	artifacts, ok := ctx.Value(jobArtifactsKey{}).(jobArtifacts)
+	if !ok || artifacts.store == nil {
+		return Artifact{}, ErrNoJobArtifacts
+	}
+
+	return artifacts.store.PutArtifact(ctx, artifacts.tenantId, artifacts.jobId, name, content)
+}
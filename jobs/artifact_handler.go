@@ -0,0 +1,89 @@
+package jobs
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ListJobArtifactsHandler returns the artifacts attached to a job sorted by name.
+func (a *HTTPHandler) ListJobArtifactsHandler(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to parse id")
+	}
+
+	tenantId := TenantFromContext(ctx)
+	if err := a.checkJobExists(ctx, tenantId, id); err != nil {
+		return err
+	}
+
+	artifacts, err := a.artifacts.ListArtifacts(ctx.Request().Context(), tenantId, id)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if artifacts == nil {
+		artifacts = []Artifact{}
+	}
+
+	return ctx.JSON(http.StatusOK, artifacts)
+}
+
+// GetJobArtifactHandler downloads an artifact of a job.
+func (a *HTTPHandler) GetJobArtifactHandler(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to parse id")
+	}
+
+	// echo routes the escaped path when it has escaped characters, e.g. a space
+	name, err := url.PathUnescape(ctx.Param("name"))
+	if err != nil || ValidateArtifactName(name) != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "invalid artifact name")
+	}
+
+	tenantId := TenantFromContext(ctx)
+	if err := a.checkJobExists(ctx, tenantId, id); err != nil {
+		return err
+	}
+
+	content, artifact, err := a.artifacts.OpenArtifact(ctx.Request().Context(), tenantId, id, name)
+	if err != nil {
+		if errors.Is(err, ErrArtifactNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, ErrArtifactNotFound.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+	defer content.Close()
+
+	header := ctx.Response().Header()
+	header.Set(echo.HeaderContentDisposition, mime.FormatMediaType("attachment", map[string]string{"filename": artifact.Name}))
+	if artifact.Size >= 0 {
+		header.Set(echo.HeaderContentLength, strconv.FormatInt(artifact.Size, 10))
+	}
+
+	if !artifact.CreatedAt.IsZero() {
+		header.Set(echo.HeaderLastModified, artifact.CreatedAt.Format(http.TimeFormat))
+	}
+
+	return ctx.Stream(http.StatusOK, artifact.ContentType, content)
+}
+
+// checkJobExists returns the HTTP error of a job the tenant has not, so the artifacts of the other tenants stay hidden.
+func (a *HTTPHandler) checkJobExists(ctx echo.Context, tenantId string, id int) error {
+	if _, err := a.service.GetJobByID(ctx.Request().Context(), tenantId, id); err != nil {
+		if errors.Is(err, ErrJobNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, ErrJobNotFound.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	return nil
+}
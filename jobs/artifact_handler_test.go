@@ -0,0 +1,90 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+func TestHandlerJobArtifacts(t *testing.T) {
+	ctx := context.Background()
+	svc := initTestService(t, gofakeit.UUID(), initTestClock())
+	cfg := config.Config{
+		AuthConfig: config.AuthConfig{
+			APIKeys: map[string]string{"key-a": "team-a", "key-b": "team-b"},
+		},
+	}
+	handler := initTestHandler(cfg, svc)
+
+	job, err := svc.SaveJob(ctx, "team-a", JobPayload{ObjectId: newTestObjectId()})
+	require.NoError(t, err)
+
+	// the handler of the job attaches the artifacts
+	jobCtx := WithJobArtifacts(ctx, testArtifacts, job)
+	_, err = AttachArtifact(jobCtx, "report 2026.csv", strings.NewReader("id,total\n1,3\n"))
+	require.NoError(t, err)
+	_, err = AttachArtifact(jobCtx, "summary.json", strings.NewReader(`{"total":3}`))
+	require.NoError(t, err)
+
+	get := func(uri, apiKey string) (int, http.Header, string) {
+		tr := testRequest{method: http.MethodGet, uri: uri, headers: map[string]string{"X-API-Key": apiKey}}
+		rec := tr.do(handler)
+		return rec.Code, rec.Header(), rec.Body.String()
+	}
+
+	t.Run("list", func(t *testing.T) {
+		code, _, body := get(fmt.Sprintf("/v1/jobs/%d/artifacts", job.Id), "key-a")
+		require.Equal(t, http.StatusOK, code)
+
+		var artifacts []Artifact
+		require.NoError(t, json.Unmarshal([]byte(body), &artifacts))
+		require.Len(t, artifacts, 2)
+		assert.Equal(t, "report 2026.csv", artifacts[0].Name)
+		assert.EqualValues(t, len("id,total\n1,3\n"), artifacts[0].Size)
+		assert.Equal(t, "summary.json", artifacts[1].Name)
+		assert.Equal(t, "application/json", artifacts[1].ContentType)
+	})
+
+	t.Run("download", func(t *testing.T) {
+		code, header, body := get(fmt.Sprintf("/v1/jobs/%d/artifacts/report%%202026.csv", job.Id), "key-a")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, "id,total\n1,3\n", body)
+		assert.Equal(t, `attachment; filename="report 2026.csv"`, header.Get("Content-Disposition"))
+		assert.Equal(t, "13", header.Get("Content-Length"))
+
+		code, header, body = get(fmt.Sprintf("/v1/jobs/%d/artifacts/summary.json", job.Id), "key-a")
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, `{"total":3}`, body)
+		assert.Equal(t, "application/json", header.Get("Content-Type"))
+	})
+
+	t.Run("missing artifact", func(t *testing.T) {
+		code, _, _ := get(fmt.Sprintf("/v1/jobs/%d/artifacts/missing.txt", job.Id), "key-a")
+		assert.Equal(t, http.StatusNotFound, code)
+
+		code, _, _ = get(fmt.Sprintf("/v1/jobs/%d/artifacts/..", job.Id), "key-a")
+		assert.Equal(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("artifacts of the other tenants are hidden", func(t *testing.T) {
+		code, _, _ := get(fmt.Sprintf("/v1/jobs/%d/artifacts", job.Id), "key-b")
+		assert.Equal(t, http.StatusNotFound, code)
+
+		code, _, _ = get(fmt.Sprintf("/v1/jobs/%d/artifacts/summary.json", job.Id), "key-b")
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+
+	t.Run("attach outside of a job", func(t *testing.T) {
+		_, err := AttachArtifact(ctx, "orphan.txt", strings.NewReader("orphan"))
+		assert.ErrorIs(t, err, ErrNoJobArtifacts)
+	})
+}
@@ -0,0 +1,162 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+)
+
+// LocalArtifactStore keeps the artifacts as files under dir/<tenant>/<job id>/<name>, the workers and the API
+// must share dir, e.g. a volume.
+type LocalArtifactStore struct {
+	dir string
+}
+
+func NewLocalArtifactStore(dir string) *LocalArtifactStore {
+	return &LocalArtifactStore{
+		dir: dir,
+	}
+}
+
+func (s *LocalArtifactStore) jobDir(tenantId string, jobId int) string {
+	return filepath.Join(s.dir, url.PathEscape(tenantId), strconv.Itoa(jobId))
+}
+
+// PutArtifact writes a temporary file renamed once complete, a reader never sees a partial artifact.
+func (s *LocalArtifactStore) PutArtifact(ctx context.Context, tenantId string, jobId int, name string, content io.Reader) (Artifact, error) {
+	if err := ValidateArtifactName(name); err != nil {
+		return Artifact{}, err
+	}
+
+	dir := s.jobDir(tenantId, jobId)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return Artifact{}, err
+	}
+
+	file, err := os.CreateTemp(dir, ".artifact-*")
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	if _, err := io.Copy(file, content); err != nil {
+		return Artifact{}, err
+	}
+
+	if err := file.Sync(); err != nil {
+		return Artifact{}, err
+	}
+
+	if err := file.Close(); err != nil {
+		return Artifact{}, err
+	}
+
+	if err := os.Rename(file.Name(), filepath.Join(dir, name)); err != nil {
+		return Artifact{}, err
+	}
+
+	return s.stat(dir, name)
+}
+
+func (s *LocalArtifactStore) ListArtifacts(ctx context.Context, tenantId string, jobId int) ([]Artifact, error) {
+	dir := s.jobDir(tenantId, jobId)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, nil
+		}
+
+		return nil, err
+	}
+
+	var result []Artifact
+	for _, entry := range entries {
+		// skip the temporary files of the artifacts being written, their names start with a dot
+		if !entry.Type().IsRegular() || ValidateArtifactName(entry.Name()) != nil {
+			continue
+		}
+
+		artifact, err := s.stat(dir, entry.Name())
+		if err != nil {
+			if errors.Is(err, ErrArtifactNotFound) {
+				continue
+			}
+
+			return nil, err
+		}
+
+		result = append(result, artifact)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func (s *LocalArtifactStore) OpenArtifact(ctx context.Context, tenantId string, jobId int, name string) (io.ReadCloser, Artifact, error) {
+	if err := ValidateArtifactName(name); err != nil {
+		return nil, Artifact{}, ErrArtifactNotFound
+	}
+
+	dir := s.jobDir(tenantId, jobId)
+	file, err := os.Open(filepath.Join(dir, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil, Artifact{}, ErrArtifactNotFound
+		}
+
+		return nil, Artifact{}, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, Artifact{}, err
+	}
+
+	return file, localArtifact(info), nil
+}
+
+func (s *LocalArtifactStore) DeleteArtifacts(ctx context.Context, tenantId string, jobId int) (int, error) {
+	artifacts, err := s.ListArtifacts(ctx, tenantId, jobId)
+	if err != nil {
+		return 0, err
+	}
+
+	if err := os.RemoveAll(s.jobDir(tenantId, jobId)); err != nil {
+		return 0, err
+	}
+
+	return len(artifacts), nil
+}
+
+func (s *LocalArtifactStore) stat(dir, name string) (Artifact, error) {
+	info, err := os.Stat(filepath.Join(dir, name))
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return Artifact{}, ErrArtifactNotFound
+		}
+
+		return Artifact{}, err
+	}
+
+	return localArtifact(info), nil
+}
+
+func localArtifact(info fs.FileInfo) Artifact {
+	return Artifact{
+		Name:        info.Name(),
+		Size:        info.Size(),
+		ContentType: artifactContentType(info.Name()),
+		CreatedAt:   info.ModTime().UTC(),
+	}
+}
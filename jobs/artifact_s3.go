@@ -0,0 +1,419 @@
+package jobs
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+const (
+	s3EmptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	s3TimeFormat       = "20060102T150405Z"
+	s3DateFormat       = "20060102"
+)
+
+// S3ArtifactStore keeps the artifacts as objects <tenant>/<job id>/<name> of a bucket of an S3 compatible storage,
+// e.g. AWS S3 or MinIO. The objects are addressed path style, <endpoint>/<bucket>/<key>, which every implementation
+// supports, and the requests are signed with AWS Signature Version 4.
+type S3ArtifactStore struct {
+	client    *http.Client
+	endpoint  *url.URL
+	region    string
+	bucket    string
+	accessKey string
+	secretKey string
+	clock     clock.Clock
+}
+
+func NewS3ArtifactStore(cfg config.ArtifactConfig, clock clock.Clock) (*S3ArtifactStore, error) {
+	endpoint, err := url.Parse(cfg.ArtifactS3Endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ARTIFACT_S3_ENDPOINT: %w", err)
+	}
+
+	if endpoint.Scheme != "http" && endpoint.Scheme != "https" || endpoint.Host == "" {
+		return nil, fmt.Errorf("invalid ARTIFACT_S3_ENDPOINT %q, expected http(s)://<host>[:<port>]", cfg.ArtifactS3Endpoint)
+	}
+
+	return &S3ArtifactStore{
+		client:    &http.Client{},
+		endpoint:  endpoint,
+		region:    cfg.ArtifactS3Region,
+		bucket:    cfg.ArtifactS3Bucket,
+		accessKey: cfg.ArtifactS3AccessKey,
+		secretKey: cfg.ArtifactS3SecretKey,
+		clock:     utils.UTCClock(clock),
+	}, nil
+}
+
+func (s *S3ArtifactStore) jobPrefix(tenantId string, jobId int) string {
+	return url.PathEscape(tenantId) + "/" + strconv.Itoa(jobId) + "/"
+}
+
+// PutArtifact spools content to a temporary file, a signed request needs the length and the hash of its body.
+func (s *S3ArtifactStore) PutArtifact(ctx context.Context, tenantId string, jobId int, name string, content io.Reader) (Artifact, error) {
+	if err := ValidateArtifactName(name); err != nil {
+		return Artifact{}, err
+	}
+
+	file, err := os.CreateTemp("", ".artifact-*")
+	if err != nil {
+		return Artifact{}, err
+	}
+	defer os.Remove(file.Name())
+	defer file.Close()
+
+	hash := sha256.New()
+	size, err := io.Copy(io.MultiWriter(file, hash), content)
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return Artifact{}, err
+	}
+
+	artifact := Artifact{
+		Name:        name,
+		Size:        size,
+		ContentType: artifactContentType(name),
+		CreatedAt:   s.clock.Now(),
+	}
+
+	req, err := s.newRequest(ctx, http.MethodPut, s.jobPrefix(tenantId, jobId)+name, nil, io.NopCloser(file), hex.EncodeToString(hash.Sum(nil)))
+	if err != nil {
+		return Artifact{}, err
+	}
+
+	req.ContentLength = size
+	req.Header.Set("Content-Type", artifact.ContentType)
+
+	resp, err := s.do(req)
+	if err != nil {
+		return Artifact{}, err
+	}
+	resp.Body.Close()
+
+	return artifact, nil
+}
+
+type s3ListBucketResult struct {
+	Contents []struct {
+		Key          string    `xml:"Key"`
+		LastModified time.Time `xml:"LastModified"`
+		Size         int64     `xml:"Size"`
+	} `xml:"Contents"`
+	IsTruncated           bool   `xml:"IsTruncated"`
+	NextContinuationToken string `xml:"NextContinuationToken"`
+}
+
+// ListArtifacts reads the objects of the job with ListObjectsV2, the content types are guessed from the names.
+func (s *S3ArtifactStore) ListArtifacts(ctx context.Context, tenantId string, jobId int) ([]Artifact, error) {
+	prefix := s.jobPrefix(tenantId, jobId)
+
+	var result []Artifact
+	var token string
+	for {
+		query := url.Values{"list-type": {"2"}, "prefix": {prefix}}
+		if token != "" {
+			query.Set("continuation-token", token)
+		}
+
+		req, err := s.newRequest(ctx, http.MethodGet, "", query, nil, s3EmptyPayloadHash)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err := s.do(req)
+		if err != nil {
+			return nil, err
+		}
+
+		var list s3ListBucketResult
+		err = xml.NewDecoder(resp.Body).Decode(&list)
+		resp.Body.Close()
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode the objects of %s: %w", prefix, err)
+		}
+
+		for _, object := range list.Contents {
+			name := strings.TrimPrefix(object.Key, prefix)
+			if ValidateArtifactName(name) != nil {
+				continue
+			}
+
+			result = append(result, Artifact{
+				Name:        name,
+				Size:        object.Size,
+				ContentType: artifactContentType(name),
+				CreatedAt:   object.LastModified.UTC(),
+			})
+		}
+
+		if !list.IsTruncated || list.NextContinuationToken == "" {
+			break
+		}
+
+		token = list.NextContinuationToken
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func (s *S3ArtifactStore) OpenArtifact(ctx context.Context, tenantId string, jobId int, name string) (io.ReadCloser, Artifact, error) {
+	if err := ValidateArtifactName(name); err != nil {
+		return nil, Artifact{}, ErrArtifactNotFound
+	}
+
+	req, err := s.newRequest(ctx, http.MethodGet, s.jobPrefix(tenantId, jobId)+name, nil, nil, s3EmptyPayloadHash)
+	if err != nil {
+		return nil, Artifact{}, err
+	}
+
+	resp, err := s.do(req)
+	if err != nil {
+		return nil, Artifact{}, err
+	}
+
+	artifact := Artifact{
+		Name:        name,
+		Size:        resp.ContentLength,
+		ContentType: resp.Header.Get("Content-Type"),
+	}
+
+	if artifact.ContentType == "" {
+		artifact.ContentType = artifactContentType(name)
+	}
+
+	if lastModified, err := http.ParseTime(resp.Header.Get("Last-Modified")); err == nil {
+		artifact.CreatedAt = lastModified.UTC()
+	}
+
+	return resp.Body, artifact, nil
+}
+
+// DeleteArtifacts deletes the objects one by one, the batch delete of S3 requires a Content-MD5 header
+// which not every implementation agrees on.
+func (s *S3ArtifactStore) DeleteArtifacts(ctx context.Context, tenantId string, jobId int) (int, error) {
+	artifacts, err := s.ListArtifacts(ctx, tenantId, jobId)
+	if err != nil {
+		return 0, err
+	}
+
+	for i, artifact := range artifacts {
+		req, err := s.newRequest(ctx, http.MethodDelete, s.jobPrefix(tenantId, jobId)+artifact.Name, nil, nil, s3EmptyPayloadHash)
+		if err != nil {
+			return i, err
+		}
+
+		resp, err := s.do(req)
+		if err != nil {
+			return i, err
+		}
+		resp.Body.Close()
+	}
+
+	return len(artifacts), nil
+}
+
+// CreateBucket creates the bucket unless it exists. The bucket is usually created with the storage,
+// it is meant for the local setups and the tests.
+func (s *S3ArtifactStore) CreateBucket(ctx context.Context) error {
+	req, err := s.newRequest(ctx, http.MethodHead, "", nil, nil, s3EmptyPayloadHash)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+
+	var body []byte
+	if s.region != "" && s.region != "us-east-1" {
+		body = []byte(fmt.Sprintf(`<CreateBucketConfiguration xmlns="http://s3.amazonaws.com/doc/2006-03-01/"><LocationConstraint>%s</LocationConstraint></CreateBucketConfiguration>`, s.region))
+	}
+
+	hash := sha256.Sum256(body)
+	req, err = s.newRequest(ctx, http.MethodPut, "", nil, io.NopCloser(strings.NewReader(string(body))), hex.EncodeToString(hash[:]))
+	if err != nil {
+		return err
+	}
+
+	req.ContentLength = int64(len(body))
+	resp, err = s.do(req)
+	if err != nil {
+		return err
+	}
+
+	return resp.Body.Close()
+}
+
+// newRequest returns a signed request of the object key of the bucket, or of the bucket itself when key is empty.
+func (s *S3ArtifactStore) newRequest(ctx context.Context, method, key string, query url.Values, body io.ReadCloser, payloadHash string) (*http.Request, error) {
+	u := *s.endpoint
+	u.Path = strings.TrimSuffix(u.Path, "/") + "/" + s.bucket
+	if key != "" {
+		u.Path += "/" + key
+	}
+
+	u.RawPath = s3EscapePath(u.Path)
+	u.RawQuery = s3CanonicalQuery(query)
+
+	req, err := http.NewRequestWithContext(ctx, method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+
+	// http.NewRequest parses the URL again, it must keep the escaping of the signature
+	req.URL.RawPath = u.RawPath
+
+	s3SignV4(req, payloadHash, s.accessKey, s.secretKey, s.region, s.clock.Now())
+	return req, nil
+}
+
+// do sends req and turns the responses other than 2xx into errors, 404 being ErrArtifactNotFound.
+func (s *S3ArtifactStore) do(req *http.Request) (*http.Response, error) {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound && req.Method != http.MethodPut {
+		return nil, ErrArtifactNotFound
+	}
+
+	var s3Err struct {
+		Code    string `xml:"Code"`
+		Message string `xml:"Message"`
+	}
+	_ = xml.NewDecoder(io.LimitReader(resp.Body, 64*1024)).Decode(&s3Err)
+
+	return nil, fmt.Errorf("s3 %s %s failed with status %d: %s %s", req.Method, req.URL.Path, resp.StatusCode, s3Err.Code, s3Err.Message)
+}
+
+// s3SignV4 adds the headers of AWS Signature Version 4 to req, every header already set on req is signed.
+// See https://docs.aws.amazon.com/AmazonS3/latest/API/sig-v4-header-based-auth.html
+func s3SignV4(req *http.Request, payloadHash, accessKey, secretKey, region string, now time.Time) {
+	now = now.UTC()
+	req.Header.Set("X-Amz-Date", now.Format(s3TimeFormat))
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.Join(values, ",")
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + strings.TrimSpace(headers[name]) + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		payloadHash,
+	}, "\n")
+
+	scope := now.Format(s3DateFormat) + "/" + region + "/s3/aws4_request"
+	canonicalHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format(s3TimeFormat) + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	key := []byte("AWS4" + secretKey)
+	for _, part := range []string{now.Format(s3DateFormat), region, "s3", "aws4_request"} {
+		key = s3HMAC(key, part)
+	}
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		accessKey, scope, signedHeaders, hex.EncodeToString(s3HMAC(key, stringToSign))))
+}
+
+func s3HMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// s3EscapePath escapes every segment of path the way the signature expects, the slashes are kept.
+func s3EscapePath(path string) string {
+	segments := strings.Split(path, "/")
+	for i, segment := range segments {
+		segments[i] = s3Escape(segment)
+	}
+
+	return strings.Join(segments, "/")
+}
+
+// s3CanonicalQuery encodes query sorted by key, the way the signature expects.
+func s3CanonicalQuery(query url.Values) string {
+	keys := make([]string, 0, len(query))
+	for key := range query {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var pairs []string
+	for _, key := range keys {
+		for _, value := range query[key] {
+			pairs = append(pairs, s3Escape(key)+"="+s3Escape(value))
+		}
+	}
+
+	return strings.Join(pairs, "&")
+}
+
+// s3Escape percent-encodes every byte but the unreserved characters of RFC 3986.
+func s3Escape(value string) string {
+	var b strings.Builder
+	for i := 0; i < len(value); i++ {
+		c := value[i]
+		if 'A' <= c && c <= 'Z' || 'a' <= c && c <= 'z' || '0' <= c && c <= '9' || c == '-' || c == '.' || c == '_' || c == '~' {
+			b.WriteByte(c)
+			continue
+		}
+
+		fmt.Fprintf(&b, "%%%02X", c)
+	}
+
+	return b.String()
+}
@@ -0,0 +1,40 @@
+package jobs
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+)
+
+const adminContextKey = "admin"
+
+// AdminMiddleware authenticates operators of the admin API, apiKeys maps an admin key to the name of its owner.
+func AdminMiddleware(apiKeys map[string]string) echo.MiddlewareFunc {
+	return apiKeyMiddleware(apiKeys, adminContextKey)
+}
+
+// AdminFromContext returns the name of the operator resolved by AdminMiddleware.
+func AdminFromContext(ctx echo.Context) string {
+	admin, _ := ctx.Get(adminContextKey).(string)
+	return admin
+}
+
+// apiKeyMiddleware accepts requests whose key is in apiKeys and stores the value of the key in the context under contextKey.
+func apiKeyMiddleware(apiKeys map[string]string, contextKey string) echo.MiddlewareFunc {
+	return middleware.KeyAuthWithConfig(middleware.KeyAuthConfig{
+		KeyLookup: "header:X-API-Key,header:" + echo.HeaderAuthorization,
+		Validator: func(key string, ctx echo.Context) (bool, error) {
+			value, ok := apiKeys[key]
+			if !ok {
+				return false, nil
+			}
+
+			ctx.Set(contextKey, value)
+			return true, nil
+		},
+		ErrorHandler: func(err error, ctx echo.Context) error {
+			return echo.NewHTTPError(http.StatusUnauthorized, ErrUnauthorized.Error())
+		},
+	})
+}
@@ -0,0 +1,19 @@
+package jobs_test
+
+import (
+	"github.com/tuyentv96/hasty-challenge/jobs"
+	"github.com/tuyentv96/hasty-challenge/jobs/memory"
+)
+
+func init() {
+	jobs.UseMemoryBackends(func() jobs.Backends {
+		return jobs.Backends{
+			Store:         memory.NewStore(),
+			Broker:        memory.NewBroker("test"),
+			Transactioner: memory.NewTransactioner(),
+			JobLogs:       memory.NewJobLogStore(),
+			Workers:       memory.NewWorkerRegistry(),
+			Settings:      memory.NewSettingsStore(),
+		}
+	})
+}
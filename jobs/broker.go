@@ -0,0 +1,83 @@
+package jobs
+
+import (
+	"context"
+	"time"
+)
+
+// Delivery is a message consumed from a Queue, it stays unacked until the consumer acks, rejects or pushes it.
+type Delivery interface {
+	Payload() string
+	Ack() error
+	Reject() error
+	// Push puts the delivery back at the end of the ready deliveries of its queue for another attempt
+	Push() error
+	// Return puts the delivery back at the end of the ready deliveries of its queue, e.g. for a worker which can read it
+	Return() error
+}
+
+type QueueConsumer interface {
+	Consume(delivery Delivery)
+}
+
+// QueueConsumerFunc allows the use of ordinary functions as queue consumers.
+type QueueConsumerFunc func(delivery Delivery)
+
+func (f QueueConsumerFunc) Consume(delivery Delivery) {
+	f(delivery)
+}
+
+type Queue interface {
+	// Publish adds a message to the queue, brokers backed by the database publish in the transaction of ctx
+	Publish(ctx context.Context, payload []byte) error
+	// StartConsuming fetches up to prefetchLimit unacked deliveries every pollDuration
+	StartConsuming(prefetchLimit int64, pollDuration time.Duration) error
+	AddConsumer(tag string, consumer QueueConsumer) error
+	// StopConsuming stops fetching deliveries, the returned channel is closed once the consumers handled the fetched ones
+	StopConsuming() <-chan struct{}
+}
+
+type QueueStats struct {
+	Name string `json:"name"`
+	// Type, Priority and Paused are the job type and priority of the queue and whether it is paused, they are set by JobQueueAdmin
+	Type        string                 `json:"type,omitempty"`
+	Priority    string                 `json:"priority,omitempty"`
+	Paused      bool                   `json:"paused"`
+	Ready       int64                  `json:"ready"`
+	Rejected    int64                  `json:"rejected"`
+	Unacked     int64                  `json:"unacked"`
+	Consumers   int64                  `json:"consumers"`
+	Connections []QueueConnectionStats `json:"connections"`
+}
+
+type QueueConnectionStats struct {
+	Name      string   `json:"name"`
+	Active    bool     `json:"active"`
+	Unacked   int64    `json:"unacked"`
+	Consumers []string `json:"consumers"`
+}
+
+type ConnectionInfo struct {
+	Name   string   `json:"name"`
+	Active bool     `json:"active"`
+	Queues []string `json:"queues"`
+	// HeartbeatAge is the time since the last heartbeat in seconds, it is empty when the heartbeat expired
+	HeartbeatAge *float64 `json:"heartbeat_age"`
+}
+
+type QueueAdmin interface {
+	QueueStats(ctx context.Context) ([]QueueStats, error)
+	Connections(ctx context.Context) ([]ConnectionInfo, error)
+	PurgeReady(ctx context.Context, queue string) (int64, error)
+	PurgeRejected(ctx context.Context, queue string) (int64, error)
+	ReturnRejected(ctx context.Context, queue string, max int64) (int64, error)
+}
+
+// Broker opens the queues of a backend and operates them.
+type Broker interface {
+	QueueAdmin
+
+	OpenQueue(name string) (Queue, error)
+	// Clean moves the unacked deliveries of connections whose heartbeat expired back to ready
+	Clean(ctx context.Context) (int64, error)
+}
@@ -0,0 +1,497 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+const (
+	deliveryStatusReady    = "ready"
+	deliveryStatusUnacked  = "unacked"
+	deliveryStatusRejected = "rejected"
+
+	pgNow = "now()"
+
+	// A connection refreshes its heartbeat every few seconds, its unacked deliveries are cleaned once it expired
+	pgHeartbeatInterval = 5 * time.Second
+	pgHeartbeatTTL      = time.Minute
+)
+
+// PostgresBroker is a Broker storing queues in the job_queue table, so the service can run without Redis.
+// Consumers poll the table and fetch their deliveries with FOR UPDATE SKIP LOCKED. The deliveries are kept apart from
+// the jobs table, a Broker only carries payloads and a job has a message per attempt, besides the queues it moves across.
+type PostgresBroker struct {
+	db     *pg.DB
+	name   string
+	logger *logrus.Entry
+}
+
+func NewPostgresBroker(db *pg.DB, logger *logrus.Entry, tag string) *PostgresBroker {
+	return &PostgresBroker{
+		db:     db,
+		name:   fmt.Sprintf("%s-%s", tag, strconv.FormatInt(rand.Int63(), 36)),
+		logger: logger.WithField("tag", "postgres-broker"),
+	}
+}
+
+func (b *PostgresBroker) OpenQueue(name string) (Queue, error) {
+	return &PostgresQueue{
+		broker: b,
+		name:   name,
+	}, nil
+}
+
+type pgQueueCount struct {
+	Queue      string `pg:"queue"`
+	Status     string `pg:"status"`
+	Connection string `pg:"connection"`
+	Count      int64  `pg:"count"`
+}
+
+type pgQueueConsumers struct {
+	Connection   string   `pg:"connection"`
+	Queue        string   `pg:"queue"`
+	Consumers    []string `pg:"consumers,array"`
+	HeartbeatAge float64  `pg:"heartbeat_age"`
+}
+
+func (b *PostgresBroker) QueueStats(ctx context.Context) ([]QueueStats, error) {
+	var counts []pgQueueCount
+	_, err := b.db.WithContext(ctx).Query(&counts, `SELECT queue, status, coalesce(connection, '') AS connection, count(*) AS count
+		FROM job_queue GROUP BY queue, status, connection`)
+	if err != nil {
+		return nil, err
+	}
+
+	consumers, err := b.consumers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	queues := make(map[string]*QueueStats)
+	connections := make(map[string]map[string]*QueueConnectionStats)
+	queueStats := func(name string) *QueueStats {
+		if _, ok := queues[name]; !ok {
+			queues[name] = &QueueStats{Name: name, Connections: []QueueConnectionStats{}}
+			connections[name] = make(map[string]*QueueConnectionStats)
+		}
+
+		return queues[name]
+	}
+
+	for _, c := range consumers {
+		stats := queueStats(c.Queue)
+		stats.Consumers += int64(len(c.Consumers))
+		connections[c.Queue][c.Connection] = &QueueConnectionStats{
+			Name:      c.Connection,
+			Active:    c.HeartbeatAge < pgHeartbeatTTL.Seconds(),
+			Consumers: c.Consumers,
+		}
+	}
+
+	for _, count := range counts {
+		stats := queueStats(count.Queue)
+		switch count.Status {
+		case deliveryStatusReady:
+			stats.Ready += count.Count
+		case deliveryStatusRejected:
+			stats.Rejected += count.Count
+		case deliveryStatusUnacked:
+			stats.Unacked += count.Count
+
+			// deliveries of a connection which was cleaned up already
+			connection, ok := connections[count.Queue][count.Connection]
+			if !ok {
+				connection = &QueueConnectionStats{Name: count.Connection, Consumers: []string{}}
+				connections[count.Queue][count.Connection] = connection
+			}
+
+			connection.Unacked += count.Count
+		}
+	}
+
+	result := make([]QueueStats, 0, len(queues))
+	for name, stats := range queues {
+		for _, connection := range connections[name] {
+			stats.Connections = append(stats.Connections, *connection)
+		}
+
+		sort.Slice(stats.Connections, func(i, j int) bool {
+			return stats.Connections[i].Name < stats.Connections[j].Name
+		})
+
+		result = append(result, *stats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func (b *PostgresBroker) Connections(ctx context.Context) ([]ConnectionInfo, error) {
+	consumers, err := b.consumers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	connections := make(map[string]*ConnectionInfo)
+	for _, c := range consumers {
+		connection, ok := connections[c.Connection]
+		if !ok {
+			connection = &ConnectionInfo{Name: c.Connection, Queues: []string{}}
+			connections[c.Connection] = connection
+			names = append(names, c.Connection)
+		}
+
+		connection.Queues = append(connection.Queues, c.Queue)
+		if c.HeartbeatAge < pgHeartbeatTTL.Seconds() && (connection.HeartbeatAge == nil || c.HeartbeatAge < *connection.HeartbeatAge) {
+			age := c.HeartbeatAge
+			connection.Active = true
+			connection.HeartbeatAge = &age
+		}
+	}
+
+	sort.Strings(names)
+	result := make([]ConnectionInfo, 0, len(names))
+	for _, name := range names {
+		connection := connections[name]
+		sort.Strings(connection.Queues)
+		result = append(result, *connection)
+	}
+
+	return result, nil
+}
+
+func (b *PostgresBroker) consumers(ctx context.Context) ([]pgQueueConsumers, error) {
+	var consumers []pgQueueConsumers
+	_, err := b.db.WithContext(ctx).Query(&consumers, `SELECT connection, queue, consumers,
+		extract(epoch FROM `+pgNow+` - heartbeat_at) AS heartbeat_age
+		FROM job_queue_consumers`)
+	if err != nil {
+		return nil, err
+	}
+
+	return consumers, nil
+}
+
+func (b *PostgresBroker) PurgeReady(ctx context.Context, queue string) (int64, error) {
+	return b.purge(ctx, queue, deliveryStatusReady)
+}
+
+func (b *PostgresBroker) PurgeRejected(ctx context.Context, queue string) (int64, error) {
+	return b.purge(ctx, queue, deliveryStatusRejected)
+}
+
+func (b *PostgresBroker) purge(ctx context.Context, queue string, status string) (int64, error) {
+	if err := b.checkQueue(ctx, queue); err != nil {
+		return 0, err
+	}
+
+	result, err := b.db.WithContext(ctx).Exec(`DELETE FROM job_queue WHERE queue = ? AND status = ?`, queue, status)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(result.RowsAffected()), nil
+}
+
+func (b *PostgresBroker) ReturnRejected(ctx context.Context, queue string, max int64) (int64, error) {
+	if err := b.checkQueue(ctx, queue); err != nil {
+		return 0, err
+	}
+
+	result, err := b.db.WithContext(ctx).Exec(`UPDATE job_queue SET status = ? WHERE id IN (
+		SELECT id FROM job_queue WHERE queue = ? AND status = ? ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED
+	)`, deliveryStatusReady, queue, deliveryStatusRejected, max)
+	if err != nil {
+		return 0, err
+	}
+
+	return int64(result.RowsAffected()), nil
+}
+
+// checkQueue returns ErrQueueNotFound for a queue without deliveries nor consumers
+func (b *PostgresBroker) checkQueue(ctx context.Context, queue string) error {
+	var exists bool
+	_, err := b.db.WithContext(ctx).QueryOne(pg.Scan(&exists), `SELECT EXISTS (SELECT 1 FROM job_queue WHERE queue = ?)
+		OR EXISTS (SELECT 1 FROM job_queue_consumers WHERE queue = ?)`, queue, queue)
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrQueueNotFound
+	}
+
+	return nil
+}
+
+func (b *PostgresBroker) Clean(ctx context.Context) (int64, error) {
+	var returned int64
+	err := b.db.WithContext(ctx).RunInTransaction(func(tx *pg.Tx) error {
+		_, err := tx.Exec(`DELETE FROM job_queue_consumers WHERE heartbeat_at < `+pgNow+` - ? * interval '1 second'`, pgHeartbeatTTL.Seconds())
+		if err != nil {
+			return err
+		}
+
+		// unacked deliveries are owned by a registered connection until they are acked or rejected
+		result, err := tx.Exec(`UPDATE job_queue SET status = ?, connection = NULL WHERE status = ? AND NOT EXISTS (
+			SELECT 1 FROM job_queue_consumers c WHERE c.connection = job_queue.connection AND c.queue = job_queue.queue
+		)`, deliveryStatusReady, deliveryStatusUnacked)
+		if err != nil {
+			return err
+		}
+
+		returned = int64(result.RowsAffected())
+		return nil
+	})
+
+	return returned, err
+}
+
+type PostgresQueue struct {
+	broker *PostgresBroker
+	name   string
+
+	mu            sync.Mutex
+	consumers     []string
+	deliveries    chan Delivery
+	stop          chan struct{}
+	stopped       bool
+	prefetchLimit int64
+	pollDuration  time.Duration
+	// unacked counts the fetched deliveries which were not acked or rejected yet
+	unacked   int64
+	polling   sync.WaitGroup
+	consuming sync.WaitGroup
+}
+
+func (q *PostgresQueue) Publish(ctx context.Context, payload []byte) error {
+	_, err := utils.TransactionFromContext(ctx, q.broker.db).Exec(`INSERT INTO job_queue (queue, payload, status) VALUES (?, ?, ?)`,
+		q.name, string(payload), deliveryStatusReady)
+
+	return err
+}
+
+func (q *PostgresQueue) StartConsuming(prefetchLimit int64, pollDuration time.Duration) error {
+	q.mu.Lock()
+	if q.deliveries != nil {
+		q.mu.Unlock()
+		return ErrQueueConsuming
+	}
+
+	q.prefetchLimit = prefetchLimit
+	q.pollDuration = pollDuration
+	q.deliveries = make(chan Delivery, prefetchLimit)
+	q.stop = make(chan struct{})
+	q.mu.Unlock()
+
+	if err := q.heartbeat(); err != nil {
+		return err
+	}
+
+	q.polling.Add(2)
+	go q.poll()
+	go q.heartbeats()
+
+	return nil
+}
+
+func (q *PostgresQueue) AddConsumer(tag string, consumer QueueConsumer) error {
+	q.mu.Lock()
+	if q.deliveries == nil || q.stopped {
+		q.mu.Unlock()
+		return ErrQueueNotConsuming
+	}
+
+	q.consumers = append(q.consumers, tag)
+	deliveries := q.deliveries
+	q.consuming.Add(1)
+	q.mu.Unlock()
+
+	go func() {
+		defer q.consuming.Done()
+		for delivery := range deliveries {
+			consumer.Consume(delivery)
+		}
+	}()
+
+	return q.heartbeat()
+}
+
+func (q *PostgresQueue) StopConsuming() <-chan struct{} {
+	finished := make(chan struct{})
+
+	q.mu.Lock()
+	if q.deliveries == nil || q.stopped {
+		q.mu.Unlock()
+		close(finished)
+		return finished
+	}
+
+	q.stopped = true
+	close(q.stop)
+	q.mu.Unlock()
+
+	go func() {
+		// the poller closes the deliveries channel, consumers handle the fetched deliveries before returning
+		q.polling.Wait()
+		q.consuming.Wait()
+
+		_, err := q.broker.db.Exec(`DELETE FROM job_queue_consumers WHERE connection = ? AND queue = ?`, q.broker.name, q.name)
+		if err != nil {
+			q.broker.logger.WithError(err).Errorf("failed to unregister consumers of queue %s", q.name)
+		}
+
+		close(finished)
+	}()
+
+	return finished
+}
+
+func (q *PostgresQueue) poll() {
+	defer q.polling.Done()
+	defer close(q.deliveries)
+
+	for {
+		if batch := q.prefetchLimit - atomic.LoadInt64(&q.unacked); batch > 0 {
+			if err := q.fetch(batch); err != nil {
+				q.broker.logger.WithError(err).Errorf("failed to fetch deliveries of queue %s", q.name)
+			}
+		}
+
+		select {
+		case <-q.stop:
+			return
+		case <-time.After(q.pollDuration):
+		}
+	}
+}
+
+type pgDelivery struct {
+	Id      int64  `pg:"id"`
+	Payload string `pg:"payload"`
+}
+
+func (q *PostgresQueue) fetch(batch int64) error {
+	var deliveries []pgDelivery
+	_, err := q.broker.db.Query(&deliveries, `UPDATE job_queue SET status = ?, connection = ? WHERE id IN (
+		SELECT id FROM job_queue WHERE queue = ? AND status = ? ORDER BY id LIMIT ? FOR UPDATE SKIP LOCKED
+	) RETURNING id, payload`, deliveryStatusUnacked, q.broker.name, q.name, deliveryStatusReady, batch)
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(deliveries, func(i, j int) bool {
+		return deliveries[i].Id < deliveries[j].Id
+	})
+
+	for _, delivery := range deliveries {
+		atomic.AddInt64(&q.unacked, 1)
+		// the channel has room for prefetchLimit deliveries, so this never blocks
+		q.deliveries <- &PostgresDelivery{
+			queue:   q,
+			id:      delivery.Id,
+			payload: delivery.Payload,
+		}
+	}
+
+	return nil
+}
+
+func (q *PostgresQueue) heartbeats() {
+	defer q.polling.Done()
+
+	ticker := time.NewTicker(pgHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			if err := q.heartbeat(); err != nil {
+				q.broker.logger.WithError(err).Errorf("failed to refresh heartbeat of queue %s", q.name)
+			}
+		}
+	}
+}
+
+// heartbeat registers the consumers of the connection, it registers them again if a cleaner removed them.
+func (q *PostgresQueue) heartbeat() error {
+	q.mu.Lock()
+	consumers := make([]string, len(q.consumers))
+	copy(consumers, q.consumers)
+	q.mu.Unlock()
+
+	_, err := q.broker.db.Exec(`INSERT INTO job_queue_consumers (connection, queue, consumers, heartbeat_at) VALUES (?, ?, ?, `+pgNow+`)
+		ON CONFLICT (connection, queue) DO UPDATE SET consumers = EXCLUDED.consumers, heartbeat_at = EXCLUDED.heartbeat_at`,
+		q.broker.name, q.name, pg.Array(consumers))
+
+	return err
+}
+
+type PostgresDelivery struct {
+	queue   *PostgresQueue
+	id      int64
+	payload string
+	once    sync.Once
+}
+
+func (d *PostgresDelivery) Payload() string {
+	return d.payload
+}
+
+func (d *PostgresDelivery) Ack() error {
+	return d.settle(`DELETE FROM job_queue WHERE id = ? AND connection = ? AND status = ?`,
+		d.id, d.queue.broker.name, deliveryStatusUnacked)
+}
+
+func (d *PostgresDelivery) Reject() error {
+	return d.settle(`UPDATE job_queue SET status = ?, connection = NULL WHERE id = ? AND connection = ? AND status = ?`,
+		deliveryStatusRejected, d.id, d.queue.broker.name, deliveryStatusUnacked)
+}
+
+// Push returns the delivery, postgres queues have no push queue.
+func (d *PostgresDelivery) Push() error {
+	return d.Return()
+}
+
+// Return makes the delivery ready again with a new id, so it is consumed after the deliveries which are ready already.
+func (d *PostgresDelivery) Return() error {
+	return d.settle(`UPDATE job_queue SET status = ?, connection = NULL, id = nextval(pg_get_serial_sequence('job_queue', 'id'))
+		WHERE id = ? AND connection = ? AND status = ?`,
+		deliveryStatusReady, d.id, d.queue.broker.name, deliveryStatusUnacked)
+}
+
+// settle releases the delivery, ErrDeliveryNotFound means a cleaner returned it to the queue in the meantime.
+func (d *PostgresDelivery) settle(query string, params ...interface{}) error {
+	d.once.Do(func() {
+		atomic.AddInt64(&d.queue.unacked, -1)
+	})
+
+	result, err := d.queue.broker.db.Exec(query, params...)
+	if err != nil {
+		return err
+	}
+
+	if result.RowsAffected() == 0 {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
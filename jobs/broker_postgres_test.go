@@ -0,0 +1,203 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findQueueStats(t *testing.T, broker Broker, queueName string) QueueStats {
+	stats, err := broker.QueueStats(context.Background())
+	require.NoError(t, err)
+
+	for _, s := range stats {
+		if s.Name == queueName {
+			return s
+		}
+	}
+
+	return QueueStats{}
+}
+
+func TestPostgresBrokerConsume(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	broker := NewPostgresBroker(testDb, testLogger, "test")
+	queueName := gofakeit.UUID()
+	queue, err := broker.OpenQueue(queueName)
+	require.NoError(t, err)
+
+	for _, payload := range []string{"ack", "reject", "push"} {
+		require.NoError(t, queue.Publish(ctx, []byte(payload)))
+	}
+
+	stat := findQueueStats(t, broker, queueName)
+	assert.Equal(t, int64(3), stat.Ready)
+
+	require.NoError(t, queue.StartConsuming(10, 10*time.Millisecond))
+
+	consumed := make(chan string, 3)
+	err = queue.AddConsumer("test", QueueConsumerFunc(func(delivery Delivery) {
+		switch delivery.Payload() {
+		case "ack":
+			require.NoError(t, delivery.Ack())
+		case "reject":
+			require.NoError(t, delivery.Reject())
+		case "push":
+			require.NoError(t, delivery.Push())
+		}
+
+		consumed <- delivery.Payload()
+	}))
+	require.NoError(t, err)
+
+	// deliveries are consumed in publishing order
+	for _, payload := range []string{"ack", "reject", "push"} {
+		assert.Equal(t, payload, <-consumed)
+	}
+
+	stat = findQueueStats(t, broker, queueName)
+	assert.Equal(t, int64(0), stat.Ready)
+	assert.Equal(t, int64(0), stat.Unacked)
+	assert.Equal(t, int64(2), stat.Rejected)
+	assert.Equal(t, int64(1), stat.Consumers)
+	require.Len(t, stat.Connections, 1)
+	assert.True(t, stat.Connections[0].Active)
+	assert.Equal(t, []string{"test"}, stat.Connections[0].Consumers)
+
+	connections, err := broker.Connections(ctx)
+	require.NoError(t, err)
+	var connection ConnectionInfo
+	for _, c := range connections {
+		if c.Name == broker.name {
+			connection = c
+		}
+	}
+
+	assert.True(t, connection.Active)
+	assert.Equal(t, []string{queueName}, connection.Queues)
+	require.NotNil(t, connection.HeartbeatAge)
+	assert.Less(t, *connection.HeartbeatAge, pgHeartbeatTTL.Seconds())
+
+	<-queue.StopConsuming()
+
+	t.Run("stop consuming unregisters the consumers", func(t *testing.T) {
+		stat := findQueueStats(t, broker, queueName)
+		assert.Equal(t, int64(0), stat.Consumers)
+		assert.Empty(t, stat.Connections)
+	})
+
+	t.Run("return rejected deliveries", func(t *testing.T) {
+		count, err := broker.ReturnRejected(ctx, queueName, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		stat := findQueueStats(t, broker, queueName)
+		assert.Equal(t, int64(1), stat.Ready)
+		assert.Equal(t, int64(1), stat.Rejected)
+	})
+
+	t.Run("purge deliveries", func(t *testing.T) {
+		count, err := broker.PurgeReady(ctx, queueName)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		count, err = broker.PurgeRejected(ctx, queueName)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("unknown queue", func(t *testing.T) {
+		_, err := broker.PurgeReady(ctx, gofakeit.UUID())
+		assert.Equal(t, ErrQueueNotFound, err)
+	})
+}
+
+func TestPostgresBrokerSkipLocked(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	queueName := gofakeit.UUID()
+	first, err := NewPostgresBroker(testDb, testLogger, "first").OpenQueue(queueName)
+	require.NoError(t, err)
+	second, err := NewPostgresBroker(testDb, testLogger, "second").OpenQueue(queueName)
+	require.NoError(t, err)
+
+	for i := 0; i < 20; i++ {
+		require.NoError(t, first.Publish(ctx, []byte(gofakeit.UUID())))
+	}
+
+	consumed := make(chan string, 20)
+	consumer := QueueConsumerFunc(func(delivery Delivery) {
+		require.NoError(t, delivery.Ack())
+		consumed <- delivery.Payload()
+	})
+
+	for _, queue := range []Queue{first, second} {
+		require.NoError(t, queue.StartConsuming(2, 10*time.Millisecond))
+		require.NoError(t, queue.AddConsumer("test", consumer))
+	}
+
+	payloads := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		payload := <-consumed
+		assert.False(t, payloads[payload], "delivery was consumed twice")
+		payloads[payload] = true
+	}
+
+	<-first.StopConsuming()
+	<-second.StopConsuming()
+}
+
+func TestPostgresBrokerPublishInTransaction(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	broker := NewPostgresBroker(testDb, testLogger, "test")
+	queueName := gofakeit.UUID()
+	queue, err := broker.OpenQueue(queueName)
+	require.NoError(t, err)
+
+	errRollback := errors.New("rollback")
+	err = testTransaction.RunWithTransaction(ctx, func(ctx context.Context) error {
+		require.NoError(t, queue.Publish(ctx, []byte("a")))
+		return errRollback
+	})
+	require.Equal(t, errRollback, err)
+
+	_, err = broker.PurgeReady(ctx, queueName)
+	assert.Equal(t, ErrQueueNotFound, err)
+}
+
+func TestPostgresBrokerClean(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	broker := NewPostgresBroker(testDb, testLogger, "test")
+	queueName := gofakeit.UUID()
+	queue, err := broker.OpenQueue(queueName)
+	require.NoError(t, err)
+	require.NoError(t, queue.Publish(ctx, []byte("a")))
+
+	// a connection which died while its delivery was unacked
+	_, err = testDb.Exec(`UPDATE job_queue SET status = ?, connection = ? WHERE queue = ?`, deliveryStatusUnacked, "dead", queueName)
+	require.NoError(t, err)
+	_, err = testDb.Exec(`INSERT INTO job_queue_consumers (connection, queue, heartbeat_at) VALUES (?, ?, `+pgNow+` - interval '2 minutes')`, "dead", queueName)
+	require.NoError(t, err)
+
+	stat := findQueueStats(t, broker, queueName)
+	assert.Equal(t, int64(1), stat.Unacked)
+	require.Len(t, stat.Connections, 1)
+	assert.False(t, stat.Connections[0].Active)
+
+	returned, err := broker.Clean(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, returned, int64(1))
+
+	stat = findQueueStats(t, broker, queueName)
+	assert.Equal(t, int64(1), stat.Ready)
+	assert.Equal(t, int64(0), stat.Unacked)
+	assert.Empty(t, stat.Connections)
+}
@@ -0,0 +1,284 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/adjust/rmq/v5"
+	"github.com/go-redis/redis/v8"
+)
+
+// Redis keys maintained by rmq, see github.com/adjust/rmq/v5/redis_keys.go.
+// rmq only exposes queue level counters, per connection details are read from these keys.
+const (
+	rmqConnectionsKey             = "rmq::connections"
+	rmqConnectionHeartbeatKey     = "rmq::connection::{connection}::heartbeat"
+	rmqConnectionQueuesKey        = "rmq::connection::{connection}::queues"
+	rmqConnectionQueueConsumerKey = "rmq::connection::{connection}::queue::[{queue}]::consumers"
+	rmqConnectionQueueUnackedKey  = "rmq::connection::{connection}::queue::[{queue}]::unacked"
+
+	// rmq refreshes the heartbeat of a connection every second with a TTL of a minute
+	rmqHeartbeatTTL = time.Minute
+)
+
+// RmqBroker is a Broker storing queues in Redis with rmq.
+type RmqBroker struct {
+	connection rmq.Connection
+	client     *redis.Client
+	cleaner    *rmq.Cleaner
+}
+
+func NewRmqBroker(connection rmq.Connection, client *redis.Client) *RmqBroker {
+	return &RmqBroker{
+		connection: connection,
+		client:     client,
+		cleaner:    rmq.NewCleaner(connection),
+	}
+}
+
+func (r *RmqBroker) OpenQueue(name string) (Queue, error) {
+	queue, err := r.connection.OpenQueue(name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RmqQueue{queue: queue}, nil
+}
+
+func (r *RmqBroker) Clean(ctx context.Context) (int64, error) {
+	return r.cleaner.Clean()
+}
+
+func (r *RmqBroker) QueueStats(ctx context.Context) ([]QueueStats, error) {
+	queues, err := r.connection.GetOpenQueues()
+	if err != nil {
+		return nil, err
+	}
+
+	stats, err := r.connection.CollectStats(queues)
+	if err != nil {
+		return nil, err
+	}
+
+	connections, err := r.Connections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]QueueStats, 0, len(queues))
+	for _, name := range queues {
+		stat := stats.QueueStats[name]
+		queueStats := QueueStats{
+			Name:        name,
+			Ready:       stat.ReadyCount,
+			Rejected:    stat.RejectedCount,
+			Unacked:     stat.UnackedCount(),
+			Consumers:   stat.ConsumerCount(),
+			Connections: []QueueConnectionStats{},
+		}
+
+		for _, connection := range connections {
+			if !containsString(connection.Queues, name) {
+				continue
+			}
+
+			connectionStats, err := r.queueConnectionStats(ctx, connection, name)
+			if err != nil {
+				return nil, err
+			}
+
+			queueStats.Connections = append(queueStats.Connections, connectionStats)
+		}
+
+		result = append(result, queueStats)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+
+	return result, nil
+}
+
+func (r *RmqBroker) queueConnectionStats(ctx context.Context, connection ConnectionInfo, queue string) (QueueConnectionStats, error) {
+	consumers, err := r.client.SMembers(ctx, rmqKey(rmqConnectionQueueConsumerKey, connection.Name, queue)).Result()
+	if err != nil {
+		return QueueConnectionStats{}, err
+	}
+
+	unacked, err := r.client.LLen(ctx, rmqKey(rmqConnectionQueueUnackedKey, connection.Name, queue)).Result()
+	if err != nil {
+		return QueueConnectionStats{}, err
+	}
+
+	sort.Strings(consumers)
+	return QueueConnectionStats{
+		Name:      connection.Name,
+		Active:    connection.Active,
+		Unacked:   unacked,
+		Consumers: consumers,
+	}, nil
+}
+
+func (r *RmqBroker) Connections(ctx context.Context) ([]ConnectionInfo, error) {
+	return redisConnections(ctx, r.client, rmqConnectionsKey, rmqConnectionHeartbeatKey, rmqConnectionQueuesKey, rmqHeartbeatTTL)
+}
+
+// redisConnections reads the connections registered in the connectionsKey set, with their heartbeat and queues keys.
+func redisConnections(ctx context.Context, client *redis.Client, connectionsKey, heartbeatKey, queuesKey string, heartbeatTTL time.Duration) ([]ConnectionInfo, error) {
+	names, err := client.SMembers(ctx, connectionsKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(names)
+	connections := make([]ConnectionInfo, 0, len(names))
+	for _, name := range names {
+		ttl, err := client.TTL(ctx, rmqKey(heartbeatKey, name, "")).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		queues, err := client.SMembers(ctx, rmqKey(queuesKey, name, "")).Result()
+		if err != nil {
+			return nil, err
+		}
+
+		sort.Strings(queues)
+		connection := ConnectionInfo{
+			Name:   name,
+			Queues: queues,
+		}
+
+		// TTL is negative when the heartbeat key does not exist
+		if ttl > 0 {
+			age := (heartbeatTTL - ttl).Seconds()
+			connection.Active = true
+			connection.HeartbeatAge = &age
+		}
+
+		connections = append(connections, connection)
+	}
+
+	return connections, nil
+}
+
+// CheckHeartbeat fails once the heartbeat of the connection of the process expired, e.g. after too many Redis errors
+// rmq stops consuming and the cleaner of another worker may return the unacked deliveries to ready.
+func (r *RmqBroker) CheckHeartbeat(ctx context.Context) error {
+	name := fmt.Sprint(r.connection)
+	ttl, err := r.client.TTL(ctx, rmqKey(rmqConnectionHeartbeatKey, name, "")).Result()
+	if err != nil {
+		return err
+	}
+
+	// TTL is negative when the heartbeat key does not exist
+	if ttl <= 0 {
+		return fmt.Errorf("%w: %s", ErrHeartbeatExpired, name)
+	}
+
+	return nil
+}
+
+func (r *RmqBroker) PurgeReady(ctx context.Context, queue string) (int64, error) {
+	q, err := r.openQueue(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	return q.PurgeReady()
+}
+
+func (r *RmqBroker) PurgeRejected(ctx context.Context, queue string) (int64, error) {
+	q, err := r.openQueue(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	return q.PurgeRejected()
+}
+
+func (r *RmqBroker) ReturnRejected(ctx context.Context, queue string, max int64) (int64, error) {
+	q, err := r.openQueue(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	return q.ReturnRejected(max)
+}
+
+// openQueue opens an existing queue, opening an unknown name would create a new queue.
+func (r *RmqBroker) openQueue(name string) (rmq.Queue, error) {
+	queues, err := r.connection.GetOpenQueues()
+	if err != nil {
+		return nil, err
+	}
+
+	if !containsString(queues, name) {
+		return nil, ErrQueueNotFound
+	}
+
+	return r.connection.OpenQueue(name)
+}
+
+func rmqKey(template, connection, queue string) string {
+	key := strings.Replace(template, "{connection}", connection, 1)
+	return strings.Replace(key, "{queue}", queue, 1)
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}
+
+type RmqQueue struct {
+	queue rmq.Queue
+}
+
+func (q *RmqQueue) Publish(ctx context.Context, payload []byte) error {
+	return q.queue.PublishBytes(payload)
+}
+
+func (q *RmqQueue) StartConsuming(prefetchLimit int64, pollDuration time.Duration) error {
+	return q.queue.StartConsuming(prefetchLimit, pollDuration)
+}
+
+func (q *RmqQueue) AddConsumer(tag string, consumer QueueConsumer) error {
+	_, err := q.queue.AddConsumerFunc(tag, func(delivery rmq.Delivery) {
+		consumer.Consume(&RmqDelivery{Delivery: delivery, queue: q.queue})
+	})
+
+	return err
+}
+
+func (q *RmqQueue) StopConsuming() <-chan struct{} {
+	return q.queue.StopConsuming()
+}
+
+type RmqDelivery struct {
+	rmq.Delivery
+	queue rmq.Queue
+}
+
+// Push returns the delivery, the rmq queues are opened without a push queue.
+func (d *RmqDelivery) Push() error {
+	return d.Return()
+}
+
+// Return publishes the payload again and acks the delivery, rmq cannot move a single delivery back to ready.
+// A failed ack leaves the delivery unacked besides its copy, the consumers skip the jobs which are no longer queued.
+func (d *RmqDelivery) Return() error {
+	if err := d.queue.PublishBytes([]byte(d.Payload())); err != nil {
+		return err
+	}
+
+	return d.Ack()
+}
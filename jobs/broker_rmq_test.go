@@ -0,0 +1,79 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRmqBrokerQueueStats(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	queueName := gofakeit.UUID()
+	queue := initTestQueue(t, queueName)
+	admin := NewRmqBroker(testRmqConnection, testRedisClient)
+
+	require.NoError(t, queue.Publish(ctx, []byte("a")))
+
+	require.NoError(t, queue.StartConsuming(1, 10*time.Millisecond))
+	defer func() {
+		<-queue.StopConsuming()
+	}()
+
+	consumed := make(chan bool, 1)
+	err := queue.AddConsumer("test", QueueConsumerFunc(func(delivery Delivery) {
+		delivery.Reject()
+		consumed <- true
+	}))
+	require.NoError(t, err)
+	<-consumed
+
+	stats, err := admin.QueueStats(ctx)
+	require.NoError(t, err)
+
+	var stat QueueStats
+	for _, s := range stats {
+		if s.Name == queueName {
+			stat = s
+		}
+	}
+
+	require.Equal(t, queueName, stat.Name)
+	assert.Equal(t, int64(1), stat.Rejected)
+	assert.Equal(t, int64(1), stat.Consumers)
+	require.Len(t, stat.Connections, 1)
+	assert.True(t, stat.Connections[0].Active)
+	assert.Len(t, stat.Connections[0].Consumers, 1)
+
+	t.Run("return rejected deliveries", func(t *testing.T) {
+		count, err := admin.ReturnRejected(ctx, queueName, 10)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+	})
+
+	t.Run("unknown queue", func(t *testing.T) {
+		_, err := admin.PurgeReady(ctx, gofakeit.UUID())
+		assert.Equal(t, ErrQueueNotFound, err)
+	})
+}
+
+func TestRmqBrokerConnections(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	admin := NewRmqBroker(testRmqConnection, testRedisClient)
+
+	connections, err := admin.Connections(ctx)
+	require.NoError(t, err)
+	require.NotEmpty(t, connections)
+
+	for _, connection := range connections {
+		if connection.Active {
+			require.NotNil(t, connection.HeartbeatAge)
+			assert.Less(t, *connection.HeartbeatAge, rmqHeartbeatTTL.Seconds())
+		}
+	}
+}
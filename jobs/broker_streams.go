@@ -0,0 +1,705 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+	"github.com/sirupsen/logrus"
+)
+
+// Redis keys of the streams broker, they follow the layout of the rmq keys so both brokers can share a Redis.
+const (
+	streamsConnectionsKey             = "streams::connections"
+	streamsConnectionHeartbeatKey     = "streams::connection::{connection}::heartbeat"
+	streamsConnectionQueuesKey        = "streams::connection::{connection}::queues"
+	streamsConnectionQueueConsumerKey = "streams::connection::{connection}::queue::[{queue}]::consumers"
+	streamsQueuesKey                  = "streams::queues"
+	streamsQueueKey                   = "streams::queue::[{queue}]"
+	streamsQueueRejectedKey           = "streams::queue::[{queue}]::rejected"
+
+	// streamsGroup is the consumer group of every queue, each connection is a consumer of the group
+	streamsGroup        = "workers"
+	streamsPayloadField = "payload"
+
+	streamsHeartbeatInterval = 5 * time.Second
+	streamsHeartbeatTTL      = time.Minute
+	// streamsClaimIdle is how long a delivery stays pending before another connection claims it with XAUTOCLAIM.
+	// Connections refresh the idle time of their deliveries with their heartbeat, so only deliveries of dead ones are claimed.
+	streamsClaimIdle = time.Minute
+)
+
+var (
+	// streamsAckScript deletes the entry once it is acked, so the length of the stream only counts ready and unacked entries
+	streamsAckScript = redis.NewScript(`
+		local acked = redis.call('XACK', KEYS[1], ARGV[1], ARGV[2])
+		if acked == 1 then
+			redis.call('XDEL', KEYS[1], ARGV[2])
+		end
+		return acked
+	`)
+
+	streamsRejectScript = redis.NewScript(`
+		local acked = redis.call('XACK', KEYS[1], ARGV[1], ARGV[2])
+		if acked == 1 then
+			redis.call('XDEL', KEYS[1], ARGV[2])
+			redis.call('LPUSH', KEYS[2], ARGV[3])
+		end
+		return acked
+	`)
+
+	// streamsReturnScript adds the entry again, a pending entry cannot be delivered to the group again
+	streamsReturnScript = redis.NewScript(`
+		local acked = redis.call('XACK', KEYS[1], ARGV[1], ARGV[2])
+		if acked == 1 then
+			redis.call('XDEL', KEYS[1], ARGV[2])
+			redis.call('XADD', KEYS[1], '*', ARGV[3], ARGV[4])
+		end
+		return acked
+	`)
+
+	streamsReturnRejectedScript = redis.NewScript(`
+		local count = 0
+		while count < tonumber(ARGV[1]) do
+			local payload = redis.call('RPOP', KEYS[2])
+			if not payload then
+				break
+			end
+
+			redis.call('XADD', KEYS[1], '*', ARGV[2], payload)
+			count = count + 1
+		end
+		return count
+	`)
+
+	// streamsPurgeReadyScript deletes the entries which were not delivered to the group yet
+	streamsPurgeReadyScript = redis.NewScript(`
+		local last = '0-0'
+		for _, group in ipairs(redis.call('XINFO', 'GROUPS', KEYS[1])) do
+			local info = {}
+			for i = 1, #group, 2 do
+				info[group[i]] = group[i + 1]
+			end
+
+			if info['name'] == ARGV[1] then
+				last = info['last-delivered-id']
+			end
+		end
+
+		local count = 0
+		while true do
+			local entries = redis.call('XRANGE', KEYS[1], '(' .. last, '+', 'COUNT', 100)
+			if #entries == 0 then
+				break
+			end
+
+			for _, entry in ipairs(entries) do
+				redis.call('XDEL', KEYS[1], entry[1])
+				last = entry[1]
+			end
+			count = count + #entries
+		end
+		return count
+	`)
+)
+
+// RedisStreamBroker is a Broker storing queues in Redis Streams.
+// Consumers block on XREADGROUP instead of polling and recover the deliveries of dead connections with XAUTOCLAIM,
+// which requires Redis 6.2.
+type RedisStreamBroker struct {
+	client    *redis.Client
+	name      string
+	logger    *logrus.Entry
+	claimIdle time.Duration
+}
+
+func NewRedisStreamBroker(client *redis.Client, logger *logrus.Entry, tag string) *RedisStreamBroker {
+	return &RedisStreamBroker{
+		client:    client,
+		name:      fmt.Sprintf("%s-%s", tag, strconv.FormatInt(rand.Int63(), 36)),
+		logger:    logger.WithField("tag", "streams-broker"),
+		claimIdle: streamsClaimIdle,
+	}
+}
+
+func (b *RedisStreamBroker) OpenQueue(name string) (Queue, error) {
+	ctx := context.Background()
+	if err := b.client.SAdd(ctx, streamsQueuesKey, name).Err(); err != nil {
+		return nil, err
+	}
+
+	err := b.client.XGroupCreateMkStream(ctx, rmqKey(streamsQueueKey, "", name), streamsGroup, "0").Err()
+	if err != nil && !strings.HasPrefix(err.Error(), "BUSYGROUP") {
+		return nil, err
+	}
+
+	return &RedisStreamQueue{
+		broker: b,
+		name:   name,
+		stream: rmqKey(streamsQueueKey, "", name),
+	}, nil
+}
+
+func (b *RedisStreamBroker) QueueStats(ctx context.Context) ([]QueueStats, error) {
+	queues, err := b.client.SMembers(ctx, streamsQueuesKey).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	connections, err := b.Connections(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Strings(queues)
+	result := make([]QueueStats, 0, len(queues))
+	for _, name := range queues {
+		stats, err := b.queueStats(ctx, name, connections)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, stats)
+	}
+
+	return result, nil
+}
+
+func (b *RedisStreamBroker) queueStats(ctx context.Context, name string, connections []ConnectionInfo) (QueueStats, error) {
+	stream := rmqKey(streamsQueueKey, "", name)
+	length, err := b.client.XLen(ctx, stream).Result()
+	if err != nil {
+		return QueueStats{}, err
+	}
+
+	pending, err := b.client.XPending(ctx, stream, streamsGroup).Result()
+	if err != nil {
+		return QueueStats{}, err
+	}
+
+	rejected, err := b.client.LLen(ctx, rmqKey(streamsQueueRejectedKey, "", name)).Result()
+	if err != nil {
+		return QueueStats{}, err
+	}
+
+	stats := QueueStats{
+		Name:        name,
+		Ready:       length - pending.Count,
+		Rejected:    rejected,
+		Unacked:     pending.Count,
+		Connections: []QueueConnectionStats{},
+	}
+
+	registered := make(map[string]bool)
+	for _, connection := range connections {
+		if !containsString(connection.Queues, name) {
+			continue
+		}
+
+		consumers, err := b.client.SMembers(ctx, rmqKey(streamsConnectionQueueConsumerKey, connection.Name, name)).Result()
+		if err != nil {
+			return QueueStats{}, err
+		}
+
+		sort.Strings(consumers)
+		registered[connection.Name] = true
+		stats.Consumers += int64(len(consumers))
+		stats.Connections = append(stats.Connections, QueueConnectionStats{
+			Name:      connection.Name,
+			Active:    connection.Active,
+			Unacked:   pending.Consumers[connection.Name],
+			Consumers: consumers,
+		})
+	}
+
+	// deliveries of a connection which was cleaned up already, they are claimed by the other connections
+	for consumer, count := range pending.Consumers {
+		if !registered[consumer] {
+			stats.Connections = append(stats.Connections, QueueConnectionStats{
+				Name:      consumer,
+				Unacked:   count,
+				Consumers: []string{},
+			})
+		}
+	}
+
+	sort.Slice(stats.Connections, func(i, j int) bool {
+		return stats.Connections[i].Name < stats.Connections[j].Name
+	})
+
+	return stats, nil
+}
+
+func (b *RedisStreamBroker) Connections(ctx context.Context) ([]ConnectionInfo, error) {
+	return redisConnections(ctx, b.client, streamsConnectionsKey, streamsConnectionHeartbeatKey, streamsConnectionQueuesKey, streamsHeartbeatTTL)
+}
+
+func (b *RedisStreamBroker) PurgeReady(ctx context.Context, queue string) (int64, error) {
+	if err := b.checkQueue(ctx, queue); err != nil {
+		return 0, err
+	}
+
+	return streamsPurgeReadyScript.Run(ctx, b.client, []string{rmqKey(streamsQueueKey, "", queue)}, streamsGroup).Int64()
+}
+
+func (b *RedisStreamBroker) PurgeRejected(ctx context.Context, queue string) (int64, error) {
+	if err := b.checkQueue(ctx, queue); err != nil {
+		return 0, err
+	}
+
+	key := rmqKey(streamsQueueRejectedKey, "", queue)
+	pipe := b.client.TxPipeline()
+	count := pipe.LLen(ctx, key)
+	pipe.Del(ctx, key)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, err
+	}
+
+	return count.Val(), nil
+}
+
+func (b *RedisStreamBroker) ReturnRejected(ctx context.Context, queue string, max int64) (int64, error) {
+	if err := b.checkQueue(ctx, queue); err != nil {
+		return 0, err
+	}
+
+	keys := []string{rmqKey(streamsQueueKey, "", queue), rmqKey(streamsQueueRejectedKey, "", queue)}
+	return streamsReturnRejectedScript.Run(ctx, b.client, keys, max, streamsPayloadField).Int64()
+}
+
+func (b *RedisStreamBroker) checkQueue(ctx context.Context, queue string) error {
+	exists, err := b.client.SIsMember(ctx, streamsQueuesKey, queue).Result()
+	if err != nil {
+		return err
+	}
+
+	if !exists {
+		return ErrQueueNotFound
+	}
+
+	return nil
+}
+
+// Clean unregisters the connections whose heartbeat expired. Their unacked deliveries are not moved here,
+// the consumers of the queue claim them with XAUTOCLAIM once they are idle for claimIdle, so Clean always returns 0.
+func (b *RedisStreamBroker) Clean(ctx context.Context) (int64, error) {
+	connections, err := b.Connections(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, connection := range connections {
+		if connection.Active {
+			continue
+		}
+
+		for _, queue := range connection.Queues {
+			if err := b.removeConsumer(ctx, connection.Name, queue); err != nil {
+				return 0, err
+			}
+		}
+
+		pipe := b.client.TxPipeline()
+		pipe.Del(ctx, rmqKey(streamsConnectionQueuesKey, connection.Name, ""))
+		pipe.SRem(ctx, streamsConnectionsKey, connection.Name)
+		if _, err := pipe.Exec(ctx); err != nil {
+			return 0, err
+		}
+	}
+
+	return 0, nil
+}
+
+// removeConsumer deletes the consumer of a dead connection from the group, unless it still owns deliveries to be claimed.
+func (b *RedisStreamBroker) removeConsumer(ctx context.Context, connection, queue string) error {
+	if err := b.client.Del(ctx, rmqKey(streamsConnectionQueueConsumerKey, connection, queue)).Err(); err != nil {
+		return err
+	}
+
+	stream := rmqKey(streamsQueueKey, "", queue)
+	pending, err := b.client.XPending(ctx, stream, streamsGroup).Result()
+	if err != nil {
+		return err
+	}
+
+	if pending.Consumers[connection] > 0 {
+		return nil
+	}
+
+	return b.client.XGroupDelConsumer(ctx, stream, streamsGroup, connection).Err()
+}
+
+type RedisStreamQueue struct {
+	broker *RedisStreamBroker
+	name   string
+	stream string
+
+	mu            sync.Mutex
+	consumers     []string
+	deliveries    chan Delivery
+	stop          chan struct{}
+	stopped       bool
+	prefetchLimit int64
+	pollDuration  time.Duration
+	// unacked holds the ids of the fetched deliveries which were not acked or rejected yet
+	unacked     map[string]bool
+	unackedSize int64
+	claimCursor string
+	polling     sync.WaitGroup
+	consuming   sync.WaitGroup
+}
+
+func (q *RedisStreamQueue) Publish(ctx context.Context, payload []byte) error {
+	return q.broker.client.XAdd(ctx, &redis.XAddArgs{
+		Stream: q.stream,
+		Values: map[string]interface{}{streamsPayloadField: string(payload)},
+	}).Err()
+}
+
+func (q *RedisStreamQueue) StartConsuming(prefetchLimit int64, pollDuration time.Duration) error {
+	q.mu.Lock()
+	if q.deliveries != nil {
+		q.mu.Unlock()
+		return ErrQueueConsuming
+	}
+
+	q.prefetchLimit = prefetchLimit
+	q.pollDuration = pollDuration
+	q.deliveries = make(chan Delivery, prefetchLimit)
+	q.stop = make(chan struct{})
+	q.unacked = make(map[string]bool)
+	q.claimCursor = "0-0"
+	q.mu.Unlock()
+
+	ctx := context.Background()
+	pipe := q.broker.client.TxPipeline()
+	pipe.SAdd(ctx, streamsConnectionsKey, q.broker.name)
+	pipe.SAdd(ctx, rmqKey(streamsConnectionQueuesKey, q.broker.name, ""), q.name)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return err
+	}
+
+	if err := q.heartbeat(); err != nil {
+		return err
+	}
+
+	q.polling.Add(2)
+	go q.poll()
+	go q.heartbeats()
+
+	return nil
+}
+
+func (q *RedisStreamQueue) AddConsumer(tag string, consumer QueueConsumer) error {
+	q.mu.Lock()
+	if q.deliveries == nil || q.stopped {
+		q.mu.Unlock()
+		return ErrQueueNotConsuming
+	}
+
+	q.consumers = append(q.consumers, tag)
+	deliveries := q.deliveries
+	q.consuming.Add(1)
+	q.mu.Unlock()
+
+	go func() {
+		defer q.consuming.Done()
+		for delivery := range deliveries {
+			consumer.Consume(delivery)
+		}
+	}()
+
+	return q.broker.client.SAdd(context.Background(), rmqKey(streamsConnectionQueueConsumerKey, q.broker.name, q.name), tag).Err()
+}
+
+func (q *RedisStreamQueue) StopConsuming() <-chan struct{} {
+	finished := make(chan struct{})
+
+	q.mu.Lock()
+	if q.deliveries == nil || q.stopped {
+		q.mu.Unlock()
+		close(finished)
+		return finished
+	}
+
+	q.stopped = true
+	close(q.stop)
+	q.mu.Unlock()
+
+	go func() {
+		// the poller closes the deliveries channel, consumers handle the fetched deliveries before returning
+		q.polling.Wait()
+		q.consuming.Wait()
+
+		ctx := context.Background()
+		pipe := q.broker.client.TxPipeline()
+		pipe.Del(ctx, rmqKey(streamsConnectionQueueConsumerKey, q.broker.name, q.name))
+		pipe.SRem(ctx, rmqKey(streamsConnectionQueuesKey, q.broker.name, ""), q.name)
+		if _, err := pipe.Exec(ctx); err != nil {
+			q.broker.logger.WithError(err).Errorf("failed to unregister consumers of queue %s", q.name)
+		}
+
+		close(finished)
+	}()
+
+	return finished
+}
+
+func (q *RedisStreamQueue) poll() {
+	defer q.polling.Done()
+	defer close(q.deliveries)
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		default:
+		}
+
+		batch := q.prefetchLimit - atomic.LoadInt64(&q.unackedSize)
+		if batch <= 0 {
+			q.wait()
+			continue
+		}
+
+		claimed, err := q.claim(batch)
+		if err != nil {
+			q.broker.logger.WithError(err).Errorf("failed to claim deliveries of queue %s", q.name)
+		}
+
+		if batch -= claimed; batch <= 0 {
+			continue
+		}
+
+		// XREADGROUP blocks until an entry is published, so it replaces the sleep between two polls
+		if err := q.read(batch); err != nil {
+			q.broker.logger.WithError(err).Errorf("failed to fetch deliveries of queue %s", q.name)
+			q.wait()
+		}
+	}
+}
+
+func (q *RedisStreamQueue) wait() {
+	select {
+	case <-q.stop:
+	case <-time.After(q.pollDuration):
+	}
+}
+
+func (q *RedisStreamQueue) read(batch int64) error {
+	block := q.pollDuration
+	if block < time.Millisecond {
+		block = time.Millisecond
+	}
+
+	streams, err := q.broker.client.XReadGroup(context.Background(), &redis.XReadGroupArgs{
+		Group:    streamsGroup,
+		Consumer: q.broker.name,
+		Streams:  []string{q.stream, ">"},
+		Count:    batch,
+		Block:    block,
+	}).Result()
+	if err == redis.Nil {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	for _, stream := range streams {
+		for _, message := range stream.Messages {
+			payload, _ := message.Values[streamsPayloadField].(string)
+			q.deliver(message.ID, payload)
+		}
+	}
+
+	return nil
+}
+
+// claim takes over the deliveries which were pending for claimIdle with XAUTOCLAIM, it returns how many were claimed.
+// go-redis does not support XAUTOCLAIM yet, so its reply is parsed here.
+func (q *RedisStreamQueue) claim(batch int64) (int64, error) {
+	ctx := context.Background()
+	reply, err := q.broker.client.Do(ctx, "XAUTOCLAIM", q.stream, streamsGroup, q.broker.name,
+		q.broker.claimIdle.Milliseconds(), q.claimCursor, "COUNT", batch).Result()
+	if err != nil {
+		return 0, err
+	}
+
+	values, ok := reply.([]interface{})
+	if !ok || len(values) < 2 {
+		return 0, fmt.Errorf("unexpected XAUTOCLAIM reply %v", reply)
+	}
+
+	q.claimCursor, _ = values[0].(string)
+	entries, _ := values[1].([]interface{})
+
+	var claimed int64
+	var deleted []string
+	for _, value := range entries {
+		entry, ok := value.([]interface{})
+		if !ok || len(entry) < 2 {
+			continue
+		}
+
+		id, _ := entry[0].(string)
+		fields, _ := entry[1].([]interface{})
+		if fields == nil {
+			// Redis 6.2 claims entries which were deleted meanwhile with empty fields
+			deleted = append(deleted, id)
+			continue
+		}
+
+		var payload string
+		for i := 0; i+1 < len(fields); i += 2 {
+			if fields[i] == streamsPayloadField {
+				payload, _ = fields[i+1].(string)
+			}
+		}
+
+		if q.deliver(id, payload) {
+			claimed++
+		}
+	}
+
+	if len(deleted) > 0 {
+		if err := q.broker.client.XAck(ctx, q.stream, streamsGroup, deleted...).Err(); err != nil {
+			return claimed, err
+		}
+	}
+
+	return claimed, nil
+}
+
+// deliver hands the entry to the consumers, unless it is unacked by them already.
+func (q *RedisStreamQueue) deliver(id, payload string) bool {
+	q.mu.Lock()
+	if q.unacked[id] {
+		q.mu.Unlock()
+		return false
+	}
+
+	q.unacked[id] = true
+	q.mu.Unlock()
+
+	atomic.AddInt64(&q.unackedSize, 1)
+	// the channel has room for prefetchLimit deliveries, so this never blocks
+	q.deliveries <- &RedisStreamDelivery{
+		queue:   q,
+		id:      id,
+		payload: payload,
+	}
+
+	return true
+}
+
+func (q *RedisStreamQueue) settle(id string) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.unacked[id] {
+		delete(q.unacked, id)
+		atomic.AddInt64(&q.unackedSize, -1)
+	}
+}
+
+func (q *RedisStreamQueue) heartbeats() {
+	defer q.polling.Done()
+
+	ticker := time.NewTicker(streamsHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-q.stop:
+			return
+		case <-ticker.C:
+			if err := q.heartbeat(); err != nil {
+				q.broker.logger.WithError(err).Errorf("failed to refresh heartbeat of queue %s", q.name)
+			}
+		}
+	}
+}
+
+// heartbeat refreshes the heartbeat of the connection and the idle time of its unacked deliveries,
+// so long running jobs are not claimed by other connections.
+func (q *RedisStreamQueue) heartbeat() error {
+	ctx := context.Background()
+	err := q.broker.client.Set(ctx, rmqKey(streamsConnectionHeartbeatKey, q.broker.name, ""), "1", streamsHeartbeatTTL).Err()
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	ids := make([]string, 0, len(q.unacked))
+	for id := range q.unacked {
+		ids = append(ids, id)
+	}
+	q.mu.Unlock()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	// deliveries idle for less than half of claimIdle are skipped, they may have been claimed by another connection
+	return q.broker.client.XClaimJustID(ctx, &redis.XClaimArgs{
+		Stream:   q.stream,
+		Group:    streamsGroup,
+		Consumer: q.broker.name,
+		MinIdle:  q.broker.claimIdle / 2,
+		Messages: ids,
+	}).Err()
+}
+
+type RedisStreamDelivery struct {
+	queue   *RedisStreamQueue
+	id      string
+	payload string
+}
+
+func (d *RedisStreamDelivery) Payload() string {
+	return d.payload
+}
+
+func (d *RedisStreamDelivery) Ack() error {
+	return d.settle(streamsAckScript, []string{d.queue.stream}, streamsGroup, d.id)
+}
+
+func (d *RedisStreamDelivery) Reject() error {
+	keys := []string{d.queue.stream, rmqKey(streamsQueueRejectedKey, "", d.queue.name)}
+	return d.settle(streamsRejectScript, keys, streamsGroup, d.id, d.payload)
+}
+
+// Push returns the delivery, streams queues have no push queue.
+func (d *RedisStreamDelivery) Push() error {
+	return d.Return()
+}
+
+// Return acks the entry and adds its payload again at the end of the stream, in one script.
+func (d *RedisStreamDelivery) Return() error {
+	return d.settle(streamsReturnScript, []string{d.queue.stream}, streamsGroup, d.id, streamsPayloadField, d.payload)
+}
+
+// settle releases the delivery, ErrDeliveryNotFound means it was settled already.
+func (d *RedisStreamDelivery) settle(script *redis.Script, keys []string, args ...interface{}) error {
+	d.queue.settle(d.id)
+
+	acked, err := script.Run(context.Background(), d.queue.broker.client, keys, args...).Int64()
+	if err != nil {
+		return err
+	}
+
+	if acked == 0 {
+		return ErrDeliveryNotFound
+	}
+
+	return nil
+}
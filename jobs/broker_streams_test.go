@@ -0,0 +1,75 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRedisStreamBrokerClaimDeliveriesOfDeadConnection(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	queueName := gofakeit.UUID()
+
+	dead := NewRedisStreamBroker(testRedisClient, testLogger, "dead")
+	deadQueue, err := dead.OpenQueue(queueName)
+	require.NoError(t, err)
+	require.NoError(t, deadQueue.Publish(ctx, []byte("job")))
+
+	// the dead connection fetches the delivery and never acks it
+	fetched := make(chan string, 1)
+	require.NoError(t, deadQueue.StartConsuming(1, 10*time.Millisecond))
+	require.NoError(t, deadQueue.AddConsumer("dead", QueueConsumerFunc(func(delivery Delivery) {
+		fetched <- delivery.Payload()
+	})))
+	assert.Equal(t, "job", <-fetched)
+	<-deadQueue.StopConsuming()
+	require.NoError(t, testRedisClient.Del(ctx, rmqKey(streamsConnectionHeartbeatKey, dead.name, "")).Err())
+
+	stat := findQueueStats(t, dead, queueName)
+	assert.Equal(t, int64(0), stat.Ready)
+	assert.Equal(t, int64(1), stat.Unacked)
+
+	alive := NewRedisStreamBroker(testRedisClient, testLogger, "alive")
+	alive.claimIdle = 100 * time.Millisecond
+	aliveQueue, err := alive.OpenQueue(queueName)
+	require.NoError(t, err)
+
+	consumed := make(chan string, 1)
+	require.NoError(t, aliveQueue.StartConsuming(1, 10*time.Millisecond))
+	require.NoError(t, aliveQueue.AddConsumer("alive", QueueConsumerFunc(func(delivery Delivery) {
+		require.NoError(t, delivery.Ack())
+		consumed <- delivery.Payload()
+	})))
+	defer func() { <-aliveQueue.StopConsuming() }()
+
+	select {
+	case payload := <-consumed:
+		assert.Equal(t, "job", payload)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the delivery of the dead connection was not claimed")
+	}
+
+	stat = findQueueStats(t, alive, queueName)
+	assert.Equal(t, int64(0), stat.Ready)
+	assert.Equal(t, int64(0), stat.Unacked)
+
+	t.Run("clean unregisters the dead connection", func(t *testing.T) {
+		_, err := alive.Clean(ctx)
+		require.NoError(t, err)
+
+		connections, err := alive.Connections(ctx)
+		require.NoError(t, err)
+		for _, connection := range connections {
+			assert.NotEqual(t, dead.name, connection.Name)
+		}
+
+		pending, err := testRedisClient.XPending(ctx, rmqKey(streamsQueueKey, "", queueName), streamsGroup).Result()
+		require.NoError(t, err)
+		assert.NotContains(t, pending.Consumers, dead.name)
+	})
+}
@@ -0,0 +1,48 @@
+package jobs_test
+
+import (
+	"testing"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+	"github.com/tuyentv96/hasty-challenge/jobs/jobstest"
+)
+
+func TestConformance(t *testing.T) {
+	// The in-memory backends are checked by the tests of package memory
+	jobs.RequireDocker(t)
+	store, transactioner, registry, logs, settings, brokers, artifacts := jobs.ConformanceBackends()
+
+	t.Run("store", func(t *testing.T) {
+		jobstest.TestStore(t, store)
+	})
+
+	t.Run("transactioner", func(t *testing.T) {
+		jobstest.TestTransactioner(t, transactioner, store)
+	})
+
+	t.Run("worker registry", func(t *testing.T) {
+		jobstest.TestWorkerRegistry(t, registry)
+	})
+
+	t.Run("job log store", func(t *testing.T) {
+		jobstest.TestJobLogStore(t, logs)
+	})
+
+	t.Run("settings store", func(t *testing.T) {
+		jobstest.TestSettingsStore(t, settings)
+	})
+
+	for name, broker := range brokers {
+		broker := broker
+		t.Run("broker "+name, func(t *testing.T) {
+			jobstest.TestBroker(t, broker)
+		})
+	}
+
+	for name, artifactStore := range artifacts {
+		artifactStore := artifactStore
+		t.Run("artifact store "+name, func(t *testing.T) {
+			jobstest.TestArtifactStore(t, artifactStore)
+		})
+	}
+}
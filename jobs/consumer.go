@@ -2,9 +2,9 @@ package jobs
 
 import (
 	"context"
+	"sync"
 	"time"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/benbjohnson/clock"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -16,6 +16,13 @@ import (
 const (
 	MinSleepTime = 15
 	MaxSleepTime = 40
+
+	// A job is failed once it exceeds its timeout, a consumer still running it a minute later is stuck
+	consumerStuckGrace = time.Minute
+
+	// A deferred or failed delivery is returned to its queue after a random delay, e.g. its slot is held for the whole run of another job
+	minDeferDelay = time.Second
+	maxDeferDelay = 5 * time.Second
 )
 
 type Consumer struct {
@@ -25,55 +32,231 @@ type Consumer struct {
 	clock         clock.Clock
 	random        utils.Random
 	transactioner utils.Transactioner
+	semaphore     Semaphore
+	logs          JobLogStore
+	artifacts     ArtifactStore
+	// workerId and hostname attribute the jobs run by the consumer, the worker sets them
+	workerId string
+	hostname string
+	// settings are the runtime settings of the worker, they override cfg
+	settings *liveSettings
+
+	// the job the consumer is running, see State
+	stateMu  sync.Mutex
+	jobId    int
+	since    time.Time
+	deadline time.Time
 }
 
-func NewConsumer(cfg config.Config, logger *logrus.Entry, svc Service, clock clock.Clock, random utils.Random, transactioner utils.Transactioner) *Consumer {
+func NewConsumer(cfg config.Config, logger *logrus.Entry, svc Service, clock clock.Clock, random utils.Random, transactioner utils.Transactioner, semaphore Semaphore, logs JobLogStore, artifacts ArtifactStore) *Consumer {
 	return &Consumer{
 		cfg:           cfg,
 		svc:           svc,
 		logger:        logger,
-		clock:         clock,
+		clock:         utils.UTCClock(clock),
 		random:        random,
 		transactioner: transactioner,
+		semaphore:     semaphore,
+		logs:          logs,
+		artifacts:     artifacts,
 	}
 }
 
-func (c *Consumer) Consume(delivery rmq.Delivery) {
+func (c *Consumer) Consume(delivery Delivery) {
 	ctx := context.Background()
 	var err error
+	// reject is set when the delivery must not be retried, giveBack when it must run later or on another worker
+	var reject, giveBack bool
 
 	defer func() {
-		if err == nil {
+		switch {
+		case giveBack:
+			c.settleLater(delivery, "return", delivery.Return)
+		case reject:
+			if err := delivery.Reject(); err != nil {
+				c.logger.WithError(err).Errorf("failed to reject job: %s", delivery.Payload())
+			}
+		case err == nil:
 			if err := delivery.Ack(); err != nil {
 				c.logger.WithError(err).Errorf("failed to ack job: %s", delivery.Payload())
 			}
-		} else {
-			if err := delivery.Push(); err != nil {
-				c.logger.WithError(err).Errorf("failed to push job: %s", delivery.Payload())
-			}
+		default:
+			// The job is retried once the failure, e.g. of the store, had time to clear
+			c.settleLater(delivery, "push", delivery.Push)
 		}
 	}()
 
+	msg, err := ParseJobMessage([]byte(delivery.Payload()))
+	if err != nil {
+		// A newer worker reads the messages of a newer version, the others are malformed
+		if errors.Is(err, ErrUnsupportedMessageVersion) {
+			c.logger.WithError(err).Warnf("returning job to a newer worker: %s", delivery.Payload())
+			err = nil
+			giveBack = true
+		} else {
+			c.logger.WithError(err).Errorf("failed to parse job: %s", delivery.Payload())
+			reject = true
+		}
+		return
+	}
+
+	if msg.Trace != nil {
+		ctx = WithTraceContext(ctx, *msg.Trace)
+	}
+
+	// The message only references the job, its stored row is the state to run
 	var job Job
-	job, err = JobFromJSON([]byte(delivery.Payload()))
+	job, err = c.svc.GetJobByID(ctx, msg.TenantId, msg.JobId)
 	if err != nil {
-		c.logger.WithError(err).Errorf("failed to parse job: %s", delivery.Payload())
+		// The job was deleted meanwhile, e.g. purged by the maintenance
+		if errors.Is(err, ErrJobNotFound) {
+			c.logger.WithField("jobId", msg.JobId).Warn("Job of the message was not found")
+			err = nil
+		}
+		return
+	}
+
+	if job.Status == JobStatusRunning && msg.Attempt+1 == job.Attempts {
+		// The attempt of the message was claimed and never settled, its worker was lost and the broker recovered the delivery
+		c.logger.WithField("jobId", job.Id).Warnf("Worker %s of attempt %d was lost, retrying the job", job.WorkerId, job.Attempts)
+		job, err = c.svc.SetJobLost(ctx, job)
+		if err != nil {
+			// The job was settled meanwhile, its worker was not lost
+			if errors.Is(err, ErrInvalidJobStatus) {
+				err = nil
+			}
+			return
+		}
+	} else if msg.Attempt < job.Attempts {
+		c.logger.WithField("jobId", job.Id).Infof("Skipping message of attempt %d, the job is at attempt %d", msg.Attempt, job.Attempts)
+		return
+	}
+
+	// The job was settled or claimed meanwhile, e.g. it was cancelled
+	if !job.Status.CanTransition(JobStatusRunning) {
+		c.logger.WithField("jobId", job.Id).Infof("Skipping job in status %s", job.Status)
+		return
+	}
+
+	// The worker and the host are stored once the job is claimed
+	running := job
+	running.WorkerId = c.workerId
+	running.Hostname = c.hostname
+
+	c.setRunning(running)
+	defer c.setRunning(Job{})
+
+	err = recoverPanic(func() error {
+		return c.DoJob(ctx, running)
+	})
+
+	// A panic before the claim fails the job of the delivery, DoJob fails the claimed job itself
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		err = c.jobPanicked(ctx, running, panicErr)
+	}
+
+	if errors.Is(err, ErrJobPanicked) {
+		err = nil
+		reject = true
 		return
 	}
 
-	err = c.DoJob(ctx, job)
+	if errors.Is(err, ErrJobDeferred) {
+		// The delivery goes back to its queue, the job is retried once a slot is free
+		c.logger.WithField("jobId", job.Id).Info("Job was deferred, returning it to its queue")
+		err = nil
+		giveBack = true
+	}
 }
 
-func (c *Consumer) DoJob(ctx context.Context, job Job) error {
-	// Wrap DoJob function with a transaction
-	return c.transactioner.RunWithTransaction(ctx, func(ctx context.Context) error {
-		return c.doJob(ctx, job)
+// settleLater returns or pushes the delivery back to its queue after the defer delay, without holding the consumer
+// meanwhile. The delay keeps the consumers from polling the store and the semaphore while a slot is held or the store
+// fails, and the workers of an older version from passing a newer message around. When the worker stops first, the
+// delivery is left unacked and the cleaner returns it to ready.
+func (c *Consumer) settleLater(delivery Delivery, action string, settle func() error) {
+	c.clock.AfterFunc(c.deferDelay(), func() {
+		if err := settle(); err != nil {
+			c.logger.WithError(err).Errorf("failed to %s job: %s", action, delivery.Payload())
+		}
 	})
 }
 
-func (c *Consumer) doJob(ctx context.Context, job Job) (err error) {
-	// Try to claim job
-	err = c.svc.ClaimJob(ctx, job)
+// deferDelay spreads the returned deliveries between minDeferDelay and maxDeferDelay, so they are not retried at once.
+func (c *Consumer) deferDelay() time.Duration {
+	return time.Duration(c.random.Rand(int(minDeferDelay.Milliseconds()), int(maxDeferDelay.Milliseconds()))) * time.Millisecond
+}
+
+// State returns the job the consumer is running and whether it is stuck with it.
+func (c *Consumer) State() ConsumerState {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	state := ConsumerState{Id: c.workerId}
+	if c.jobId == 0 {
+		return state
+	}
+
+	since, deadline := c.since, c.deadline
+	state.JobId = c.jobId
+	state.Since = &since
+	state.Deadline = &deadline
+	state.Stuck = c.clock.Now().After(deadline)
+	return state
+}
+
+// setRunning records the job the consumer runs, an empty job once it is done.
+func (c *Consumer) setRunning(job Job) {
+	c.stateMu.Lock()
+	defer c.stateMu.Unlock()
+
+	c.jobId = job.Id
+	if job.Id == 0 {
+		return
+	}
+
+	c.since = c.clock.Now()
+	c.deadline = c.since.Add(time.Duration(c.jobConfig().TenantTimeout(job.TenantId))*time.Second + consumerStuckGrace)
+}
+
+// jobConfig returns the job config the consumer runs with, the runtime settings of its worker override the config.
+func (c *Consumer) jobConfig() config.JobConfig {
+	if c.settings == nil {
+		return c.cfg.JobConfig
+	}
+
+	return c.settings.get().JobConfig(c.cfg.JobConfig)
+}
+
+// jobPanicked fails the job which panicked, it returns ErrJobPanicked once the job failed so its delivery is rejected.
+// The delivery is retried when the job could not be updated.
+func (c *Consumer) jobPanicked(ctx context.Context, job Job, panicErr *PanicError) error {
+	countPanic(job.Type)
+	logger := c.logger.WithField("jobId", job.Id)
+	logger.WithField("stack", string(panicErr.Stack)).Errorf("Job panicked: %v", panicErr.Value)
+
+	_, err := c.svc.SetJobPanicked(ctx, job, panicErr)
+	if err != nil {
+		// The job changed its status meanwhile, it was settled before the panic or by another worker
+		if errors.Is(err, ErrInvalidJobStatus) {
+			return nil
+		}
+
+		return errors.Wrap(err, "failed to set job panicked")
+	}
+
+	return ErrJobPanicked
+}
+
+func (c *Consumer) DoJob(ctx context.Context, job Job) error {
+	release, err := c.acquire(ctx, job)
+	if err != nil {
+		return err
+	}
+	defer release()
+
+	// Try to claim job, the claim is committed so a job left running tells the next delivery that its worker was lost
+	claimed, err := c.svc.ClaimJob(ctx, job)
 	if err != nil {
 		// Job was claimed by another worker, just ignore
 		if errors.Is(err, ErrJobWasClaimed) {
@@ -84,33 +267,111 @@ func (c *Consumer) doJob(ctx context.Context, job Job) (err error) {
 		return err
 	}
 
+	// Wrap the run of the job with a transaction, a panic rolls it back and fails the claimed job
+	err = recoverPanic(func() error {
+		return c.transactioner.RunWithTransaction(ctx, func(ctx context.Context) error {
+			return c.doJob(ctx, claimed)
+		})
+	})
+
+	var panicErr *PanicError
+	if errors.As(err, &panicErr) {
+		return c.jobPanicked(ctx, claimed, panicErr)
+	}
+
+	return err
+}
+
+type semaphoreSlot struct {
+	key   string
+	limit int
+}
+
+// slots returns the concurrency limits that apply to the job
+func (c *Consumer) slots(job Job) []semaphoreSlot {
+	var slots []semaphoreSlot
+	cfg := c.jobConfig()
+	if limit := cfg.TenantConcurrency[job.TenantId]; limit > 0 {
+		slots = append(slots, semaphoreSlot{key: tenantSemaphoreKey(job.TenantId), limit: limit})
+	}
+
+	if limit := cfg.TypeConcurrency[job.Type]; limit > 0 {
+		slots = append(slots, semaphoreSlot{key: typeSemaphoreKey(job.Type), limit: limit})
+	}
+
+	if limit := cfg.ObjectConcurrency; limit > 0 {
+		slots = append(slots, semaphoreSlot{key: objectSemaphoreKey(job.TenantId, job.ObjectId), limit: limit})
+	}
+
+	return slots
+}
+
+// acquire takes a slot of every concurrency limit of the job, it returns ErrJobDeferred when one of them is full.
+func (c *Consumer) acquire(ctx context.Context, job Job) (func(), error) {
+	var releases []func()
+	release := func() {
+		for i := len(releases) - 1; i >= 0; i-- {
+			releases[i]()
+		}
+	}
+
+	for _, slot := range c.slots(job) {
+		releaseSlot, acquired, err := c.semaphore.TryAcquire(ctx, slot.key, slot.limit)
+		if err != nil {
+			release()
+			return nil, errors.Wrapf(err, "failed to acquire slot %s", slot.key)
+		}
+
+		if !acquired {
+			release()
+			return nil, ErrJobDeferred
+		}
+
+		releases = append(releases, releaseSlot)
+	}
+
+	return release, nil
+}
+
+func (c *Consumer) doJob(ctx context.Context, job Job) (err error) {
+	// The handler of the job logs with JobLogger(ctx), its lines are kept for GET /v1/jobs/:id/logs
+	base := c.logger
+	if trace, ok := TraceContextFromContext(ctx); ok {
+		base = base.WithField("traceparent", trace.TraceParent)
+	}
+
+	logger := NewJobLogger(base, c.logs, job, c.jobConfig().JobLogMaxBytes)
+	ctx = WithJobLogger(ctx, logger)
+	// and attaches its files with AttachArtifact(ctx, ...), they are served by GET /v1/jobs/:id/artifacts
+	ctx = WithJobArtifacts(ctx, c.artifacts, job)
+
 	var isJobTimeout bool
 
 	defer func() {
 		if isJobTimeout {
-			_, err = c.svc.SetJobFailed(ctx, job, ErrJobExceedTimeout.Error())
+			_, err = c.svc.SetJobFailed(ctx, job, Transient(ErrJobExceedTimeout))
 			if err != nil {
 				err = errors.Wrap(err, "failed to set job failed")
 			} else {
-				c.logger.WithField("jobId", job.Id).Error("Job was exceed timeout")
+				logger.Error("Job was exceed timeout")
 			}
 		} else {
 			_, err = c.svc.SetJobSuccess(ctx, job)
 			if err != nil {
 				err = errors.Wrap(err, "failed to set job success")
 			} else {
-				c.logger.WithField("jobId", job.Id).Infof("Job ran successfully")
+				logger.Infof("Job ran successfully")
 			}
 		}
 	}()
 
 	sleepTime := c.random.Rand(MinSleepTime, MaxSleepTime)
-	c.logger.WithField("jobId", job.Id).Infof("Job will run in %d seconds", sleepTime)
+	logger.Infof("Job will run in %d seconds", sleepTime)
 
 	select {
 	case <-c.clock.After(time.Duration(sleepTime) * time.Second):
 		break
-	case <-c.clock.After(time.Duration(c.cfg.JobConfig.TimeoutInSeconds) * time.Second):
+	case <-c.clock.After(time.Duration(c.jobConfig().TenantTimeout(job.TenantId)) * time.Second):
 		isJobTimeout = true
 	}
 
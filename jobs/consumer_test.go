@@ -2,6 +2,9 @@ package jobs
 
 import (
 	"context"
+	"errors"
+	"expvar"
+	"math"
 	"testing"
 	"time"
 
@@ -15,8 +18,8 @@ import (
 )
 
 func initTestConsumer(svc Service, clock clock.Clock, random utils.Random) *Consumer {
-	cfg := config.Config{}
-	return NewConsumer(cfg, testLogger, svc, clock, random, testTransaction)
+	cfg := config.Config{JobConfig: config.JobConfig{JobLogMaxBytes: 1024}}
+	return NewConsumer(cfg, testLogger, svc, clock, random, testTransaction, NewLocalSemaphore(), testJobLogs, testArtifacts)
 }
 
 func TestConsumerDoJob(t *testing.T) {
@@ -28,10 +31,10 @@ func TestConsumerDoJob(t *testing.T) {
 		svc := initTestService(t, queueName, clock)
 
 		consumer := initTestConsumer(svc, clock, random)
-		job, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
-		job, err = svc.GetJobByID(ctx, job.Id)
+		job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
 		require.NoError(t, err)
 
 		consumer.cfg.JobConfig.TimeoutInSeconds = 30
@@ -48,9 +51,16 @@ func TestConsumerDoJob(t *testing.T) {
 		<-wait
 		require.NoError(t, err)
 
-		job, err = svc.GetJobByID(ctx, job.Id)
+		job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
 		require.NoError(t, err)
 		assert.Equal(t, JobStatusSuccess, job.Status)
+
+		lines, err := testJobLogs.JobLogs(ctx, DefaultTenantId, job.Id, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "Job will run in 25 seconds", lines[0].Message)
+		assert.Equal(t, "Job ran successfully", lines[1].Message)
+		assert.Equal(t, 1, lines[1].Attempt)
 	})
 
 	t.Run("job exceed timeout", func(t *testing.T) {
@@ -61,10 +71,10 @@ func TestConsumerDoJob(t *testing.T) {
 		svc := initTestService(t, queueName, clock)
 
 		consumer := initTestConsumer(svc, clock, random)
-		job, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
-		job, err = svc.GetJobByID(ctx, job.Id)
+		job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
 		require.NoError(t, err)
 
 		consumer.cfg.JobConfig.TimeoutInSeconds = 30
@@ -81,9 +91,9 @@ func TestConsumerDoJob(t *testing.T) {
 		<-wait
 		require.Error(t, ErrJobExceedTimeout, err)
 
-		job, err = svc.GetJobByID(ctx, job.Id)
+		job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
 		require.NoError(t, err)
-		assert.Equal(t, JobStatusFailed, job.Status)
+		assert.Equal(t, JobStatusTimedOut, job.Status)
 	})
 
 	t.Run("job was claimed", func(t *testing.T) {
@@ -94,10 +104,10 @@ func TestConsumerDoJob(t *testing.T) {
 		svc := initTestService(t, queueName, clock)
 
 		consumer := initTestConsumer(svc, clock, random)
-		job, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
-		err = svc.ClaimJob(ctx, job)
+		_, err = svc.ClaimJob(ctx, job)
 		require.NoError(t, err)
 
 		consumer.cfg.JobConfig.TimeoutInSeconds = 30
@@ -106,8 +116,360 @@ func TestConsumerDoJob(t *testing.T) {
 		err = consumer.DoJob(ctx, job)
 		require.Nil(t, err)
 
-		job, err = svc.GetJobByID(ctx, job.Id)
+		job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
 		require.NoError(t, err)
 		assert.Equal(t, JobStatusRunning, job.Status)
 	})
+	t.Run("tenant reached concurrency limit", func(t *testing.T) {
+		ctx := context.Background()
+		clock := clock.NewMock()
+		random := utils.NewMockRandomImpl()
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, clock)
+
+		consumer := initTestConsumer(svc, clock, random)
+		consumer.cfg.JobConfig.TenantConcurrency = map[string]int{DefaultTenantId: 1}
+
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+
+		release, acquired, err := consumer.semaphore.TryAcquire(ctx, tenantSemaphoreKey(DefaultTenantId), 1)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		defer release()
+
+		err = consumer.DoJob(ctx, job)
+		require.Equal(t, ErrJobDeferred, err)
+
+		job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusQueued, job.Status)
+	})
+	t.Run("another job of the same object is running", func(t *testing.T) {
+		ctx := context.Background()
+		clock := clock.NewMock()
+		random := utils.NewMockRandomImpl()
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, clock)
+
+		consumer := initTestConsumer(svc, clock, random)
+		consumer.cfg.JobConfig.ObjectConcurrency = 1
+
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+
+		release, acquired, err := consumer.semaphore.TryAcquire(ctx, objectSemaphoreKey(job.TenantId, job.ObjectId), 1)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		defer release()
+
+		err = consumer.DoJob(ctx, job)
+		require.Equal(t, ErrJobDeferred, err)
+	})
+
+	t.Run("job type reached concurrency limit", func(t *testing.T) {
+		ctx := context.Background()
+		clock := clock.NewMock()
+		random := utils.NewMockRandomImpl()
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, clock)
+
+		jobType := gofakeit.UUID()
+		consumer := initTestConsumer(svc, clock, random)
+		consumer.cfg.JobConfig.TypeConcurrency = map[string]int{jobType: 1}
+
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId(), Type: jobType})
+		require.NoError(t, err)
+		assert.Equal(t, jobType, job.Type)
+
+		release, acquired, err := consumer.semaphore.TryAcquire(ctx, typeSemaphoreKey(jobType), 1)
+		require.NoError(t, err)
+		require.True(t, acquired)
+
+		err = consumer.DoJob(ctx, job)
+		require.Equal(t, ErrJobDeferred, err)
+
+		// the job runs once the slot is free
+		release()
+		consumer.cfg.JobConfig.TimeoutInSeconds = 30
+		random.SetVal(25)
+
+		wait := make(chan bool)
+		go func() {
+			err = consumer.DoJob(ctx, job)
+			close(wait)
+		}()
+
+		time.Sleep(time.Second)
+		clock.Add(25 * time.Second)
+		<-wait
+		require.NoError(t, err)
+
+		job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusSuccess, job.Status)
+	})
+}
+
+func TestConsumerDeferredJob(t *testing.T) {
+	ctx := context.Background()
+	clock := clock.NewMock()
+	queueName := gofakeit.UUID()
+	svc := initTestService(t, queueName, clock)
+
+	jobType := gofakeit.UUID()
+	random := utils.NewMockRandomImpl()
+	random.SetVal(int(maxDeferDelay.Milliseconds()))
+	consumer := initTestConsumer(svc, clock, random)
+	consumer.cfg.JobConfig.TypeConcurrency = map[string]int{jobType: 1}
+	consumer.workerId = "test-worker/worker:0"
+	consumer.hostname = "test"
+
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId(), Type: jobType})
+	require.NoError(t, err)
+
+	release, acquired, err := consumer.semaphore.TryAcquire(ctx, typeSemaphoreKey(jobType), 1)
+	require.NoError(t, err)
+	require.True(t, acquired)
+	defer release()
+
+	queue := JobQueueName(queueName, jobType, JobPriorityNormal)
+	require.Equal(t, int64(1), findQueueStats(t, testBroker, queue).Ready)
+
+	// the consumer is free at once, the delivery is returned to its queue after the delay
+	delivery := &settledDelivery{payload: string(job.ToJSON())}
+	consumer.Consume(delivery)
+	assert.Empty(t, delivery.settled)
+
+	clock.Add(maxDeferDelay - time.Millisecond)
+	assert.Empty(t, delivery.settled, "the delay is drawn by the random of the consumer")
+	clock.Add(time.Millisecond)
+	assert.Equal(t, "return", delivery.settled)
+	assert.Equal(t, int64(1), findQueueStats(t, testBroker, queue).Ready, "no message is published for the deferred job")
+
+	// the job did not run on the worker
+	job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+	require.NoError(t, err)
+	assert.Empty(t, job.WorkerId)
+	assert.Empty(t, job.Hostname)
+}
+
+func TestConsumerLostWorker(t *testing.T) {
+	ctx := context.Background()
+	clock := clock.NewMock()
+	random := utils.NewMockRandomImpl()
+	svc := initTestService(t, gofakeit.UUID(), clock)
+	consumer := initTestConsumer(svc, clock, random)
+	consumer.cfg.JobConfig.TimeoutInSeconds = 30
+	random.SetVal(25)
+
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+	require.NoError(t, err)
+
+	// the worker of the first attempt was lost once it claimed the job, the broker delivers its message again
+	lost := job
+	lost.WorkerId = "lost-worker/worker:0"
+	_, err = svc.ClaimJob(ctx, lost)
+	require.NoError(t, err)
+
+	delivery := &settledDelivery{payload: string(NewJobMessage(ctx, job).ToJSON())}
+	wait := make(chan bool)
+	go func() {
+		consumer.Consume(delivery)
+		close(wait)
+	}()
+
+	time.Sleep(time.Second)
+	running, err := svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusRunning, running.Status)
+	assert.Equal(t, 2, running.Attempts)
+	require.NotNil(t, running.Error)
+	assert.Equal(t, JobErrorLostWorker, running.Error.Code)
+	assert.Equal(t, 1, running.Error.Attempt)
+	assert.True(t, running.Error.Retryable)
+
+	clock.Add(25 * time.Second)
+	<-wait
+	assert.Equal(t, "ack", delivery.settled)
+
+	job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusSuccess, job.Status)
+}
+
+// failingGetService fails to get the jobs, e.g. while the store is down.
+type failingGetService struct {
+	Service
+	err error
+}
+
+func (s failingGetService) GetJobByID(ctx context.Context, tenantId string, jobId int) (Job, error) {
+	return Job{}, s.err
+}
+
+func TestConsumerPushedJob(t *testing.T) {
+	ctx := context.Background()
+	clock := clock.NewMock()
+	svc := initTestService(t, gofakeit.UUID(), clock)
+
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+	require.NoError(t, err)
+
+	random := utils.NewMockRandomImpl()
+	random.SetVal(int(minDeferDelay.Milliseconds()))
+	consumer := initTestConsumer(failingGetService{Service: svc, err: errors.New("store is down")}, clock, random)
+
+	// the consumer is free at once, the delivery is pushed back to its queue after the delay
+	delivery := &settledDelivery{payload: string(job.ToJSON())}
+	consumer.Consume(delivery)
+	assert.Empty(t, delivery.settled)
+
+	clock.Add(minDeferDelay)
+	assert.Equal(t, "push", delivery.settled)
+}
+
+type panicRandom struct{}
+
+func (panicRandom) Rand(min, max int) int {
+	panic("random exploded")
+}
+
+// settledDelivery records how the consumer settled the delivery.
+type settledDelivery struct {
+	payload string
+	settled string
+}
+
+func (d *settledDelivery) Payload() string { return d.payload }
+func (d *settledDelivery) Ack() error      { d.settled = "ack"; return nil }
+func (d *settledDelivery) Reject() error   { d.settled = "reject"; return nil }
+func (d *settledDelivery) Push() error     { d.settled = "push"; return nil }
+func (d *settledDelivery) Return() error   { d.settled = "return"; return nil }
+
+func panicCount() int64 {
+	if panics, ok := metrics.Get(metricPanics).(*expvar.Int); ok {
+		return panics.Value()
+	}
+
+	return 0
+}
+
+func TestConsumerPanic(t *testing.T) {
+	ctx := context.Background()
+	clock := clock.NewMock()
+	svc := initTestService(t, gofakeit.UUID(), clock)
+	consumer := initTestConsumer(svc, clock, panicRandom{})
+
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+	require.NoError(t, err)
+
+	panics := panicCount()
+	delivery := &settledDelivery{payload: string(job.ToJSON())}
+	require.NotPanics(t, func() {
+		consumer.Consume(delivery)
+	})
+	assert.Equal(t, "reject", delivery.settled)
+	assert.Equal(t, panics+1, panicCount())
+
+	job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusFailed, job.Status)
+	require.NotNil(t, job.Error)
+	assert.Equal(t, JobErrorPanic, job.Error.Code)
+	assert.Equal(t, "panic: random exploded", job.Error.Message)
+	assert.False(t, job.Error.Retryable)
+	assert.Equal(t, 1, job.Error.Attempt)
+	assert.Contains(t, job.Error.Details["stack"], "panicRandom")
+	assert.NotNil(t, job.EndTime)
+
+	t.Run("failed job is acked", func(t *testing.T) {
+		delivery := &settledDelivery{payload: string(job.ToJSON())}
+		consumer.Consume(delivery)
+		assert.Equal(t, "ack", delivery.settled)
+	})
+}
+
+func TestConsumerMessages(t *testing.T) {
+	ctx := context.Background()
+	clock := clock.NewMock()
+	svc := initTestService(t, gofakeit.UUID(), clock)
+	// the job panics as soon as it runs, the test only needs to know whether it ran
+	consumer := initTestConsumer(svc, clock, panicRandom{})
+
+	t.Run("run the stored job rather than the published one", func(t *testing.T) {
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+
+		stale := job
+		stale.ObjectId = newTestObjectId()
+
+		delivery := &settledDelivery{payload: string(stale.ToJSON())}
+		consumer.Consume(delivery)
+		assert.Equal(t, "reject", delivery.settled)
+
+		ran, err := svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusFailed, ran.Status)
+		assert.Equal(t, job.ObjectId, ran.ObjectId)
+	})
+
+	t.Run("skip the messages of a past attempt", func(t *testing.T) {
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+
+		claimed, err := svc.ClaimJob(ctx, job)
+		require.NoError(t, err)
+		failed, err := svc.SetJobFailed(ctx, claimed, errors.New("failed"))
+		require.NoError(t, err)
+		_, err = svc.RetryJob(ctx, DefaultTenantId, failed.Id)
+		require.NoError(t, err)
+
+		delivery := &settledDelivery{payload: string(NewJobMessage(ctx, job).ToJSON())}
+		consumer.Consume(delivery)
+		assert.Equal(t, "ack", delivery.settled)
+
+		job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusQueued, job.Status, "the retry is left to its own message")
+	})
+
+	t.Run("ack the messages of deleted jobs", func(t *testing.T) {
+		delivery := &settledDelivery{payload: string(NewJobMessage(ctx, Job{Id: math.MaxInt32, TenantId: DefaultTenantId}).ToJSON())}
+		consumer.Consume(delivery)
+		assert.Equal(t, "ack", delivery.settled)
+	})
+
+	t.Run("return the messages of a newer version to the queue", func(t *testing.T) {
+		queueName := gofakeit.UUID()
+		queue, err := testBroker.OpenQueue(queueName)
+		require.NoError(t, err)
+		require.NoError(t, queue.Publish(ctx, []byte(`{"v": 99, "job_id": 1}`)))
+
+		require.NoError(t, queue.StartConsuming(1, 10*time.Millisecond))
+		consumed := make(chan Delivery, 1)
+		require.NoError(t, queue.AddConsumer("old", QueueConsumerFunc(func(delivery Delivery) {
+			consumed <- delivery
+		})))
+
+		delivery := <-consumed
+		<-queue.StopConsuming()
+
+		// the consumer is free at once, the delivery is returned after the delay
+		consumer.random = utils.NewMockRandomImpl()
+		consumer.Consume(delivery)
+		assert.Equal(t, int64(1), findQueueStats(t, testBroker, queueName).Unacked)
+		clock.Add(maxDeferDelay)
+
+		stats := findQueueStats(t, testBroker, queueName)
+		assert.Equal(t, int64(1), stats.Ready)
+		assert.Equal(t, int64(0), stats.Unacked)
+		assert.Equal(t, int64(0), stats.Rejected)
+	})
+
+	t.Run("reject malformed messages", func(t *testing.T) {
+		delivery := &settledDelivery{payload: `not json`}
+		consumer.Consume(delivery)
+		assert.Equal(t, "reject", delivery.settled)
+	})
 }
@@ -62,9 +62,19 @@ func TestE2EJob(t *testing.T) {
 		// wait for DoJob done
 		time.Sleep(2 * time.Second)
 
-		actual, err := svc.GetJobByID(ctx, job.Id)
+		actual, err := svc.GetJobByID(ctx, DefaultTenantId, job.Id)
 		require.NoError(t, err)
 		assert.Equal(t, JobStatusSuccess, actual.Status)
+
+		// attributed to a consumer of the worker
+		assert.Contains(t, actual.WorkerId, worker.info.Id+"/worker:")
+		assert.Equal(t, worker.info.Hostname, actual.Hostname)
+		wait, ok := actual.QueueWait()
+		require.True(t, ok)
+		assert.Zero(t, wait, "the clock did not move until the job was claimed")
+		run, ok := actual.RunTime()
+		require.True(t, ok)
+		assert.Equal(t, time.Duration(sleepTimeInSeconds)*time.Second, run)
 	})
 
 	t.Run("run job exceed timeout", func(t *testing.T) {
@@ -113,10 +123,12 @@ func TestE2EJob(t *testing.T) {
 		// wait for DoJob done
 		time.Sleep(2 * time.Second)
 
-		actual, err := svc.GetJobByID(ctx, job.Id)
+		actual, err := svc.GetJobByID(ctx, DefaultTenantId, job.Id)
 		require.NoError(t, err)
-		assert.Equal(t, JobStatusFailed, actual.Status)
+		assert.Equal(t, JobStatusTimedOut, actual.Status)
 		assert.Equal(t, objectId, actual.ObjectId)
-		assert.Equal(t, ErrJobExceedTimeout.Error(), actual.Message)
+		require.NotNil(t, actual.Error)
+		assert.Equal(t, JobErrorTimeout, actual.Error.Code)
+		assert.True(t, actual.Error.Retryable)
 	})
 }
@@ -3,9 +3,110 @@ package jobs
 import "errors"
 
 var (
-	ErrJobNotFound      = errors.New("job not found")
-	ErrNoRowUpdated     = errors.New("no row updated")
-	ErrJobWasClaimed    = errors.New("job was claimed")
-	ErrJobWasNotClaimed = errors.New("job was not claimed")
-	ErrJobExceedTimeout = errors.New("job exceed timeout")
+	ErrJobNotFound               = errors.New("job not found")
+	ErrNoRowUpdated              = errors.New("no row updated")
+	ErrJobWasClaimed             = errors.New("job was claimed")
+	ErrJobWasNotClaimed          = errors.New("job was not claimed")
+	ErrJobExceedTimeout          = errors.New("job exceed timeout")
+	ErrJobCancelled              = errors.New("job was cancelled")
+	ErrWorkerLost                = errors.New("worker of the job was lost")
+	ErrJobDeferred               = errors.New("job was deferred")
+	ErrJobPanicked               = errors.New("job panicked")
+	ErrUnauthorized              = errors.New("unauthorized")
+	ErrRateLimitExceeded         = errors.New("rate limit exceeded")
+	ErrQueueNotFound             = errors.New("queue not found")
+	ErrQueueConsuming            = errors.New("queue is already consuming")
+	ErrQueueNotConsuming         = errors.New("queue is not consuming")
+	ErrDeliveryNotFound          = errors.New("delivery not found")
+	ErrInvalidJobStatus          = errors.New("operation is not allowed in the current job status")
+	ErrInvalidPriority           = errors.New("invalid job priority")
+	ErrJobTypeNotServed          = errors.New("no worker serves the job type")
+	ErrArtifactNotFound          = errors.New("artifact not found")
+	ErrInvalidArtifactName       = errors.New("invalid artifact name")
+	ErrNoJobArtifacts            = errors.New("artifacts can only be attached while running a job")
+	ErrUnsupportedMessageVersion = errors.New("unsupported job message version")
+	ErrUnknownSetting            = errors.New("unknown setting")
+	ErrInvalidSetting            = errors.New("invalid setting")
+	ErrHeartbeatExpired          = errors.New("heartbeat of the queue connection expired")
 )
+
+// NewJobError describes the failure of the given attempt of a job.
+func NewJobError(err error, attempt int) *JobError {
+	jobErr := &JobError{
+		Code:      JobErrorHandler,
+		Message:   err.Error(),
+		Retryable: IsRetryable(err),
+		Attempt:   attempt,
+	}
+
+	var panicErr *PanicError
+	switch {
+	case errors.As(err, &panicErr):
+		jobErr.Code = JobErrorPanic
+		jobErr.Details = map[string]interface{}{"stack": string(panicErr.Stack)}
+	case errors.Is(err, ErrJobExceedTimeout):
+		jobErr.Code = JobErrorTimeout
+	case errors.Is(err, ErrJobCancelled):
+		jobErr.Code = JobErrorCancelled
+	case errors.Is(err, ErrWorkerLost):
+		jobErr.Code = JobErrorLostWorker
+	}
+
+	return jobErr
+}
+
+// PermanentError is a job failure which happens again when the job is retried, e.g. an invalid object.
+type PermanentError struct {
+	Err error
+}
+
+// Permanent marks err as a permanent job failure.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &PermanentError{Err: err}
+}
+
+func (e *PermanentError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *PermanentError) Unwrap() error {
+	return e.Err
+}
+
+// TransientError is a job failure which may not happen again when the job is retried, e.g. an unavailable dependency.
+type TransientError struct {
+	Err error
+}
+
+// Transient marks err as a transient job failure.
+func Transient(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	return &TransientError{Err: err}
+}
+
+func (e *TransientError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *TransientError) Unwrap() error {
+	return e.Err
+}
+
+// IsRetryable tells whether a job which failed with err may succeed when retried.
+// Only the failures marked transient are, a permanent mark wins over a transient one.
+func IsRetryable(err error) bool {
+	var permanent *PermanentError
+	if errors.As(err, &permanent) {
+		return false
+	}
+
+	var transient *TransientError
+	return errors.As(err, &transient)
+}
@@ -0,0 +1,72 @@
+package jobs
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewJobError(t *testing.T) {
+	testcases := []struct {
+		name      string
+		err       error
+		code      string
+		retryable bool
+	}{
+		{
+			name: "handler error",
+			err:  errors.New("object is broken"),
+			code: JobErrorHandler,
+		},
+		{
+			name:      "transient handler error",
+			err:       fmt.Errorf("fetch object: %w", Transient(errors.New("connection refused"))),
+			code:      JobErrorHandler,
+			retryable: true,
+		},
+		{
+			name: "permanent wins over transient",
+			err:  Permanent(Transient(errors.New("object is broken"))),
+			code: JobErrorHandler,
+		},
+		{
+			name:      "timeout",
+			err:       Transient(ErrJobExceedTimeout),
+			code:      JobErrorTimeout,
+			retryable: true,
+		},
+		{
+			name: "panic",
+			err:  &PanicError{Value: "boom", Stack: []byte("stack")},
+			code: JobErrorPanic,
+		},
+		{
+			name: "cancelled",
+			err:  ErrJobCancelled,
+			code: JobErrorCancelled,
+		},
+		{
+			name:      "lost worker",
+			err:       Transient(ErrWorkerLost),
+			code:      JobErrorLostWorker,
+			retryable: true,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			jobErr := NewJobError(tc.err, 2)
+			assert.Equal(t, tc.code, jobErr.Code)
+			assert.Equal(t, tc.err.Error(), jobErr.Message)
+			assert.Equal(t, tc.retryable, jobErr.Retryable)
+			assert.Equal(t, 2, jobErr.Attempt)
+		})
+	}
+
+	t.Run("panic stack is a detail", func(t *testing.T) {
+		jobErr := NewJobError(&PanicError{Value: "boom", Stack: []byte("stack")}, 1)
+		assert.Equal(t, map[string]interface{}{"stack": "stack"}, jobErr.Details)
+	})
+}
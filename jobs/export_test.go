@@ -0,0 +1,46 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+// ConformanceBackends returns the backends set up by TestMain to the conformance tests of package jobs_test.
+func ConformanceBackends() (Store, utils.Transactioner, WorkerRegistry, JobLogStore, SettingsStore, map[string]Broker, map[string]ArtifactStore) {
+	brokers := map[string]Broker{
+		"rmq":           testBroker,
+		"redis-streams": NewRedisStreamBroker(testRedisClient, testLogger, "conformance"),
+		"postgres":      NewPostgresBroker(testDb, testLogger, "conformance"),
+	}
+
+	artifacts := map[string]ArtifactStore{
+		"local": testArtifacts,
+		"s3":    testS3Artifacts,
+	}
+
+	return testStore, testTransaction, testWorkers, testJobLogs, testSettings, brokers, artifacts
+}
+
+// Backends are the backends of the tests which do not depend on Postgres or Redis.
+type Backends struct {
+	Store         Store
+	Broker        Broker
+	Transactioner utils.Transactioner
+	JobLogs       JobLogStore
+	Workers       WorkerRegistry
+	Settings      SettingsStore
+}
+
+// memoryBackends returns the in-memory backends, package jobs cannot import them from package memory
+var memoryBackends func() Backends
+
+// UseMemoryBackends sets the backends TestMain runs the tests on when Docker is not available.
+func UseMemoryBackends(backends func() Backends) {
+	memoryBackends = backends
+}
+
+// RequireDocker skips a test of package jobs_test which needs the containers of TestMain.
+func RequireDocker(t *testing.T) {
+	requireDocker(t)
+}
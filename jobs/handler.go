@@ -1,6 +1,7 @@
 package jobs
 
 import (
+	"context"
 	"errors"
 	"fmt"
 	"net/http"
@@ -8,20 +9,37 @@ import (
 
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
+	"github.com/sirupsen/logrus"
 
 	"github.com/tuyentv96/hasty-challenge/config"
 )
 
 type HTTPHandler struct {
-	config  config.Config
-	routes  *echo.Echo
-	service Service
+	config     config.Config
+	logger     *logrus.Entry
+	routes     *echo.Echo
+	service    Service
+	limiter    RateLimiter
+	queueAdmin QueueAdmin
+	workers    WorkerRegistry
+	logs       JobLogStore
+	artifacts  ArtifactStore
+	settings   SettingsStore
+	checks     HealthChecks
 }
 
-func NewHTTPHandler(cfg config.Config, svc Service) *HTTPHandler {
+func NewHTTPHandler(cfg config.Config, logger *logrus.Entry, svc Service, limiter RateLimiter, queueAdmin QueueAdmin, workers WorkerRegistry, logs JobLogStore, artifacts ArtifactStore, settings SettingsStore, checks HealthChecks) *HTTPHandler {
 	h := HTTPHandler{
-		config:  cfg,
-		service: svc,
+		config:     cfg,
+		logger:     logger.WithField("tag", "http"),
+		service:    svc,
+		limiter:    limiter,
+		queueAdmin: queueAdmin,
+		workers:    workers,
+		logs:       logs,
+		artifacts:  artifacts,
+		settings:   settings,
+		checks:     checks,
 	}
 
 	h.InitRoutes()
@@ -31,6 +49,7 @@ func NewHTTPHandler(cfg config.Config, svc Service) *HTTPHandler {
 func (a *HTTPHandler) InitRoutes() {
 	a.routes = echo.New()
 	a.routes.HideBanner = true
+	a.routes.IPExtractor = ipExtractor(a.config.HTTPConfig)
 	a.routes.Use(middleware.Recover())
 
 	if a.config.HTTPLogger {
@@ -42,19 +61,46 @@ func (a *HTTPHandler) InitRoutes() {
 		AllowHeaders: []string{echo.HeaderOrigin, echo.HeaderContentType, echo.HeaderAccept},
 	}))
 
-	a.routes.GET("/health", func(context echo.Context) error {
-		return context.String(http.StatusOK, "OK")
-	})
+	// The tenant and admin keys identify the callers of the rate limits
+	apiKeys := make(map[string]string, len(a.config.APIKeys)+len(a.config.AdminAPIKeys))
+	for key, tenantId := range a.config.APIKeys {
+		apiKeys[key] = tenantId
+	}
+	for key, admin := range a.config.AdminAPIKeys {
+		apiKeys[key] = admin
+	}
+
+	a.routes.Use(RateLimitMiddleware(a.config.RateLimitConfig, a.logger, a.limiter, apiKeys))
+	a.routes.Use(TraceMiddleware())
+
+	a.routes.GET("/health", a.HealthHandler)
+	healthRoutes(a.routes, liveReport, a.checks)
 
-	v1 := a.routes.Group("/v1")
+	v1 := a.routes.Group("/v1", TenantMiddleware(a.config.APIKeys))
 	v1.POST("/jobs", a.SaveJobHandler)
+	// A nested group would apply the tenant middleware again, echo then routes POST /v1/jobs to its not found handler
+	v1.GET("/jobs/:id", a.GetJobHandler)
+	v1.GET("/jobs/:id/logs", a.GetJobLogsHandler)
+	v1.GET("/jobs/:id/artifacts", a.ListJobArtifactsHandler)
+	v1.GET("/jobs/:id/artifacts/:name", a.GetJobArtifactHandler)
+	v1.GET("/meta/statuses", a.GetStatusesHandler)
+
+	a.initAdminRoutes()
+}
+
+// Serve listens until Shutdown is called
+func (a *HTTPHandler) Serve() error {
+	err := a.routes.Start(fmt.Sprintf(":%d", a.config.HTTPConfig.HTTPPort))
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
 
-	jobs := v1.Group("/jobs")
-	jobs.GET("/:id", a.GetJobHandler)
+	return err
 }
 
-func (a *HTTPHandler) Serve() {
-	a.routes.Start(fmt.Sprintf(":%d", a.config.HTTPConfig.HTTPPort))
+// Shutdown stops accepting requests and waits for the pending ones
+func (a *HTTPHandler) Shutdown(ctx context.Context) error {
+	return a.routes.Shutdown(ctx)
 }
 
 func (a *HTTPHandler) GetJobHandler(ctx echo.Context) error {
@@ -63,7 +109,7 @@ func (a *HTTPHandler) GetJobHandler(ctx echo.Context) error {
 		return echo.NewHTTPError(http.StatusBadRequest, "failed to parse id")
 	}
 
-	result, err := a.service.GetJobByID(ctx.Request().Context(), id)
+	result, err := a.service.GetJobByID(ctx.Request().Context(), TenantFromContext(ctx), id)
 	if err != nil {
 		if errors.Is(err, ErrJobNotFound) {
 			return echo.NewHTTPError(http.StatusNotFound, ErrJobNotFound.Error())
@@ -75,16 +121,72 @@ func (a *HTTPHandler) GetJobHandler(ctx echo.Context) error {
 	return ctx.JSON(http.StatusOK, result)
 }
 
+// Health is the state of the service returned by GET /health.
+type Health struct {
+	Status       string   `json:"status"`
+	PausedTypes  []string `json:"paused_types"`
+	PausedQueues []string `json:"paused_queues"`
+}
+
+// HealthHandler tells the service is up, with the job types and queues whose jobs the workers leave in the queues.
+func (a *HTTPHandler) HealthHandler(ctx echo.Context) error {
+	health := Health{Status: "OK", PausedTypes: []string{}, PausedQueues: []string{}}
+
+	paused, err := PausedSettings(ctx.Request().Context(), a.settings)
+	if err != nil {
+		// the service is up even when the settings are out of reach
+		a.logger.WithError(err).Warn("failed to load the paused queues")
+		return ctx.JSON(http.StatusOK, health)
+	}
+
+	health.PausedTypes = paused.PausedTypes
+	health.PausedQueues = paused.PausedQueues
+	return ctx.JSON(http.StatusOK, health)
+}
+
+// GetStatusesHandler returns the state machine of a job, so clients know the statuses and the changes between them.
+func (a *HTTPHandler) GetStatusesHandler(ctx echo.Context) error {
+	return ctx.JSON(http.StatusOK, JobStatusMachine())
+}
+
 func (a *HTTPHandler) SaveJobHandler(ctx echo.Context) error {
 	var job JobPayload
 	if err := ctx.Bind(&job); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
 	}
 
-	result, err := a.service.SaveJob(ctx.Request().Context(), job)
+	if job.Type == "" {
+		job.Type = DefaultJobType
+	}
+
+	if err := a.checkJobType(ctx.Request().Context(), job.Type); err != nil {
+		return err
+	}
+
+	result, err := a.service.SaveJob(ctx.Request().Context(), TenantFromContext(ctx), job)
 	if err != nil {
+		if errors.Is(err, ErrInvalidPriority) {
+			return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+		}
+
 		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
 	}
 
 	return ctx.JSON(http.StatusCreated, result)
 }
+
+// checkJobType rejects the job types no active worker serves, their jobs would never run.
+func (a *HTTPHandler) checkJobType(ctx context.Context, jobType string) error {
+	workers, err := a.workers.Workers(ctx)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	for _, worker := range workers {
+		if worker.Serves(jobType) {
+			return nil
+		}
+	}
+
+	return echo.NewHTTPError(http.StatusUnprocessableEntity, fmt.Sprintf("%s: %s", ErrJobTypeNotServed.Error(), jobType))
+}
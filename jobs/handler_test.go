@@ -3,6 +3,7 @@ package jobs
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +13,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/benbjohnson/clock"
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/labstack/echo/v4"
 	"github.com/stretchr/testify/assert"
@@ -21,8 +23,26 @@ import (
 	"github.com/tuyentv96/hasty-challenge/utils"
 )
 
+// initTestHandler registers a worker serving the job types of the tests, otherwise the API rejects their jobs.
 func initTestHandler(cfg config.Config, svc Service) *HTTPHandler {
-	return NewHTTPHandler(cfg, svc)
+	_ = testWorkers.Register(context.Background(), WorkerInfo{
+		Id:        "test-worker",
+		Hostname:  "test",
+		Types:     []string{DefaultJobType, "report", "export"},
+		StartedAt: utils.TimeNow(),
+	})
+
+	return NewHTTPHandler(cfg, testLogger, svc, NewRedisRateLimiter(testRedisClient, clock.New()), NewJobQueueAdmin(testBroker, QueueName, testSettings), testWorkers, testJobLogs, testArtifacts, testSettings, testHealthChecks())
+}
+
+// testHealthChecks are the readiness checks of the API run with the test containers, none on the in-memory backends
+func testHealthChecks() HealthChecks {
+	if !testDocker {
+		return HealthChecks{}
+	}
+
+	cfg := config.Config{StoreConfig: config.StoreConfig{StoreBackend: config.StoreBackendPostgres}, QueueConfig: config.QueueConfig{QueueBackend: config.QueueBackendRedis}}
+	return NewHealthChecks(cfg, testDb, testRedisClient, testBroker)
 }
 
 func jobFromRec(t *testing.T, rec *httptest.ResponseRecorder) Job {
@@ -34,14 +54,18 @@ func jobFromRec(t *testing.T, rec *httptest.ResponseRecorder) Job {
 }
 
 type testRequest struct {
-	method string
-	uri    string
-	body   io.Reader
+	method  string
+	uri     string
+	body    io.Reader
+	headers map[string]string
 }
 
 func (tr *testRequest) do(handler *HTTPHandler) *httptest.ResponseRecorder {
 	req := httptest.NewRequest(tr.method, tr.uri, tr.body)
 	req.Header.Set(echo.HeaderContentType, echo.MIMEApplicationJSON)
+	for key, value := range tr.headers {
+		req.Header.Set(key, value)
+	}
 	rec := httptest.NewRecorder()
 
 	handler.routes.ServeHTTP(rec, req)
@@ -62,6 +86,56 @@ func TestHandlerHealth(t *testing.T) {
 
 	rec := tr.do(handler)
 	assert.Equal(t, http.StatusOK, rec.Code)
+
+	var health Health
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &health))
+	assert.Equal(t, "OK", health.Status)
+}
+
+func TestHandlerHealthChecks(t *testing.T) {
+	clock := initTestClock()
+	cfg := config.Config{}
+	queueName := gofakeit.UUID()
+	svc := initTestService(t, queueName, clock)
+
+	t.Run("live", func(t *testing.T) {
+		handler := initTestHandler(cfg, svc)
+		rec := (&testRequest{method: http.MethodGet, uri: "/health/live"}).do(handler)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var report HealthReport
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		assert.Equal(t, HealthStatusOK, report.Status)
+	})
+
+	t.Run("ready", func(t *testing.T) {
+		requireDocker(t)
+		handler := initTestHandler(cfg, svc)
+		rec := (&testRequest{method: http.MethodGet, uri: "/health/ready"}).do(handler)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var report HealthReport
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		assert.Equal(t, HealthStatusOK, report.Status)
+		assert.Equal(t, HealthStatusOK, report.Checks["postgres"].Status)
+		assert.Equal(t, HealthStatusOK, report.Checks["redis"].Status)
+		assert.Equal(t, HealthStatusOK, report.Checks["queue_heartbeat"].Status)
+	})
+
+	t.Run("not ready when a check fails", func(t *testing.T) {
+		handler := initTestHandler(cfg, svc)
+		handler.checks["postgres"] = func(ctx context.Context) error {
+			return errors.New("connection refused")
+		}
+
+		rec := (&testRequest{method: http.MethodGet, uri: "/health/ready"}).do(handler)
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+
+		var report HealthReport
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &report))
+		assert.Equal(t, HealthStatusFailed, report.Status)
+		assert.Equal(t, HealthCheckResult{Status: HealthStatusFailed, Error: "connection refused"}, report.Checks["postgres"])
+	})
 }
 
 func TestHandlerSaveJob(t *testing.T) {
@@ -92,6 +166,20 @@ func TestHandlerSaveJob(t *testing.T) {
 		assert.NotZero(t, resp.Id)
 	})
 
+	t.Run("reject job type no worker serves", func(t *testing.T) {
+		tr := testRequest{
+			method: http.MethodPost,
+			uri:    "/v1/jobs",
+			body:   strings.NewReader(fmt.Sprintf(`{"object_id": %d, "type": "unserved"}`, newTestObjectId())),
+		}
+
+		svc := initTestService(t, gofakeit.UUID(), initTestClock())
+		handler := initTestHandler(config.Config{}, svc)
+
+		rec := tr.do(handler)
+		assert.Equal(t, http.StatusUnprocessableEntity, rec.Code)
+	})
+
 	t.Run("save same object_id in five minutes, return same job", func(t *testing.T) {
 		clock := initTestClock()
 
@@ -100,7 +188,7 @@ func TestHandlerSaveJob(t *testing.T) {
 		svc := initTestService(t, queueName, clock)
 
 		clock.Set(now)
-		job, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
 		handler := initTestHandler(cfg, svc)
@@ -128,7 +216,7 @@ func TestHandlerSaveJob(t *testing.T) {
 		handler := initTestHandler(cfg, svc)
 
 		clock.Set(now.Add(-60 * time.Minute))
-		job1, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job1, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
 		tr := testRequest{
@@ -174,7 +262,7 @@ func TestHandlerGetJob(t *testing.T) {
 	queueName := gofakeit.UUID()
 	svc := initTestService(t, queueName, clock)
 
-	job, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 	require.NoError(t, err)
 
 	testcases := []struct {
@@ -217,3 +305,180 @@ func TestHandlerGetJob(t *testing.T) {
 		})
 	}
 }
+
+func TestHandlerGetStatuses(t *testing.T) {
+	svc := initTestService(t, gofakeit.UUID(), initTestClock())
+	handler := initTestHandler(config.Config{}, svc)
+
+	tr := testRequest{method: http.MethodGet, uri: "/v1/meta/statuses"}
+	rec := tr.do(handler)
+	require.Equal(t, http.StatusOK, rec.Code)
+
+	var statuses []JobStatusInfo
+	require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &statuses))
+	assert.Equal(t, JobStatusMachine(), statuses)
+}
+
+func TestHandlerTenantIsolation(t *testing.T) {
+	clock := initTestClock()
+	cfg := config.Config{
+		AuthConfig: config.AuthConfig{
+			APIKeys: map[string]string{
+				"key-a": "tenant-a",
+				"key-b": "tenant-b",
+			},
+		},
+	}
+	queueName := gofakeit.UUID()
+	svc := initTestService(t, queueName, clock)
+	handler := initTestHandler(cfg, svc)
+	objectId := newTestObjectId()
+
+	save := func(apiKey string) Job {
+		tr := testRequest{
+			method:  http.MethodPost,
+			uri:     "/v1/jobs",
+			body:    strings.NewReader(fmt.Sprintf(`{"object_id": %d}`, objectId)),
+			headers: map[string]string{"X-API-Key": apiKey},
+		}
+
+		rec := tr.do(handler)
+		require.Equal(t, http.StatusCreated, rec.Code)
+		return jobFromRec(t, rec)
+	}
+
+	jobA := save("key-a")
+	jobB := save("key-b")
+	assert.Equal(t, "tenant-a", jobA.TenantId)
+	assert.Equal(t, "tenant-b", jobB.TenantId)
+	// object_id dedupe is per tenant
+	assert.NotEqual(t, jobA.Id, jobB.Id)
+
+	testcases := []struct {
+		name       string
+		id         int
+		headers    map[string]string
+		statusCode int
+	}{
+		{
+			name:       "tenant reads its own job",
+			id:         jobA.Id,
+			headers:    map[string]string{"X-API-Key": "key-a"},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "tenant reads its own job with bearer token",
+			id:         jobB.Id,
+			headers:    map[string]string{echo.HeaderAuthorization: "Bearer key-b"},
+			statusCode: http.StatusOK,
+		},
+		{
+			name:       "tenant can not read job of another tenant",
+			id:         jobA.Id,
+			headers:    map[string]string{"X-API-Key": "key-b"},
+			statusCode: http.StatusNotFound,
+		},
+		{
+			name:       "unknown api key",
+			id:         jobA.Id,
+			headers:    map[string]string{"X-API-Key": "key-c"},
+			statusCode: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing api key",
+			id:         jobA.Id,
+			statusCode: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tc := range testcases {
+		t.Run(tc.name, func(t *testing.T) {
+			tr := testRequest{
+				method:  http.MethodGet,
+				uri:     fmt.Sprintf("/v1/jobs/%d", tc.id),
+				headers: tc.headers,
+			}
+
+			rec := tr.do(handler)
+			assert.Equal(t, tc.statusCode, rec.Code)
+		})
+	}
+}
+
+func TestHandlerRateLimit(t *testing.T) {
+	clock := initTestClock()
+	apiKey, otherApiKey := gofakeit.UUID(), gofakeit.UUID()
+	cfg := config.Config{
+		RateLimitConfig: config.RateLimitConfig{
+			RateLimitRoutes: config.RateLimitRoutes{
+				"POST /v1/jobs": {Limit: 2, Window: time.Minute},
+			},
+		},
+		AuthConfig: config.AuthConfig{APIKeys: map[string]string{apiKey: "team-a", otherApiKey: "team-b"}},
+	}
+	queueName := gofakeit.UUID()
+	svc := initTestService(t, queueName, clock)
+	handler := initTestHandler(cfg, svc)
+	handler.limiter = newTestRateLimiter()
+	handler.InitRoutes()
+
+	save := func(apiKey string) *httptest.ResponseRecorder {
+		tr := testRequest{
+			method:  http.MethodPost,
+			uri:     "/v1/jobs",
+			body:    strings.NewReader(fmt.Sprintf(`{"object_id": %d}`, newTestObjectId())),
+			headers: map[string]string{"X-API-Key": apiKey},
+		}
+
+		return tr.do(handler)
+	}
+
+	rec := save(apiKey)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "2", rec.Header().Get(HeaderRateLimitLimit))
+	assert.Equal(t, "1", rec.Header().Get(HeaderRateLimitRemaining))
+
+	rec = save(apiKey)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.Equal(t, "0", rec.Header().Get(HeaderRateLimitRemaining))
+
+	rec = save(apiKey)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get(echo.HeaderRetryAfter))
+	assert.NotEmpty(t, rec.Header().Get(HeaderRateLimitReset))
+
+	// another client has its own limit
+	rec = save(otherApiKey)
+	assert.Equal(t, http.StatusCreated, rec.Code)
+
+	// unknown keys share the limit of their IP
+	rec = save(gofakeit.UUID())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = save(gofakeit.UUID())
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	rec = save(gofakeit.UUID())
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// the forwarded IP of a caller which is not a trusted proxy is ignored
+	tr := testRequest{
+		method: http.MethodPost,
+		uri:    "/v1/jobs",
+		body:   strings.NewReader(fmt.Sprintf(`{"object_id": %d}`, newTestObjectId())),
+		headers: map[string]string{
+			"X-API-Key":              gofakeit.UUID(),
+			echo.HeaderXForwardedFor: gofakeit.IPv4Address(),
+			echo.HeaderXRealIP:       gofakeit.IPv4Address(),
+		},
+	}
+	rec = tr.do(handler)
+	assert.Equal(t, http.StatusTooManyRequests, rec.Code)
+
+	// routes without limit are not limited
+	tr = testRequest{
+		method:  http.MethodGet,
+		uri:     "/v1/jobs/1",
+		headers: map[string]string{"X-API-Key": apiKey},
+	}
+	rec = tr.do(handler)
+	assert.Empty(t, rec.Header().Get(HeaderRateLimitLimit))
+}
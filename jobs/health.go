@@ -0,0 +1,171 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v9/orm"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+const (
+	HealthStatusOK     = "OK"
+	HealthStatusFailed = "FAILED"
+
+	// A check which does not answer in time fails, so a hanging dependency does not hang the probe
+	healthCheckTimeout = 2 * time.Second
+)
+
+// HealthCheck tells whether a dependency of the process is usable.
+type HealthCheck func(ctx context.Context) error
+
+// HealthChecks are the checks of GET /health/ready by name.
+type HealthChecks map[string]HealthCheck
+
+// NewHealthChecks returns the checks of the dependencies used with cfg, db is nil when Postgres is not used.
+func NewHealthChecks(cfg config.Config, db orm.DB, redisClient *redis.Client, broker Broker) HealthChecks {
+	checks := make(HealthChecks)
+	if cfg.UsesPostgres() && db != nil {
+		checks["postgres"] = PostgresHealthCheck(db)
+	}
+
+	if cfg.QueueConfig.UsesRedis() {
+		checks["redis"] = RedisHealthCheck(redisClient)
+	}
+
+	if heartbeat, ok := broker.(interface {
+		CheckHeartbeat(ctx context.Context) error
+	}); ok {
+		checks["queue_heartbeat"] = heartbeat.CheckHeartbeat
+	}
+
+	return checks
+}
+
+func PostgresHealthCheck(db orm.DB) HealthCheck {
+	return func(ctx context.Context) error {
+		_, err := db.ExecOneContext(ctx, "SELECT 1")
+		return err
+	}
+}
+
+func RedisHealthCheck(client *redis.Client) HealthCheck {
+	return func(ctx context.Context) error {
+		return client.Ping(ctx).Err()
+	}
+}
+
+// HealthCheckResult is the outcome of a check, Error tells why it failed.
+type HealthCheckResult struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// HealthReport is returned by GET /health/live and GET /health/ready, Status is FAILED when one of the checks failed.
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks"`
+	// Consumers are the job consumers of a worker, on its admin server
+	Consumers []ConsumerState `json:"consumers,omitempty"`
+}
+
+func (r HealthReport) IsOK() bool {
+	return r.Status == HealthStatusOK
+}
+
+// Run runs the checks at once, each of them gets healthCheckTimeout to answer.
+func (c HealthChecks) Run(ctx context.Context) HealthReport {
+	report := HealthReport{Status: HealthStatusOK, Checks: make(map[string]HealthCheckResult, len(c))}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range c {
+		wg.Add(1)
+		go func(name string, check HealthCheck) {
+			defer wg.Done()
+
+			ctx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			result := HealthCheckResult{Status: HealthStatusOK}
+			if err := check(ctx); err != nil {
+				result = HealthCheckResult{Status: HealthStatusFailed, Error: err.Error()}
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Checks[name] = result
+			if result.Status != HealthStatusOK {
+				report.Status = HealthStatusFailed
+			}
+		}(name, check)
+	}
+
+	wg.Wait()
+	return report
+}
+
+// healthRoutes adds GET /health/live and GET /health/ready to e, they answer 503 when the report is not OK.
+// live reports whether the process works at all, it must not depend on other services.
+func healthRoutes(e *echo.Echo, live func() HealthReport, checks HealthChecks) {
+	respond := func(ctx echo.Context, report HealthReport) error {
+		if !report.IsOK() {
+			return ctx.JSON(http.StatusServiceUnavailable, report)
+		}
+
+		return ctx.JSON(http.StatusOK, report)
+	}
+
+	e.GET("/health/live", func(ctx echo.Context) error {
+		return respond(ctx, live())
+	})
+
+	e.GET("/health/ready", func(ctx echo.Context) error {
+		return respond(ctx, checks.Run(ctx.Request().Context()))
+	})
+}
+
+// liveReport is the liveness of a process without consumers, it is live as long as it answers.
+func liveReport() HealthReport {
+	return HealthReport{Status: HealthStatusOK, Checks: map[string]HealthCheckResult{}}
+}
+
+// ConsumerState is the job a consumer of a worker is running, a consumer is stuck once it runs a job past its deadline.
+type ConsumerState struct {
+	Id       string     `json:"id"`
+	JobId    int        `json:"job_id,omitempty"`
+	Since    *time.Time `json:"since,omitempty"`
+	Deadline *time.Time `json:"deadline,omitempty"`
+	Stuck    bool       `json:"stuck"`
+}
+
+// consumersReport is the liveness of a worker, it fails when one of its consumers is stuck.
+func consumersReport(consumers []ConsumerState) HealthReport {
+	report := liveReport()
+	report.Consumers = consumers
+
+	var stuck []string
+	for _, consumer := range consumers {
+		if consumer.Stuck {
+			stuck = append(stuck, fmt.Sprintf("%s runs job %d since %s", consumer.Id, consumer.JobId, consumer.Since.Format(time.RFC3339)))
+		}
+	}
+
+	result := HealthCheckResult{Status: HealthStatusOK}
+	if len(stuck) > 0 {
+		sort.Strings(stuck)
+		result = HealthCheckResult{Status: HealthStatusFailed, Error: "stuck consumers: " + strings.Join(stuck, "; ")}
+		report.Status = HealthStatusFailed
+	}
+
+	report.Checks["consumers"] = result
+	return report
+}
@@ -0,0 +1,96 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+func TestHealthChecksRun(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("ok", func(t *testing.T) {
+		requireDocker(t)
+		report := HealthChecks{
+			"postgres": PostgresHealthCheck(testDb),
+			"redis":    RedisHealthCheck(testRedisClient),
+		}.Run(ctx)
+
+		assert.True(t, report.IsOK())
+		assert.Equal(t, map[string]HealthCheckResult{
+			"postgres": {Status: HealthStatusOK},
+			"redis":    {Status: HealthStatusOK},
+		}, report.Checks)
+	})
+
+	t.Run("failed check", func(t *testing.T) {
+		report := HealthChecks{
+			"working": func(ctx context.Context) error {
+				return nil
+			},
+			"broken": func(ctx context.Context) error {
+				return errors.New("connection refused")
+			},
+		}.Run(ctx)
+
+		assert.False(t, report.IsOK())
+		assert.Equal(t, HealthCheckResult{Status: HealthStatusOK}, report.Checks["working"])
+		assert.Equal(t, HealthCheckResult{Status: HealthStatusFailed, Error: "connection refused"}, report.Checks["broken"])
+	})
+
+	t.Run("check timed out", func(t *testing.T) {
+		report := HealthChecks{
+			"hanging": func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}.Run(ctx)
+
+		assert.False(t, report.IsOK())
+		assert.Equal(t, HealthCheckResult{Status: HealthStatusFailed, Error: context.DeadlineExceeded.Error()}, report.Checks["hanging"])
+	})
+
+	t.Run("queue heartbeat", func(t *testing.T) {
+		requireDocker(t)
+		cfg := config.Config{QueueConfig: config.QueueConfig{QueueBackend: config.QueueBackendRedis}}
+		checks := NewHealthChecks(cfg, nil, testRedisClient, testBroker)
+
+		assert.Contains(t, checks, "queue_heartbeat")
+		assert.NotContains(t, checks, "postgres")
+		assert.True(t, checks.Run(ctx).IsOK())
+	})
+}
+
+func TestConsumerState(t *testing.T) {
+	clock := initTestClock()
+	consumer := initTestConsumer(nil, clock, nil)
+	consumer.cfg.JobConfig.TimeoutInSeconds = 60
+
+	assert.Equal(t, ConsumerState{Id: consumer.workerId}, consumer.State())
+
+	since := clock.Now().UTC()
+	consumer.setRunning(Job{Id: 42})
+
+	state := consumer.State()
+	assert.Equal(t, 42, state.JobId)
+	assert.Equal(t, since, *state.Since)
+	assert.Equal(t, since.Add(time.Minute+consumerStuckGrace), *state.Deadline)
+	assert.False(t, state.Stuck)
+
+	clock.Add(time.Minute + consumerStuckGrace + time.Second)
+	assert.True(t, consumer.State().Stuck)
+
+	report := consumersReport([]ConsumerState{consumer.State(), {Id: "idle"}})
+	assert.False(t, report.IsOK())
+	assert.Len(t, report.Consumers, 2)
+	assert.Contains(t, report.Checks["consumers"].Error, "runs job 42")
+
+	consumer.setRunning(Job{})
+	assert.Equal(t, ConsumerState{Id: consumer.workerId}, consumer.State())
+	assert.True(t, consumersReport([]ConsumerState{consumer.State()}).IsOK())
+}
@@ -0,0 +1,187 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v9/orm"
+	"github.com/sirupsen/logrus"
+)
+
+// JobLogLine is a line logged by a job with the logger of JobLogger.
+type JobLogLine struct {
+	tableName struct{} `pg:"job_logs"`
+
+	// Id orders the lines of a job, it is the cursor of JobLogStore.JobLogs
+	Id        int64                  `json:"id" pg:"id"`
+	TenantId  string                 `json:"-" pg:"tenant_id"`
+	JobId     int                    `json:"job_id" pg:"job_id"`
+	Attempt   int                    `json:"attempt" pg:"attempt,use_zero"`
+	Level     string                 `json:"level" pg:"level"`
+	Message   string                 `json:"message" pg:"message"`
+	Fields    map[string]interface{} `json:"fields,omitempty" pg:"fields,type:jsonb"`
+	CreatedAt time.Time              `json:"created_at" pg:"created_at"`
+}
+
+// JobLogStore keeps the log lines of jobs, they are written outside of the transaction of the job so they survive its rollback.
+type JobLogStore interface {
+	AppendJobLog(ctx context.Context, line JobLogLine) (JobLogLine, error)
+	// JobLogs returns at most limit lines of a job logged after the line afterId, the oldest first
+	JobLogs(ctx context.Context, tenantId string, jobId int, afterId int64, limit int) ([]JobLogLine, error)
+}
+
+type JobLogStoreImpl struct {
+	db orm.DB
+}
+
+func NewJobLogStore(db orm.DB) *JobLogStoreImpl {
+	return &JobLogStoreImpl{
+		db: db,
+	}
+}
+
+func (s *JobLogStoreImpl) AppendJobLog(ctx context.Context, line JobLogLine) (JobLogLine, error) {
+	if _, err := s.db.ModelContext(ctx, &line).Returning("*").Insert(); err != nil {
+		return JobLogLine{}, err
+	}
+
+	line.CreatedAt = line.CreatedAt.UTC()
+	return line, nil
+}
+
+func (s *JobLogStoreImpl) JobLogs(ctx context.Context, tenantId string, jobId int, afterId int64, limit int) ([]JobLogLine, error) {
+	var result []JobLogLine
+	err := s.db.ModelContext(ctx, &result).
+		Where("tenant_id = ?", tenantId).
+		Where("job_id = ?", jobId).
+		Where("id > ?", afterId).
+		Order("id").
+		Limit(limit).
+		Select()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range result {
+		result[i].CreatedAt = result[i].CreatedAt.UTC()
+	}
+
+	return result, nil
+}
+
+type jobLoggerKey struct{}
+
+// WithJobLogger returns a copy of ctx carrying the logger of a job, see JobLogger.
+func WithJobLogger(ctx context.Context, logger *logrus.Entry) context.Context {
+	return context.WithValue(ctx, jobLoggerKey{}, logger)
+}
+
+// JobLogger returns the logger of the job run with ctx, its lines are written to the log of the process and kept
+// in the JobLogStore. It falls back to the standard logger outside of a job.
+func JobLogger(ctx context.Context) *logrus.Entry {
+	if logger, ok := ctx.Value(jobLoggerKey{}).(*logrus.Entry); ok {
+		return logger
+	}
+
+	return logrus.NewEntry(logrus.StandardLogger())
+}
+
+// NewJobLogger returns a logger of an attempt of job, it logs like base and keeps up to maxBytes of messages in logs.
+// maxBytes of 0 disables the capture.
+func NewJobLogger(base *logrus.Entry, logs JobLogStore, job Job, maxBytes int) *logrus.Entry {
+	if maxBytes <= 0 || logs == nil {
+		return base.WithField("jobId", job.Id)
+	}
+
+	// Hooks belong to a logger, the job gets its own logger writing to the same output
+	logger := logrus.New()
+	logger.Out = base.Logger.Out
+	logger.Formatter = base.Logger.Formatter
+	logger.Level = base.Logger.Level
+	logger.ReportCaller = base.Logger.ReportCaller
+	for level, hooks := range base.Logger.Hooks {
+		logger.Hooks[level] = append([]logrus.Hook(nil), hooks...)
+	}
+
+	logger.AddHook(&jobLogHook{
+		logs:     logs,
+		tenantId: job.TenantId,
+		jobId:    job.Id,
+		attempt:  job.Attempts,
+		maxBytes: maxBytes,
+	})
+
+	return logger.WithFields(base.Data).WithField("jobId", job.Id)
+}
+
+// jobLogHook stores the lines of a job until they reach maxBytes, a last line tells the log was truncated.
+type jobLogHook struct {
+	logs     JobLogStore
+	tenantId string
+	jobId    int
+	attempt  int
+	maxBytes int
+
+	mu        sync.Mutex
+	written   int
+	truncated bool
+}
+
+func (h *jobLogHook) Levels() []logrus.Level {
+	return logrus.AllLevels
+}
+
+func (h *jobLogHook) Fire(entry *logrus.Entry) error {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.truncated {
+		return nil
+	}
+
+	line := JobLogLine{
+		TenantId:  h.tenantId,
+		JobId:     h.jobId,
+		Attempt:   h.attempt,
+		Level:     entry.Level.String(),
+		Message:   entry.Message,
+		Fields:    jobLogFields(entry.Data),
+		CreatedAt: entry.Time.UTC(),
+	}
+
+	if h.written+len(line.Message) > h.maxBytes {
+		h.truncated = true
+		line.Level = logrus.WarnLevel.String()
+		line.Message = fmt.Sprintf("log truncated, the job logged more than %d bytes", h.maxBytes)
+		line.Fields = nil
+	}
+
+	h.written += len(line.Message)
+	// The entry may be logged with the context of a transaction, the line must not be rolled back with it
+	_, err := h.logs.AppendJobLog(context.Background(), line)
+	return err
+}
+
+// jobLogFields returns the fields of a line without those every line of the job has.
+func jobLogFields(data logrus.Fields) map[string]interface{} {
+	fields := make(map[string]interface{}, len(data))
+	for key, value := range data {
+		if key == "jobId" || key == "tag" || key == "traceparent" {
+			continue
+		}
+
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+
+		fields[key] = value
+	}
+
+	if len(fields) == 0 {
+		return nil
+	}
+
+	return fields
+}
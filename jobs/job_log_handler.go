@@ -0,0 +1,136 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	defaultJobLogsLimit = 100
+	maxJobLogsLimit     = 1000
+)
+
+var (
+	// jobLogsFollowInterval is how often a follow request reads the new lines of a job
+	jobLogsFollowInterval = time.Second
+	// jobLogsFollowTimeout ends a follow request of a job which runs for long, the client follows again from its last line
+	jobLogsFollowTimeout = 10 * time.Minute
+)
+
+// GetJobLogsHandler returns the log lines of a job logged after the line ?after=<id>, the oldest first.
+// With ?follow=true it streams them as NDJSON until the job is finished, for jobLogsFollowTimeout at most.
+func (a *HTTPHandler) GetJobLogsHandler(ctx echo.Context) error {
+	id, err := strconv.Atoi(ctx.Param("id"))
+	if err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to parse id")
+	}
+
+	after, err := queryInt(ctx, "after", 0)
+	if err != nil || after < 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to parse after")
+	}
+
+	limit, err := queryInt(ctx, "limit", defaultJobLogsLimit)
+	if err != nil || limit <= 0 || limit > maxJobLogsLimit {
+		return echo.NewHTTPError(http.StatusBadRequest, "limit must be between 1 and "+strconv.Itoa(maxJobLogsLimit))
+	}
+
+	tenantId := TenantFromContext(ctx)
+	if _, err := a.service.GetJobByID(ctx.Request().Context(), tenantId, id); err != nil {
+		if errors.Is(err, ErrJobNotFound) {
+			return echo.NewHTTPError(http.StatusNotFound, ErrJobNotFound.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if follow, _ := strconv.ParseBool(ctx.QueryParam("follow")); follow {
+		return a.followJobLogs(ctx, tenantId, id, int64(after))
+	}
+
+	lines, err := a.logs.JobLogs(ctx.Request().Context(), tenantId, id, int64(after), limit)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if lines == nil {
+		lines = []JobLogLine{}
+	}
+
+	return ctx.JSON(http.StatusOK, lines)
+}
+
+// followJobLogs writes the lines of a job as they are logged, until the job is finished, the client goes away
+// or the follow timeout is reached.
+func (a *HTTPHandler) followJobLogs(ctx echo.Context, tenantId string, jobId int, after int64) error {
+	reqCtx := ctx.Request().Context()
+	resp := ctx.Response()
+	resp.Header().Set(echo.HeaderContentType, "application/x-ndjson")
+	resp.WriteHeader(http.StatusOK)
+	resp.Flush()
+
+	encoder := json.NewEncoder(resp)
+	ticker := time.NewTicker(jobLogsFollowInterval)
+	defer ticker.Stop()
+	timeout := time.NewTimer(jobLogsFollowTimeout)
+	defer timeout.Stop()
+
+	for {
+		// A full page is followed by the next one at once, the client may have left meanwhile
+		if reqCtx.Err() != nil {
+			return nil
+		}
+
+		// The status is read before the lines, the last lines of a finished job are written before stopping
+		job, err := a.service.GetJobByID(reqCtx, tenantId, jobId)
+		if err != nil {
+			a.logger.WithError(err).WithField("jobId", jobId).Error("failed to follow job logs")
+			return nil
+		}
+
+		lines, err := a.logs.JobLogs(reqCtx, tenantId, jobId, after, maxJobLogsLimit)
+		if err != nil {
+			a.logger.WithError(err).WithField("jobId", jobId).Error("failed to follow job logs")
+			return nil
+		}
+
+		for _, line := range lines {
+			if err := encoder.Encode(line); err != nil {
+				return nil
+			}
+
+			after = line.Id
+		}
+
+		resp.Flush()
+		if len(lines) == maxJobLogsLimit {
+			continue
+		}
+
+		if job.Status.IsFinished() {
+			return nil
+		}
+
+		select {
+		case <-reqCtx.Done():
+			return nil
+		case <-timeout.C:
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func queryInt(ctx echo.Context, name string, defaultValue int) (int, error) {
+	value := ctx.QueryParam(name)
+	if value == "" {
+		return defaultValue, nil
+	}
+
+	return strconv.Atoi(value)
+}
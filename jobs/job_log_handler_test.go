@@ -0,0 +1,144 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+func TestHandlerGetJobLogs(t *testing.T) {
+	ctx := context.Background()
+	svc := initTestService(t, gofakeit.UUID(), initTestClock())
+	handler := initTestHandler(config.Config{}, svc)
+
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+	require.NoError(t, err)
+	job, err = svc.ClaimJob(ctx, job)
+	require.NoError(t, err)
+
+	logger := NewJobLogger(testLogger, testJobLogs, job, 1024)
+	for i := 0; i < 3; i++ {
+		logger.Infof("line %d", i)
+	}
+
+	getLines := func(t *testing.T, query string) []JobLogLine {
+		tr := testRequest{method: http.MethodGet, uri: fmt.Sprintf("/v1/jobs/%d/logs%s", job.Id, query)}
+		rec := tr.do(handler)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var lines []JobLogLine
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &lines))
+		return lines
+	}
+
+	t.Run("get lines", func(t *testing.T) {
+		lines := getLines(t, "")
+		require.Len(t, lines, 3)
+		assert.Equal(t, "line 0", lines[0].Message)
+
+		after := getLines(t, fmt.Sprintf("?after=%d&limit=1", lines[0].Id))
+		require.Len(t, after, 1)
+		assert.Equal(t, "line 1", after[0].Message)
+
+		assert.Empty(t, getLines(t, fmt.Sprintf("?after=%d", lines[2].Id)))
+	})
+
+	t.Run("follow until the job is finished", func(t *testing.T) {
+		jobLogsFollowInterval = 100 * time.Millisecond
+		defer func() { jobLogsFollowInterval = time.Second }()
+
+		server := httptest.NewServer(handler.routes)
+		defer server.Close()
+
+		resp, err := http.Get(fmt.Sprintf("%s/v1/jobs/%d/logs?follow=true", server.URL, job.Id))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		assert.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+
+		go func() {
+			time.Sleep(300 * time.Millisecond)
+			logger.Info("line 3")
+			_, _ = svc.SetJobSuccess(ctx, job)
+		}()
+
+		var messages []string
+		scanner := bufio.NewScanner(resp.Body)
+		for scanner.Scan() {
+			var line JobLogLine
+			require.NoError(t, json.Unmarshal(scanner.Bytes(), &line))
+			messages = append(messages, line.Message)
+		}
+
+		assert.Equal(t, []string{"line 0", "line 1", "line 2", "line 3"}, messages, "the response ends with the job")
+	})
+
+	t.Run("stop following once the client left", func(t *testing.T) {
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+		NewJobLogger(testLogger, testJobLogs, job, 1024).Info("line 0")
+
+		// the client leaves once the stream started
+		left, cancel := context.WithCancel(ctx)
+		defer cancel()
+		req := httptest.NewRequest(http.MethodGet, fmt.Sprintf("/v1/jobs/%d/logs?follow=true", job.Id), nil).WithContext(left)
+		rec := httptest.NewRecorder()
+		handler.routes.ServeHTTP(cancelOnFlush{ResponseRecorder: rec, cancel: cancel}, req)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Body.String(), "no page is read for a client which left")
+	})
+
+	t.Run("stop following after the timeout", func(t *testing.T) {
+		jobLogsFollowInterval = 10 * time.Millisecond
+		jobLogsFollowTimeout = 100 * time.Millisecond
+		defer func() {
+			jobLogsFollowInterval = time.Second
+			jobLogsFollowTimeout = 10 * time.Minute
+		}()
+
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+		NewJobLogger(testLogger, testJobLogs, job, 1024).Info("line 0")
+
+		// the job never finishes, the response ends anyway
+		tr := testRequest{method: http.MethodGet, uri: fmt.Sprintf("/v1/jobs/%d/logs?follow=true", job.Id)}
+		rec := tr.do(handler)
+		assert.Equal(t, http.StatusOK, rec.Code)
+
+		var line JobLogLine
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &line))
+		assert.Equal(t, "line 0", line.Message)
+	})
+
+	t.Run("unknown job", func(t *testing.T) {
+		tr := testRequest{method: http.MethodGet, uri: "/v1/jobs/-1/logs"}
+		assert.Equal(t, http.StatusNotFound, tr.do(handler).Code)
+	})
+
+	t.Run("invalid limit", func(t *testing.T) {
+		tr := testRequest{method: http.MethodGet, uri: fmt.Sprintf("/v1/jobs/%d/logs?limit=0", job.Id)}
+		assert.Equal(t, http.StatusBadRequest, tr.do(handler).Code)
+	})
+}
+
+// cancelOnFlush cancels the request of the response once it is flushed
+type cancelOnFlush struct {
+	*httptest.ResponseRecorder
+	cancel func()
+}
+
+func (w cancelOnFlush) Flush() {
+	w.cancel()
+	w.ResponseRecorder.Flush()
+}
@@ -0,0 +1,84 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobLogger(t *testing.T) {
+	ctx := context.Background()
+	newJob := func() Job {
+		return Job{Id: gofakeit.Number(1, 1000000), TenantId: gofakeit.UUID(), Attempts: 2}
+	}
+
+	t.Run("keep the lines of the job", func(t *testing.T) {
+		var out bytes.Buffer
+		base := logrus.New()
+		base.Out = &out
+		job := newJob()
+
+		logger := NewJobLogger(logrus.NewEntry(base).WithField("tag", "worker"), testJobLogs, job, 1024)
+		logger.WithField("step", "load").Info("loading")
+		logger.WithError(errors.New("boom")).Warn("retrying")
+
+		assert.Contains(t, out.String(), "loading", "lines are logged by the process too")
+		assert.Contains(t, out.String(), "tag=worker")
+
+		lines, err := testJobLogs.JobLogs(ctx, job.TenantId, job.Id, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, lines, 2)
+		assert.Equal(t, "loading", lines[0].Message)
+		assert.Equal(t, "info", lines[0].Level)
+		assert.Equal(t, 2, lines[0].Attempt)
+		assert.Equal(t, map[string]interface{}{"step": "load"}, lines[0].Fields)
+		assert.Equal(t, "warning", lines[1].Level)
+		assert.Equal(t, map[string]interface{}{"error": "boom"}, lines[1].Fields)
+	})
+
+	t.Run("truncate the log", func(t *testing.T) {
+		job := newJob()
+		logger := NewJobLogger(testLogger, testJobLogs, job, 10)
+		logger.Info("12345")
+		logger.Info("67890")
+		logger.Info(strings.Repeat("x", 10))
+		logger.Info("dropped")
+
+		lines, err := testJobLogs.JobLogs(ctx, job.TenantId, job.Id, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, lines, 3)
+		assert.Equal(t, "67890", lines[1].Message)
+		assert.Equal(t, "log truncated, the job logged more than 10 bytes", lines[2].Message)
+	})
+
+	t.Run("capture disabled", func(t *testing.T) {
+		job := newJob()
+		NewJobLogger(testLogger, testJobLogs, job, 0).Info("not kept")
+
+		lines, err := testJobLogs.JobLogs(ctx, job.TenantId, job.Id, 0, 10)
+		require.NoError(t, err)
+		assert.Empty(t, lines)
+	})
+
+	t.Run("lines survive the rollback of the job", func(t *testing.T) {
+		job := newJob()
+		errRollback := errors.New("rollback")
+		err := testTransaction.RunWithTransaction(ctx, func(ctx context.Context) error {
+			ctx = WithJobLogger(ctx, NewJobLogger(testLogger, testJobLogs, job, 1024))
+			JobLogger(ctx).Info("before the rollback")
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+
+		lines, err := testJobLogs.JobLogs(ctx, job.TenantId, job.Id, 0, 10)
+		require.NoError(t, err)
+		assert.Len(t, lines, 1)
+	})
+}
@@ -0,0 +1,110 @@
+package jobstest
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+)
+
+// TestArtifactStore checks that artifacts follows the semantics of jobs.ArtifactStore.
+func TestArtifactStore(t *testing.T, artifacts jobs.ArtifactStore) {
+	ctx := context.Background()
+	tenantId := gofakeit.UUID()
+	jobId := gofakeit.Number(1, 1000000)
+
+	put := func(t *testing.T, tenantId string, jobId int, name, content string) jobs.Artifact {
+		artifact, err := artifacts.PutArtifact(ctx, tenantId, jobId, name, strings.NewReader(content))
+		require.NoError(t, err)
+		return artifact
+	}
+
+	read := func(t *testing.T, name string) (string, jobs.Artifact) {
+		content, artifact, err := artifacts.OpenArtifact(ctx, tenantId, jobId, name)
+		require.NoError(t, err)
+		defer content.Close()
+
+		data, err := io.ReadAll(content)
+		require.NoError(t, err)
+		return string(data), artifact
+	}
+
+	t.Run("put and open", func(t *testing.T) {
+		artifact := put(t, tenantId, jobId, "report.json", `{"total":3}`)
+		assert.Equal(t, "report.json", artifact.Name)
+		assert.EqualValues(t, len(`{"total":3}`), artifact.Size)
+		assert.Equal(t, "application/json", artifact.ContentType)
+		assert.False(t, artifact.CreatedAt.IsZero())
+
+		content, opened := read(t, "report.json")
+		assert.Equal(t, `{"total":3}`, content)
+		assert.Equal(t, artifact.Size, opened.Size)
+		assert.Equal(t, "application/json", opened.ContentType)
+	})
+
+	t.Run("put replaces the artifact of the same name", func(t *testing.T) {
+		put(t, tenantId, jobId, "export", "first")
+		put(t, tenantId, jobId, "export", "second version")
+
+		content, artifact := read(t, "export")
+		assert.Equal(t, "second version", content)
+		assert.EqualValues(t, len("second version"), artifact.Size)
+		assert.Equal(t, "application/octet-stream", artifact.ContentType)
+	})
+
+	t.Run("list the artifacts of the job by name", func(t *testing.T) {
+		put(t, tenantId, jobId+1, "other-job.txt", "other job")
+		put(t, gofakeit.UUID(), jobId, "other-tenant.txt", "other tenant")
+
+		listed, err := artifacts.ListArtifacts(ctx, tenantId, jobId)
+		require.NoError(t, err)
+		require.Len(t, listed, 2)
+		assert.Equal(t, "export", listed[0].Name)
+		assert.EqualValues(t, len("second version"), listed[0].Size)
+		assert.Equal(t, "report.json", listed[1].Name)
+		assert.Equal(t, "application/json", listed[1].ContentType)
+
+		empty, err := artifacts.ListArtifacts(ctx, tenantId, jobId+2)
+		require.NoError(t, err)
+		assert.Empty(t, empty)
+	})
+
+	t.Run("open a missing artifact", func(t *testing.T) {
+		_, _, err := artifacts.OpenArtifact(ctx, tenantId, jobId, "missing.txt")
+		assert.ErrorIs(t, err, jobs.ErrArtifactNotFound)
+
+		_, _, err = artifacts.OpenArtifact(ctx, gofakeit.UUID(), jobId, "report.json")
+		assert.ErrorIs(t, err, jobs.ErrArtifactNotFound, "artifacts are per tenant")
+	})
+
+	t.Run("reject invalid names", func(t *testing.T) {
+		for _, name := range []string{"", ".", "..", "../escape.txt", "dir/file.txt", `dir\file.txt`, ".hidden"} {
+			_, err := artifacts.PutArtifact(ctx, tenantId, jobId, name, strings.NewReader("invalid"))
+			assert.ErrorIs(t, err, jobs.ErrInvalidArtifactName, name)
+		}
+	})
+
+	t.Run("delete the artifacts of the job", func(t *testing.T) {
+		deleted, err := artifacts.DeleteArtifacts(ctx, tenantId, jobId)
+		require.NoError(t, err)
+		assert.Equal(t, 2, deleted)
+
+		listed, err := artifacts.ListArtifacts(ctx, tenantId, jobId)
+		require.NoError(t, err)
+		assert.Empty(t, listed)
+
+		deleted, err = artifacts.DeleteArtifacts(ctx, tenantId, jobId)
+		require.NoError(t, err)
+		assert.Zero(t, deleted)
+
+		other, err := artifacts.ListArtifacts(ctx, tenantId, jobId+1)
+		require.NoError(t, err)
+		assert.Len(t, other, 1, "the artifacts of the other jobs are kept")
+	})
+}
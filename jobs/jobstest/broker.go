@@ -0,0 +1,148 @@
+package jobstest
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+)
+
+const pollDuration = 10 * time.Millisecond
+
+func queueStats(t *testing.T, broker jobs.Broker, queueName string) jobs.QueueStats {
+	stats, err := broker.QueueStats(context.Background())
+	require.NoError(t, err)
+
+	for _, s := range stats {
+		if s.Name == queueName {
+			return s
+		}
+	}
+
+	t.Fatalf("queue %s not found in stats", queueName)
+	return jobs.QueueStats{}
+}
+
+func receive(t *testing.T, deliveries <-chan jobs.Delivery) jobs.Delivery {
+	select {
+	case delivery := <-deliveries:
+		return delivery
+	case <-time.After(5 * time.Second):
+		t.Fatal("no delivery was consumed")
+		return nil
+	}
+}
+
+// TestBroker checks that broker follows the semantics of jobs.Broker.
+func TestBroker(t *testing.T, broker jobs.Broker) {
+	ctx := context.Background()
+	queueName := gofakeit.UUID()
+	queue, err := broker.OpenQueue(queueName)
+	require.NoError(t, err)
+
+	for _, payload := range []string{"ack", "reject", "push", "return"} {
+		require.NoError(t, queue.Publish(ctx, []byte(payload)))
+	}
+
+	stats := queueStats(t, broker, queueName)
+	assert.Equal(t, int64(4), stats.Ready)
+
+	require.NoError(t, queue.StartConsuming(1, pollDuration))
+	consumed := make(chan jobs.Delivery, 1)
+	require.NoError(t, queue.AddConsumer("conformance", jobs.QueueConsumerFunc(func(delivery jobs.Delivery) {
+		consumed <- delivery
+	})))
+
+	t.Run("consume in publishing order", func(t *testing.T) {
+		delivery := receive(t, consumed)
+		assert.Equal(t, "ack", delivery.Payload())
+
+		// the prefetch limit is reached until the delivery is acked
+		stats := queueStats(t, broker, queueName)
+		assert.Equal(t, int64(3), stats.Ready)
+		assert.Equal(t, int64(1), stats.Unacked)
+		assert.Equal(t, int64(1), stats.Consumers)
+
+		connections, err := broker.Connections(ctx)
+		require.NoError(t, err)
+		assert.NotEmpty(t, connections)
+
+		require.NoError(t, delivery.Ack())
+
+		delivery = receive(t, consumed)
+		assert.Equal(t, "reject", delivery.Payload())
+		require.NoError(t, delivery.Reject())
+
+		delivery = receive(t, consumed)
+		assert.Equal(t, "push", delivery.Payload())
+		require.NoError(t, delivery.Push())
+
+		// a pushed or returned delivery is ready again, after the deliveries which were ready already
+		delivery = receive(t, consumed)
+		assert.Equal(t, "return", delivery.Payload())
+		require.NoError(t, delivery.Return())
+
+		delivery = receive(t, consumed)
+		assert.Equal(t, "push", delivery.Payload())
+		require.NoError(t, delivery.Ack())
+
+		delivery = receive(t, consumed)
+		assert.Equal(t, "return", delivery.Payload())
+		require.NoError(t, delivery.Ack())
+	})
+
+	<-queue.StopConsuming()
+
+	t.Run("rejected deliveries", func(t *testing.T) {
+		stats := queueStats(t, broker, queueName)
+		assert.Equal(t, int64(0), stats.Ready)
+		assert.Equal(t, int64(0), stats.Unacked)
+		assert.Equal(t, int64(1), stats.Rejected)
+
+		count, err := broker.ReturnRejected(ctx, queueName, 1)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		stats = queueStats(t, broker, queueName)
+		assert.Equal(t, int64(1), stats.Ready)
+		assert.Equal(t, int64(0), stats.Rejected)
+	})
+
+	t.Run("purge", func(t *testing.T) {
+		count, err := broker.PurgeReady(ctx, queueName)
+		require.NoError(t, err)
+		assert.Equal(t, int64(1), count)
+
+		count, err = broker.PurgeRejected(ctx, queueName)
+		require.NoError(t, err)
+		assert.Equal(t, int64(0), count)
+	})
+
+	t.Run("unknown queue", func(t *testing.T) {
+		unknown := gofakeit.UUID()
+
+		_, err := broker.PurgeReady(ctx, unknown)
+		assert.Equal(t, jobs.ErrQueueNotFound, err)
+
+		_, err = broker.PurgeRejected(ctx, unknown)
+		assert.Equal(t, jobs.ErrQueueNotFound, err)
+
+		_, err = broker.ReturnRejected(ctx, unknown, math.MaxInt64)
+		assert.Equal(t, jobs.ErrQueueNotFound, err)
+	})
+
+	t.Run("clean", func(t *testing.T) {
+		_, err := broker.Clean(ctx)
+		assert.NoError(t, err)
+	})
+
+	t.Run("stop consuming twice", func(t *testing.T) {
+		<-queue.StopConsuming()
+	})
+}
@@ -0,0 +1,70 @@
+package jobstest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+)
+
+// TestJobLogStore checks that logs follows the semantics of jobs.JobLogStore.
+func TestJobLogStore(t *testing.T, logs jobs.JobLogStore) {
+	ctx := context.Background()
+	tenantId := gofakeit.UUID()
+	jobId := gofakeit.Number(1, 1000000)
+
+	var appended []jobs.JobLogLine
+	for _, message := range []string{"first", "second", "third"} {
+		line, err := logs.AppendJobLog(ctx, jobs.JobLogLine{
+			TenantId: tenantId,
+			JobId:    jobId,
+			Attempt:  1,
+			Level:    "info",
+			Message:  message,
+			Fields:   map[string]interface{}{"step": message},
+		})
+		require.NoError(t, err)
+		appended = append(appended, line)
+	}
+
+	_, err := logs.AppendJobLog(ctx, jobs.JobLogLine{TenantId: tenantId, JobId: jobId + 1, Level: "info", Message: "other job"})
+	require.NoError(t, err)
+
+	t.Run("append", func(t *testing.T) {
+		assert.NotZero(t, appended[0].Id)
+		assert.Greater(t, appended[1].Id, appended[0].Id)
+		assert.False(t, appended[0].CreatedAt.IsZero())
+	})
+
+	t.Run("lines of a job", func(t *testing.T) {
+		lines, err := logs.JobLogs(ctx, tenantId, jobId, 0, 10)
+		require.NoError(t, err)
+		require.Len(t, lines, 3)
+		assert.Equal(t, "first", lines[0].Message)
+		assert.Equal(t, "third", lines[2].Message)
+		assert.Equal(t, 1, lines[0].Attempt)
+		assert.Equal(t, "info", lines[0].Level)
+		assert.Equal(t, map[string]interface{}{"step": "first"}, lines[0].Fields)
+	})
+
+	t.Run("lines after a line", func(t *testing.T) {
+		lines, err := logs.JobLogs(ctx, tenantId, jobId, appended[0].Id, 1)
+		require.NoError(t, err)
+		require.Len(t, lines, 1)
+		assert.Equal(t, "second", lines[0].Message)
+
+		lines, err = logs.JobLogs(ctx, tenantId, jobId, appended[2].Id, 10)
+		require.NoError(t, err)
+		assert.Empty(t, lines)
+	})
+
+	t.Run("lines of another tenant", func(t *testing.T) {
+		lines, err := logs.JobLogs(ctx, gofakeit.UUID(), jobId, 0, 10)
+		require.NoError(t, err)
+		assert.Empty(t, lines)
+	})
+}
@@ -0,0 +1,120 @@
+package jobstest
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+)
+
+// TestSettingsStore checks that settings follows the semantics of jobs.SettingsStore.
+func TestSettingsStore(t *testing.T, settings jobs.SettingsStore) {
+	ctx := context.Background()
+
+	find := func(t *testing.T, key string) (jobs.Setting, bool) {
+		stored, err := settings.Settings(ctx)
+		require.NoError(t, err)
+
+		for _, setting := range stored {
+			if setting.Key == key {
+				return setting, true
+			}
+		}
+
+		return jobs.Setting{}, false
+	}
+
+	t.Run("put a setting", func(t *testing.T) {
+		put, err := settings.PutSetting(ctx, jobs.Setting{
+			Key:       jobs.SettingTypeConcurrency,
+			Value:     json.RawMessage(`{"report": 2}`),
+			UpdatedBy: "alice",
+		})
+		require.NoError(t, err)
+		assert.Equal(t, jobs.SettingTypeConcurrency, put.Key)
+		assert.JSONEq(t, `{"report": 2}`, string(put.Value))
+		assert.Equal(t, "alice", put.UpdatedBy)
+		assert.False(t, put.UpdatedAt.IsZero())
+
+		setting, ok := find(t, jobs.SettingTypeConcurrency)
+		require.True(t, ok)
+		assert.JSONEq(t, `{"report": 2}`, string(setting.Value))
+		assert.Equal(t, "alice", setting.UpdatedBy)
+		assert.Equal(t, put.UpdatedAt.Unix(), setting.UpdatedAt.Unix())
+	})
+
+	t.Run("replace a setting", func(t *testing.T) {
+		_, err := settings.PutSetting(ctx, jobs.Setting{Key: jobs.SettingJobTimeout, Value: json.RawMessage(`30`), UpdatedBy: "alice"})
+		require.NoError(t, err)
+		_, err = settings.PutSetting(ctx, jobs.Setting{Key: jobs.SettingJobTimeout, Value: json.RawMessage(`60`), UpdatedBy: "bob"})
+		require.NoError(t, err)
+
+		setting, ok := find(t, jobs.SettingJobTimeout)
+		require.True(t, ok)
+		assert.JSONEq(t, `60`, string(setting.Value))
+		assert.Equal(t, "bob", setting.UpdatedBy)
+	})
+
+	t.Run("reset a setting", func(t *testing.T) {
+		put, err := settings.PutSetting(ctx, jobs.Setting{Key: jobs.SettingJobTimeout, UpdatedBy: "carol"})
+		require.NoError(t, err)
+		assert.True(t, put.IsReset())
+
+		setting, ok := find(t, jobs.SettingJobTimeout)
+		require.True(t, ok, "a reset setting keeps who reset it")
+		assert.True(t, setting.IsReset())
+		assert.Equal(t, "carol", setting.UpdatedBy)
+	})
+
+	t.Run("list the settings by key", func(t *testing.T) {
+		stored, err := settings.Settings(ctx)
+		require.NoError(t, err)
+
+		for i := 1; i < len(stored); i++ {
+			assert.Less(t, stored[i-1].Key, stored[i].Key)
+		}
+	})
+
+	t.Run("put an item of a list setting", func(t *testing.T) {
+		// random job types, so no queue of the other tests is paused
+		first, second := gofakeit.UUID(), gofakeit.UUID()
+		_, err := settings.PutSetting(ctx, jobs.Setting{Key: jobs.SettingPausedTypes, Value: json.RawMessage(`"not a list"`), UpdatedBy: "alice"})
+		require.NoError(t, err)
+
+		put, err := settings.PutSettingItem(ctx, jobs.SettingPausedTypes, second, true, "alice")
+		require.NoError(t, err)
+		assert.JSONEq(t, fmt.Sprintf(`[%q]`, second), string(put.Value), "a value that is not a list counts as empty")
+		_, err = settings.PutSettingItem(ctx, jobs.SettingPausedTypes, first, true, "alice")
+		require.NoError(t, err)
+		_, err = settings.PutSettingItem(ctx, jobs.SettingPausedTypes, first, true, "alice")
+		require.NoError(t, err)
+
+		setting, ok := find(t, jobs.SettingPausedTypes)
+		require.True(t, ok)
+		var items []string
+		require.NoError(t, json.Unmarshal(setting.Value, &items))
+		assert.ElementsMatch(t, []string{first, second}, items)
+
+		put, err = settings.PutSettingItem(ctx, jobs.SettingPausedTypes, second, false, "bob")
+		require.NoError(t, err)
+		assert.JSONEq(t, fmt.Sprintf(`[%q]`, first), string(put.Value))
+		assert.Equal(t, "bob", put.UpdatedBy)
+		assert.False(t, put.UpdatedAt.IsZero())
+
+		put, err = settings.PutSettingItem(ctx, jobs.SettingPausedTypes, first, false, "bob")
+		require.NoError(t, err)
+		assert.JSONEq(t, `[]`, string(put.Value))
+	})
+
+	// leave the store as the other tests expect it
+	for _, key := range []string{jobs.SettingTypeConcurrency, jobs.SettingJobTimeout, jobs.SettingPausedTypes} {
+		_, err := settings.PutSetting(ctx, jobs.Setting{Key: key, UpdatedBy: "test"})
+		require.NoError(t, err)
+	}
+}
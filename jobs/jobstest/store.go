@@ -0,0 +1,300 @@
+// Package jobstest provides the conformance tests every backend of the jobs package must pass.
+package jobstest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+// newJob returns a created job of a tenant unique to the test, so the suites can run against a shared database.
+func newJob(tenantId string) jobs.Job {
+	return jobs.Job{
+		TenantId:  tenantId,
+		ObjectId:  gofakeit.Number(1, 1000000),
+		Type:      jobs.DefaultJobType,
+		Status:    jobs.JobStatusCreated,
+		CreatedAt: utils.TimeNow(),
+	}
+}
+
+// TestStore checks that store follows the semantics of jobs.Store.
+func TestStore(t *testing.T, store jobs.Store) {
+	ctx := context.Background()
+
+	t.Run("save job", func(t *testing.T) {
+		first, err := store.SaveJob(ctx, newJob(gofakeit.UUID()))
+		require.NoError(t, err)
+		second, err := store.SaveJob(ctx, newJob(gofakeit.UUID()))
+		require.NoError(t, err)
+
+		assert.NotZero(t, first.Id)
+		assert.Greater(t, second.Id, first.Id)
+	})
+
+	t.Run("save job with default values", func(t *testing.T) {
+		job, err := store.SaveJob(ctx, jobs.Job{ObjectId: gofakeit.Number(1, 1000000), Status: jobs.JobStatusCreated})
+		require.NoError(t, err)
+
+		assert.Equal(t, jobs.DefaultTenantId, job.TenantId)
+		assert.Equal(t, jobs.DefaultJobType, job.Type)
+		assert.Equal(t, jobs.DefaultJobPriority, job.Priority)
+		assert.False(t, job.CreatedAt.IsZero())
+	})
+
+	t.Run("save job in UTC", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		job := newJob(tenantId)
+		// a time of a host which is not in UTC
+		job.CreatedAt = utils.TimeNow().Truncate(time.Millisecond).In(time.FixedZone("UTC-5", -5*60*60))
+		job.StartTime = utils.TimeToPtr(job.CreatedAt.Add(time.Minute))
+		saved, err := store.SaveJob(ctx, job)
+		require.NoError(t, err)
+
+		actual, err := store.GetJobByID(ctx, tenantId, saved.Id)
+		require.NoError(t, err)
+		assert.Equal(t, time.UTC, actual.CreatedAt.Location())
+		assert.True(t, job.CreatedAt.Equal(actual.CreatedAt))
+		require.NotNil(t, actual.StartTime)
+		assert.Equal(t, time.UTC, actual.StartTime.Location())
+		assert.Equal(t, time.Minute, actual.StartTime.Sub(actual.CreatedAt))
+
+		found, err := store.GetJobByObjectId(ctx, tenantId, job.ObjectId, job.CreatedAt.In(time.Local))
+		require.NoError(t, err, "time window of another time zone")
+		assert.Equal(t, saved.Id, found.Id)
+	})
+
+	t.Run("get job by id", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		expected, err := store.SaveJob(ctx, newJob(tenantId))
+		require.NoError(t, err)
+
+		actual, err := store.GetJobByID(ctx, tenantId, expected.Id)
+		require.NoError(t, err)
+		assert.Equal(t, expected.Id, actual.Id)
+		assert.Equal(t, expected.ObjectId, actual.ObjectId)
+		assert.Equal(t, expected.Status, actual.Status)
+		assert.WithinDuration(t, expected.CreatedAt, actual.CreatedAt, time.Millisecond)
+
+		_, err = store.GetJobByID(ctx, gofakeit.UUID(), expected.Id)
+		assert.Equal(t, jobs.ErrJobNotFound, err, "job of another tenant")
+
+		_, err = store.GetJobByID(ctx, tenantId, -1)
+		assert.Equal(t, jobs.ErrJobNotFound, err, "unknown job")
+	})
+
+	t.Run("get job by object id", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		expected, err := store.SaveJob(ctx, newJob(tenantId))
+		require.NoError(t, err)
+
+		actual, err := store.GetJobByObjectId(ctx, tenantId, expected.ObjectId, expected.CreatedAt.Add(-time.Minute))
+		require.NoError(t, err)
+		assert.Equal(t, expected.Id, actual.Id)
+
+		_, err = store.GetJobByObjectId(ctx, tenantId, expected.ObjectId, expected.CreatedAt.Add(time.Minute))
+		assert.Equal(t, jobs.ErrJobNotFound, err, "job created before the time window")
+
+		_, err = store.GetJobByObjectId(ctx, gofakeit.UUID(), expected.ObjectId, expected.CreatedAt.Add(-time.Minute))
+		assert.Equal(t, jobs.ErrJobNotFound, err, "job of another tenant")
+	})
+
+	t.Run("update job optimistically", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		job, err := store.SaveJob(ctx, newJob(tenantId))
+		require.NoError(t, err)
+
+		update := job
+		update.ObjectId = job.ObjectId + 1
+		update.Status = jobs.JobStatusRunning
+		update.StartTime = utils.TimeToPtr(utils.TimeNow())
+		update.Attempts = 1
+		update.PublishedAt = utils.TimeToPtr(job.CreatedAt)
+		update.WorkerId = "host-1-abc/worker:0"
+		update.Hostname = "host"
+		update.Error = &jobs.JobError{Code: jobs.JobErrorHandler, Message: "running", Attempt: 1, Details: map[string]interface{}{"stack": "stack"}}
+
+		err = store.UpdateJobOptimistically(ctx, update, jobs.JobStatusSuccess)
+		assert.Equal(t, jobs.ErrNoRowUpdated, err, "current status does not match")
+
+		other := update
+		other.TenantId = gofakeit.UUID()
+		err = store.UpdateJobOptimistically(ctx, other, jobs.JobStatusCreated)
+		assert.Equal(t, jobs.ErrNoRowUpdated, err, "job of another tenant")
+
+		require.NoError(t, store.UpdateJobOptimistically(ctx, update, jobs.JobStatusCreated))
+
+		actual, err := store.GetJobByID(ctx, tenantId, job.Id)
+		require.NoError(t, err)
+		assert.Equal(t, jobs.JobStatusRunning, actual.Status)
+		assert.Equal(t, 1, actual.Attempts)
+		assert.Equal(t, update.WorkerId, actual.WorkerId)
+		assert.Equal(t, update.Hostname, actual.Hostname)
+		require.NotNil(t, actual.PublishedAt)
+		assert.WithinDuration(t, *update.PublishedAt, *actual.PublishedAt, time.Millisecond)
+		assert.Equal(t, update.Error, actual.Error)
+		require.NotNil(t, actual.StartTime)
+		assert.WithinDuration(t, *update.StartTime, *actual.StartTime, time.Millisecond)
+		assert.Equal(t, job.ObjectId, actual.ObjectId, "only the status fields are updated")
+
+		err = store.UpdateJobOptimistically(ctx, update, jobs.JobStatusCreated)
+		assert.Equal(t, jobs.ErrNoRowUpdated, err, "job was updated already")
+	})
+
+	t.Run("list jobs", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		var saved []jobs.Job
+		for _, jobType := range []string{"report", "export", "report"} {
+			job := newJob(tenantId)
+			job.Type = jobType
+			job, err := store.SaveJob(ctx, job)
+			require.NoError(t, err)
+			saved = append(saved, job)
+		}
+
+		_, err := store.SaveJob(ctx, newJob(gofakeit.UUID()))
+		require.NoError(t, err)
+
+		ids := func(list []jobs.Job) []int {
+			var result []int
+			for _, job := range list {
+				result = append(result, job.Id)
+			}
+
+			return result
+		}
+
+		result, err := store.ListJobs(ctx, jobs.JobFilter{TenantId: tenantId})
+		require.NoError(t, err)
+		assert.Equal(t, []int{saved[2].Id, saved[1].Id, saved[0].Id}, ids(result), "newest first")
+
+		result, err = store.ListJobs(ctx, jobs.JobFilter{TenantId: tenantId, Type: "report", Limit: 1})
+		require.NoError(t, err)
+		assert.Equal(t, []int{saved[2].Id}, ids(result))
+
+		result, err = store.ListJobs(ctx, jobs.JobFilter{TenantId: tenantId, ObjectId: saved[1].ObjectId, Status: jobs.JobStatusCreated})
+		require.NoError(t, err)
+		assert.Contains(t, ids(result), saved[1].Id)
+
+		result, err = store.ListJobs(ctx, jobs.JobFilter{TenantId: tenantId, Status: jobs.JobStatusFailed})
+		require.NoError(t, err)
+		assert.Empty(t, result)
+	})
+
+	t.Run("delete jobs", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		// jobs older than the jobs of the other tests, which the deletes must leave alone
+		createdAt := time.Date(1901, 1, 1, 0, 0, 0, 0, time.UTC)
+		var saved []jobs.Job
+		for i, status := range []jobs.JobStatus{jobs.JobStatusSuccess, jobs.JobStatusCreated, jobs.JobStatusFailed, jobs.JobStatusSuccess} {
+			job := newJob(tenantId)
+			job.Status = status
+			job.CreatedAt = createdAt.Add(time.Duration(i) * time.Hour)
+			job, err := store.SaveJob(ctx, job)
+			require.NoError(t, err)
+			saved = append(saved, job)
+		}
+
+		filter := jobs.RetentionFilter{
+			Statuses:      []jobs.JobStatus{jobs.JobStatusSuccess, jobs.JobStatusFailed},
+			CreatedBefore: createdAt.Add(3 * time.Hour),
+			Limit:         1,
+		}
+
+		deleted, err := store.DeleteJobs(ctx, filter)
+		require.NoError(t, err)
+		require.Len(t, deleted, 1)
+		assert.Equal(t, saved[0].Id, deleted[0].Id, "oldest first")
+		assert.Equal(t, jobs.JobStatusSuccess, deleted[0].Status)
+
+		filter.Limit = 10
+		deleted, err = store.DeleteJobs(ctx, filter)
+		require.NoError(t, err)
+		require.Len(t, deleted, 1)
+		assert.Equal(t, saved[2].Id, deleted[0].Id, "jobs of other statuses and newer jobs are kept")
+
+		_, err = store.GetJobByID(ctx, tenantId, saved[0].Id)
+		assert.Equal(t, jobs.ErrJobNotFound, err)
+
+		for _, job := range []jobs.Job{saved[1], saved[3]} {
+			_, err = store.GetJobByID(ctx, tenantId, job.Id)
+			assert.NoError(t, err)
+		}
+	})
+}
+
+// TestTransactioner checks that the changes of store are committed or rolled back with the transactions of transactioner.
+func TestTransactioner(t *testing.T, transactioner utils.Transactioner, store jobs.Store) {
+	ctx := context.Background()
+	errRollback := errors.New("rollback")
+
+	t.Run("commit", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		var job jobs.Job
+		err := transactioner.RunWithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			job, err = store.SaveJob(ctx, newJob(tenantId))
+			return err
+		})
+		require.NoError(t, err)
+
+		_, err = store.GetJobByID(ctx, tenantId, job.Id)
+		assert.NoError(t, err)
+	})
+
+	t.Run("rollback on error", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		existing, err := store.SaveJob(ctx, newJob(tenantId))
+		require.NoError(t, err)
+
+		var saved jobs.Job
+		err = transactioner.RunWithTransaction(ctx, func(ctx context.Context) error {
+			var err error
+			saved, err = store.SaveJob(ctx, newJob(tenantId))
+			require.NoError(t, err)
+
+			update := existing
+			update.Status = jobs.JobStatusRunning
+			require.NoError(t, store.UpdateJobOptimistically(ctx, update, jobs.JobStatusCreated))
+
+			// changes are visible inside the transaction
+			actual, err := store.GetJobByID(ctx, tenantId, existing.Id)
+			require.NoError(t, err)
+			assert.Equal(t, jobs.JobStatusRunning, actual.Status)
+
+			return errRollback
+		})
+		assert.Equal(t, errRollback, err)
+
+		_, err = store.GetJobByID(ctx, tenantId, saved.Id)
+		assert.Equal(t, jobs.ErrJobNotFound, err, "saved job was rolled back")
+
+		actual, err := store.GetJobByID(ctx, tenantId, existing.Id)
+		require.NoError(t, err)
+		assert.Equal(t, jobs.JobStatusCreated, actual.Status, "update was rolled back")
+	})
+
+	t.Run("rollback on panic", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		var saved jobs.Job
+		assert.Panics(t, func() {
+			_ = transactioner.RunWithTransaction(ctx, func(ctx context.Context) error {
+				var err error
+				saved, err = store.SaveJob(ctx, newJob(tenantId))
+				require.NoError(t, err)
+				panic(errRollback)
+			})
+		})
+
+		_, err := store.GetJobByID(ctx, tenantId, saved.Id)
+		assert.Equal(t, jobs.ErrJobNotFound, err)
+	})
+}
@@ -0,0 +1,72 @@
+package jobstest
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+func findWorker(t *testing.T, registry jobs.WorkerRegistry, id string) (jobs.WorkerInfo, bool) {
+	workers, err := registry.Workers(context.Background())
+	require.NoError(t, err)
+
+	for _, worker := range workers {
+		if worker.Id == id {
+			return worker, true
+		}
+	}
+
+	return jobs.WorkerInfo{}, false
+}
+
+// TestWorkerRegistry checks that registry follows the semantics of jobs.WorkerRegistry.
+func TestWorkerRegistry(t *testing.T, registry jobs.WorkerRegistry) {
+	ctx := context.Background()
+	worker := jobs.WorkerInfo{
+		Id:        gofakeit.UUID(),
+		Hostname:  "host-a",
+		Types:     []string{jobs.DefaultJobType, "report"},
+		Labels:    []string{"large-cache"},
+		StartedAt: utils.TimeNow(),
+	}
+
+	t.Run("register", func(t *testing.T) {
+		require.NoError(t, registry.Register(ctx, worker))
+
+		actual, ok := findWorker(t, registry, worker.Id)
+		require.True(t, ok)
+		assert.Equal(t, "host-a", actual.Hostname)
+		assert.Equal(t, worker.Types, actual.Types)
+		assert.Equal(t, worker.Labels, actual.Labels)
+		assert.WithinDuration(t, worker.StartedAt, actual.StartedAt, time.Millisecond)
+		assert.WithinDuration(t, utils.TimeNow(), actual.HeartbeatAt, 5*time.Second)
+		assert.True(t, actual.Active)
+		assert.True(t, actual.Serves("report"))
+		assert.False(t, actual.Serves("export"))
+	})
+
+	t.Run("register again refreshes the types", func(t *testing.T) {
+		update := worker
+		update.Types = []string{"export"}
+		require.NoError(t, registry.Register(ctx, update))
+
+		actual, ok := findWorker(t, registry, worker.Id)
+		require.True(t, ok)
+		assert.Equal(t, []string{"export"}, actual.Types)
+		assert.WithinDuration(t, worker.StartedAt, actual.StartedAt, time.Millisecond)
+	})
+
+	t.Run("unregister", func(t *testing.T) {
+		require.NoError(t, registry.Unregister(ctx, worker.Id))
+
+		_, ok := findWorker(t, registry, worker.Id)
+		assert.False(t, ok)
+	})
+}
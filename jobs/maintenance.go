@@ -0,0 +1,209 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+// Maintenance keeps the jobs table small: it archives and purges the old finished jobs and manages the partitions.
+type Maintenance struct {
+	cfg           config.RetentionConfig
+	logger        *logrus.Entry
+	store         Store
+	transactioner utils.Transactioner
+	archive       JobArchive
+	partitions    JobPartitioner
+	artifacts     ArtifactStore
+	clock         clock.Clock
+}
+
+// NewMaintenance accepts a nil partitions when the jobs table is not partitioned.
+func NewMaintenance(cfg config.RetentionConfig, logger *logrus.Entry, store Store, transactioner utils.Transactioner, archive JobArchive, partitions JobPartitioner, artifacts ArtifactStore, clock clock.Clock) *Maintenance {
+	return &Maintenance{
+		cfg:           cfg,
+		logger:        logger.WithField("tag", "maintenance"),
+		store:         store,
+		transactioner: transactioner,
+		archive:       archive,
+		partitions:    partitions,
+		artifacts:     artifacts,
+		clock:         utils.UTCClock(clock),
+	}
+}
+
+// MaintenanceReport tells what a maintenance run changed.
+type MaintenanceReport struct {
+	CreatedPartitions []string          `json:"created_partitions"`
+	Archived          int               `json:"archived"`
+	Purged            map[JobStatus]int `json:"purged"`
+	DroppedPartitions []string          `json:"dropped_partitions"`
+	// DeletedArtifacts counts the artifacts of the archived and purged jobs, they are not archived
+	DeletedArtifacts int `json:"deleted_artifacts"`
+}
+
+// Run purges the jobs of the purge policy, archives the other finished jobs past the archival age,
+// then drops the partitions left empty and creates the partitions of the coming months.
+func (m *Maintenance) Run(ctx context.Context) (MaintenanceReport, error) {
+	report := MaintenanceReport{Purged: make(map[JobStatus]int)}
+	if err := m.validate(); err != nil {
+		return report, err
+	}
+
+	now := m.clock.Now()
+
+	statuses := make([]string, 0, len(m.cfg.PurgeAfterDays))
+	for status := range m.cfg.PurgeAfterDays {
+		statuses = append(statuses, status)
+	}
+	sort.Strings(statuses)
+
+	for _, status := range statuses {
+		purged, artifacts, err := m.deleteJobs(ctx, RetentionFilter{
+			Statuses:      []JobStatus{JobStatus(status)},
+			CreatedBefore: daysBefore(now, m.cfg.PurgeAfterDays[status]),
+		}, nil)
+		report.Purged[JobStatus(status)] = purged
+		report.DeletedArtifacts += artifacts
+		if err != nil {
+			return report, fmt.Errorf("failed to purge %s jobs: %w", status, err)
+		}
+	}
+
+	if m.cfg.ArchiveAfterDays > 0 {
+		archived, artifacts, err := m.deleteJobs(ctx, RetentionFilter{
+			Statuses:      FinishedJobStatuses,
+			CreatedBefore: daysBefore(now, m.cfg.ArchiveAfterDays),
+		}, m.archive)
+		report.Archived = archived
+		report.DeletedArtifacts += artifacts
+		if err != nil {
+			return report, fmt.Errorf("failed to archive jobs: %w", err)
+		}
+	}
+
+	if m.partitions == nil {
+		return report, nil
+	}
+
+	// jobs are inserted in the current month, the partitions of the past months only shrink
+	dropped, err := m.partitions.DropEmptyPartitions(ctx, startOfMonth(now))
+	report.DroppedPartitions = dropped
+	if err != nil {
+		return report, err
+	}
+
+	created, err := m.partitions.EnsurePartitions(ctx, now, m.cfg.PartitionMonthsAhead)
+	report.CreatedPartitions = created
+	return report, err
+}
+
+func (m *Maintenance) validate() error {
+	for status := range m.cfg.PurgeAfterDays {
+		if !JobStatus(status).IsFinished() {
+			return fmt.Errorf("jobs in status %s can't be purged, only finished jobs can", status)
+		}
+	}
+
+	if m.cfg.ArchiveAfterDays > 0 && m.archive == nil {
+		return fmt.Errorf("archival is enabled without an archive")
+	}
+
+	return nil
+}
+
+// deleteJobs deletes the jobs selected by filter in batches of RetentionBatchSize and passes them to archive unless it is nil.
+// Every batch is a transaction, the jobs of a batch are kept when their archival fails.
+// It returns the number of deleted jobs and of their deleted artifacts.
+func (m *Maintenance) deleteJobs(ctx context.Context, filter RetentionFilter, archive JobArchive) (int, int, error) {
+	filter.Limit = m.cfg.RetentionBatchSize
+
+	var total, totalArtifacts int
+	for {
+		var deleted []Job
+		err := m.transactioner.RunWithTransaction(ctx, func(ctx context.Context) error {
+			jobs, err := m.store.DeleteJobs(ctx, filter)
+			if err != nil {
+				return err
+			}
+
+			if archive != nil {
+				if err := archive.Archive(ctx, jobs); err != nil {
+					return err
+				}
+			}
+
+			deleted = jobs
+			return nil
+		})
+		if err != nil {
+			return total, totalArtifacts, err
+		}
+
+		total += len(deleted)
+		totalArtifacts += m.deleteArtifacts(ctx, deleted)
+		if len(deleted) < filter.Limit {
+			return total, totalArtifacts, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return total, totalArtifacts, ctx.Err()
+		default:
+		}
+	}
+}
+
+// deleteArtifacts deletes the artifacts of jobs once they are deleted, a rolled back batch keeps its artifacts.
+// The artifacts failing to be deleted are left behind and logged.
+func (m *Maintenance) deleteArtifacts(ctx context.Context, jobs []Job) int {
+	if m.artifacts == nil {
+		return 0
+	}
+
+	var total int
+	for _, job := range jobs {
+		deleted, err := m.artifacts.DeleteArtifacts(ctx, job.TenantId, job.Id)
+		total += deleted
+		if err != nil {
+			m.logger.WithError(err).WithField("jobId", job.Id).Warn("failed to delete the artifacts of a deleted job")
+		}
+	}
+
+	return total
+}
+
+// Loop runs the maintenance every interval until ctx is done, a failed run is logged and retried at the next interval.
+func (m *Maintenance) Loop(ctx context.Context, interval time.Duration) {
+	for {
+		report, err := m.Run(ctx)
+		if err != nil {
+			m.logger.WithError(err).Error("maintenance failed")
+		} else {
+			m.logger.WithFields(logrus.Fields{
+				"archived":           report.Archived,
+				"purged":             report.Purged,
+				"created_partitions": report.CreatedPartitions,
+				"dropped_partitions": report.DroppedPartitions,
+				"deleted_artifacts":  report.DeletedArtifacts,
+			}).Info("maintenance done")
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-m.clock.After(interval):
+		}
+	}
+}
+
+func daysBefore(now time.Time, days int) time.Time {
+	return now.AddDate(0, 0, -days)
+}
@@ -0,0 +1,198 @@
+package jobs
+
+import (
+	"bufio"
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/go-pg/pg/v9"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+// saveOldJobs saves a job per status created at createdAt, older than the jobs of the other tests.
+func saveOldJobs(t *testing.T, tenantId string, createdAt time.Time, statuses ...JobStatus) []Job {
+	var saved []Job
+	for _, status := range statuses {
+		job, err := testStore.SaveJob(context.Background(), Job{
+			TenantId:  tenantId,
+			ObjectId:  newTestObjectId(),
+			Status:    status,
+			CreatedAt: createdAt,
+		})
+		require.NoError(t, err)
+		saved = append(saved, job)
+	}
+
+	return saved
+}
+
+func initTestMaintenance(cfg config.RetentionConfig, archive JobArchive, now time.Time) *Maintenance {
+	clock := clock.NewMock()
+	clock.Set(now)
+
+	cfg.RetentionBatchSize = 2
+	return NewMaintenance(cfg, testLogger, testStore, testTransaction, archive, nil, testArtifacts, clock)
+}
+
+func TestMaintenanceArchive(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	createdAt := time.Date(1902, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := createdAt.AddDate(0, 0, 10)
+
+	t.Run("archive to a table", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		saved := saveOldJobs(t, tenantId, createdAt, JobStatusSuccess, JobStatusFailed, JobStatusTimedOut, JobStatusRunning)
+
+		maintenance := initTestMaintenance(config.RetentionConfig{ArchiveAfterDays: 7}, NewTableArchive(testDb), now)
+		report, err := maintenance.Run(ctx)
+		require.NoError(t, err)
+		assert.GreaterOrEqual(t, report.Archived, 3)
+
+		for _, job := range saved[:3] {
+			_, err := testStore.GetJobByID(ctx, tenantId, job.Id)
+			assert.Equal(t, ErrJobNotFound, err)
+
+			var raw string
+			_, err = testDb.QueryOne(pg.Scan(&raw), `SELECT job FROM jobs_archive WHERE id = ?`, job.Id)
+			require.NoError(t, err)
+
+			archived, err := JobFromJSON([]byte(raw))
+			require.NoError(t, err)
+			assert.Equal(t, job.Status, archived.Status)
+			assert.Equal(t, tenantId, archived.TenantId)
+		}
+
+		_, err = testStore.GetJobByID(ctx, tenantId, saved[3].Id)
+		assert.NoError(t, err, "running jobs are not archived")
+	})
+
+	t.Run("archive to files", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		saved := saveOldJobs(t, tenantId, createdAt, JobStatusCancelled, JobStatusSuccess, JobStatusCreated)
+
+		dir := t.TempDir()
+		maintenance := initTestMaintenance(config.RetentionConfig{ArchiveAfterDays: 7}, NewFileArchive(dir, clock.New()), now)
+		_, err := maintenance.Run(ctx)
+		require.NoError(t, err)
+
+		files, err := filepath.Glob(filepath.Join(dir, "jobs-*.ndjson"))
+		require.NoError(t, err)
+		require.NotEmpty(t, files)
+
+		archived := make(map[int]Job)
+		for _, name := range files {
+			file, err := os.Open(name)
+			require.NoError(t, err)
+
+			scanner := bufio.NewScanner(file)
+			for scanner.Scan() {
+				job, err := JobFromJSON(scanner.Bytes())
+				require.NoError(t, err)
+				archived[job.Id] = job
+			}
+			file.Close()
+		}
+
+		assert.Contains(t, archived, saved[0].Id)
+		assert.Contains(t, archived, saved[1].Id)
+		assert.NotContains(t, archived, saved[2].Id, "created jobs are not archived")
+	})
+
+	t.Run("recent jobs are kept", func(t *testing.T) {
+		tenantId := gofakeit.UUID()
+		saved := saveOldJobs(t, tenantId, now.AddDate(0, 0, -1), JobStatusSuccess)
+
+		maintenance := initTestMaintenance(config.RetentionConfig{ArchiveAfterDays: 7}, NewTableArchive(testDb), now)
+		_, err := maintenance.Run(ctx)
+		require.NoError(t, err)
+
+		_, err = testStore.GetJobByID(ctx, tenantId, saved[0].Id)
+		assert.NoError(t, err)
+	})
+}
+
+func TestMaintenancePurge(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	createdAt := time.Date(1903, 1, 1, 0, 0, 0, 0, time.UTC)
+	now := createdAt.AddDate(0, 0, 10)
+
+	tenantId := gofakeit.UUID()
+	saved := saveOldJobs(t, tenantId, createdAt, JobStatusSuccess, JobStatusCancelled, JobStatusFailed)
+	for _, job := range saved {
+		_, err := testArtifacts.PutArtifact(ctx, tenantId, job.Id, "report.txt", strings.NewReader("report"))
+		require.NoError(t, err)
+	}
+
+	maintenance := initTestMaintenance(config.RetentionConfig{
+		PurgeAfterDays: map[string]int{"success": 5, "cancelled": 30},
+	}, nil, now)
+	report, err := maintenance.Run(ctx)
+	require.NoError(t, err)
+	assert.GreaterOrEqual(t, report.Purged[JobStatusSuccess], 1)
+	assert.Equal(t, 0, report.Purged[JobStatusCancelled])
+	assert.GreaterOrEqual(t, report.DeletedArtifacts, 1)
+
+	_, err = testStore.GetJobByID(ctx, tenantId, saved[0].Id)
+	assert.Equal(t, ErrJobNotFound, err)
+
+	artifacts, err := testArtifacts.ListArtifacts(ctx, tenantId, saved[0].Id)
+	require.NoError(t, err)
+	assert.Empty(t, artifacts, "the artifacts are deleted with their job")
+
+	for _, job := range saved[1:] {
+		_, err = testStore.GetJobByID(ctx, tenantId, job.Id)
+		assert.NoError(t, err)
+
+		artifacts, err := testArtifacts.ListArtifacts(ctx, tenantId, job.Id)
+		require.NoError(t, err)
+		assert.Len(t, artifacts, 1)
+	}
+
+	t.Run("only finished jobs can be purged", func(t *testing.T) {
+		maintenance := initTestMaintenance(config.RetentionConfig{PurgeAfterDays: map[string]int{"running": 1}}, nil, now)
+		_, err := maintenance.Run(ctx)
+		assert.Error(t, err)
+	})
+}
+
+func TestJobPartitions(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	partitions := NewJobPartitions(testDb)
+	month := time.Date(2100, 1, 1, 0, 0, 0, 0, time.UTC)
+
+	t.Cleanup(func() {
+		// the test drops the empty partitions of the current months as well
+		_, err := partitions.EnsurePartitions(ctx, utils.TimeNow(), 3)
+		require.NoError(t, err)
+	})
+
+	created, err := partitions.EnsurePartitions(ctx, month, 1)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"jobs_p210001", "jobs_p210002"}, created)
+
+	created, err = partitions.EnsurePartitions(ctx, month, 1)
+	require.NoError(t, err)
+	assert.Empty(t, created, "existing partitions are kept")
+
+	tenantId := gofakeit.UUID()
+	saveOldJobs(t, tenantId, month.Add(time.Hour), JobStatusSuccess)
+
+	dropped, err := partitions.DropEmptyPartitions(ctx, month.AddDate(0, 2, 0))
+	require.NoError(t, err)
+	assert.Contains(t, dropped, "jobs_p210002")
+	assert.NotContains(t, dropped, "jobs_p210001", "partitions with jobs are kept")
+	assert.NotContains(t, dropped, "jobs_default")
+}
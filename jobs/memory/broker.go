@@ -0,0 +1,366 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+)
+
+// Broker keeps queues in memory, they are shared by the consumers of a single process.
+type Broker struct {
+	mu     sync.Mutex
+	name   string
+	queues map[string]*Queue
+}
+
+func NewBroker(name string) *Broker {
+	return &Broker{
+		name:   name,
+		queues: make(map[string]*Queue),
+	}
+}
+
+// OpenQueue returns the queue of name, it is created on first use.
+func (b *Broker) OpenQueue(name string) (jobs.Queue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	queue, ok := b.queues[name]
+	if !ok {
+		queue = &Queue{name: name}
+		b.queues[name] = queue
+	}
+
+	return queue, nil
+}
+
+func (b *Broker) QueueStats(ctx context.Context) ([]jobs.QueueStats, error) {
+	result := make([]jobs.QueueStats, 0)
+	for _, queue := range b.sortedQueues() {
+		result = append(result, queue.stats(b.name))
+	}
+
+	return result, nil
+}
+
+func (b *Broker) Connections(ctx context.Context) ([]jobs.ConnectionInfo, error) {
+	var age float64
+	connection := jobs.ConnectionInfo{
+		Name:         b.name,
+		Active:       true,
+		Queues:       []string{},
+		HeartbeatAge: &age,
+	}
+
+	for _, queue := range b.sortedQueues() {
+		if queue.isConsuming() {
+			connection.Queues = append(connection.Queues, queue.name)
+		}
+	}
+
+	return []jobs.ConnectionInfo{connection}, nil
+}
+
+func (b *Broker) PurgeReady(ctx context.Context, queue string) (int64, error) {
+	q, err := b.queue(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	count := int64(len(q.ready))
+	q.ready = nil
+	return count, nil
+}
+
+func (b *Broker) PurgeRejected(ctx context.Context, queue string) (int64, error) {
+	q, err := b.queue(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	count := int64(len(q.rejected))
+	q.rejected = nil
+	return count, nil
+}
+
+func (b *Broker) ReturnRejected(ctx context.Context, queue string, max int64) (int64, error) {
+	q, err := b.queue(queue)
+	if err != nil {
+		return 0, err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	count := int64(len(q.rejected))
+	if count > max {
+		count = max
+	}
+
+	q.ready = append(q.ready, q.rejected[:count]...)
+	q.rejected = q.rejected[count:]
+	return count, nil
+}
+
+// Clean does nothing, deliveries are never owned by another process.
+func (b *Broker) Clean(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (b *Broker) queue(name string) (*Queue, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	queue, ok := b.queues[name]
+	if !ok {
+		return nil, jobs.ErrQueueNotFound
+	}
+
+	return queue, nil
+}
+
+func (b *Broker) sortedQueues() []*Queue {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	queues := make([]*Queue, 0, len(b.queues))
+	for _, queue := range b.queues {
+		queues = append(queues, queue)
+	}
+
+	sort.Slice(queues, func(i, j int) bool {
+		return queues[i].name < queues[j].name
+	})
+
+	return queues
+}
+
+type Queue struct {
+	name string
+
+	mu            sync.Mutex
+	ready         []string
+	rejected      []string
+	unacked       int64
+	consumers     []string
+	deliveries    chan jobs.Delivery
+	stop          chan struct{}
+	stopped       bool
+	prefetchLimit int64
+	polling       sync.WaitGroup
+	consuming     sync.WaitGroup
+}
+
+func (q *Queue) Publish(ctx context.Context, payload []byte) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.ready = append(q.ready, string(payload))
+	return nil
+}
+
+func (q *Queue) StartConsuming(prefetchLimit int64, pollDuration time.Duration) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.deliveries != nil {
+		return jobs.ErrQueueConsuming
+	}
+
+	q.prefetchLimit = prefetchLimit
+	q.deliveries = make(chan jobs.Delivery, prefetchLimit)
+	q.stop = make(chan struct{})
+
+	q.polling.Add(1)
+	go q.poll(q.deliveries, q.stop, pollDuration)
+
+	return nil
+}
+
+func (q *Queue) AddConsumer(tag string, consumer jobs.QueueConsumer) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if q.deliveries == nil || q.stopped {
+		return jobs.ErrQueueNotConsuming
+	}
+
+	q.consumers = append(q.consumers, tag)
+	q.consuming.Add(1)
+	go func(deliveries <-chan jobs.Delivery) {
+		defer q.consuming.Done()
+		for delivery := range deliveries {
+			consumer.Consume(delivery)
+		}
+	}(q.deliveries)
+
+	return nil
+}
+
+func (q *Queue) StopConsuming() <-chan struct{} {
+	finished := make(chan struct{})
+
+	q.mu.Lock()
+	if q.deliveries == nil || q.stopped {
+		q.mu.Unlock()
+		close(finished)
+		return finished
+	}
+
+	q.stopped = true
+	close(q.stop)
+	q.mu.Unlock()
+
+	go func() {
+		// the poller closes the deliveries channel, consumers handle the fetched deliveries before returning
+		q.polling.Wait()
+		q.consuming.Wait()
+
+		q.mu.Lock()
+		q.consumers = nil
+		q.mu.Unlock()
+
+		close(finished)
+	}()
+
+	return finished
+}
+
+func (q *Queue) poll(deliveries chan jobs.Delivery, stop <-chan struct{}, pollDuration time.Duration) {
+	defer q.polling.Done()
+	defer close(deliveries)
+
+	for {
+		for _, payload := range q.fetch() {
+			// the channel has room for prefetchLimit deliveries, so this never blocks
+			deliveries <- &Delivery{queue: q, payload: payload}
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-time.After(pollDuration):
+		}
+	}
+}
+
+// fetch moves up to prefetchLimit deliveries from ready to unacked
+func (q *Queue) fetch() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	batch := q.prefetchLimit - q.unacked
+	if batch <= 0 {
+		return nil
+	}
+
+	if batch > int64(len(q.ready)) {
+		batch = int64(len(q.ready))
+	}
+
+	payloads := q.ready[:batch]
+	q.ready = q.ready[batch:]
+	q.unacked += batch
+	return payloads
+}
+
+func (q *Queue) isConsuming() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	return q.deliveries != nil && !q.stopped
+}
+
+func (q *Queue) stats(connection string) jobs.QueueStats {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	stats := jobs.QueueStats{
+		Name:        q.name,
+		Ready:       int64(len(q.ready)),
+		Rejected:    int64(len(q.rejected)),
+		Unacked:     q.unacked,
+		Consumers:   int64(len(q.consumers)),
+		Connections: []jobs.QueueConnectionStats{},
+	}
+
+	if len(q.consumers) > 0 || q.unacked > 0 {
+		consumers := make([]string, len(q.consumers))
+		copy(consumers, q.consumers)
+		sort.Strings(consumers)
+
+		stats.Connections = append(stats.Connections, jobs.QueueConnectionStats{
+			Name:      connection,
+			Active:    true,
+			Unacked:   q.unacked,
+			Consumers: consumers,
+		})
+	}
+
+	return stats
+}
+
+type Delivery struct {
+	queue   *Queue
+	payload string
+
+	mu      sync.Mutex
+	settled bool
+}
+
+func (d *Delivery) Payload() string {
+	return d.payload
+}
+
+func (d *Delivery) Ack() error {
+	return d.settle(nil)
+}
+
+func (d *Delivery) Reject() error {
+	return d.settle(func(q *Queue) {
+		q.rejected = append(q.rejected, d.payload)
+	})
+}
+
+// Push returns the delivery, memory queues have no push queue.
+func (d *Delivery) Push() error {
+	return d.Return()
+}
+
+func (d *Delivery) Return() error {
+	return d.settle(func(q *Queue) {
+		q.ready = append(q.ready, d.payload)
+	})
+}
+
+// settle releases the delivery, move keeps its payload in another list of the queue.
+func (d *Delivery) settle(move func(q *Queue)) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if d.settled {
+		return jobs.ErrDeliveryNotFound
+	}
+
+	d.settled = true
+
+	q := d.queue
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	q.unacked--
+	if move != nil {
+		move(q)
+	}
+
+	return nil
+}
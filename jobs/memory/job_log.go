@@ -0,0 +1,54 @@
+package memory
+
+import (
+	"context"
+	"sync"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+// JobLogStore keeps the log lines of jobs in memory, it follows the semantics of jobs.JobLogStoreImpl.
+type JobLogStore struct {
+	mu     sync.RWMutex
+	lines  []jobs.JobLogLine
+	nextId int64
+}
+
+func NewJobLogStore() *JobLogStore {
+	return &JobLogStore{}
+}
+
+func (s *JobLogStore) AppendJobLog(ctx context.Context, line jobs.JobLogLine) (jobs.JobLogLine, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if line.CreatedAt.IsZero() {
+		line.CreatedAt = utils.TimeNow()
+	}
+
+	s.nextId++
+	line.Id = s.nextId
+	line.CreatedAt = line.CreatedAt.UTC()
+	s.lines = append(s.lines, line)
+	return line, nil
+}
+
+func (s *JobLogStore) JobLogs(ctx context.Context, tenantId string, jobId int, afterId int64, limit int) ([]jobs.JobLogLine, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []jobs.JobLogLine
+	for _, line := range s.lines {
+		if line.TenantId != tenantId || line.JobId != jobId || line.Id <= afterId {
+			continue
+		}
+
+		result = append(result, line)
+		if limit > 0 && len(result) == limit {
+			break
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package memory
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/tuyentv96/hasty-challenge/jobs/jobstest"
+)
+
+func TestMain(m *testing.M) {
+	// Run in a time zone other than UTC like the tests of the jobs package
+	time.Local = time.FixedZone("UTC+7", 7*60*60)
+	os.Exit(m.Run())
+}
+
+func TestStore(t *testing.T) {
+	jobstest.TestStore(t, NewStore())
+}
+
+func TestTransactioner(t *testing.T) {
+	jobstest.TestTransactioner(t, NewTransactioner(), NewStore())
+}
+
+func TestBroker(t *testing.T) {
+	jobstest.TestBroker(t, NewBroker("test"))
+}
+
+func TestJobLogStore(t *testing.T) {
+	jobstest.TestJobLogStore(t, NewJobLogStore())
+}
+
+func TestWorkerRegistry(t *testing.T) {
+	jobstest.TestWorkerRegistry(t, NewWorkerRegistry())
+}
+
+func TestSettingsStore(t *testing.T) {
+	jobstest.TestSettingsStore(t, NewSettingsStore())
+}
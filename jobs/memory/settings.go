@@ -0,0 +1,85 @@
+package memory
+
+import (
+	"context"
+	"encoding/json"
+	"sort"
+	"sync"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+// SettingsStore keeps the runtime settings in memory, it follows the semantics of jobs.SettingsStoreImpl.
+type SettingsStore struct {
+	mu       sync.RWMutex
+	settings map[string]jobs.Setting
+}
+
+func NewSettingsStore() *SettingsStore {
+	return &SettingsStore{
+		settings: make(map[string]jobs.Setting),
+	}
+}
+
+func (s *SettingsStore) Settings(ctx context.Context) ([]jobs.Setting, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	settings := make([]jobs.Setting, 0, len(s.settings))
+	for _, setting := range s.settings {
+		settings = append(settings, setting)
+	}
+
+	sort.Slice(settings, func(i, j int) bool {
+		return settings[i].Key < settings[j].Key
+	})
+
+	return settings, nil
+}
+
+func (s *SettingsStore) PutSetting(ctx context.Context, setting jobs.Setting) (jobs.Setting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if setting.IsReset() {
+		setting.Value = json.RawMessage("null")
+	}
+
+	setting.Value = append(json.RawMessage(nil), setting.Value...)
+	setting.UpdatedAt = utils.TimeNow()
+	s.settings[setting.Key] = setting
+	return setting, nil
+}
+
+func (s *SettingsStore) PutSettingItem(ctx context.Context, key string, item string, present bool, by string) (jobs.Setting, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// a value that is not a list counts as empty, like in jobs.SettingsStoreImpl
+	var items []string
+	_ = json.Unmarshal(s.settings[key].Value, &items)
+
+	unique := make(map[string]bool, len(items)+1)
+	for _, current := range items {
+		unique[current] = true
+	}
+	unique[item] = present
+
+	kept := make([]string, 0, len(unique))
+	for current, ok := range unique {
+		if ok {
+			kept = append(kept, current)
+		}
+	}
+	sort.Strings(kept)
+
+	value, err := json.Marshal(kept)
+	if err != nil {
+		return jobs.Setting{}, err
+	}
+
+	setting := jobs.Setting{Key: key, Value: value, UpdatedBy: by, UpdatedAt: utils.TimeNow()}
+	s.settings[key] = setting
+	return setting, nil
+}
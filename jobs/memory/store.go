@@ -0,0 +1,203 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+// Store keeps jobs in memory, it follows the semantics of jobs.StoreImpl.
+type Store struct {
+	mu     sync.RWMutex
+	jobs   map[int]jobs.Job
+	nextId int
+}
+
+func NewStore() *Store {
+	return &Store{
+		jobs: make(map[int]jobs.Job),
+	}
+}
+
+func (s *Store) SaveJob(ctx context.Context, job jobs.Job) (jobs.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// Zero values get the defaults of the jobs table
+	if job.TenantId == "" {
+		job.TenantId = jobs.DefaultTenantId
+	}
+
+	if job.Type == "" {
+		job.Type = jobs.DefaultJobType
+	}
+
+	if job.Priority == "" {
+		job.Priority = jobs.DefaultJobPriority
+	}
+
+	// Times are kept in UTC like in the timestamptz columns of the jobs table
+	if job.CreatedAt.IsZero() {
+		job.CreatedAt = utils.TimeNow()
+	}
+
+	job.CreatedAt = job.CreatedAt.UTC()
+	job.StartTime = utils.TimePtrToUTC(job.StartTime)
+	job.EndTime = utils.TimePtrToUTC(job.EndTime)
+	job.PublishedAt = utils.TimePtrToUTC(job.PublishedAt)
+
+	s.nextId++
+	job.Id = s.nextId
+	s.jobs[job.Id] = job
+
+	onRollback(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		delete(s.jobs, job.Id)
+	})
+
+	return job, nil
+}
+
+func (s *Store) UpdateJobOptimistically(ctx context.Context, job jobs.Job, currentStatus jobs.JobStatus) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	previous, ok := s.jobs[job.Id]
+	if !ok || previous.TenantId != job.TenantId || previous.Status != currentStatus {
+		return jobs.ErrNoRowUpdated
+	}
+
+	updated := previous
+	updated.Status = job.Status
+	updated.StartTime = utils.TimePtrToUTC(job.StartTime)
+	updated.EndTime = utils.TimePtrToUTC(job.EndTime)
+	updated.PublishedAt = utils.TimePtrToUTC(job.PublishedAt)
+	updated.WorkerId = job.WorkerId
+	updated.Hostname = job.Hostname
+	updated.Attempts = job.Attempts
+	updated.Error = job.Error
+	s.jobs[job.Id] = updated
+
+	onRollback(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		s.jobs[job.Id] = previous
+	})
+
+	return nil
+}
+
+func (s *Store) GetJobByID(ctx context.Context, tenantId string, jobId int) (jobs.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[jobId]
+	if !ok || job.TenantId != tenantId {
+		return jobs.Job{}, jobs.ErrJobNotFound
+	}
+
+	return job, nil
+}
+
+func (s *Store) GetJobByObjectId(ctx context.Context, tenantId string, objectId int, createdAt time.Time) (jobs.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, job := range s.sortedJobs() {
+		if job.TenantId == tenantId && job.ObjectId == objectId && !job.CreatedAt.Before(createdAt) {
+			return job, nil
+		}
+	}
+
+	return jobs.Job{}, jobs.ErrJobNotFound
+}
+
+func (s *Store) ListJobs(ctx context.Context, filter jobs.JobFilter) ([]jobs.Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	sorted := s.sortedJobs()
+	var result []jobs.Job
+	for i := len(sorted) - 1; i >= 0; i-- {
+		job := sorted[i]
+		if job.TenantId != filter.TenantId ||
+			(filter.Status != "" && job.Status != filter.Status) ||
+			(filter.Type != "" && job.Type != filter.Type) ||
+			(filter.ObjectId != 0 && job.ObjectId != filter.ObjectId) {
+			continue
+		}
+
+		result = append(result, job)
+		if filter.Limit > 0 && len(result) == filter.Limit {
+			break
+		}
+	}
+
+	return result, nil
+}
+
+func (s *Store) DeleteJobs(ctx context.Context, filter jobs.RetentionFilter) ([]jobs.Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sorted := s.sortedJobs()
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].CreatedAt.Before(sorted[j].CreatedAt)
+	})
+
+	var deleted []jobs.Job
+	for _, job := range sorted {
+		if filter.Limit > 0 && len(deleted) == filter.Limit {
+			break
+		}
+
+		if !job.CreatedAt.Before(filter.CreatedBefore) || !containsStatus(filter.Statuses, job.Status) {
+			continue
+		}
+
+		delete(s.jobs, job.Id)
+		deleted = append(deleted, job)
+	}
+
+	onRollback(ctx, func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		for _, job := range deleted {
+			s.jobs[job.Id] = job
+		}
+	})
+
+	return deleted, nil
+}
+
+func containsStatus(statuses []jobs.JobStatus, status jobs.JobStatus) bool {
+	for _, s := range statuses {
+		if s == status {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortedJobs returns the jobs ordered by id, the caller must hold the lock
+func (s *Store) sortedJobs() []jobs.Job {
+	result := make([]jobs.Job, 0, len(s.jobs))
+	for _, job := range s.jobs {
+		result = append(result, job)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Id < result[j].Id
+	})
+
+	return result
+}
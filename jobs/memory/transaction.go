@@ -0,0 +1,65 @@
+package memory
+
+import (
+	"context"
+	"sync"
+)
+
+type transactionKey struct{}
+
+type transaction struct {
+	mu   sync.Mutex
+	undo []func()
+}
+
+func (t *transaction) rollback() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	for i := len(t.undo) - 1; i >= 0; i-- {
+		t.undo[i]()
+	}
+
+	t.undo = nil
+}
+
+// Transactioner runs functions in a transaction kept in the context.
+// Changes of the memory store are visible immediately and reverted from an undo log when the function fails.
+type Transactioner struct{}
+
+func NewTransactioner() *Transactioner {
+	return &Transactioner{}
+}
+
+func (t *Transactioner) RunWithTransaction(ctx context.Context, fn func(ctx context.Context) error) (err error) {
+	// Join the transaction of the caller, it will be reverted as a whole
+	if _, ok := ctx.Value(transactionKey{}).(*transaction); ok {
+		return fn(ctx)
+	}
+
+	tx := &transaction{}
+	defer func() {
+		if p := recover(); p != nil {
+			// a panic occurred, rollback and repanic
+			tx.rollback()
+			panic(p)
+		} else if err != nil {
+			tx.rollback()
+		}
+	}()
+
+	return fn(context.WithValue(ctx, transactionKey{}, tx))
+}
+
+// onRollback registers fn to revert a change made in the transaction of ctx, changes made without a transaction are final.
+func onRollback(ctx context.Context, fn func()) {
+	tx, ok := ctx.Value(transactionKey{}).(*transaction)
+	if !ok {
+		return
+	}
+
+	tx.mu.Lock()
+	defer tx.mu.Unlock()
+
+	tx.undo = append(tx.undo, fn)
+}
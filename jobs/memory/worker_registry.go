@@ -0,0 +1,63 @@
+package memory
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/tuyentv96/hasty-challenge/jobs"
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+// WorkerRegistry keeps the workers of the process in memory, it follows the semantics of jobs.WorkerRegistryImpl.
+type WorkerRegistry struct {
+	mu      sync.RWMutex
+	workers map[string]jobs.WorkerInfo
+}
+
+func NewWorkerRegistry() *WorkerRegistry {
+	return &WorkerRegistry{
+		workers: make(map[string]jobs.WorkerInfo),
+	}
+}
+
+func (r *WorkerRegistry) Register(ctx context.Context, worker jobs.WorkerInfo) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if registered, ok := r.workers[worker.Id]; ok {
+		worker.Hostname = registered.Hostname
+		worker.StartedAt = registered.StartedAt
+	}
+
+	worker.StartedAt = worker.StartedAt.UTC()
+	worker.HeartbeatAt = utils.TimeNow()
+	r.workers[worker.Id] = worker
+	return nil
+}
+
+func (r *WorkerRegistry) Unregister(ctx context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.workers, id)
+	return nil
+}
+
+func (r *WorkerRegistry) Workers(ctx context.Context) ([]jobs.WorkerInfo, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	workers := make([]jobs.WorkerInfo, 0, len(r.workers))
+	for _, worker := range r.workers {
+		worker.Active = time.Since(worker.HeartbeatAt) < jobs.WorkerHeartbeatTTL
+		workers = append(workers, worker)
+	}
+
+	sort.Slice(workers, func(i, j int) bool {
+		return workers[i].Id < workers[j].Id
+	})
+
+	return workers, nil
+}
@@ -0,0 +1,140 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"time"
+
+	"github.com/labstack/echo/v4"
+)
+
+// JobMessageVersion is the version of the JobMessage published by this code.
+// Version 0 is the whole job the workers published before, the consumers still read it.
+const JobMessageVersion = 1
+
+// JobMessage is what is published to the queues: a reference to a job rather than a copy of it,
+// the consumer runs the job stored when the message is consumed.
+type JobMessage struct {
+	Version  int    `json:"v"`
+	JobId    int    `json:"job_id"`
+	TenantId string `json:"tenant_id"`
+	// Attempt is the number of attempts of the job when it was published, the messages of a past attempt are skipped
+	Attempt     int           `json:"attempt"`
+	PublishedAt *time.Time    `json:"published_at,omitempty"`
+	Trace       *TraceContext `json:"trace,omitempty"`
+}
+
+// NewJobMessage returns the message of job published with ctx, it carries the trace context of ctx.
+func NewJobMessage(ctx context.Context, job Job) JobMessage {
+	msg := JobMessage{
+		Version:     JobMessageVersion,
+		JobId:       job.Id,
+		TenantId:    job.TenantId,
+		Attempt:     job.Attempts,
+		PublishedAt: job.PublishedAt,
+	}
+
+	if trace, ok := TraceContextFromContext(ctx); ok {
+		msg.Trace = &trace
+	}
+
+	return msg
+}
+
+func (m JobMessage) ToJSON() []byte {
+	buf, _ := json.Marshal(m)
+	return buf
+}
+
+// ParseJobMessage reads a message of any version up to JobMessageVersion, a newer version is left to the newer workers.
+func ParseJobMessage(payload []byte) (JobMessage, error) {
+	var probe struct {
+		Version *int `json:"v"`
+	}
+	if err := json.Unmarshal(payload, &probe); err != nil {
+		return JobMessage{}, err
+	}
+
+	if probe.Version == nil {
+		return parseJobMessageV0(payload)
+	}
+
+	if *probe.Version > JobMessageVersion {
+		return JobMessage{}, fmt.Errorf("%w: %d", ErrUnsupportedMessageVersion, *probe.Version)
+	}
+
+	var msg JobMessage
+	if err := json.Unmarshal(payload, &msg); err != nil {
+		return JobMessage{}, err
+	}
+
+	if msg.JobId == 0 {
+		return JobMessage{}, fmt.Errorf("message without a job id")
+	}
+
+	return msg, nil
+}
+
+// parseJobMessageV0 turns the job published by the workers before the versioned messages into its reference.
+func parseJobMessageV0(payload []byte) (JobMessage, error) {
+	job, err := JobFromJSON(payload)
+	if err != nil {
+		return JobMessage{}, err
+	}
+
+	if job.Id == 0 {
+		return JobMessage{}, fmt.Errorf("message without a job id")
+	}
+
+	// Jobs published before tenancy was introduced belong to the default tenant
+	if job.TenantId == "" {
+		job.TenantId = DefaultTenantId
+	}
+
+	return JobMessage{
+		JobId:       job.Id,
+		TenantId:    job.TenantId,
+		Attempt:     job.Attempts,
+		PublishedAt: job.PublishedAt,
+	}, nil
+}
+
+// TraceContext is the W3C trace context of the request which published a job, see https://www.w3.org/TR/trace-context/.
+type TraceContext struct {
+	TraceParent string `json:"traceparent"`
+	TraceState  string `json:"tracestate,omitempty"`
+}
+
+var traceParentPattern = regexp.MustCompile(`^[0-9a-f]{2}-[0-9a-f]{32}-[0-9a-f]{16}-[0-9a-f]{2}$`)
+
+type traceContextKey struct{}
+
+// WithTraceContext returns a copy of ctx carrying trace, the messages published with it continue the trace.
+func WithTraceContext(ctx context.Context, trace TraceContext) context.Context {
+	return context.WithValue(ctx, traceContextKey{}, trace)
+}
+
+func TraceContextFromContext(ctx context.Context) (TraceContext, bool) {
+	trace, ok := ctx.Value(traceContextKey{}).(TraceContext)
+	return trace, ok
+}
+
+// TraceMiddleware keeps the traceparent and tracestate headers of a request in its context, an invalid traceparent is ignored.
+func TraceMiddleware() echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			traceParent := c.Request().Header.Get("traceparent")
+			if traceParentPattern.MatchString(traceParent) {
+				req := c.Request()
+				c.SetRequest(req.WithContext(WithTraceContext(req.Context(), TraceContext{
+					TraceParent: traceParent,
+					TraceState:  req.Header.Get("tracestate"),
+				})))
+			}
+
+			return next(c)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+func TestJobMessage(t *testing.T) {
+	trace := TraceContext{TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", TraceState: "vendor=1"}
+	job := Job{
+		Id:          42,
+		TenantId:    "team-a",
+		ObjectId:    7,
+		Status:      JobStatusQueued,
+		Attempts:    2,
+		PublishedAt: utils.TimeToPtr(time.Date(2026, 10, 19, 12, 0, 0, 0, time.UTC)),
+	}
+
+	t.Run("publish a reference of the job", func(t *testing.T) {
+		msg := NewJobMessage(WithTraceContext(context.Background(), trace), job)
+		assert.JSONEq(t, `{
+			"v": 1,
+			"job_id": 42,
+			"tenant_id": "team-a",
+			"attempt": 2,
+			"published_at": "2026-10-19T12:00:00Z",
+			"trace": {"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "tracestate": "vendor=1"}
+		}`, string(msg.ToJSON()))
+
+		parsed, err := ParseJobMessage(msg.ToJSON())
+		require.NoError(t, err)
+		assert.Equal(t, msg, parsed)
+
+		assert.Nil(t, NewJobMessage(context.Background(), job).Trace)
+	})
+
+	t.Run("read the jobs published before the versioned messages", func(t *testing.T) {
+		msg, err := ParseJobMessage(job.ToJSON())
+		require.NoError(t, err)
+		assert.Equal(t, JobMessage{JobId: 42, TenantId: "team-a", Attempt: 2, PublishedAt: job.PublishedAt}, msg)
+
+		msg, err = ParseJobMessage([]byte(`{"id": 43, "object_id": 7, "status": "created"}`))
+		require.NoError(t, err)
+		assert.Equal(t, DefaultTenantId, msg.TenantId, "jobs published before tenancy belong to the default tenant")
+	})
+
+	t.Run("leave the newer versions", func(t *testing.T) {
+		_, err := ParseJobMessage([]byte(`{"v": 2, "job_id": 42}`))
+		assert.ErrorIs(t, err, ErrUnsupportedMessageVersion)
+	})
+
+	t.Run("malformed messages", func(t *testing.T) {
+		for _, payload := range []string{`not json`, `{"v": 1, "tenant_id": "team-a"}`, `{"object_id": 7}`} {
+			_, err := ParseJobMessage([]byte(payload))
+			assert.Error(t, err, payload)
+			assert.NotErrorIs(t, err, ErrUnsupportedMessageVersion, payload)
+		}
+	})
+}
+
+func TestTraceMiddleware(t *testing.T) {
+	traceOf := func(headers map[string]string) (TraceContext, bool) {
+		var trace TraceContext
+		var ok bool
+		handler := TraceMiddleware()(func(c echo.Context) error {
+			trace, ok = TraceContextFromContext(c.Request().Context())
+			return nil
+		})
+
+		req := httptest.NewRequest(http.MethodPost, "/v1/jobs", nil)
+		for key, value := range headers {
+			req.Header.Set(key, value)
+		}
+
+		require.NoError(t, handler(echo.New().NewContext(req, httptest.NewRecorder())))
+		return trace, ok
+	}
+
+	trace, ok := traceOf(map[string]string{
+		"traceparent": "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"tracestate":  "vendor=1",
+	})
+	require.True(t, ok)
+	assert.Equal(t, TraceContext{TraceParent: "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", TraceState: "vendor=1"}, trace)
+
+	_, ok = traceOf(map[string]string{"traceparent": "invalid"})
+	assert.False(t, ok)
+
+	_, ok = traceOf(nil)
+	assert.False(t, ok)
+}
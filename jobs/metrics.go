@@ -0,0 +1,33 @@
+package jobs
+
+import "expvar"
+
+// Metrics of the jobs package, they are published by expvar under "jobs".
+var (
+	metrics = expvar.NewMap("jobs")
+	// panicsByType counts the panics recovered from jobs per job type
+	panicsByType = new(expvar.Map).Init()
+	// pausedQueues is 1 for the queues consumed by the worker which are paused, 0 for the others
+	pausedQueues = new(expvar.Map).Init()
+)
+
+const metricPanics = "panics"
+
+func init() {
+	metrics.Set("panics_by_type", panicsByType)
+	metrics.Set("paused_queues", pausedQueues)
+}
+
+func countPanic(jobType string) {
+	metrics.Add(metricPanics, 1)
+	panicsByType.Add(jobType, 1)
+}
+
+func setQueuePaused(queue string, paused bool) {
+	value := new(expvar.Int)
+	if paused {
+		value.Set(1)
+	}
+
+	pausedQueues.Set(queue, value)
+}
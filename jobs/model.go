@@ -1,29 +1,143 @@
 package jobs
 
 import (
+	"context"
 	"encoding/json"
 	"time"
+
+	"github.com/tuyentv96/hasty-challenge/utils"
+)
+
+const DefaultJobType = "default"
+
+const (
+	JobPriorityHigh   = "high"
+	JobPriorityNormal = "normal"
+	JobPriorityLow    = "low"
+
+	DefaultJobPriority = JobPriorityNormal
 )
 
+// JobPriorities lists the priorities from the most to the least urgent
+var JobPriorities = []string{JobPriorityHigh, JobPriorityNormal, JobPriorityLow}
+
+func IsValidJobPriority(priority string) bool {
+	for _, p := range JobPriorities {
+		if p == priority {
+			return true
+		}
+	}
+
+	return false
+}
+
 type JobStatus string
 
+// Statuses of a job, see jobTransitions for the changes between them
 const (
-	JobStatusCreated JobStatus = "created"
-	JobStatusRunning JobStatus = "running"
-	JobStatusSuccess JobStatus = "success"
-	JobStatusFailed  JobStatus = "failed"
+	JobStatusCreated   JobStatus = "created"
+	JobStatusScheduled JobStatus = "scheduled"
+	JobStatusQueued    JobStatus = "queued"
+	JobStatusRunning   JobStatus = "running"
+	JobStatusRetrying  JobStatus = "retrying"
+	JobStatusSuccess   JobStatus = "success"
+	JobStatusFailed    JobStatus = "failed"
+	JobStatusTimedOut  JobStatus = "timed_out"
+	JobStatusCancelled JobStatus = "cancelled"
+	JobStatusExpired   JobStatus = "expired"
 )
 
+// Codes of JobError
+const (
+	JobErrorTimeout    = "timeout"
+	JobErrorHandler    = "handler_error"
+	JobErrorPanic      = "panic"
+	JobErrorCancelled  = "cancelled"
+	JobErrorLostWorker = "lost_worker"
+)
+
+// JobError describes why a job failed or was cancelled, see NewJobError.
+type JobError struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+	// Retryable tells whether the job may succeed when it is retried
+	Retryable bool                   `json:"retryable"`
+	Attempt   int                    `json:"attempt"`
+	Details   map[string]interface{} `json:"details,omitempty"`
+}
+
 type Job struct {
 	tableName struct{} `pg:"jobs,discard_unknown_columns"`
 
-	Id        int        `json:"id" pg:"id"`
-	ObjectId  int        `json:"object_id" pg:"object_id"`
-	Status    JobStatus  `json:"status" pg:"status"`
-	StartTime *time.Time `json:"start_time" pg:"start_time"`
-	EndTime   *time.Time `json:"end_time" pg:"end_time"`
-	Message   string     `json:"message" pg:"message"`
-	CreatedAt time.Time  `json:"created_at" pg:"created_at"`
+	Id       int       `json:"id" pg:"id"`
+	TenantId string    `json:"tenant_id" pg:"tenant_id"`
+	ObjectId int       `json:"object_id" pg:"object_id"`
+	Type     string    `json:"type" pg:"type"`
+	Priority string    `json:"priority" pg:"priority"`
+	Status   JobStatus `json:"status" pg:"status"`
+	// PublishedAt is the last time the job was published to its queue
+	PublishedAt *time.Time `json:"published_at" pg:"published_at"`
+	StartTime   *time.Time `json:"start_time" pg:"start_time"`
+	EndTime     *time.Time `json:"end_time" pg:"end_time"`
+	// Attempts counts the runs of the job, it is incremented when a worker claims the job
+	Attempts int `json:"attempts" pg:"attempts,use_zero"`
+	// WorkerId is the consumer which ran the last attempt, e.g. "host-42-x1y2/worker:3", on the host Hostname
+	WorkerId  string    `json:"worker_id" pg:"worker_id"`
+	Hostname  string    `json:"hostname" pg:"hostname"`
+	Error     *JobError `json:"error,omitempty" pg:"error,type:jsonb"`
+	CreatedAt time.Time `json:"created_at" pg:"created_at"`
+}
+
+// QueueWait is the time the last attempt of the job waited in the queue, from its publication to its claim.
+func (j Job) QueueWait() (time.Duration, bool) {
+	if j.PublishedAt == nil || j.StartTime == nil {
+		return 0, false
+	}
+
+	return j.StartTime.Sub(*j.PublishedAt), true
+}
+
+// RunTime is the time the last attempt of the job ran, from its claim to its end.
+func (j Job) RunTime() (time.Duration, bool) {
+	if j.StartTime == nil || j.EndTime == nil {
+		return 0, false
+	}
+
+	return j.EndTime.Sub(*j.StartTime), true
+}
+
+// MarshalJSON adds queue_wait_ms and run_ms to the fields of the job, they are null until they are known.
+func (j Job) MarshalJSON() ([]byte, error) {
+	type job Job
+	value := struct {
+		job
+		QueueWaitMs *int64 `json:"queue_wait_ms"`
+		RunMs       *int64 `json:"run_ms"`
+	}{job: job(j)}
+
+	if wait, ok := j.QueueWait(); ok {
+		value.QueueWaitMs = durationMs(wait)
+	}
+
+	if run, ok := j.RunTime(); ok {
+		value.RunMs = durationMs(run)
+	}
+
+	return json.Marshal(value)
+}
+
+func durationMs(d time.Duration) *int64 {
+	ms := d.Milliseconds()
+	return &ms
+}
+
+// AfterScan converts the times read from Postgres to UTC, they are read in the time zone of the session otherwise.
+func (j *Job) AfterScan(ctx context.Context) error {
+	j.CreatedAt = j.CreatedAt.UTC()
+	j.StartTime = utils.TimePtrToUTC(j.StartTime)
+	j.EndTime = utils.TimePtrToUTC(j.EndTime)
+	j.PublishedAt = utils.TimePtrToUTC(j.PublishedAt)
+	return nil
 }
 
 func (j Job) ToJSON() []byte {
@@ -41,6 +155,25 @@ func JobFromJSON(js []byte) (Job, error) {
 	return job, err
 }
 
+// RetentionFilter selects the jobs the maintenance archives or purges, the oldest first
+type RetentionFilter struct {
+	Statuses      []JobStatus
+	CreatedBefore time.Time
+	Limit         int
+}
+
+// JobFilter selects the jobs of a tenant, empty fields match every job
+type JobFilter struct {
+	TenantId string
+	Status   JobStatus
+	Type     string
+	ObjectId int
+	Limit    int
+}
+
 type JobPayload struct {
-	ObjectId int `json:"object_id"`
+	ObjectId int    `json:"object_id"`
+	Type     string `json:"type"`
+	// Priority is high, normal or low, it is normal when empty
+	Priority string `json:"priority"`
 }
@@ -1,6 +1,7 @@
 package jobs
 
 import (
+	"context"
 	"testing"
 	"time"
 
@@ -17,32 +18,46 @@ func newTestObjectId() int {
 
 func TestModelToJSON(t *testing.T) {
 	job := Job{
-		Id:        1,
-		ObjectId:  99093383,
-		Status:    JobStatusCreated,
-		StartTime: utils.TimeToPtr(time.Date(2020, 02, 01, 03, 04, 05, 0, time.UTC)),
-		EndTime:   utils.TimeToPtr(time.Date(2020, 03, 01, 03, 04, 05, 0, time.UTC)),
-		Message:   "test message",
-		CreatedAt: time.Date(2019, 04, 01, 03, 04, 05, 0, time.UTC),
+		Id:          1,
+		TenantId:    DefaultTenantId,
+		ObjectId:    99093383,
+		Type:        DefaultJobType,
+		Priority:    DefaultJobPriority,
+		Status:      JobStatusCreated,
+		PublishedAt: utils.TimeToPtr(time.Date(2020, 02, 01, 03, 04, 0, 0, time.UTC)),
+		StartTime:   utils.TimeToPtr(time.Date(2020, 02, 01, 03, 04, 05, 0, time.UTC)),
+		EndTime:     utils.TimeToPtr(time.Date(2020, 03, 01, 03, 04, 05, 0, time.UTC)),
+		Attempts:    1,
+		WorkerId:    "host-1-abc/worker:0",
+		Hostname:    "host",
+		Error:       &JobError{Code: JobErrorHandler, Message: "test message", Attempt: 1},
+		CreatedAt:   time.Date(2019, 04, 01, 03, 04, 05, 0, time.UTC),
 	}
 
-	want := []byte(`{"id":1,"object_id":99093383,"status":"created","start_time":"2020-02-01T03:04:05Z","end_time":"2020-03-01T03:04:05Z","message":"test message","created_at":"2019-04-01T03:04:05Z"}`)
+	want := []byte(`{"id":1,"tenant_id":"default","object_id":99093383,"type":"default","priority":"normal","status":"created","published_at":"2020-02-01T03:04:00Z","start_time":"2020-02-01T03:04:05Z","end_time":"2020-03-01T03:04:05Z","attempts":1,"worker_id":"host-1-abc/worker:0","hostname":"host","error":{"code":"handler_error","message":"test message","retryable":false,"attempt":1},"created_at":"2019-04-01T03:04:05Z","queue_wait_ms":5000,"run_ms":2505600000}`)
 	assert.Equal(t, want, job.ToJSON())
 }
 
 func TestModelJobFromJSON(t *testing.T) {
 	t.Run("happy case", func(t *testing.T) {
 		job := Job{
-			Id:        1,
-			ObjectId:  99093383,
-			Status:    JobStatusCreated,
-			StartTime: utils.TimeToPtr(time.Date(2020, 02, 01, 03, 04, 05, 0, time.UTC)),
-			EndTime:   utils.TimeToPtr(time.Date(2020, 03, 01, 03, 04, 05, 0, time.UTC)),
-			Message:   "test message",
-			CreatedAt: time.Date(2019, 04, 01, 03, 04, 05, 0, time.UTC),
+			Id:          1,
+			TenantId:    DefaultTenantId,
+			ObjectId:    99093383,
+			Type:        DefaultJobType,
+			Priority:    DefaultJobPriority,
+			Status:      JobStatusCreated,
+			PublishedAt: utils.TimeToPtr(time.Date(2020, 02, 01, 03, 04, 0, 0, time.UTC)),
+			StartTime:   utils.TimeToPtr(time.Date(2020, 02, 01, 03, 04, 05, 0, time.UTC)),
+			EndTime:     utils.TimeToPtr(time.Date(2020, 03, 01, 03, 04, 05, 0, time.UTC)),
+			Attempts:    1,
+			WorkerId:    "host-1-abc/worker:0",
+			Hostname:    "host",
+			Error:       &JobError{Code: JobErrorHandler, Message: "test message", Attempt: 1},
+			CreatedAt:   time.Date(2019, 04, 01, 03, 04, 05, 0, time.UTC),
 		}
 
-		js := []byte(`{"id":1,"object_id":99093383,"status":"created","start_time":"2020-02-01T03:04:05Z","end_time":"2020-03-01T03:04:05Z","message":"test message","created_at":"2019-04-01T03:04:05Z"}`)
+		js := []byte(`{"id":1,"tenant_id":"default","object_id":99093383,"type":"default","priority":"normal","status":"created","published_at":"2020-02-01T03:04:00Z","start_time":"2020-02-01T03:04:05Z","end_time":"2020-03-01T03:04:05Z","attempts":1,"worker_id":"host-1-abc/worker:0","hostname":"host","error":{"code":"handler_error","message":"test message","retryable":false,"attempt":1},"created_at":"2019-04-01T03:04:05Z"}`)
 		actual, err := JobFromJSON(js)
 		require.NoError(t, err)
 
@@ -55,3 +70,20 @@ func TestModelJobFromJSON(t *testing.T) {
 		assert.NotNil(t, err)
 	})
 }
+
+func TestModelAfterScan(t *testing.T) {
+	zone := time.FixedZone("UTC+7", 7*60*60)
+	at := time.Date(2020, 02, 01, 10, 04, 05, 0, zone)
+	job := Job{
+		PublishedAt: utils.TimeToPtr(at),
+		StartTime:   utils.TimeToPtr(at),
+		EndTime:     utils.TimeToPtr(at),
+		CreatedAt:   at,
+	}
+
+	require.NoError(t, job.AfterScan(context.Background()))
+	for _, scanned := range []time.Time{*job.PublishedAt, *job.StartTime, *job.EndTime, job.CreatedAt} {
+		assert.Equal(t, time.UTC, scanned.Location())
+		assert.True(t, at.Equal(scanned))
+	}
+}
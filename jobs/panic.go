@@ -0,0 +1,27 @@
+package jobs
+
+import (
+	"fmt"
+	"runtime/debug"
+)
+
+// PanicError is a panic recovered while a consumer ran a job.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", e.Value)
+}
+
+// recoverPanic runs fn and returns the panic it raised as a *PanicError, so a job cannot kill the worker.
+func recoverPanic(fn func() error) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = &PanicError{Value: p, Stack: debug.Stack()}
+		}
+	}()
+
+	return fn()
+}
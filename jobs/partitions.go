@@ -0,0 +1,132 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/go-pg/pg/v9/orm"
+)
+
+// JobPartitioner manages the partitions of the jobs table, the store has none without Postgres.
+type JobPartitioner interface {
+	// EnsurePartitions creates the missing partitions from the month of from to months later
+	EnsurePartitions(ctx context.Context, from time.Time, months int) ([]string, error)
+	// DropEmptyPartitions drops the empty partitions of the months which ended before before
+	DropEmptyPartitions(ctx context.Context, before time.Time) ([]string, error)
+}
+
+const jobPartitionPrefix = "jobs_p"
+
+// JobPartitions partitions the jobs table by month of created_at, the jobs_p202610 partition holds the jobs of October 2026.
+// Jobs outside of every partition land in jobs_default.
+type JobPartitions struct {
+	db orm.DB
+}
+
+func NewJobPartitions(db orm.DB) *JobPartitions {
+	return &JobPartitions{
+		db: db,
+	}
+}
+
+func jobPartitionName(month time.Time) string {
+	return jobPartitionPrefix + month.Format("200601")
+}
+
+func startOfMonth(t time.Time) time.Time {
+	t = t.UTC()
+	return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, time.UTC)
+}
+
+func (p *JobPartitions) EnsurePartitions(ctx context.Context, from time.Time, months int) ([]string, error) {
+	existing, err := p.partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var created []string
+	month := startOfMonth(from)
+	for i := 0; i <= months; i++ {
+		name := jobPartitionName(month)
+		next := month.AddDate(0, 1, 0)
+		if _, ok := existing[name]; !ok {
+			_, err := p.db.ExecContext(ctx, `CREATE TABLE IF NOT EXISTS ? PARTITION OF jobs FOR VALUES FROM (?) TO (?)`,
+				pg.Ident(name), month, next)
+			if err != nil {
+				return created, fmt.Errorf("failed to create partition %s: %w", name, err)
+			}
+
+			created = append(created, name)
+		}
+
+		month = next
+	}
+
+	return created, nil
+}
+
+func (p *JobPartitions) DropEmptyPartitions(ctx context.Context, before time.Time) ([]string, error) {
+	existing, err := p.partitions(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(existing))
+	for name := range existing {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var dropped []string
+	for _, name := range names {
+		month := existing[name]
+		if month.IsZero() || month.AddDate(0, 1, 0).After(before) {
+			continue
+		}
+
+		var empty bool
+		if _, err := p.db.QueryOneContext(ctx, pg.Scan(&empty), `SELECT NOT EXISTS (SELECT 1 FROM ?)`, pg.Ident(name)); err != nil {
+			return dropped, err
+		}
+
+		if !empty {
+			continue
+		}
+
+		if _, err := p.db.ExecContext(ctx, `DROP TABLE IF EXISTS ?`, pg.Ident(name)); err != nil {
+			return dropped, fmt.Errorf("failed to drop partition %s: %w", name, err)
+		}
+
+		dropped = append(dropped, name)
+	}
+
+	return dropped, nil
+}
+
+// partitions returns the partitions of the jobs table with their month, zero for the partitions not named by jobPartitionName
+func (p *JobPartitions) partitions(ctx context.Context) (map[string]time.Time, error) {
+	var names []string
+	_, err := p.db.QueryContext(ctx, &names, `SELECT child.relname FROM pg_inherits
+		JOIN pg_class parent ON parent.oid = pg_inherits.inhparent
+		JOIN pg_class child ON child.oid = pg_inherits.inhrelid
+		WHERE parent.relname = 'jobs'`)
+	if err != nil {
+		return nil, err
+	}
+
+	partitions := make(map[string]time.Time, len(names))
+	for _, name := range names {
+		var month time.Time
+		if strings.HasPrefix(name, jobPartitionPrefix) {
+			month, _ = time.Parse("200601", strings.TrimPrefix(name, jobPartitionPrefix))
+		}
+
+		partitions[name] = month
+	}
+
+	return partitions, nil
+}
@@ -0,0 +1,204 @@
+package jobs
+
+import (
+	"sort"
+	"sync"
+	"sync/atomic"
+)
+
+// priorityScheduler hands the deliveries of the priority queues to the job consumers with a smooth weighted round robin.
+// When every priority has ready deliveries, a priority of weight 6 is picked 6 times as often as one of weight 1,
+// so bulk jobs of low priority make progress while urgent jobs are preferred.
+// Only the priorities with a delivery waiting take part in a pick, an idle priority builds up no credit.
+type priorityScheduler struct {
+	weights map[string]int
+
+	mu      sync.Mutex
+	current map[string]int
+
+	deliveries map[string]chan Delivery
+	// waiting counts the deliveries blocked on their way to deliveries by priority, the map is never written after creation
+	waiting   map[string]*int64
+	done      chan struct{}
+	closeOnce sync.Once
+
+	// paused holds a channel per paused queue, it is closed when the queue is resumed
+	pauseMu   sync.Mutex
+	paused    map[string]chan struct{}
+	draining  chan struct{}
+	drainOnce sync.Once
+}
+
+// newPriorityScheduler uses a weight of 1 for the priorities without a positive weight.
+func newPriorityScheduler(weights map[string]int) *priorityScheduler {
+	s := &priorityScheduler{
+		weights:    make(map[string]int, len(JobPriorities)),
+		current:    make(map[string]int, len(JobPriorities)),
+		deliveries: make(map[string]chan Delivery, len(JobPriorities)),
+		waiting:    make(map[string]*int64, len(JobPriorities)),
+		done:       make(chan struct{}),
+		paused:     make(map[string]chan struct{}),
+		draining:   make(chan struct{}),
+	}
+
+	for _, priority := range JobPriorities {
+		weight := weights[priority]
+		if weight <= 0 {
+			weight = 1
+		}
+
+		s.weights[priority] = weight
+		// unbuffered, a delivery stays in its queue until a job consumer is free to run it
+		s.deliveries[priority] = make(chan Delivery)
+		s.waiting[priority] = new(int64)
+	}
+
+	return s
+}
+
+// consumer forwards the deliveries of a queue of the given priority to the job consumers.
+func (s *priorityScheduler) consumer(queue, priority string) QueueConsumer {
+	return QueueConsumerFunc(func(delivery Delivery) {
+		// The delivery of a paused queue waits unclaimed, the queue stops fetching once its prefetch limit is reached.
+		// When the worker stops meanwhile it is left unacked, the cleaner returns it to ready.
+		if !s.waitResumed(queue) {
+			return
+		}
+
+		atomic.AddInt64(s.waiting[priority], 1)
+		defer atomic.AddInt64(s.waiting[priority], -1)
+		s.deliveries[priority] <- delivery
+	})
+}
+
+// setPaused pauses the queues of queues and resumes the others.
+func (s *priorityScheduler) setPaused(queues []string) {
+	s.pauseMu.Lock()
+	defer s.pauseMu.Unlock()
+
+	for queue, resumed := range s.paused {
+		if !containsString(queues, queue) {
+			close(resumed)
+			delete(s.paused, queue)
+		}
+	}
+
+	for _, queue := range queues {
+		if _, ok := s.paused[queue]; !ok {
+			s.paused[queue] = make(chan struct{})
+		}
+	}
+}
+
+// waitResumed blocks while queue is paused, it returns false when the scheduler drains meanwhile.
+func (s *priorityScheduler) waitResumed(queue string) bool {
+	s.pauseMu.Lock()
+	resumed, paused := s.paused[queue]
+	s.pauseMu.Unlock()
+
+	if !paused {
+		return true
+	}
+
+	select {
+	case <-resumed:
+		return true
+	case <-s.draining:
+		return false
+	}
+}
+
+// drain releases the deliveries waiting in a paused queue, so the queues can stop consuming.
+func (s *priorityScheduler) drain() {
+	s.drainOnce.Do(func() {
+		close(s.draining)
+	})
+}
+
+// run passes deliveries to consumer until the scheduler is closed or stop is closed.
+func (s *priorityScheduler) run(consumer QueueConsumer, stop <-chan struct{}) {
+	for {
+		delivery, ok := s.next(stop)
+		if !ok {
+			return
+		}
+
+		consumer.Consume(delivery)
+	}
+}
+
+func (s *priorityScheduler) next(stop <-chan struct{}) (Delivery, bool) {
+	select {
+	case <-stop:
+		return nil, false
+	default:
+	}
+
+	// take the preferred priority which has a delivery waiting
+	for _, priority := range s.order() {
+		select {
+		case delivery := <-s.deliveries[priority]:
+			s.picked(priority)
+			return delivery, true
+		default:
+		}
+	}
+
+	// otherwise run whatever comes first
+	select {
+	case delivery := <-s.deliveries[JobPriorityHigh]:
+		s.picked(JobPriorityHigh)
+		return delivery, true
+	case delivery := <-s.deliveries[JobPriorityNormal]:
+		s.picked(JobPriorityNormal)
+		return delivery, true
+	case delivery := <-s.deliveries[JobPriorityLow]:
+		s.picked(JobPriorityLow)
+		return delivery, true
+	case <-s.done:
+		return nil, false
+	case <-stop:
+		return nil, false
+	}
+}
+
+// order sorts the priorities by preference for the next pick.
+func (s *priorityScheduler) order() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	order := make([]string, len(JobPriorities))
+	copy(order, JobPriorities)
+	sort.SliceStable(order, func(i, j int) bool {
+		return s.current[order[i]]+s.weights[order[i]] > s.current[order[j]]+s.weights[order[j]]
+	})
+
+	return order
+}
+
+// picked credits the priorities which have a delivery waiting and charges priority for the pick,
+// the credit of the others is reset so they do not take over the consumers once their deliveries come.
+func (s *priorityScheduler) picked(priority string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := 0
+	for p, weight := range s.weights {
+		if p != priority && atomic.LoadInt64(s.waiting[p]) == 0 {
+			s.current[p] = 0
+			continue
+		}
+
+		s.current[p] += weight
+		total += weight
+	}
+
+	s.current[priority] -= total
+}
+
+// close stops the job consumers, it must be called once the queues stopped consuming so no delivery is left behind.
+func (s *priorityScheduler) close() {
+	s.closeOnce.Do(func() {
+		close(s.done)
+	})
+}
@@ -0,0 +1,155 @@
+package jobs
+
+import (
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+type testDelivery string
+
+func (d testDelivery) Payload() string { return string(d) }
+func (d testDelivery) Ack() error      { return nil }
+func (d testDelivery) Reject() error   { return nil }
+func (d testDelivery) Push() error     { return nil }
+func (d testDelivery) Return() error   { return nil }
+
+func TestPrioritySchedulerWeights(t *testing.T) {
+	scheduler := newPriorityScheduler(map[string]int{JobPriorityHigh: 6, JobPriorityNormal: 3})
+
+	// every priority has deliveries waiting, so the preferred one is picked each time
+	for _, priority := range JobPriorities {
+		atomic.StoreInt64(scheduler.waiting[priority], 1)
+	}
+	picks := make(map[string]int)
+	var sequence []string
+	for i := 0; i < 10; i++ {
+		priority := scheduler.order()[0]
+		scheduler.picked(priority)
+		picks[priority]++
+		sequence = append(sequence, priority)
+	}
+
+	assert.Equal(t, map[string]int{JobPriorityHigh: 6, JobPriorityNormal: 3, JobPriorityLow: 1}, picks, "low priority gets the default weight of 1")
+	assert.NotEqual(t, JobPriorityHigh, sequence[1], "picks are interleaved")
+}
+
+func TestPrioritySchedulerIdlePriority(t *testing.T) {
+	scheduler := newPriorityScheduler(map[string]int{JobPriorityHigh: 6, JobPriorityNormal: 3})
+
+	// pick takes the preferred priority among those with deliveries waiting, like next does
+	pick := func(waiting ...string) string {
+		for _, priority := range JobPriorities {
+			var count int64
+			if containsString(waiting, priority) {
+				count = 1
+			}
+			atomic.StoreInt64(scheduler.waiting[priority], count)
+		}
+
+		for _, priority := range scheduler.order() {
+			if containsString(waiting, priority) {
+				scheduler.picked(priority)
+				return priority
+			}
+		}
+
+		t.Fatal("no priority has deliveries waiting")
+		return ""
+	}
+
+	// high runs alone for a while
+	for i := 0; i < 100; i++ {
+		assert.Equal(t, JobPriorityHigh, pick(JobPriorityHigh))
+	}
+
+	// then low arrives, it did not build up credit meanwhile
+	picks := make(map[string]int)
+	for i := 0; i < 7; i++ {
+		picks[pick(JobPriorityHigh, JobPriorityLow)]++
+	}
+	assert.Equal(t, map[string]int{JobPriorityHigh: 6, JobPriorityLow: 1}, picks, "high keeps its share")
+}
+
+func TestPrioritySchedulerRun(t *testing.T) {
+	scheduler := newPriorityScheduler(nil)
+
+	consumed := make(chan string, 1)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scheduler.run(QueueConsumerFunc(func(delivery Delivery) {
+			consumed <- delivery.Payload()
+		}), nil)
+	}()
+
+	scheduler.consumer("job-queue:low", JobPriorityLow).Consume(testDelivery("low"))
+	assert.Equal(t, "low", <-consumed)
+
+	scheduler.close()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the scheduler did not stop")
+	}
+}
+
+func TestPrioritySchedulerPause(t *testing.T) {
+	scheduler := newPriorityScheduler(nil)
+	defer scheduler.close()
+
+	consumed := make(chan string, 1)
+	go scheduler.run(QueueConsumerFunc(func(delivery Delivery) {
+		consumed <- delivery.Payload()
+	}), nil)
+
+	scheduler.setPaused([]string{"job-queue.report"})
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		scheduler.consumer("job-queue.report", JobPriorityNormal).Consume(testDelivery("report"))
+	}()
+
+	scheduler.consumer("job-queue", JobPriorityNormal).Consume(testDelivery("default"))
+	assert.Equal(t, "default", <-consumed, "the other queues keep running")
+
+	select {
+	case payload := <-consumed:
+		t.Fatalf("%s was consumed while paused", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	scheduler.setPaused(nil)
+	assert.Equal(t, "report", <-consumed)
+	<-forwarded
+
+	scheduler.setPaused([]string{"job-queue.report"})
+	go scheduler.consumer("job-queue.report", JobPriorityNormal).Consume(testDelivery("drained"))
+	scheduler.drain()
+	select {
+	case payload := <-consumed:
+		t.Fatalf("%s was consumed while paused", payload)
+	case <-time.After(50 * time.Millisecond):
+	}
+}
+
+func TestPrioritySchedulerStopConsumer(t *testing.T) {
+	scheduler := newPriorityScheduler(nil)
+	defer scheduler.close()
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		scheduler.run(QueueConsumerFunc(func(delivery Delivery) {}), stop)
+	}()
+
+	close(stop)
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("the consumer did not stop")
+	}
+}
@@ -0,0 +1,153 @@
+package jobs
+
+import (
+	"context"
+	"strings"
+	"sync"
+)
+
+// JobQueues opens the queue of every job type and priority on demand.
+type JobQueues struct {
+	broker Broker
+	name   string
+
+	mu     sync.Mutex
+	queues map[string]Queue
+}
+
+func NewJobQueues(broker Broker, name string) *JobQueues {
+	return &JobQueues{
+		broker: broker,
+		name:   name,
+		queues: make(map[string]Queue),
+	}
+}
+
+// Queue returns the queue of a job type and priority, jobs without a known priority go to the normal queue.
+func (q *JobQueues) Queue(jobType string, priority string) (Queue, error) {
+	if !IsValidJobPriority(priority) {
+		priority = DefaultJobPriority
+	}
+
+	name := JobQueueName(q.name, jobType, priority)
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if queue, ok := q.queues[name]; ok {
+		return queue, nil
+	}
+
+	queue, err := q.broker.OpenQueue(name)
+	if err != nil {
+		return nil, err
+	}
+
+	q.queues[name] = queue
+	return queue, nil
+}
+
+// StopConsuming stops every opened queue, the returned channel is closed once all of them stopped.
+func (q *JobQueues) StopConsuming() <-chan struct{} {
+	q.mu.Lock()
+	queues := make([]Queue, 0, len(q.queues))
+	for _, queue := range q.queues {
+		queues = append(queues, queue)
+	}
+	q.mu.Unlock()
+
+	finished := make(chan struct{})
+
+	var wg sync.WaitGroup
+	for _, queue := range queues {
+		wg.Add(1)
+		go func(queue Queue) {
+			defer wg.Done()
+			<-queue.StopConsuming()
+		}(queue)
+	}
+
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	return finished
+}
+
+// JobQueueName returns "<name>.<type>:<priority>". The default type and the normal priority are left out,
+// so the messages published before types and priorities were routed are still consumed from the queue name itself.
+func JobQueueName(name string, jobType string, priority string) string {
+	if jobType != "" && jobType != DefaultJobType {
+		name += "." + jobType
+	}
+
+	if priority != DefaultJobPriority {
+		name += ":" + priority
+	}
+
+	return name
+}
+
+// parseJobQueueName returns the job type and priority of a queue named by JobQueueName.
+func parseJobQueueName(name string, queue string) (string, string, bool) {
+	if queue != name && !strings.HasPrefix(queue, name+".") && !strings.HasPrefix(queue, name+":") {
+		return "", "", false
+	}
+
+	rest := strings.TrimPrefix(queue, name)
+	jobType, priority := DefaultJobType, DefaultJobPriority
+	if i := strings.LastIndex(rest, ":"); i >= 0 {
+		priority = rest[i+1:]
+		rest = rest[:i]
+		if !IsValidJobPriority(priority) || priority == DefaultJobPriority {
+			return "", "", false
+		}
+	}
+
+	if rest != "" {
+		jobType = strings.TrimPrefix(rest, ".")
+		if jobType == "" || jobType == DefaultJobType || !strings.HasPrefix(rest, ".") {
+			return "", "", false
+		}
+	}
+
+	return jobType, priority, true
+}
+
+// JobQueueAdmin tags the stats of the job queues with their job type and priority.
+type JobQueueAdmin struct {
+	QueueAdmin
+	name     string
+	settings SettingsStore
+}
+
+func NewJobQueueAdmin(admin QueueAdmin, name string, settings SettingsStore) *JobQueueAdmin {
+	return &JobQueueAdmin{
+		QueueAdmin: admin,
+		name:       name,
+		settings:   settings,
+	}
+}
+
+func (a *JobQueueAdmin) QueueStats(ctx context.Context) ([]QueueStats, error) {
+	stats, err := a.QueueAdmin.QueueStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	paused, err := PausedSettings(ctx, a.settings)
+	if err != nil {
+		return nil, err
+	}
+
+	for i := range stats {
+		if jobType, priority, ok := parseJobQueueName(a.name, stats[i].Name); ok {
+			stats[i].Type = jobType
+			stats[i].Priority = priority
+			stats[i].Paused = paused.IsQueuePaused(stats[i].Name, jobType)
+		}
+	}
+
+	return stats, nil
+}
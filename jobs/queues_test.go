@@ -0,0 +1,70 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJobQueueName(t *testing.T) {
+	cases := []struct {
+		jobType  string
+		priority string
+		queue    string
+	}{
+		{jobType: DefaultJobType, priority: JobPriorityNormal, queue: "job-queue"},
+		{jobType: DefaultJobType, priority: JobPriorityHigh, queue: "job-queue:high"},
+		{jobType: "report", priority: JobPriorityNormal, queue: "job-queue.report"},
+		{jobType: "report", priority: JobPriorityLow, queue: "job-queue.report:low"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.queue, func(t *testing.T) {
+			assert.Equal(t, tc.queue, JobQueueName("job-queue", tc.jobType, tc.priority))
+
+			jobType, priority, ok := parseJobQueueName("job-queue", tc.queue)
+			require.True(t, ok)
+			assert.Equal(t, tc.jobType, jobType)
+			assert.Equal(t, tc.priority, priority)
+		})
+	}
+
+	for _, queue := range []string{"other-queue", "job-queue:normal", "job-queue:urgent", "job-queue.", "job-queue-2"} {
+		_, _, ok := parseJobQueueName("job-queue", queue)
+		assert.False(t, ok, queue)
+	}
+}
+
+func TestJobQueueAdmin(t *testing.T) {
+	ctx := context.Background()
+	queueName := gofakeit.UUID()
+	queue, err := initTestQueues(queueName).Queue("report", JobPriorityLow)
+	require.NoError(t, err)
+	require.NoError(t, queue.Publish(ctx, []byte("low")))
+
+	settings := testSettings
+	_, err = settings.PutSetting(ctx, Setting{Key: SettingPausedTypes, Value: json.RawMessage(`["report"]`), UpdatedBy: "alice"})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_, _ = settings.PutSetting(ctx, Setting{Key: SettingPausedTypes, UpdatedBy: "test"})
+	})
+
+	stats, err := NewJobQueueAdmin(testBroker, queueName, settings).QueueStats(ctx)
+	require.NoError(t, err)
+
+	var actual QueueStats
+	for _, stat := range stats {
+		if stat.Name == JobQueueName(queueName, "report", JobPriorityLow) {
+			actual = stat
+		}
+	}
+
+	assert.Equal(t, "report", actual.Type)
+	assert.Equal(t, JobPriorityLow, actual.Priority)
+	assert.Equal(t, int64(1), actual.Ready)
+	assert.True(t, actual.Paused, "the queues of a paused type are paused")
+}
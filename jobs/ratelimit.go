@@ -0,0 +1,184 @@
+package jobs
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"math"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/go-redis/redis/v8"
+	"github.com/labstack/echo/v4"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+const (
+	// bearerScheme prefixes the API key in the Authorization header, as expected by apiKeyMiddleware
+	bearerScheme = "Bearer "
+
+	HeaderRateLimitLimit     = "X-RateLimit-Limit"
+	HeaderRateLimitRemaining = "X-RateLimit-Remaining"
+	HeaderRateLimitReset     = "X-RateLimit-Reset"
+)
+
+type RateLimitResult struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is the time until the oldest request of the window expires
+	ResetAfter time.Duration
+}
+
+type RateLimiter interface {
+	Allow(ctx context.Context, key string, limit config.RateLimit) (RateLimitResult, error)
+}
+
+// slidingWindowScript keeps the timestamps of the requests of the current window in a sorted set.
+// KEYS[1]: window key, ARGV: now in ms, window in ms, limit, unique member
+var slidingWindowScript = redis.NewScript(`
+local key = KEYS[1]
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+
+redis.call('ZREMRANGEBYSCORE', key, '-inf', now - window)
+local count = redis.call('ZCARD', key)
+local allowed = 0
+if count < limit then
+	redis.call('ZADD', key, now, ARGV[4])
+	redis.call('PEXPIRE', key, window)
+	count = count + 1
+	allowed = 1
+end
+
+local oldest = redis.call('ZRANGE', key, 0, 0, 'WITHSCORES')
+local resetAfter = window
+if oldest[2] then
+	resetAfter = tonumber(oldest[2]) + window - now
+end
+
+return {allowed, limit - count, resetAfter}
+`)
+
+// RedisRateLimiter is a sliding window rate limiter shared by every API instance.
+type RedisRateLimiter struct {
+	client *redis.Client
+	clock  clock.Clock
+}
+
+func NewRedisRateLimiter(client *redis.Client, clock clock.Clock) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		client: client,
+		clock:  clock,
+	}
+}
+
+func (r *RedisRateLimiter) Allow(ctx context.Context, key string, limit config.RateLimit) (RateLimitResult, error) {
+	now := r.clock.Now()
+	member := fmt.Sprintf("%d-%d", now.UnixNano(), rand.Int63())
+
+	result, err := slidingWindowScript.Run(ctx, r.client, []string{"ratelimit:" + key},
+		now.UnixNano()/int64(time.Millisecond),
+		limit.Window.Milliseconds(),
+		limit.Limit,
+		member,
+	).Result()
+	if err != nil {
+		return RateLimitResult{}, err
+	}
+
+	values, ok := result.([]interface{})
+	if !ok || len(values) != 3 {
+		return RateLimitResult{}, fmt.Errorf("unexpected rate limit script result: %v", result)
+	}
+
+	allowed, _ := values[0].(int64)
+	remaining, _ := values[1].(int64)
+	resetAfter, _ := values[2].(int64)
+
+	return RateLimitResult{
+		Allowed:    allowed == 1,
+		Limit:      limit.Limit,
+		Remaining:  int(remaining),
+		ResetAfter: time.Duration(resetAfter) * time.Millisecond,
+	}, nil
+}
+
+// RateLimitMiddleware limits the requests of a route per API key, or per IP for anonymous callers.
+// Only the keys of apiKeys identify a caller, a request with another key is limited by IP,
+// so a client cannot get a new limit by sending a new key.
+func RateLimitMiddleware(cfg config.RateLimitConfig, logger *logrus.Entry, limiter RateLimiter, apiKeys map[string]string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(ctx echo.Context) error {
+			method, path := ctx.Request().Method, ctx.Path()
+			limit := cfg.RouteRateLimit(method, path)
+			if !limit.Enabled() {
+				return next(ctx)
+			}
+
+			key := fmt.Sprintf("%s %s:%s", method, path, rateLimitIdentity(ctx, apiKeys))
+			result, err := limiter.Allow(ctx.Request().Context(), key, limit)
+			if err != nil {
+				// Do not reject requests because the limiter is unavailable
+				logger.WithError(err).Error("failed to check rate limit")
+				return next(ctx)
+			}
+
+			resetAfter := strconv.Itoa(int(math.Ceil(result.ResetAfter.Seconds())))
+			header := ctx.Response().Header()
+			header.Set(HeaderRateLimitLimit, strconv.Itoa(result.Limit))
+			header.Set(HeaderRateLimitRemaining, strconv.Itoa(result.Remaining))
+			header.Set(HeaderRateLimitReset, resetAfter)
+
+			if !result.Allowed {
+				header.Set(echo.HeaderRetryAfter, resetAfter)
+				return echo.NewHTTPError(http.StatusTooManyRequests, ErrRateLimitExceeded.Error())
+			}
+
+			return next(ctx)
+		}
+	}
+}
+
+// ipExtractor reads the IP of a caller from X-Forwarded-For only behind the trusted proxies of cfg,
+// otherwise a caller could send a new IP with every request to get a new rate limit.
+func ipExtractor(cfg config.HTTPConfig) echo.IPExtractor {
+	proxies, _ := cfg.TrustedProxies()
+	if len(proxies) == 0 {
+		return echo.ExtractIPDirect()
+	}
+
+	options := []echo.TrustOption{echo.TrustLoopback(false), echo.TrustLinkLocal(false), echo.TrustPrivateNet(false)}
+	for _, proxy := range proxies {
+		options = append(options, echo.TrustIPRange(proxy))
+	}
+
+	return echo.ExtractIPFromXFFHeader(options...)
+}
+
+// rateLimitIdentity identifies the caller by a hash of its API key, so keys are never written to Redis.
+// The key is read like apiKeyMiddleware reads it, the callers without a key of apiKeys are identified by IP.
+func rateLimitIdentity(ctx echo.Context, apiKeys map[string]string) string {
+	apiKey := ctx.Request().Header.Get("X-API-Key")
+	if apiKey == "" {
+		authorization := ctx.Request().Header.Get(echo.HeaderAuthorization)
+		if len(authorization) > len(bearerScheme) && strings.EqualFold(authorization[:len(bearerScheme)], bearerScheme) {
+			apiKey = authorization[len(bearerScheme):]
+		}
+	}
+
+	if _, ok := apiKeys[apiKey]; !ok {
+		return "ip:" + ctx.RealIP()
+	}
+
+	sum := sha1.Sum([]byte(apiKey))
+	return "key:" + hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,138 @@
+package jobs
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/labstack/echo/v4"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+func TestRedisRateLimiterAllow(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	clock := initTestClock()
+	clock.Set(time.Now())
+	limiter := NewRedisRateLimiter(testRedisClient, clock)
+	limit := config.RateLimit{Limit: 2, Window: 10 * time.Second}
+	key := gofakeit.UUID()
+
+	result, err := limiter.Allow(ctx, key, limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 1, result.Remaining)
+
+	clock.Add(4 * time.Second)
+	result, err = limiter.Allow(ctx, key, limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+
+	result, err = limiter.Allow(ctx, key, limit)
+	require.NoError(t, err)
+	assert.False(t, result.Allowed)
+	// the first request leaves the window in 6 seconds
+	assert.Equal(t, 6*time.Second, result.ResetAfter)
+
+	// window slides past the first request
+	clock.Add(7 * time.Second)
+	result, err = limiter.Allow(ctx, key, limit)
+	require.NoError(t, err)
+	assert.True(t, result.Allowed)
+	assert.Equal(t, 0, result.Remaining)
+}
+
+// testRateLimiter counts the requests of each key without window, enough for the middleware tests
+type testRateLimiter struct {
+	mu       sync.Mutex
+	requests map[string]int
+}
+
+func newTestRateLimiter() *testRateLimiter {
+	return &testRateLimiter{requests: map[string]int{}}
+}
+
+func (r *testRateLimiter) Allow(_ context.Context, key string, limit config.RateLimit) (RateLimitResult, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	result := RateLimitResult{Limit: limit.Limit, ResetAfter: limit.Window}
+	if r.requests[key] >= limit.Limit {
+		return result, nil
+	}
+
+	r.requests[key]++
+	result.Allowed = true
+	result.Remaining = limit.Limit - r.requests[key]
+	return result, nil
+}
+
+func TestRateLimitMiddlewareIdentity(t *testing.T) {
+	apiKey := gofakeit.UUID()
+	cfg := config.RateLimitConfig{
+		RateLimitRoutes: config.RateLimitRoutes{
+			"GET /limited": {Limit: 2, Window: time.Minute},
+		},
+	}
+	routes := echo.New()
+	routes.Use(RateLimitMiddleware(cfg, testLogger, newTestRateLimiter(), map[string]string{apiKey: "team-a"}))
+	routes.GET("/limited", func(ctx echo.Context) error {
+		return ctx.NoContent(http.StatusNoContent)
+	})
+
+	get := func(ip string, headers map[string]string) int {
+		req := httptest.NewRequest(http.MethodGet, "/limited", nil)
+		req.RemoteAddr = ip + ":1234"
+		for name, value := range headers {
+			req.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		routes.ServeHTTP(rec, req)
+		return rec.Code
+	}
+
+	t.Run("rotating unknown keys hit the limit of the IP", func(t *testing.T) {
+		ip := gofakeit.IPv4Address()
+		assert.Equal(t, http.StatusNoContent, get(ip, map[string]string{"X-API-Key": gofakeit.UUID()}))
+		assert.Equal(t, http.StatusNoContent, get(ip, map[string]string{echo.HeaderAuthorization: "Bearer " + gofakeit.UUID()}))
+		assert.Equal(t, http.StatusTooManyRequests, get(ip, map[string]string{"X-API-Key": gofakeit.UUID()}))
+		assert.Equal(t, http.StatusTooManyRequests, get(ip, nil))
+
+		// another IP has its own limit
+		assert.Equal(t, http.StatusNoContent, get(gofakeit.IPv4Address(), map[string]string{"X-API-Key": gofakeit.UUID()}))
+	})
+
+	t.Run("a configured key has its own limit on every IP", func(t *testing.T) {
+		assert.Equal(t, http.StatusNoContent, get(gofakeit.IPv4Address(), map[string]string{"X-API-Key": apiKey}))
+		assert.Equal(t, http.StatusNoContent, get(gofakeit.IPv4Address(), map[string]string{echo.HeaderAuthorization: "bearer " + apiKey}))
+		assert.Equal(t, http.StatusTooManyRequests, get(gofakeit.IPv4Address(), map[string]string{"X-API-Key": apiKey}))
+	})
+}
+
+func TestIPExtractor(t *testing.T) {
+	realIP := func(cfg config.HTTPConfig, remoteAddr string, forwardedFor string) string {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req.RemoteAddr = remoteAddr + ":1234"
+		req.Header.Set(echo.HeaderXForwardedFor, forwardedFor)
+		req.Header.Set(echo.HeaderXRealIP, forwardedFor)
+		return ipExtractor(cfg)(req)
+	}
+
+	t.Run("without trusted proxies", func(t *testing.T) {
+		assert.Equal(t, "10.0.0.1", realIP(config.HTTPConfig{}, "10.0.0.1", "203.0.113.7"), "a private address is not trusted either")
+	})
+
+	t.Run("behind a trusted proxy", func(t *testing.T) {
+		cfg := config.HTTPConfig{HTTPTrustedProxies: []string{"10.0.0.0/8"}}
+		assert.Equal(t, "203.0.113.7", realIP(cfg, "10.0.0.1", "203.0.113.7"))
+		assert.Equal(t, "192.168.0.1", realIP(cfg, "192.168.0.1", "203.0.113.7"), "only the configured proxies are trusted")
+	})
+}
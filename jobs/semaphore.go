@@ -0,0 +1,187 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/go-redis/redis/v8"
+)
+
+// Semaphore limits how many jobs sharing a key may run at the same time.
+type Semaphore interface {
+	// TryAcquire takes a slot of key without blocking. When acquired is true the caller must call release once done.
+	TryAcquire(ctx context.Context, key string, limit int) (release func(), acquired bool, err error)
+}
+
+// LocalSemaphore is a Semaphore shared by the consumers of a single worker process.
+type LocalSemaphore struct {
+	mu    sync.Mutex
+	slots map[string]int
+}
+
+func NewLocalSemaphore() *LocalSemaphore {
+	return &LocalSemaphore{
+		slots: make(map[string]int),
+	}
+}
+
+func (s *LocalSemaphore) TryAcquire(ctx context.Context, key string, limit int) (func(), bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.slots[key] >= limit {
+		return nil, false, nil
+	}
+
+	s.slots[key]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			s.mu.Lock()
+			defer s.mu.Unlock()
+
+			s.slots[key]--
+			if s.slots[key] <= 0 {
+				delete(s.slots, key)
+			}
+		})
+	}, true, nil
+}
+
+// acquireScript stores the holders of a semaphore in a sorted set scored by the expiry of their lease.
+// KEYS[1]: semaphore key, ARGV: now in ms, limit, lease expiry in ms, lease ttl in ms, holder token
+var acquireScript = redis.NewScript(`
+local key = KEYS[1]
+redis.call('ZREMRANGEBYSCORE', key, '-inf', ARGV[1])
+if redis.call('ZCARD', key) >= tonumber(ARGV[2]) then
+	return 0
+end
+
+redis.call('ZADD', key, ARGV[3], ARGV[5])
+redis.call('PEXPIRE', key, ARGV[4])
+return 1
+`)
+
+// renewScript extends the lease of a holder, it returns 0 when the holder lost its slot.
+// KEYS[1]: semaphore key, ARGV: lease expiry in ms, lease ttl in ms, holder token
+var renewScript = redis.NewScript(`
+local key = KEYS[1]
+if not redis.call('ZSCORE', key, ARGV[3]) then
+	return 0
+end
+
+redis.call('ZADD', key, 'XX', ARGV[1], ARGV[3])
+redis.call('PEXPIRE', key, ARGV[2])
+return 1
+`)
+
+// RedisSemaphore is a Semaphore shared by the whole worker fleet.
+// Slots are leased and renewed until they are released or ctx is done, so the slots of a crashed worker
+// are freed once their lease expires while a job may run longer than the lease.
+type RedisSemaphore struct {
+	client *redis.Client
+	clock  clock.Clock
+	lease  time.Duration
+}
+
+func NewRedisSemaphore(client *redis.Client, clock clock.Clock, lease time.Duration) *RedisSemaphore {
+	return &RedisSemaphore{
+		client: client,
+		clock:  clock,
+		lease:  lease,
+	}
+}
+
+func (s *RedisSemaphore) TryAcquire(ctx context.Context, key string, limit int) (func(), bool, error) {
+	key = "semaphore:" + key
+	now := s.clock.Now()
+	token := fmt.Sprintf("%d-%d", now.UnixNano(), rand.Int63())
+
+	acquired, err := acquireScript.Run(ctx, s.client, []string{key},
+		toMillis(now),
+		limit,
+		toMillis(now.Add(s.lease)),
+		s.lease.Milliseconds(),
+		token,
+	).Int()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if acquired == 0 {
+		return nil, false, nil
+	}
+
+	released := make(chan struct{})
+	go s.renew(ctx, key, token, s.clock.Ticker(s.lease/3), released)
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			close(released)
+			// the slot must be freed even if the job context was cancelled
+			s.client.ZRem(context.Background(), key, token)
+		})
+	}, true, nil
+}
+
+// renew extends the lease of token a few times per lease until the slot is released or ctx is done.
+func (s *RedisSemaphore) renew(ctx context.Context, key string, token string, ticker *clock.Ticker, released <-chan struct{}) {
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-released:
+			return
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			// the ticks and the release or the end of ctx may be ready at once
+			if ctx.Err() != nil || isClosed(released) {
+				return
+			}
+
+			now := s.clock.Now()
+			renewed, err := renewScript.Run(ctx, s.client, []string{key},
+				toMillis(now.Add(s.lease)),
+				s.lease.Milliseconds(),
+				token,
+			).Int()
+			// a failed renewal is tried again on the next tick, the lease outlasts a few of them
+			if err == nil && renewed == 0 {
+				return
+			}
+		}
+	}
+}
+
+func isClosed(ch <-chan struct{}) bool {
+	select {
+	case <-ch:
+		return true
+	default:
+		return false
+	}
+}
+
+func toMillis(t time.Time) string {
+	return strconv.FormatInt(t.UnixNano()/int64(time.Millisecond), 10)
+}
+
+func tenantSemaphoreKey(tenantId string) string {
+	return "tenant:" + tenantId
+}
+
+func typeSemaphoreKey(jobType string) string {
+	return "type:" + jobType
+}
+
+func objectSemaphoreKey(tenantId string, objectId int) string {
+	return fmt.Sprintf("object:%s:%d", tenantId, objectId)
+}
@@ -0,0 +1,111 @@
+package jobs
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalSemaphore(t *testing.T) {
+	ctx := context.Background()
+	semaphore := NewLocalSemaphore()
+
+	release1, acquired, err := semaphore.TryAcquire(ctx, "key", 2)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	release2, acquired, err := semaphore.TryAcquire(ctx, "key", 2)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	_, acquired, err = semaphore.TryAcquire(ctx, "key", 2)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	// other keys have their own slots
+	_, acquired, err = semaphore.TryAcquire(ctx, "other-key", 1)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	release1()
+	// releasing twice must not free another slot
+	release1()
+
+	release3, acquired, err := semaphore.TryAcquire(ctx, "key", 2)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	_, acquired, err = semaphore.TryAcquire(ctx, "key", 2)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	release2()
+	release3()
+}
+
+func TestRedisSemaphore(t *testing.T) {
+	requireDocker(t)
+	ctx := context.Background()
+	clock := initTestClock()
+	clock.Set(time.Now())
+	semaphore := NewRedisSemaphore(testRedisClient, clock, time.Minute)
+	key := gofakeit.UUID()
+
+	release, acquired, err := semaphore.TryAcquire(ctx, key, 1)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+
+	_, acquired, err = semaphore.TryAcquire(ctx, key, 1)
+	require.NoError(t, err)
+	assert.False(t, acquired)
+
+	release()
+
+	release, acquired, err = semaphore.TryAcquire(ctx, key, 1)
+	require.NoError(t, err)
+	assert.True(t, acquired)
+	release()
+
+	t.Run("slot of a dead holder is freed after its lease", func(t *testing.T) {
+		// a holder stops renewing its slot once its context is done, like a dead worker
+		dead, cancel := context.WithCancel(ctx)
+		key := gofakeit.UUID()
+		_, acquired, err := semaphore.TryAcquire(dead, key, 1)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		cancel()
+
+		_, acquired, err = semaphore.TryAcquire(ctx, key, 1)
+		require.NoError(t, err)
+		assert.False(t, acquired)
+
+		clock.Add(time.Minute + time.Second)
+		_, acquired, err = semaphore.TryAcquire(ctx, key, 1)
+		require.NoError(t, err)
+		assert.True(t, acquired)
+	})
+
+	t.Run("slot of a running holder is renewed past its lease", func(t *testing.T) {
+		key := gofakeit.UUID()
+		release, acquired, err := semaphore.TryAcquire(ctx, key, 1)
+		require.NoError(t, err)
+		require.True(t, acquired)
+		defer release()
+
+		renewedAt := clock.Now().Add(20 * time.Second)
+		clock.Add(20 * time.Second)
+		assert.Eventually(t, func() bool {
+			scores, err := testRedisClient.ZRangeWithScores(ctx, "semaphore:"+key, 0, 0).Result()
+			return err == nil && len(scores) == 1 && int64(scores[0].Score) == renewedAt.Add(time.Minute).UnixNano()/int64(time.Millisecond)
+		}, time.Second, 10*time.Millisecond)
+
+		clock.Add(time.Minute - time.Second)
+		_, acquired, err = semaphore.TryAcquire(ctx, key, 1)
+		require.NoError(t, err)
+		assert.False(t, acquired, "the first lease expired, the renewed one did not")
+	})
+}
@@ -7,43 +7,62 @@ import (
 
 	"github.com/benbjohnson/clock"
 
-	"github.com/adjust/rmq/v5"
-
 	"github.com/tuyentv96/hasty-challenge/utils"
 )
 
 const TimeWindowInMinutes = 5
 
 type Service interface {
-	SaveJob(ctx context.Context, payload JobPayload) (Job, error)
-	ClaimJob(ctx context.Context, job Job) error
-	GetJobByID(ctx context.Context, jobId int) (Job, error)
-	PublishJob(ctx context.Context, job Job) error
-	SetJobFailed(ctx context.Context, job Job, message string) (Job, error)
+	SaveJob(ctx context.Context, tenantId string, payload JobPayload) (Job, error)
+	ClaimJob(ctx context.Context, job Job) (Job, error)
+	GetJobByID(ctx context.Context, tenantId string, jobId int) (Job, error)
+	PublishJob(ctx context.Context, job Job) (Job, error)
+	SetJobFailed(ctx context.Context, job Job, cause error) (Job, error)
 	SetJobSuccess(ctx context.Context, job Job) (Job, error)
+	SetJobPanicked(ctx context.Context, job Job, panicErr *PanicError) (Job, error)
+	SetJobLost(ctx context.Context, job Job) (Job, error)
+	ListJobs(ctx context.Context, filter JobFilter) ([]Job, error)
+	RetryJob(ctx context.Context, tenantId string, jobId int) (Job, error)
+	CancelJob(ctx context.Context, tenantId string, jobId int) (Job, error)
+	RequeueJob(ctx context.Context, tenantId string, jobId int) (Job, error)
 }
 
 type ServiceImpl struct {
-	store Store
-	queue rmq.Queue
-	clock clock.Clock
+	store  Store
+	queues *JobQueues
+	clock  clock.Clock
 }
 
-func NewService(store Store, queue rmq.Queue, clock clock.Clock) *ServiceImpl {
+func NewService(store Store, queues *JobQueues, clock clock.Clock) *ServiceImpl {
 	return &ServiceImpl{
-		store: store,
-		queue: queue,
-		clock: clock,
+		store:  store,
+		queues: queues,
+		clock:  utils.UTCClock(clock),
 	}
 }
 
-func (s *ServiceImpl) SaveJob(ctx context.Context, payload JobPayload) (Job, error) {
+func (s *ServiceImpl) SaveJob(ctx context.Context, tenantId string, payload JobPayload) (Job, error) {
 	job := Job{
+		TenantId: tenantId,
 		ObjectId: payload.ObjectId,
+		Type:     payload.Type,
+		Priority: payload.Priority,
+	}
+
+	if job.Type == "" {
+		job.Type = DefaultJobType
+	}
+
+	if job.Priority == "" {
+		job.Priority = DefaultJobPriority
+	}
+
+	if !IsValidJobPriority(job.Priority) {
+		return Job{}, ErrInvalidPriority
 	}
 
 	timeWindow := s.clock.Now().Add(-time.Duration(TimeWindowInMinutes) * time.Minute)
-	existJob, err := s.store.GetJobByObjectId(ctx, job.ObjectId, timeWindow)
+	existJob, err := s.store.GetJobByObjectId(ctx, job.TenantId, job.ObjectId, timeWindow)
 	if err != nil && !errors.Is(err, ErrJobNotFound) {
 		return Job{}, err
 	}
@@ -52,68 +71,181 @@ func (s *ServiceImpl) SaveJob(ctx context.Context, payload JobPayload) (Job, err
 		return existJob, nil
 	}
 
-	job.CreatedAt = s.clock.Now().UTC()
+	job.CreatedAt = s.clock.Now()
 	job.Status = JobStatusCreated
 	job, err = s.store.SaveJob(ctx, job)
 	if err != nil {
-		return Job{}, nil
-	}
-
-	if err := s.PublishJob(ctx, job); err != nil {
 		return Job{}, err
 	}
 
-	return job, nil
+	return s.PublishJob(ctx, job)
 }
 
-func (s *ServiceImpl) GetJobByID(ctx context.Context, jobId int) (Job, error) {
-	return s.store.GetJobByID(ctx, jobId)
+func (s *ServiceImpl) GetJobByID(ctx context.Context, tenantId string, jobId int) (Job, error) {
+	return s.store.GetJobByID(ctx, tenantId, jobId)
 }
 
-func (s *ServiceImpl) ClaimJob(ctx context.Context, job Job) error {
-	job.Status = JobStatusRunning
+// ClaimJob starts an attempt of a job waiting in the queue and returns the claimed job,
+// the consumer sets the worker and the hostname of the job beforehand.
+func (s *ServiceImpl) ClaimJob(ctx context.Context, job Job) (Job, error) {
 	job.StartTime = utils.TimeToPtr(s.clock.Now())
+	job.Attempts++
+
+	job, err := s.transition(ctx, job, JobStatusRunning)
+	if errors.Is(err, ErrInvalidJobStatus) {
+		return Job{}, ErrJobWasClaimed
+	}
+
+	return job, err
+}
 
-	if err := s.store.UpdateJobOptimistically(ctx, job, JobStatusCreated); err != nil {
+// transition changes the status of job to status and saves its other fields, it enforces jobTransitions.
+// The update is optimistic, it returns ErrInvalidJobStatus as well when the job changed its status meanwhile.
+func (s *ServiceImpl) transition(ctx context.Context, job Job, status JobStatus) (Job, error) {
+	current := job.Status
+	if !current.CanTransition(status) {
+		return Job{}, ErrInvalidJobStatus
+	}
+
+	job.Status = status
+	if err := s.store.UpdateJobOptimistically(ctx, job, current); err != nil {
 		if errors.Is(err, ErrNoRowUpdated) {
-			return ErrJobWasClaimed
+			return Job{}, ErrInvalidJobStatus
 		}
 
-		return err
+		return Job{}, err
 	}
 
-	return nil
+	return job, nil
 }
 
-func (s *ServiceImpl) PublishJob(ctx context.Context, job Job) error {
-	return s.queue.PublishBytes(job.ToJSON())
+// finish ends the run of a claimed job with status.
+func (s *ServiceImpl) finish(ctx context.Context, job Job, status JobStatus) (Job, error) {
+	if job.Status != JobStatusRunning {
+		return Job{}, ErrJobWasNotClaimed
+	}
+
+	job.EndTime = utils.TimeToPtr(s.clock.Now())
+	job, err := s.transition(ctx, job, status)
+	if errors.Is(err, ErrInvalidJobStatus) {
+		return Job{}, ErrJobWasNotClaimed
+	}
+
+	return job, err
 }
 
+// PublishJob records the time in published_at and publishes a JobMessage of job to its queue, a created job is queued.
+// It returns ErrInvalidJobStatus when the job changed its status meanwhile, e.g. it was cancelled.
+func (s *ServiceImpl) PublishJob(ctx context.Context, job Job) (Job, error) {
+	queue, err := s.queues.Queue(job.Type, job.Priority)
+	if err != nil {
+		return Job{}, err
+	}
+
+	job.PublishedAt = utils.TimeToPtr(s.clock.Now())
+	if job.Status == JobStatusCreated {
+		job, err = s.transition(ctx, job, JobStatusQueued)
+	} else if err = s.store.UpdateJobOptimistically(ctx, job, job.Status); errors.Is(err, ErrNoRowUpdated) {
+		err = ErrInvalidJobStatus
+	}
+
+	if err != nil {
+		return Job{}, err
+	}
+
+	if err := queue.Publish(ctx, NewJobMessage(ctx, job).ToJSON()); err != nil {
+		return Job{}, err
+	}
+
+	return job, nil
+}
+
+// SetJobSuccess ends a running job successfully, the error of an attempt whose worker was lost is cleared.
 func (s *ServiceImpl) SetJobSuccess(ctx context.Context, job Job) (Job, error) {
-	job.Status = JobStatusSuccess
+	job.Error = nil
+	return s.finish(ctx, job, JobStatusSuccess)
+}
+
+// SetJobFailed fails a running job, cause is classified by NewJobError.
+// A job which exceeded its timeout is timed_out rather than failed.
+func (s *ServiceImpl) SetJobFailed(ctx context.Context, job Job, cause error) (Job, error) {
+	status := JobStatusFailed
+	if errors.Is(cause, ErrJobExceedTimeout) {
+		status = JobStatusTimedOut
+	}
+
+	job.Error = NewJobError(cause, job.Attempts)
+	return s.finish(ctx, job, status)
+}
+
+// SetJobPanicked fails a job whose run panicked with the stack trace in the error details.
+// The transaction of the run was rolled back, a job which panicked before its claim still has the status of its delivery
+// and the attempt is counted here.
+func (s *ServiceImpl) SetJobPanicked(ctx context.Context, job Job, panicErr *PanicError) (Job, error) {
+	if job.Status != JobStatusRunning {
+		job.StartTime = nil
+		job.Attempts++
+	}
+
 	job.EndTime = utils.TimeToPtr(s.clock.Now())
-	if err := s.store.UpdateJobOptimistically(ctx, job, JobStatusRunning); err != nil {
-		if errors.Is(err, ErrNoRowUpdated) {
-			return Job{}, ErrJobWasNotClaimed
-		}
+	job.Error = NewJobError(panicErr, job.Attempts)
+	return s.transition(ctx, job, JobStatusFailed)
+}
+
+// SetJobLost makes a running job whose worker was lost retrying, its error records the lost attempt.
+// The job runs again once a worker claims it.
+func (s *ServiceImpl) SetJobLost(ctx context.Context, job Job) (Job, error) {
+	job.Error = NewJobError(Transient(ErrWorkerLost), job.Attempts)
+	return s.transition(ctx, job, JobStatusRetrying)
+}
+
+func (s *ServiceImpl) ListJobs(ctx context.Context, filter JobFilter) ([]Job, error) {
+	return s.store.ListJobs(ctx, filter)
+}
 
+// RetryJob queues a failed or timed out job again and publishes it.
+func (s *ServiceImpl) RetryJob(ctx context.Context, tenantId string, jobId int) (Job, error) {
+	job, err := s.store.GetJobByID(ctx, tenantId, jobId)
+	if err != nil {
 		return Job{}, err
 	}
 
-	return job, nil
+	job.StartTime = nil
+	job.EndTime = nil
+	job.WorkerId = ""
+	job.Hostname = ""
+	job.Error = nil
+	job, err = s.transition(ctx, job, JobStatusQueued)
+	if err != nil {
+		return Job{}, err
+	}
+
+	return s.PublishJob(ctx, job)
 }
 
-func (s *ServiceImpl) SetJobFailed(ctx context.Context, job Job, message string) (Job, error) {
-	job.Status = JobStatusFailed
+// CancelJob cancels a job which was not claimed yet, workers skip cancelled jobs.
+func (s *ServiceImpl) CancelJob(ctx context.Context, tenantId string, jobId int) (Job, error) {
+	job, err := s.store.GetJobByID(ctx, tenantId, jobId)
+	if err != nil {
+		return Job{}, err
+	}
+
 	job.EndTime = utils.TimeToPtr(s.clock.Now())
-	job.Message = message
-	if err := s.store.UpdateJobOptimistically(ctx, job, JobStatusRunning); err != nil {
-		if errors.Is(err, ErrNoRowUpdated) {
-			return Job{}, ErrJobWasNotClaimed
-		}
+	job.Error = NewJobError(ErrJobCancelled, job.Attempts)
+	return s.transition(ctx, job, JobStatusCancelled)
+}
 
+// RequeueJob publishes a created or queued job again, e.g. when its message was purged from the queue
+// or the job was saved but could not be published.
+func (s *ServiceImpl) RequeueJob(ctx context.Context, tenantId string, jobId int) (Job, error) {
+	job, err := s.store.GetJobByID(ctx, tenantId, jobId)
+	if err != nil {
 		return Job{}, err
 	}
 
-	return job, nil
+	if job.Status != JobStatusCreated && job.Status != JobStatusQueued {
+		return Job{}, ErrInvalidJobStatus
+	}
+
+	return s.PublishJob(ctx, job)
 }
@@ -2,10 +2,10 @@ package jobs
 
 import (
 	"context"
+	"errors"
 	"testing"
 	"time"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/benbjohnson/clock"
 	"github.com/brianvoe/gofakeit/v6"
 	"github.com/stretchr/testify/assert"
@@ -18,19 +18,21 @@ func initTestClock() *clock.Mock {
 	return clock.NewMock()
 }
 
-func initTestQueue(t *testing.T, queueName string) rmq.Queue {
-	queue, err := testRmqConnection.OpenQueue(queueName)
+func initTestQueue(t *testing.T, queueName string) Queue {
+	queue, err := testBroker.OpenQueue(queueName)
 	require.NoError(t, err)
 	return queue
 }
 
-func initTestService(t *testing.T, queueName string, clock clock.Clock) *ServiceImpl {
-	queue := initTestQueue(t, queueName)
+func initTestQueues(queueName string) *JobQueues {
+	return NewJobQueues(testBroker, queueName)
+}
 
+func initTestService(t *testing.T, queueName string, clock clock.Clock) *ServiceImpl {
 	return &ServiceImpl{
-		store: testStore,
-		queue: queue,
-		clock: clock,
+		store:  testStore,
+		queues: initTestQueues(queueName),
+		clock:  utils.UTCClock(clock),
 	}
 }
 
@@ -45,11 +47,11 @@ func TestServiceSaveJob(t *testing.T) {
 		clock.Set(now)
 
 		payload := JobPayload{ObjectId: newTestObjectId()}
-		actual, err := svc.SaveJob(ctx, payload)
+		actual, err := svc.SaveJob(ctx, DefaultTenantId, payload)
 		require.NoError(t, err)
 		assert.NotZero(t, actual.Id)
 		assert.Equal(t, payload.ObjectId, actual.ObjectId)
-		assert.Equal(t, JobStatusCreated, actual.Status)
+		assert.Equal(t, JobStatusQueued, actual.Status)
 	})
 
 	t.Run("save same object_id in five minutes, return same job", func(t *testing.T) {
@@ -61,11 +63,11 @@ func TestServiceSaveJob(t *testing.T) {
 		payload := JobPayload{ObjectId: objectId}
 
 		clock.Set(now.Add(-2 * time.Minute))
-		job, err := svc.SaveJob(ctx, payload)
+		job, err := svc.SaveJob(ctx, DefaultTenantId, payload)
 		require.NoError(t, err)
 
 		clock.Set(now)
-		actual, err := svc.SaveJob(ctx, payload)
+		actual, err := svc.SaveJob(ctx, DefaultTenantId, payload)
 		require.NoError(t, err)
 		assert.Equal(t, job.Id, actual.Id)
 		assert.Equal(t, job.ObjectId, actual.ObjectId)
@@ -80,16 +82,71 @@ func TestServiceSaveJob(t *testing.T) {
 		payload := JobPayload{ObjectId: newTestObjectId()}
 
 		clock.Set(now.Add(-60 * time.Minute))
-		job1, err := svc.SaveJob(ctx, payload)
+		job1, err := svc.SaveJob(ctx, DefaultTenantId, payload)
 		require.NoError(t, err)
 
 		clock.Set(now)
-		actual, err := svc.SaveJob(ctx, payload)
+		actual, err := svc.SaveJob(ctx, DefaultTenantId, payload)
 		require.NoError(t, err)
 		assert.NotEqual(t, job1.Id, actual.Id)
 		assert.Equal(t, payload.ObjectId, actual.ObjectId)
-		assert.Equal(t, JobStatusCreated, actual.Status)
+		assert.Equal(t, JobStatusQueued, actual.Status)
+	})
+
+	t.Run("publish to the queue of the priority", func(t *testing.T) {
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, initTestClock())
+
+		actual, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId(), Priority: JobPriorityHigh})
+		require.NoError(t, err)
+		assert.Equal(t, JobPriorityHigh, actual.Priority)
+
+		actual, err = svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+		assert.Equal(t, JobPriorityNormal, actual.Priority)
+
+		assert.Equal(t, int64(1), findQueueStats(t, testBroker, JobQueueName(queueName, DefaultJobType, JobPriorityHigh)).Ready)
+		assert.Equal(t, int64(1), findQueueStats(t, testBroker, queueName).Ready)
+	})
+
+	t.Run("publish to the queue of the type", func(t *testing.T) {
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, initTestClock())
+
+		_, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId(), Type: "report", Priority: JobPriorityLow})
+		require.NoError(t, err)
+
+		assert.Equal(t, int64(1), findQueueStats(t, testBroker, JobQueueName(queueName, "report", JobPriorityLow)).Ready)
+		assert.Equal(t, int64(0), findQueueStats(t, testBroker, JobQueueName(queueName, DefaultJobType, JobPriorityLow)).Ready)
+	})
+
+	t.Run("invalid priority", func(t *testing.T) {
+		svc := initTestService(t, gofakeit.UUID(), initTestClock())
+
+		_, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId(), Priority: "urgent"})
+		assert.Equal(t, ErrInvalidPriority, err)
 	})
+
+	t.Run("store error", func(t *testing.T) {
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, initTestClock())
+		storeErr := errors.New("insert failed")
+		svc.store = failingSaveStore{Store: testStore, err: storeErr}
+
+		_, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		assert.ErrorIs(t, err, storeErr)
+		assert.Equal(t, int64(0), findQueueStats(t, testBroker, JobQueueName(queueName, DefaultJobType, DefaultJobPriority)).Ready)
+	})
+}
+
+// failingSaveStore fails to insert jobs, e.g. on a violated constraint
+type failingSaveStore struct {
+	Store
+	err error
+}
+
+func (s failingSaveStore) SaveJob(ctx context.Context, job Job) (Job, error) {
+	return Job{}, s.err
 }
 
 func TestServiceGetJob(t *testing.T) {
@@ -99,7 +156,7 @@ func TestServiceGetJob(t *testing.T) {
 	queueName := gofakeit.UUID()
 	svc := initTestService(t, queueName, clock)
 
-	job, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 	require.NoError(t, err)
 
 	cases := []struct {
@@ -121,7 +178,7 @@ func TestServiceGetJob(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			actual, err := svc.GetJobByID(ctx, tc.id)
+			actual, err := svc.GetJobByID(ctx, DefaultTenantId, tc.id)
 			assert.Equal(t, tc.err, err)
 			if tc.err == nil {
 				assert.Equal(t, tc.id, actual.Id)
@@ -140,15 +197,17 @@ func TestServiceClaimJob(t *testing.T) {
 		svc := initTestService(t, queueName, clock)
 
 		clock.Set(now)
-		job1, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job1, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
-		err = svc.ClaimJob(ctx, job1)
+		claimed, err := svc.ClaimJob(ctx, job1)
 		require.NoError(t, err)
+		assert.Equal(t, 1, claimed.Attempts)
 
-		actual, err := svc.GetJobByID(ctx, job1.Id)
+		actual, err := svc.GetJobByID(ctx, DefaultTenantId, job1.Id)
 		require.NoError(t, err)
 		assert.Equal(t, JobStatusRunning, actual.Status)
+		assert.Equal(t, 1, actual.Attempts)
 		assert.Equal(t, now.Second(), actual.StartTime.Second())
 	})
 
@@ -157,18 +216,49 @@ func TestServiceClaimJob(t *testing.T) {
 		queueName := gofakeit.UUID()
 		svc := initTestService(t, queueName, clock)
 
-		job1, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job1, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
-		err = svc.ClaimJob(ctx, job1)
+		_, err = svc.ClaimJob(ctx, job1)
 		require.NoError(t, err)
 
 		// Try to claim job again
-		err = svc.ClaimJob(ctx, job1)
+		_, err = svc.ClaimJob(ctx, job1)
 		require.Equal(t, ErrJobWasClaimed, err)
 	})
 }
 
+func TestServiceJobTimesInUTC(t *testing.T) {
+	ctx := context.Background()
+	clock := initTestClock()
+	svc := initTestService(t, gofakeit.UUID(), clock)
+
+	// the clock of a host in the time zone of the tests, see TestMain
+	now := utils.TimeNow().Truncate(time.Millisecond).In(time.Local)
+	clock.Set(now)
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+	require.NoError(t, err)
+
+	job, err = svc.ClaimJob(ctx, job)
+	require.NoError(t, err)
+
+	clock.Add(90 * time.Second)
+	_, err = svc.SetJobSuccess(ctx, job)
+	require.NoError(t, err)
+
+	actual, err := svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+	require.NoError(t, err)
+	require.NotNil(t, actual.StartTime)
+	require.NotNil(t, actual.EndTime)
+	for _, tm := range []time.Time{actual.CreatedAt, *actual.StartTime, *actual.EndTime} {
+		assert.Equal(t, time.UTC, tm.Location())
+	}
+
+	assert.True(t, now.Equal(actual.CreatedAt))
+	assert.True(t, now.Equal(*actual.StartTime))
+	assert.Equal(t, 90*time.Second, actual.EndTime.Sub(*actual.StartTime))
+}
+
 func TestServiceSetJobSuccess(t *testing.T) {
 	ctx := context.Background()
 	now := utils.TimeNow()
@@ -179,19 +269,19 @@ func TestServiceSetJobSuccess(t *testing.T) {
 		svc := initTestService(t, queueName, clock)
 
 		clock.Set(now)
-		job1, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job1, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
-		err = svc.ClaimJob(ctx, job1)
+		_, err = svc.ClaimJob(ctx, job1)
 		require.NoError(t, err)
 
-		job1, err = svc.GetJobByID(ctx, job1.Id)
+		job1, err = svc.GetJobByID(ctx, DefaultTenantId, job1.Id)
 		require.NoError(t, err)
 
 		job1, err = svc.SetJobSuccess(ctx, job1)
 		require.NoError(t, err)
 
-		actual, err := svc.GetJobByID(ctx, job1.Id)
+		actual, err := svc.GetJobByID(ctx, DefaultTenantId, job1.Id)
 		require.NoError(t, err)
 		assert.Equal(t, JobStatusSuccess, actual.Status)
 		assert.Equal(t, now.Second(), actual.EndTime.Second())
@@ -202,7 +292,7 @@ func TestServiceSetJobSuccess(t *testing.T) {
 		queueName := gofakeit.UUID()
 		svc := initTestService(t, queueName, clock)
 
-		job1, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job1, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
 		job1, err = svc.SetJobSuccess(ctx, job1)
@@ -220,23 +310,23 @@ func TestServiceSetJobFailed(t *testing.T) {
 		svc := initTestService(t, queueName, clock)
 		clock.Set(now)
 
-		job1, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job1, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
-		err = svc.ClaimJob(ctx, job1)
+		_, err = svc.ClaimJob(ctx, job1)
 		require.NoError(t, err)
 
-		job1, err = svc.GetJobByID(ctx, job1.Id)
+		job1, err = svc.GetJobByID(ctx, DefaultTenantId, job1.Id)
 		require.NoError(t, err)
 
 		msg := "test message"
-		job1, err = svc.SetJobFailed(ctx, job1, msg)
+		job1, err = svc.SetJobFailed(ctx, job1, Transient(errors.New(msg)))
 		require.NoError(t, err)
 
-		actual, err := svc.GetJobByID(ctx, job1.Id)
+		actual, err := svc.GetJobByID(ctx, DefaultTenantId, job1.Id)
 		require.NoError(t, err)
 		assert.Equal(t, JobStatusFailed, actual.Status)
-		assert.Equal(t, msg, actual.Message)
+		assert.Equal(t, &JobError{Code: JobErrorHandler, Message: msg, Retryable: true, Attempt: 1}, actual.Error)
 		assert.Equal(t, now.Second(), actual.EndTime.Second())
 	})
 
@@ -245,24 +335,193 @@ func TestServiceSetJobFailed(t *testing.T) {
 		queueName := gofakeit.UUID()
 		svc := initTestService(t, queueName, clock)
 
-		job1, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+		job1, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 		require.NoError(t, err)
 
-		msg := "test message"
-		job1, err = svc.SetJobFailed(ctx, job1, msg)
+		job1, err = svc.SetJobFailed(ctx, job1, errors.New("test message"))
 		require.Error(t, err, ErrJobWasNotClaimed)
 	})
 }
 
+func TestServiceSetJobLost(t *testing.T) {
+	ctx := context.Background()
+	clock := initTestClock()
+	svc := initTestService(t, gofakeit.UUID(), clock)
+
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+	require.NoError(t, err)
+
+	_, err = svc.SetJobLost(ctx, job)
+	assert.ErrorIs(t, err, ErrInvalidJobStatus, "only a running job has a worker to lose")
+
+	job, err = svc.ClaimJob(ctx, job)
+	require.NoError(t, err)
+
+	job, err = svc.SetJobLost(ctx, job)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusRetrying, job.Status)
+	assert.Equal(t, &JobError{Code: JobErrorLostWorker, Message: ErrWorkerLost.Error(), Retryable: true, Attempt: 1}, job.Error)
+
+	// the job runs again, its success clears the error of the lost attempt
+	job, err = svc.ClaimJob(ctx, job)
+	require.NoError(t, err)
+	assert.Equal(t, 2, job.Attempts)
+
+	_, err = svc.SetJobSuccess(ctx, job)
+	require.NoError(t, err)
+
+	actual, err := svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+	require.NoError(t, err)
+	assert.Equal(t, JobStatusSuccess, actual.Status)
+	assert.Nil(t, actual.Error)
+}
+
 func TestServicePublicJobFailed(t *testing.T) {
 	ctx := context.Background()
 	clock := initTestClock()
 	queueName := gofakeit.UUID()
 	svc := initTestService(t, queueName, clock)
 
-	job, err := svc.SaveJob(ctx, JobPayload{ObjectId: newTestObjectId()})
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
 	require.NoError(t, err)
 
-	err = svc.PublishJob(ctx, job)
+	published, err := svc.PublishJob(ctx, job)
 	require.NoError(t, err)
+	require.NotNil(t, published.PublishedAt)
+}
+
+func TestServiceRetryJob(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("retry failed job", func(t *testing.T) {
+		clock := initTestClock()
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, clock)
+
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+		_, err = svc.ClaimJob(ctx, job)
+		require.NoError(t, err)
+
+		job, err = svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+		_, err = svc.SetJobFailed(ctx, job, errors.New("test message"))
+		require.NoError(t, err)
+
+		_, err = svc.RetryJob(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+
+		actual, err := svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusQueued, actual.Status)
+		assert.Nil(t, actual.StartTime)
+		assert.Nil(t, actual.EndTime)
+		assert.Nil(t, actual.Error)
+		assert.Equal(t, 1, actual.Attempts, "the attempts of a retried job are kept")
+	})
+
+	t.Run("retry timed out job", func(t *testing.T) {
+		clock := initTestClock()
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, clock)
+
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+		job, err = svc.ClaimJob(ctx, job)
+		require.NoError(t, err)
+
+		job, err = svc.SetJobFailed(ctx, job, Transient(ErrJobExceedTimeout))
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusTimedOut, job.Status)
+
+		job, err = svc.RetryJob(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+
+		// the queued job runs again
+		job, err = svc.ClaimJob(ctx, job)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusRunning, job.Status)
+		assert.Equal(t, 2, job.Attempts)
+	})
+
+	t.Run("job was not failed", func(t *testing.T) {
+		clock := initTestClock()
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, clock)
+
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+
+		_, err = svc.RetryJob(ctx, DefaultTenantId, job.Id)
+		assert.Equal(t, ErrInvalidJobStatus, err)
+	})
+}
+
+func TestServiceCancelJob(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("cancel created job", func(t *testing.T) {
+		clock := initTestClock()
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, clock)
+
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+
+		_, err = svc.CancelJob(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+
+		actual, err := svc.GetJobByID(ctx, DefaultTenantId, job.Id)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusCancelled, actual.Status)
+		require.NotNil(t, actual.Error)
+		assert.Equal(t, JobErrorCancelled, actual.Error.Code)
+
+		// a cancelled job can't be claimed
+		_, err = svc.ClaimJob(ctx, job)
+		assert.Equal(t, ErrJobWasClaimed, err)
+	})
+
+	t.Run("cancel running job", func(t *testing.T) {
+		clock := initTestClock()
+		queueName := gofakeit.UUID()
+		svc := initTestService(t, queueName, clock)
+
+		job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+		require.NoError(t, err)
+		_, err = svc.ClaimJob(ctx, job)
+		require.NoError(t, err)
+
+		_, err = svc.CancelJob(ctx, DefaultTenantId, job.Id)
+		assert.Equal(t, ErrInvalidJobStatus, err)
+	})
+}
+
+func TestServiceRequeueJob(t *testing.T) {
+	ctx := context.Background()
+	clock := initTestClock()
+	queueName := gofakeit.UUID()
+	svc := initTestService(t, queueName, clock)
+
+	job, err := svc.SaveJob(ctx, DefaultTenantId, JobPayload{ObjectId: newTestObjectId()})
+	require.NoError(t, err)
+
+	_, err = svc.RequeueJob(ctx, DefaultTenantId, job.Id)
+	require.NoError(t, err)
+
+	_, err = svc.ClaimJob(ctx, job)
+	require.NoError(t, err)
+	_, err = svc.RequeueJob(ctx, DefaultTenantId, job.Id)
+	assert.Equal(t, ErrInvalidJobStatus, err)
+
+	t.Run("queue a job which was saved but not published", func(t *testing.T) {
+		created, err := testStore.SaveJob(ctx, Job{TenantId: DefaultTenantId, ObjectId: newTestObjectId(), Type: DefaultJobType,
+			Priority: DefaultJobPriority, Status: JobStatusCreated, CreatedAt: clock.Now()})
+		require.NoError(t, err)
+
+		queued, err := svc.RequeueJob(ctx, DefaultTenantId, created.Id)
+		require.NoError(t, err)
+		assert.Equal(t, JobStatusQueued, queued.Status)
+		assert.NotNil(t, queued.PublishedAt)
+	})
 }
@@ -0,0 +1,334 @@
+package jobs
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-pg/pg/v9/orm"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+// Keys of the runtime settings, they override the config of the same name without restarting the workers.
+const (
+	SettingJobPrefetch     = "job_prefetch"
+	SettingJobTimeout      = "job_timeout"
+	SettingTypeConcurrency = "job_type_concurrency"
+	SettingPausedTypes     = "paused_types"
+	SettingPausedQueues    = "paused_queues"
+)
+
+// The workers reload the runtime settings every few seconds
+const settingsRefreshInterval = 5 * time.Second
+
+var SettingKeys = []string{SettingJobPrefetch, SettingJobTimeout, SettingTypeConcurrency, SettingPausedTypes, SettingPausedQueues}
+
+// Setting is a runtime setting changed through the admin API.
+type Setting struct {
+	tableName struct{} `pg:"settings"`
+
+	Key string `json:"key" pg:"key,pk"`
+	// Value is the JSON value of the setting, null resets it to the config
+	Value     json.RawMessage `json:"value" pg:"value,type:jsonb"`
+	UpdatedBy string          `json:"updated_by" pg:"updated_by"`
+	UpdatedAt time.Time       `json:"updated_at" pg:"updated_at"`
+}
+
+// IsReset tells whether the setting falls back to the config.
+func (s Setting) IsReset() bool {
+	value := bytes.TrimSpace(s.Value)
+	return len(value) == 0 || bytes.Equal(value, []byte("null"))
+}
+
+// SettingsStore keeps the runtime settings shared by the API and the workers.
+type SettingsStore interface {
+	// Settings lists the stored settings sorted by key
+	Settings(ctx context.Context) ([]Setting, error)
+	// PutSetting adds or replaces the setting of a key, its updated_at is set by the store
+	PutSetting(ctx context.Context, setting Setting) (Setting, error)
+	// PutSettingItem adds item to or removes it from the JSON list of the setting key in one step,
+	// so concurrent changes of other items are kept
+	PutSettingItem(ctx context.Context, key string, item string, present bool, by string) (Setting, error)
+}
+
+type SettingsStoreImpl struct {
+	db orm.DB
+}
+
+func NewSettingsStore(db orm.DB) *SettingsStoreImpl {
+	return &SettingsStoreImpl{
+		db: db,
+	}
+}
+
+func (s *SettingsStoreImpl) Settings(ctx context.Context) ([]Setting, error) {
+	var settings []Setting
+	if err := s.db.ModelContext(ctx, &settings).Order("key").Select(); err != nil {
+		return nil, err
+	}
+
+	for i := range settings {
+		settings[i].UpdatedAt = settings[i].UpdatedAt.UTC()
+	}
+
+	return settings, nil
+}
+
+func (s *SettingsStoreImpl) PutSetting(ctx context.Context, setting Setting) (Setting, error) {
+	if setting.IsReset() {
+		setting.Value = json.RawMessage("null")
+	}
+
+	_, err := s.db.QueryOneContext(ctx, &setting, `INSERT INTO settings (key, value, updated_by, updated_at)
+		VALUES (?, ?, ?, `+pgNow+`)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value, updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+		RETURNING key, value, updated_by, updated_at`,
+		setting.Key, string(setting.Value), setting.UpdatedBy)
+	if err != nil {
+		return Setting{}, err
+	}
+
+	setting.UpdatedAt = setting.UpdatedAt.UTC()
+	return setting, nil
+}
+
+func (s *SettingsStoreImpl) PutSettingItem(ctx context.Context, key string, item string, present bool, by string) (Setting, error) {
+	value := json.RawMessage("[]")
+	if present {
+		var err error
+		if value, err = json.Marshal([]string{item}); err != nil {
+			return Setting{}, err
+		}
+	}
+
+	// The conflicting row is locked before its value is rebuilt, a value that is not a list counts as empty
+	var setting Setting
+	_, err := s.db.QueryOneContext(ctx, &setting, `INSERT INTO settings (key, value, updated_by, updated_at)
+		VALUES (?, ?, ?, `+pgNow+`)
+		ON CONFLICT (key) DO UPDATE SET value = (
+			SELECT coalesce(jsonb_agg(items.item ORDER BY items.item), '[]'::jsonb) FROM (
+				SELECT item FROM jsonb_array_elements_text(
+					CASE WHEN jsonb_typeof(settings.value) = 'array' THEN settings.value ELSE '[]'::jsonb END
+				) AS item WHERE item <> ?
+				UNION SELECT ?::text WHERE ?
+			) items
+		), updated_by = EXCLUDED.updated_by, updated_at = EXCLUDED.updated_at
+		RETURNING key, value, updated_by, updated_at`,
+		key, string(value), by, item, item, present)
+	if err != nil {
+		return Setting{}, err
+	}
+
+	setting.UpdatedAt = setting.UpdatedAt.UTC()
+	return setting, nil
+}
+
+// RuntimeSettings are the settings a worker runs with: its config overridden by the stored settings.
+type RuntimeSettings struct {
+	JobPrefetch     int64          `json:"job_prefetch"`
+	JobTimeout      int            `json:"job_timeout"`
+	TypeConcurrency map[string]int `json:"job_type_concurrency"`
+	PausedTypes     []string       `json:"paused_types"`
+	// PausedQueues are the names of the paused queues of a job type and priority, see JobQueueName
+	PausedQueues []string `json:"paused_queues"`
+}
+
+// NewRuntimeSettings returns the settings of cfg before any stored setting applies.
+func NewRuntimeSettings(cfg config.Config) RuntimeSettings {
+	typeConcurrency := make(map[string]int, len(cfg.JobConfig.TypeConcurrency))
+	for jobType, limit := range cfg.JobConfig.TypeConcurrency {
+		typeConcurrency[jobType] = limit
+	}
+
+	return RuntimeSettings{
+		JobPrefetch:     cfg.JobPrefetch,
+		JobTimeout:      cfg.JobConfig.TimeoutInSeconds,
+		TypeConcurrency: typeConcurrency,
+		PausedTypes:     []string{},
+		PausedQueues:    []string{},
+	}
+}
+
+// Apply returns s overridden by a stored setting, the job types of job_type_concurrency replace the limit of the config.
+func (s RuntimeSettings) Apply(setting Setting) (RuntimeSettings, error) {
+	if err := ValidateSetting(setting); err != nil {
+		return s, err
+	}
+
+	if setting.IsReset() {
+		return s, nil
+	}
+
+	switch setting.Key {
+	case SettingJobPrefetch:
+		return s, json.Unmarshal(setting.Value, &s.JobPrefetch)
+	case SettingJobTimeout:
+		return s, json.Unmarshal(setting.Value, &s.JobTimeout)
+	case SettingTypeConcurrency:
+		var limits map[string]int
+		if err := json.Unmarshal(setting.Value, &limits); err != nil {
+			return s, err
+		}
+
+		typeConcurrency := make(map[string]int, len(s.TypeConcurrency)+len(limits))
+		for jobType, limit := range s.TypeConcurrency {
+			typeConcurrency[jobType] = limit
+		}
+		for jobType, limit := range limits {
+			typeConcurrency[jobType] = limit
+		}
+
+		s.TypeConcurrency = typeConcurrency
+		return s, nil
+	case SettingPausedTypes:
+		var types []string
+		if err := json.Unmarshal(setting.Value, &types); err != nil {
+			return s, err
+		}
+
+		sort.Strings(types)
+		s.PausedTypes = types
+		return s, nil
+	case SettingPausedQueues:
+		var queues []string
+		if err := json.Unmarshal(setting.Value, &queues); err != nil {
+			return s, err
+		}
+
+		sort.Strings(queues)
+		s.PausedQueues = queues
+		return s, nil
+	}
+
+	return s, nil
+}
+
+// JobConfig returns the job config of base run with the settings s.
+func (s RuntimeSettings) JobConfig(base config.JobConfig) config.JobConfig {
+	base.JobPrefetch = s.JobPrefetch
+	base.TimeoutInSeconds = s.JobTimeout
+	base.TypeConcurrency = s.TypeConcurrency
+	return base
+}
+
+// IsPaused tells whether the consumers stopped running the jobs of jobType.
+func (s RuntimeSettings) IsPaused(jobType string) bool {
+	return containsString(s.PausedTypes, jobType)
+}
+
+// IsQueuePaused tells whether the consumers stopped running the jobs of queue, the queue of jobType.
+func (s RuntimeSettings) IsQueuePaused(queue string, jobType string) bool {
+	return s.IsPaused(jobType) || containsString(s.PausedQueues, queue)
+}
+
+// ValidateSetting checks the key and the value of a setting, a null value is always valid.
+func ValidateSetting(setting Setting) error {
+	if !containsString(SettingKeys, setting.Key) {
+		return fmt.Errorf("%w: %s", ErrUnknownSetting, setting.Key)
+	}
+
+	if setting.IsReset() {
+		return nil
+	}
+
+	invalid := func(format string, args ...interface{}) error {
+		return fmt.Errorf("%w: %s %s", ErrInvalidSetting, setting.Key, fmt.Sprintf(format, args...))
+	}
+
+	switch setting.Key {
+	case SettingJobPrefetch, SettingJobTimeout:
+		var value int64
+		if err := json.Unmarshal(setting.Value, &value); err != nil {
+			return invalid("must be an integer")
+		}
+
+		if value <= 0 {
+			return invalid("must be positive, got %d", value)
+		}
+	case SettingTypeConcurrency:
+		var limits map[string]int
+		if err := json.Unmarshal(setting.Value, &limits); err != nil {
+			return invalid("must map job types to integers")
+		}
+
+		for jobType, limit := range limits {
+			if limit < 0 {
+				return invalid("of %s must not be negative, got %d", jobType, limit)
+			}
+		}
+	case SettingPausedTypes:
+		var types []string
+		if err := json.Unmarshal(setting.Value, &types); err != nil {
+			return invalid("must be a list of job types")
+		}
+	case SettingPausedQueues:
+		var queues []string
+		if err := json.Unmarshal(setting.Value, &queues); err != nil {
+			return invalid("must be a list of queues")
+		}
+
+		for _, queue := range queues {
+			if _, _, ok := parseJobQueueName(QueueName, queue); !ok {
+				return invalid("has %s which is not a job queue", queue)
+			}
+		}
+	}
+
+	return nil
+}
+
+// PauseQueue pauses or resumes a queue of a job type and priority by changing the paused_queues setting.
+// Its jobs are still published, the consumers leave them in the queue while it is paused.
+func PauseQueue(ctx context.Context, settings SettingsStore, queue string, paused bool, by string) (Setting, error) {
+	if _, _, ok := parseJobQueueName(QueueName, queue); !ok {
+		return Setting{}, fmt.Errorf("%w: %s", ErrQueueNotFound, queue)
+	}
+
+	return settings.PutSettingItem(ctx, SettingPausedQueues, queue, paused, by)
+}
+
+// PausedSettings returns the paused types and queues of the stored settings.
+func PausedSettings(ctx context.Context, settings SettingsStore) (RuntimeSettings, error) {
+	stored, err := settings.Settings(ctx)
+	if err != nil {
+		return RuntimeSettings{}, err
+	}
+
+	paused := RuntimeSettings{PausedTypes: []string{}, PausedQueues: []string{}}
+	for _, setting := range stored {
+		if setting.Key != SettingPausedTypes && setting.Key != SettingPausedQueues {
+			continue
+		}
+
+		if paused, err = paused.Apply(setting); err != nil {
+			return RuntimeSettings{}, err
+		}
+	}
+
+	return paused, nil
+}
+
+// liveSettings holds the runtime settings of a worker, they change while its consumers read them.
+type liveSettings struct {
+	mu       sync.RWMutex
+	settings RuntimeSettings
+}
+
+func (l *liveSettings) get() RuntimeSettings {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return l.settings
+}
+
+func (l *liveSettings) set(settings RuntimeSettings) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.settings = settings
+}
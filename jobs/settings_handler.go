@@ -0,0 +1,71 @@
+package jobs
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+)
+
+type PutSettingRequest struct {
+	Value json.RawMessage `json:"value"`
+}
+
+// GetSettingsHandler lists the runtime settings changed through the admin API, the others are those of the config.
+func (a *HTTPHandler) GetSettingsHandler(ctx echo.Context) error {
+	settings, err := a.settings.Settings(ctx.Request().Context())
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	if settings == nil {
+		settings = []Setting{}
+	}
+
+	return ctx.JSON(http.StatusOK, settings)
+}
+
+// PutSettingHandler changes a runtime setting, the workers apply it within a few seconds.
+func (a *HTTPHandler) PutSettingHandler(ctx echo.Context) error {
+	var req PutSettingRequest
+	if err := ctx.Bind(&req); err != nil {
+		return echo.NewHTTPError(http.StatusBadRequest, "failed to parse request")
+	}
+
+	// null is explicit, a missing value is most likely a typo in the request
+	if len(req.Value) == 0 {
+		return echo.NewHTTPError(http.StatusBadRequest, "value is required")
+	}
+
+	return a.putSetting(ctx, req.Value)
+}
+
+// ResetSettingHandler makes the workers fall back to their config for a runtime setting.
+func (a *HTTPHandler) ResetSettingHandler(ctx echo.Context) error {
+	return a.putSetting(ctx, nil)
+}
+
+func (a *HTTPHandler) putSetting(ctx echo.Context, value json.RawMessage) error {
+	setting := Setting{
+		Key:       ctx.Param("key"),
+		Value:     value,
+		UpdatedBy: AdminFromContext(ctx),
+	}
+
+	if err := ValidateSetting(setting); err != nil {
+		if errors.Is(err, ErrUnknownSetting) {
+			return echo.NewHTTPError(http.StatusNotFound, err.Error())
+		}
+
+		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
+	}
+
+	setting, err := a.settings.PutSetting(ctx.Request().Context(), setting)
+	if err != nil {
+		return echo.NewHTTPError(http.StatusInternalServerError, err.Error())
+	}
+
+	a.logger.WithField("admin", setting.UpdatedBy).Infof("setting %s changed to %s", setting.Key, setting.Value)
+	return ctx.JSON(http.StatusOK, setting)
+}
@@ -0,0 +1,76 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSettingsHandler(t *testing.T) {
+	handler := initTestAdminHandler(t, gofakeit.UUID())
+	headers := map[string]string{"X-API-Key": "admin-key"}
+	t.Cleanup(func() {
+		_, _ = testSettings.PutSetting(context.Background(), Setting{Key: SettingTypeConcurrency, UpdatedBy: "test"})
+	})
+
+	put := func(key, body string) (int, Setting) {
+		tr := testRequest{method: http.MethodPut, uri: "/admin/settings/" + key, body: strings.NewReader(body), headers: headers}
+		rec := tr.do(handler)
+
+		var setting Setting
+		_ = json.Unmarshal(rec.Body.Bytes(), &setting)
+		return rec.Code, setting
+	}
+
+	t.Run("change a setting", func(t *testing.T) {
+		code, setting := put(SettingTypeConcurrency, `{"value":{"report":3}}`)
+		require.Equal(t, http.StatusOK, code)
+		assert.Equal(t, SettingTypeConcurrency, setting.Key)
+		assert.JSONEq(t, `{"report":3}`, string(setting.Value))
+		assert.Equal(t, "alice", setting.UpdatedBy, "the setting is attributed to the owner of the admin key")
+
+		tr := testRequest{method: http.MethodGet, uri: "/admin/settings", headers: headers}
+		rec := tr.do(handler)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var settings []Setting
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &settings))
+
+		var found bool
+		for _, stored := range settings {
+			if stored.Key == SettingTypeConcurrency {
+				found = true
+				assert.JSONEq(t, `{"report":3}`, string(stored.Value))
+			}
+		}
+		assert.True(t, found)
+	})
+
+	t.Run("reset a setting", func(t *testing.T) {
+		tr := testRequest{method: http.MethodDelete, uri: "/admin/settings/" + SettingTypeConcurrency, headers: headers}
+		rec := tr.do(handler)
+		require.Equal(t, http.StatusOK, rec.Code)
+
+		var setting Setting
+		require.NoError(t, json.Unmarshal(rec.Body.Bytes(), &setting))
+		assert.True(t, setting.IsReset())
+		assert.Equal(t, "alice", setting.UpdatedBy)
+	})
+
+	t.Run("reject invalid settings", func(t *testing.T) {
+		code, _ := put(SettingJobPrefetch, `{"value":0}`)
+		assert.Equal(t, http.StatusBadRequest, code)
+
+		code, _ = put(SettingJobTimeout, `{}`)
+		assert.Equal(t, http.StatusBadRequest, code, "the value is required")
+
+		code, _ = put("job_retries", `{"value":3}`)
+		assert.Equal(t, http.StatusNotFound, code)
+	})
+}
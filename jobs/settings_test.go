@@ -0,0 +1,145 @@
+package jobs
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+func TestValidateSetting(t *testing.T) {
+	testcases := []struct {
+		key   string
+		value string
+		err   error
+	}{
+		{key: SettingJobPrefetch, value: `20`},
+		{key: SettingJobPrefetch, value: `0`, err: ErrInvalidSetting},
+		{key: SettingJobPrefetch, value: `"20"`, err: ErrInvalidSetting},
+		{key: SettingJobTimeout, value: `60`},
+		{key: SettingJobTimeout, value: `-1`, err: ErrInvalidSetting},
+		{key: SettingTypeConcurrency, value: `{"report":2,"export":0}`},
+		{key: SettingTypeConcurrency, value: `{"report":-1}`, err: ErrInvalidSetting},
+		{key: SettingPausedTypes, value: `["report"]`},
+		{key: SettingPausedTypes, value: `"report"`, err: ErrInvalidSetting},
+		{key: SettingPausedQueues, value: `["job-queue.report:high","job-queue"]`},
+		{key: SettingPausedQueues, value: `["other-queue"]`, err: ErrInvalidSetting},
+		{key: SettingJobTimeout, value: `null`},
+		{key: "job_retries", value: `3`, err: ErrUnknownSetting},
+	}
+
+	for _, tc := range testcases {
+		err := ValidateSetting(Setting{Key: tc.key, Value: json.RawMessage(tc.value)})
+		if tc.err == nil {
+			assert.NoError(t, err, "%s=%s", tc.key, tc.value)
+		} else {
+			assert.ErrorIs(t, err, tc.err, "%s=%s", tc.key, tc.value)
+		}
+	}
+}
+
+func TestRuntimeSettings(t *testing.T) {
+	cfg := config.Config{
+		JobConfig: config.JobConfig{
+			JobPrefetch:            10,
+			TimeoutInSeconds:       20,
+			TenantTimeoutInSeconds: map[string]int{"team-a": 90},
+			TypeConcurrency:        map[string]int{"report": 2, "export": 5},
+		},
+	}
+
+	settings := NewRuntimeSettings(cfg)
+	assert.Equal(t, RuntimeSettings{
+		JobPrefetch:     10,
+		JobTimeout:      20,
+		TypeConcurrency: map[string]int{"report": 2, "export": 5},
+		PausedTypes:     []string{},
+		PausedQueues:    []string{},
+	}, settings)
+
+	for _, setting := range []Setting{
+		{Key: SettingJobPrefetch, Value: json.RawMessage(`4`)},
+		{Key: SettingJobTimeout, Value: json.RawMessage(`null`)},
+		{Key: SettingTypeConcurrency, Value: json.RawMessage(`{"report":1,"render":3}`)},
+		{Key: SettingPausedTypes, Value: json.RawMessage(`["render","export"]`)},
+		{Key: SettingPausedQueues, Value: json.RawMessage(`["job-queue.report:high"]`)},
+	} {
+		var err error
+		settings, err = settings.Apply(setting)
+		require.NoError(t, err)
+	}
+
+	_, err := settings.Apply(Setting{Key: SettingJobPrefetch, Value: json.RawMessage(`0`)})
+	assert.ErrorIs(t, err, ErrInvalidSetting)
+
+	assert.EqualValues(t, 4, settings.JobPrefetch)
+	assert.Equal(t, 20, settings.JobTimeout, "a reset setting falls back to the config")
+	assert.Equal(t, map[string]int{"report": 1, "export": 5, "render": 3}, settings.TypeConcurrency)
+	assert.Equal(t, []string{"export", "render"}, settings.PausedTypes)
+	assert.True(t, settings.IsPaused("render"))
+	assert.False(t, settings.IsPaused("report"))
+	assert.True(t, settings.IsQueuePaused("job-queue.report:high", "report"))
+	assert.False(t, settings.IsQueuePaused("job-queue.report", "report"), "the other priorities keep running")
+	assert.True(t, settings.IsQueuePaused("job-queue.render", "render"), "every queue of a paused type is paused")
+	assert.Equal(t, map[string]int{"report": 2, "export": 5}, cfg.JobConfig.TypeConcurrency, "the config is left unchanged")
+
+	settings, err = settings.Apply(Setting{Key: SettingJobTimeout, Value: json.RawMessage(`45`)})
+	require.NoError(t, err)
+
+	jobConfig := settings.JobConfig(cfg.JobConfig)
+	assert.Equal(t, 45, jobConfig.TenantTimeout(DefaultTenantId))
+	assert.Equal(t, 90, jobConfig.TenantTimeout("team-a"), "the timeouts of the tenants still apply")
+	assert.Equal(t, 1, jobConfig.TypeConcurrency["report"])
+}
+
+func TestPauseQueue(t *testing.T) {
+	ctx := context.Background()
+	settings := testSettings
+	t.Cleanup(func() {
+		_, _ = settings.PutSetting(ctx, Setting{Key: SettingPausedQueues, UpdatedBy: "test"})
+	})
+
+	_, err := PauseQueue(ctx, settings, "job-queue.report:high", true, "alice")
+	require.NoError(t, err)
+	_, err = PauseQueue(ctx, settings, "job-queue", true, "alice")
+	require.NoError(t, err)
+
+	setting, err := PauseQueue(ctx, settings, "job-queue.report:high", false, "bob")
+	require.NoError(t, err)
+	assert.Equal(t, "bob", setting.UpdatedBy)
+
+	paused, err := PausedSettings(ctx, settings)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"job-queue"}, paused.PausedQueues)
+
+	_, err = PauseQueue(ctx, settings, "other-queue", true, "alice")
+	assert.ErrorIs(t, err, ErrQueueNotFound)
+
+	t.Run("concurrent pauses are all kept", func(t *testing.T) {
+		queues := make([]string, 0, 10)
+		for i := 0; i < 10; i++ {
+			queues = append(queues, JobQueueName(QueueName, fmt.Sprintf("type-%d", i), JobPriorityHigh))
+		}
+
+		var wg sync.WaitGroup
+		for _, queue := range queues {
+			wg.Add(1)
+			go func(queue string) {
+				defer wg.Done()
+				_, err := PauseQueue(ctx, settings, queue, true, "alice")
+				assert.NoError(t, err)
+			}(queue)
+		}
+		wg.Wait()
+
+		paused, err := PausedSettings(ctx, settings)
+		require.NoError(t, err)
+		assert.Subset(t, paused.PausedQueues, queues)
+	})
+}
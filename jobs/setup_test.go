@@ -1,45 +1,115 @@
 package jobs
 
 import (
+	"context"
 	"log"
 	"os"
 	"testing"
+	"time"
 
 	"github.com/adjust/rmq/v5"
+	"github.com/benbjohnson/clock"
 	"github.com/go-pg/pg/v9"
+	"github.com/go-redis/redis/v8"
 	"github.com/sirupsen/logrus"
 
+	"github.com/tuyentv96/hasty-challenge/config"
 	"github.com/tuyentv96/hasty-challenge/utils"
 )
 
 var (
 	testDb            *pg.DB
+	testRedisClient   *redis.Client
 	testRmqConnection rmq.Connection
+	testBroker        Broker
 	testStore         Store
 	testLogger        *logrus.Entry
 	testTransaction   utils.Transactioner
+	testJobLogs       JobLogStore
+	testWorkers       WorkerRegistry
+	testSettings      SettingsStore
+	testArtifacts     ArtifactStore
+	testS3Artifacts   *S3ArtifactStore
+	// testDocker is false when the tests run on the in-memory backends, see requireDocker
+	testDocker bool
 )
 
 func TestMain(m *testing.M) {
+	// Run in a time zone other than UTC, times which are not converted to UTC would be off by 7 hours
+	time.Local = time.FixedZone("UTC+7", 7*60*60)
+
 	logger := logrus.New()
 	testLogger = logrus.NewEntry(logger)
 
+	artifactDir, err := os.MkdirTemp("", "artifacts")
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	testArtifacts = NewLocalArtifactStore(artifactDir)
+
+	testDocker = utils.DockerAvailable()
+	if !testDocker {
+		log.Println("Docker is not available, the tests run on the in-memory backends and skip those of Postgres, Redis and S3")
+		backends := memoryBackends()
+		testStore = backends.Store
+		testBroker = backends.Broker
+		testTransaction = backends.Transactioner
+		testJobLogs = backends.JobLogs
+		testWorkers = backends.Workers
+		testSettings = backends.Settings
+
+		code := m.Run()
+		os.RemoveAll(artifactDir)
+		os.Exit(code)
+	}
+
 	var redisCloseFunc func() error
-	redisClient, redisCloseFunc := utils.SetupRedisTest()
+	testRedisClient, redisCloseFunc = utils.SetupRedisTest()
 
-	var err error
-	testRmqConnection, err = rmq.OpenConnectionWithRedisClient("test", redisClient, nil)
+	testRmqConnection, err = rmq.OpenConnectionWithRedisClient("test", testRedisClient, nil)
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
 
+	testBroker = NewRmqBroker(testRmqConnection, testRedisClient)
+
 	var closeFunc func() error
 	testDb, closeFunc = utils.SetupDBTest()
 	testTransaction = utils.NewTransaction(testDb)
 	testStore = NewJobStore(testDb)
+	testJobLogs = NewJobLogStore(testDb)
+	testWorkers = NewWorkerRegistry(testDb)
+	testSettings = NewSettingsStore(testDb)
+
+	minioEndpoint, minioCloseFunc := utils.SetupMinioTest()
+	testS3Artifacts, err = NewS3ArtifactStore(config.ArtifactConfig{
+		ArtifactS3Endpoint:  minioEndpoint,
+		ArtifactS3Region:    "us-east-1",
+		ArtifactS3Bucket:    "artifacts",
+		ArtifactS3AccessKey: utils.MinioAccessKey,
+		ArtifactS3SecretKey: utils.MinioSecretKey,
+	}, clock.New())
+	if err != nil {
+		log.Fatalln(err.Error())
+	}
+
+	if err := testS3Artifacts.CreateBucket(context.Background()); err != nil {
+		log.Fatalln(err.Error())
+	}
 
 	code := m.Run()
+	minioCloseFunc()
 	closeFunc()
 	redisCloseFunc()
+	os.RemoveAll(artifactDir)
 	os.Exit(code)
 }
+
+// requireDocker skips a test of Postgres, Redis or S3 when the tests run on the in-memory backends.
+func requireDocker(t *testing.T) {
+	t.Helper()
+	if !testDocker {
+		t.Skip("needs Docker")
+	}
+}
@@ -0,0 +1,102 @@
+package jobs
+
+// JobStatuses lists every job status in the order of the lifecycle of a job.
+// The CHECK constraint of jobs.status in the migrations must list the same statuses.
+var JobStatuses = []JobStatus{
+	JobStatusCreated,
+	JobStatusScheduled,
+	JobStatusQueued,
+	JobStatusRunning,
+	JobStatusRetrying,
+	JobStatusSuccess,
+	JobStatusFailed,
+	JobStatusTimedOut,
+	JobStatusCancelled,
+	JobStatusExpired,
+}
+
+// jobTransitions is the state machine of a job, it maps a status to the statuses the job may change to.
+// Every status change of ServiceImpl goes through transition, which enforces this table.
+// Nothing schedules or expires jobs yet, scheduled and expired are reserved for delayed jobs and jobs which waited too long.
+var jobTransitions = map[JobStatus][]JobStatus{
+	// a created job is queued once it is published, the jobs published while created was their queued status still run
+	// and a job which panicked before its claim fails without running
+	JobStatusCreated:   {JobStatusQueued, JobStatusRunning, JobStatusFailed, JobStatusCancelled, JobStatusExpired},
+	JobStatusScheduled: {JobStatusQueued, JobStatusCancelled, JobStatusExpired},
+	JobStatusQueued:    {JobStatusRunning, JobStatusFailed, JobStatusCancelled, JobStatusExpired},
+	// a running job whose worker was lost is retrying until a worker claims it again
+	JobStatusRunning:  {JobStatusSuccess, JobStatusFailed, JobStatusTimedOut, JobStatusRetrying},
+	JobStatusRetrying: {JobStatusQueued, JobStatusRunning, JobStatusFailed, JobStatusCancelled, JobStatusExpired},
+	// failed and timed out jobs are queued again when they are retried
+	JobStatusFailed:    {JobStatusQueued},
+	JobStatusTimedOut:  {JobStatusQueued},
+	JobStatusSuccess:   nil,
+	JobStatusCancelled: nil,
+	JobStatusExpired:   nil,
+}
+
+// FinishedJobStatuses are the statuses of the jobs which ran or will never run, the maintenance archives and purges them.
+// Failed and timed out jobs are finished though they may be retried.
+var FinishedJobStatuses = []JobStatus{
+	JobStatusSuccess,
+	JobStatusFailed,
+	JobStatusTimedOut,
+	JobStatusCancelled,
+	JobStatusExpired,
+}
+
+// IsFinished tells whether the job in the status ran or will never run.
+func (s JobStatus) IsFinished() bool {
+	for _, status := range FinishedJobStatuses {
+		if status == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func IsValidJobStatus(status JobStatus) bool {
+	_, ok := jobTransitions[status]
+	return ok
+}
+
+// CanTransition tells whether a job may change from one status to another.
+func (s JobStatus) CanTransition(to JobStatus) bool {
+	for _, status := range jobTransitions[s] {
+		if status == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsTerminal tells whether a job in the status is done for good.
+func (s JobStatus) IsTerminal() bool {
+	return IsValidJobStatus(s) && len(jobTransitions[s]) == 0
+}
+
+// JobStatusInfo describes a status of the state machine for the clients of the API.
+type JobStatusInfo struct {
+	Status      JobStatus   `json:"status"`
+	Terminal    bool        `json:"terminal"`
+	Transitions []JobStatus `json:"transitions"`
+}
+
+// JobStatusMachine returns the state machine of a job, one entry per status of JobStatuses.
+func JobStatusMachine() []JobStatusInfo {
+	machine := make([]JobStatusInfo, 0, len(JobStatuses))
+	for _, status := range JobStatuses {
+		transitions := make([]JobStatus, len(jobTransitions[status]))
+		copy(transitions, jobTransitions[status])
+
+		machine = append(machine, JobStatusInfo{
+			Status:      status,
+			Terminal:    status.IsTerminal(),
+			Transitions: transitions,
+		})
+	}
+
+	return machine
+}
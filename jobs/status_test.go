@@ -0,0 +1,61 @@
+package jobs
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestJobTransitions(t *testing.T) {
+	assert.Len(t, jobTransitions, len(JobStatuses), "every status has transitions")
+
+	for from, transitions := range jobTransitions {
+		for _, to := range transitions {
+			assert.True(t, IsValidJobStatus(to), "%s -> %s", from, to)
+			assert.NotEqual(t, from, to)
+		}
+	}
+
+	testcases := []struct {
+		from, to JobStatus
+		allowed  bool
+	}{
+		{from: JobStatusCreated, to: JobStatusQueued, allowed: true},
+		{from: JobStatusCreated, to: JobStatusRunning, allowed: true},
+		{from: JobStatusQueued, to: JobStatusRunning, allowed: true},
+		{from: JobStatusRunning, to: JobStatusTimedOut, allowed: true},
+		{from: JobStatusFailed, to: JobStatusQueued, allowed: true},
+		{from: JobStatusCreated, to: JobStatusSuccess},
+		{from: JobStatusRunning, to: JobStatusCancelled},
+		{from: JobStatusSuccess, to: JobStatusQueued},
+		{from: JobStatus("unknown"), to: JobStatusRunning},
+	}
+
+	for _, tc := range testcases {
+		assert.Equal(t, tc.allowed, tc.from.CanTransition(tc.to), "%s -> %s", tc.from, tc.to)
+	}
+}
+
+func TestJobStatusMachine(t *testing.T) {
+	machine := JobStatusMachine()
+	assert.Len(t, machine, len(JobStatuses))
+	assert.Equal(t, JobStatusCreated, machine[0].Status)
+
+	terminal := make(map[JobStatus]bool)
+	for _, info := range machine {
+		terminal[info.Status] = info.Terminal
+	}
+
+	assert.Equal(t, map[JobStatus]bool{
+		JobStatusCreated:   false,
+		JobStatusScheduled: false,
+		JobStatusQueued:    false,
+		JobStatusRunning:   false,
+		JobStatusRetrying:  false,
+		JobStatusSuccess:   true,
+		JobStatusFailed:    false,
+		JobStatusTimedOut:  false,
+		JobStatusCancelled: true,
+		JobStatusExpired:   true,
+	}, terminal)
+}
@@ -14,8 +14,11 @@ import (
 type Store interface {
 	SaveJob(ctx context.Context, job Job) (Job, error)
 	UpdateJobOptimistically(ctx context.Context, job Job, currentStatus JobStatus) error
-	GetJobByID(ctx context.Context, jobId int) (Job, error)
-	GetJobByObjectId(ctx context.Context, objectId int, createdAt time.Time) (Job, error)
+	GetJobByID(ctx context.Context, tenantId string, jobId int) (Job, error)
+	GetJobByObjectId(ctx context.Context, tenantId string, objectId int, createdAt time.Time) (Job, error)
+	ListJobs(ctx context.Context, filter JobFilter) ([]Job, error)
+	// DeleteJobs deletes the jobs selected by filter and returns them
+	DeleteJobs(ctx context.Context, filter RetentionFilter) ([]Job, error)
 }
 
 type StoreImpl struct {
@@ -46,8 +49,13 @@ func (j StoreImpl) UpdateJobOptimistically(ctx context.Context, job Job, current
 		Set("status = ?", job.Status).
 		Set("start_time = ?", job.StartTime).
 		Set("end_time = ?", job.EndTime).
-		Set("message = ?", job.Message).
+		Set("published_at = ?", job.PublishedAt).
+		Set("worker_id = ?", job.WorkerId).
+		Set("hostname = ?", job.Hostname).
+		Set("attempts = ?", job.Attempts).
+		Set("error = ?", job.Error).
 		Where("id = ?", job.Id).
+		Where("tenant_id = ?", job.TenantId).
 		Where("status = ?", currentStatus).
 		Update()
 	if err != nil {
@@ -61,11 +69,12 @@ func (j StoreImpl) UpdateJobOptimistically(ctx context.Context, job Job, current
 	return nil
 }
 
-func (j StoreImpl) GetJobByID(ctx context.Context, jobId int) (Job, error) {
+func (j StoreImpl) GetJobByID(ctx context.Context, tenantId string, jobId int) (Job, error) {
 	var result Job
 
 	if err := j.GetDB(ctx).Model(&result).
 		Where("id = ?", jobId).
+		Where("tenant_id = ?", tenantId).
 		Select(); err != nil {
 		if errors.Is(err, pg.ErrNoRows) {
 			return Job{}, ErrJobNotFound
@@ -77,10 +86,11 @@ func (j StoreImpl) GetJobByID(ctx context.Context, jobId int) (Job, error) {
 	return result, nil
 }
 
-func (j StoreImpl) GetJobByObjectId(ctx context.Context, objectId int, createdAt time.Time) (Job, error) {
+func (j StoreImpl) GetJobByObjectId(ctx context.Context, tenantId string, objectId int, createdAt time.Time) (Job, error) {
 	var result Job
 
 	if err := j.GetDB(ctx).Model(&result).
+		Where("tenant_id = ?", tenantId).
 		Where("object_id = ?", objectId).
 		Where("created_at >= ?", createdAt).
 		Limit(1).
@@ -94,3 +104,57 @@ func (j StoreImpl) GetJobByObjectId(ctx context.Context, objectId int, createdAt
 
 	return result, nil
 }
+
+func (j StoreImpl) ListJobs(ctx context.Context, filter JobFilter) ([]Job, error) {
+	var result []Job
+
+	query := j.GetDB(ctx).Model(&result).
+		Where("tenant_id = ?", filter.TenantId).
+		Order("id DESC")
+
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	if filter.Type != "" {
+		query = query.Where("type = ?", filter.Type)
+	}
+
+	if filter.ObjectId != 0 {
+		query = query.Where("object_id = ?", filter.ObjectId)
+	}
+
+	if filter.Limit > 0 {
+		query = query.Limit(filter.Limit)
+	}
+
+	if err := query.Select(); err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+func (j StoreImpl) DeleteJobs(ctx context.Context, filter RetentionFilter) ([]Job, error) {
+	var result []Job
+	if len(filter.Statuses) == 0 {
+		return result, nil
+	}
+
+	// SKIP LOCKED leaves out the jobs updated by running transactions, the next run deletes them.
+	// The log lines of the jobs go with them.
+	_, err := j.GetDB(ctx).QueryContext(ctx, &result, `WITH deleted AS (
+		DELETE FROM jobs WHERE (id, created_at) IN (
+			SELECT id, created_at FROM jobs WHERE status IN (?) AND created_at < ?
+			ORDER BY created_at LIMIT ? FOR UPDATE SKIP LOCKED
+		) RETURNING *
+	), logs AS (
+		DELETE FROM job_logs WHERE job_id IN (SELECT id FROM deleted)
+	)
+	SELECT * FROM deleted`, pg.In(filter.Statuses), filter.CreatedBefore, filter.Limit)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
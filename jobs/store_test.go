@@ -5,6 +5,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/brianvoe/gofakeit/v6"
 	"github.com/stretchr/testify/require"
 
 	"github.com/stretchr/testify/assert"
@@ -48,9 +49,10 @@ func TestStoreGetJob(t *testing.T) {
 	require.NoError(t, err)
 
 	cases := []struct {
-		name  string
-		jobId int
-		err   error
+		name     string
+		tenantId string
+		jobId    int
+		err      error
 	}{
 		{
 			name:  "get existede job",
@@ -62,11 +64,22 @@ func TestStoreGetJob(t *testing.T) {
 			jobId: 99999,
 			err:   ErrJobNotFound,
 		},
+		{
+			name:     "get job of another tenant",
+			tenantId: "another-tenant",
+			jobId:    job.Id,
+			err:      ErrJobNotFound,
+		},
 	}
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := testStore.GetJobByID(context.Background(), tc.jobId)
+			tenantId := DefaultTenantId
+			if tc.tenantId != "" {
+				tenantId = tc.tenantId
+			}
+
+			_, err := testStore.GetJobByID(context.Background(), tenantId, tc.jobId)
 			assert.Equal(t, tc.err, err)
 		})
 
@@ -106,7 +119,7 @@ func TestStoreGetJobByObjectId(t *testing.T) {
 
 	for _, tc := range cases {
 		t.Run(tc.name, func(t *testing.T) {
-			_, err := testStore.GetJobByObjectId(context.Background(), tc.objectId, tc.createdAt)
+			_, err := testStore.GetJobByObjectId(context.Background(), DefaultTenantId, tc.objectId, tc.createdAt)
 			assert.Equal(t, tc.err, err)
 		})
 	}
@@ -154,3 +167,54 @@ func TestStoreUpdateJob(t *testing.T) {
 		})
 	}
 }
+
+func TestStoreListJobs(t *testing.T) {
+	ctx := context.Background()
+	tenantId := gofakeit.UUID()
+	objectId := newTestObjectId()
+
+	for _, status := range []JobStatus{JobStatusCreated, JobStatusFailed, JobStatusFailed} {
+		_, err := testStore.SaveJob(ctx, Job{
+			TenantId: tenantId,
+			ObjectId: objectId,
+			Type:     DefaultJobType,
+			Status:   status,
+		})
+		require.NoError(t, err)
+	}
+
+	cases := []struct {
+		name   string
+		filter JobFilter
+		count  int
+	}{
+		{
+			name:   "all jobs of tenant",
+			filter: JobFilter{TenantId: tenantId},
+			count:  3,
+		},
+		{
+			name:   "filter by status",
+			filter: JobFilter{TenantId: tenantId, Status: JobStatusFailed},
+			count:  2,
+		},
+		{
+			name:   "filter by object id with limit",
+			filter: JobFilter{TenantId: tenantId, ObjectId: objectId, Limit: 1},
+			count:  1,
+		},
+		{
+			name:   "another tenant",
+			filter: JobFilter{TenantId: gofakeit.UUID()},
+			count:  0,
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			result, err := testStore.ListJobs(ctx, tc.filter)
+			require.NoError(t, err)
+			assert.Len(t, result, tc.count)
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"github.com/labstack/echo/v4"
+)
+
+const (
+	DefaultTenantId = "default"
+
+	tenantContextKey = "tenant_id"
+)
+
+// TenantMiddleware resolves the tenant of the caller from its API key.
+// If no API keys are configured, every request belongs to DefaultTenantId.
+func TenantMiddleware(apiKeys map[string]string) echo.MiddlewareFunc {
+	if len(apiKeys) == 0 {
+		return func(next echo.HandlerFunc) echo.HandlerFunc {
+			return func(ctx echo.Context) error {
+				ctx.Set(tenantContextKey, DefaultTenantId)
+				return next(ctx)
+			}
+		}
+	}
+
+	return apiKeyMiddleware(apiKeys, tenantContextKey)
+}
+
+// TenantFromContext returns the tenant resolved by TenantMiddleware.
+func TenantFromContext(ctx echo.Context) string {
+	tenantId, _ := ctx.Get(tenantContextKey).(string)
+	return tenantId
+}
@@ -1,10 +1,16 @@
 package jobs
 
 import (
+	"context"
 	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"github.com/adjust/rmq/v5"
 	"github.com/benbjohnson/clock"
 	"github.com/pkg/errors"
 	"github.com/sirupsen/logrus"
@@ -21,72 +27,341 @@ type Worker interface {
 	Start() error
 	Stop()
 	RunCleaner()
+	// Consumers returns the state of the running consumers
+	Consumers() []ConsumerState
 }
 
 type WorkerImpl struct {
 	cfg           config.Config
 	svc           Service
-	connection    rmq.Connection
-	queue         rmq.Queue
+	broker        Broker
+	queues        *JobQueues
+	registry      WorkerRegistry
+	info          WorkerInfo
+	scheduler     *priorityScheduler
+	running       sync.WaitGroup
+	heartbeat     sync.WaitGroup
+	startMu       sync.Mutex
+	stopping      chan struct{}
 	closed        chan bool
 	logger        *logrus.Entry
 	clock         clock.Clock
 	random        utils.Random
 	transactioner utils.Transactioner
+	semaphore     Semaphore
+	logs          JobLogStore
+	artifacts     ArtifactStore
+
+	settingsStore SettingsStore
+	settings      *liveSettings
+	// stored are the settings last loaded from settingsStore by key
+	stored map[string]Setting
+	// consumers are the running consumers, consumerSeq numbers the consumers started
+	consumersMu sync.Mutex
+	consumers   []workerConsumer
+	consumerSeq int
+	// prefetch is the prefetch limit the queues started consuming with, job_prefetch only scales the consumers
+	prefetch int64
+	// queueTypes maps the queues consumed by the worker to their job type, paused are those of them which are paused
+	queueTypes map[string]string
+	paused     []string
 }
 
-func NewWorker(cfg config.Config, logger *logrus.Entry, svc Service, connection rmq.Connection, queue rmq.Queue, clock clock.Clock, random utils.Random, transactioner utils.Transactioner) *WorkerImpl {
+func NewWorker(cfg config.Config, logger *logrus.Entry, svc Service, broker Broker, queues *JobQueues, registry WorkerRegistry, clock clock.Clock, random utils.Random, transactioner utils.Transactioner, semaphore Semaphore, logs JobLogStore, artifacts ArtifactStore, settingsStore SettingsStore) *WorkerImpl {
+	hostname, _ := os.Hostname()
+
 	return &WorkerImpl{
-		cfg:           cfg,
-		closed:        make(chan bool),
-		svc:           svc,
-		connection:    connection,
-		queue:         queue,
+		cfg:      cfg,
+		stopping: make(chan struct{}),
+		closed:   make(chan bool),
+		svc:      svc,
+		broker:   broker,
+		queues:   queues,
+		registry: registry,
+		info: WorkerInfo{
+			Id:       fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), strconv.FormatInt(rand.Int63(), 36)),
+			Hostname: hostname,
+			Labels:   cfg.WorkerConfig.WorkerLabels,
+		},
+		scheduler:     newPriorityScheduler(cfg.JobConfig.PriorityWeights),
 		logger:        logger.WithField("tag", "worker"),
-		clock:         clock,
+		clock:         utils.UTCClock(clock),
 		random:        random,
 		transactioner: transactioner,
+		semaphore:     semaphore,
+		logs:          logs,
+		artifacts:     artifacts,
+		settingsStore: settingsStore,
+		settings:      &liveSettings{settings: NewRuntimeSettings(cfg)},
+		stored:        make(map[string]Setting),
+		queueTypes:    make(map[string]string),
+		paused:        []string{},
 	}
 }
 
+// Start consumes the queues of the job types served by the worker at every priority,
+// JOB_PREFETCH consumers run the deliveries picked by the priority weights.
+// The runtime settings are reloaded while the worker runs, see SettingsStore.
 func (w *WorkerImpl) Start() error {
-	if err := w.queue.StartConsuming(w.cfg.JobPrefetch, time.Duration(w.cfg.RedisConfig.RedisPollIntervalMs)*time.Millisecond); err != nil {
-		return errors.Wrapf(err, "failed to start consuming")
+	for priority := range w.cfg.JobConfig.PriorityWeights {
+		if !IsValidJobPriority(priority) {
+			return fmt.Errorf("unknown job priority %q in JOB_PRIORITY_WEIGHTS", priority)
+		}
 	}
 
-	for i := int64(0); i < w.cfg.JobPrefetch; i++ {
-		if _, err := w.queue.AddConsumer(fmt.Sprintf("worker:%d", i), NewConsumer(w.cfg, w.logger, w.svc, w.clock, w.random, w.transactioner)); err != nil {
-			return errors.Wrap(err, "failed to add consumer")
+	types, err := ServedJobTypes(w.cfg.WorkerConfig.WorkerTypes, w.cfg.WorkerConfig.WorkerLabels, w.cfg.JobConfig.TypeLabels)
+	if err != nil {
+		return err
+	}
+
+	for _, jobType := range types {
+		for _, priority := range JobPriorities {
+			w.queueTypes[JobQueueName(w.queues.name, jobType, priority)] = jobType
 		}
 	}
 
-	w.logger.Info("Start worker successfully")
+	// A worker whose settings cannot be loaded runs with its config until the next reload
+	if err := w.reloadSettings(context.Background()); err != nil {
+		w.logger.WithError(err).Error("failed to load runtime settings")
+	}
+
+	prefetch := w.settings.get().JobPrefetch
+	w.prefetch = prefetch
+	for _, jobType := range types {
+		for _, priority := range JobPriorities {
+			queue, err := w.queues.Queue(jobType, priority)
+			if err != nil {
+				return errors.Wrapf(err, "failed to open queue of %s jobs", jobType)
+			}
+
+			if err := queue.StartConsuming(prefetch, w.cfg.QueueConfig.PollInterval(w.cfg.RedisConfig)); err != nil {
+				return errors.Wrapf(err, "failed to start consuming %s jobs of %s priority", jobType, priority)
+			}
+
+			if err := queue.AddConsumer(fmt.Sprintf("%s:%s", jobType, priority), w.scheduler.consumer(JobQueueName(w.queues.name, jobType, priority), priority)); err != nil {
+				return errors.Wrap(err, "failed to add consumer")
+			}
+		}
+	}
+
+	w.scaleConsumers(int(prefetch))
+
+	w.info.Types = types
+	w.info.StartedAt = w.clock.Now()
+	if err := w.registry.Register(context.Background(), w.info); err != nil {
+		return errors.Wrap(err, "failed to register worker")
+	}
+
+	w.startMu.Lock()
+	w.heartbeat.Add(2)
+	go w.heartbeats()
+	go w.watchSettings()
+	w.startMu.Unlock()
+
+	w.logger.WithField("types", types).Info("Start worker successfully")
 	// wait until channel is closed
 	<-w.closed
 	return nil
 }
 
 func (w *WorkerImpl) Stop() {
-	<-w.queue.StopConsuming()
+	// the API no longer counts on this worker for its job types
+	// Start adds to heartbeat under startMu, not while Stop waits for it
+	w.startMu.Lock()
+	close(w.stopping)
+	w.heartbeat.Wait()
+	w.startMu.Unlock()
+	if err := w.registry.Unregister(context.Background(), w.info.Id); err != nil {
+		w.logger.WithError(err).Error("failed to unregister worker")
+	}
+
+	// the consumers keep running the fetched deliveries until every queue stopped, but those of the paused types
+	w.scheduler.drain()
+	<-w.queues.StopConsuming()
+	w.scheduler.close()
+	w.running.Wait()
 	close(w.closed)
 }
 
+// heartbeats refreshes the registration of the worker until it stops.
+func (w *WorkerImpl) heartbeats() {
+	defer w.heartbeat.Done()
+
+	ticker := time.NewTicker(workerHeartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopping:
+			return
+		case <-ticker.C:
+			if err := w.registry.Register(context.Background(), w.info); err != nil {
+				w.logger.WithError(err).Error("failed to refresh worker registration")
+			}
+		}
+	}
+}
+
+// watchSettings reloads the runtime settings until the worker stops.
+func (w *WorkerImpl) watchSettings() {
+	defer w.heartbeat.Done()
+
+	ticker := time.NewTicker(settingsRefreshInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-w.stopping:
+			return
+		case <-ticker.C:
+			if err := w.reloadSettings(context.Background()); err != nil {
+				w.logger.WithError(err).Error("failed to reload runtime settings")
+			}
+		}
+	}
+}
+
+// reloadSettings applies the stored settings to the config of the worker, every change is logged with its author.
+func (w *WorkerImpl) reloadSettings(ctx context.Context) error {
+	stored, err := w.settingsStore.Settings(ctx)
+	if err != nil {
+		return err
+	}
+
+	settings := NewRuntimeSettings(w.cfg)
+	loaded := make(map[string]Setting, len(stored))
+	for _, setting := range stored {
+		loaded[setting.Key] = setting
+		logger := w.logger.WithFields(logrus.Fields{
+			"setting":    setting.Key,
+			"updated_by": setting.UpdatedBy,
+			"updated_at": setting.UpdatedAt,
+		})
+
+		applied, err := settings.Apply(setting)
+		if err != nil {
+			logger.WithError(err).Error("Ignoring invalid setting")
+			continue
+		}
+		settings = applied
+
+		if previous, ok := w.stored[setting.Key]; ok && previous.UpdatedAt.Equal(setting.UpdatedAt) {
+			continue
+		}
+
+		if setting.IsReset() {
+			logger.Info("Setting was reset to the config")
+		} else {
+			logger.Infof("Setting was changed to %s", setting.Value)
+		}
+	}
+
+	w.stored = loaded
+	w.applySettings(settings)
+	return nil
+}
+
+// applySettings switches the worker to settings, the running jobs keep the timeout they started with.
+// A changed job_prefetch scales the consumers, the queues keep the prefetch limit they started consuming with.
+func (w *WorkerImpl) applySettings(settings RuntimeSettings) {
+	previous := w.settings.get()
+	w.settings.set(settings)
+
+	paused := []string{}
+	for queue, jobType := range w.queueTypes {
+		isPaused := settings.IsQueuePaused(queue, jobType)
+		setQueuePaused(queue, isPaused)
+		if isPaused {
+			paused = append(paused, queue)
+		}
+	}
+	sort.Strings(paused)
+	w.scheduler.setPaused(paused)
+
+	if previous.JobTimeout != settings.JobTimeout {
+		w.logger.Infof("Job timeout changed from %ds to %ds", previous.JobTimeout, settings.JobTimeout)
+	}
+
+	if strings.Join(w.paused, ",") != strings.Join(paused, ",") {
+		w.logger.WithField("queues", paused).Info("Paused queues changed")
+		w.paused = paused
+	}
+
+	// the consumers only run once the worker started
+	if count := w.consumerCount(); count > 0 && int64(count) != settings.JobPrefetch {
+		w.logger.Infof("Scaling consumers from %d to %d, the queues keep fetching up to %d deliveries until the worker restarts", count, settings.JobPrefetch, w.prefetch)
+		w.scaleConsumers(int(settings.JobPrefetch))
+	}
+}
+
+// workerConsumer is a consumer run by the worker until stop is closed.
+type workerConsumer struct {
+	consumer *Consumer
+	stop     chan struct{}
+}
+
+func (w *WorkerImpl) consumerCount() int {
+	w.consumersMu.Lock()
+	defer w.consumersMu.Unlock()
+
+	return len(w.consumers)
+}
+
+// Consumers returns the state of the running consumers, those stopped by a scale down are left out.
+func (w *WorkerImpl) Consumers() []ConsumerState {
+	w.consumersMu.Lock()
+	defer w.consumersMu.Unlock()
+
+	states := make([]ConsumerState, 0, len(w.consumers))
+	for _, c := range w.consumers {
+		states = append(states, c.consumer.State())
+	}
+
+	return states
+}
+
+// scaleConsumers starts or stops consumers until count of them run, a stopped consumer finishes its current job first.
+func (w *WorkerImpl) scaleConsumers(count int) {
+	w.consumersMu.Lock()
+	defer w.consumersMu.Unlock()
+
+	for len(w.consumers) < count {
+		consumer := NewConsumer(w.cfg, w.logger, w.svc, w.clock, w.random, w.transactioner, w.semaphore, w.logs, w.artifacts)
+		consumer.workerId = fmt.Sprintf("%s/worker:%d", w.info.Id, w.consumerSeq)
+		consumer.hostname = w.info.Hostname
+		consumer.settings = w.settings
+		w.consumerSeq++
+
+		stop := make(chan struct{})
+		w.consumers = append(w.consumers, workerConsumer{consumer: consumer, stop: stop})
+		w.running.Add(1)
+		go func() {
+			defer w.running.Done()
+			w.scheduler.run(consumer, stop)
+		}()
+	}
+
+	for len(w.consumers) > count {
+		last := len(w.consumers) - 1
+		close(w.consumers[last].stop)
+		w.consumers = w.consumers[:last]
+	}
+}
+
 // RunCleaner cleaner to make sure no unacked deliveries are stuck in the queue system.
-// it will detect queue connections whose heartbeat expired and will clean up all their consumer queues by moving their unacked deliveries back to the ready list.
+// it will detect queue connections whose heartbeat expired and will move their unacked deliveries back to the ready list.
 func (w *WorkerImpl) RunCleaner() {
-	cleaner := rmq.NewCleaner(w.connection)
-
 	for {
 		select {
 		case <-time.After(time.Second):
-			returned, err := cleaner.Clean()
+			returned, err := w.broker.Clean(context.Background())
 			if err != nil {
-				w.logger.WithError(err).Error("[rmq] failed to clean")
+				w.logger.WithError(err).Error("[queue] failed to clean")
 				continue
 			}
 
 			if returned > 0 {
-				w.logger.Infof("[rmq] cleaned %d msg", returned)
+				w.logger.Infof("[queue] cleaned %d msg", returned)
 			}
 		case <-w.closed:
 			return
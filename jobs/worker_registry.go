@@ -0,0 +1,124 @@
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/go-pg/pg/v9"
+	"github.com/go-pg/pg/v9/orm"
+)
+
+const (
+	// A worker refreshes its registration every few seconds, it is inactive once its heartbeat expired
+	workerHeartbeatInterval = 5 * time.Second
+	WorkerHeartbeatTTL      = time.Minute
+)
+
+// WorkerInfo describes a worker of the fleet and the job types it serves.
+type WorkerInfo struct {
+	Id          string    `json:"id"`
+	Hostname    string    `json:"hostname"`
+	Types       []string  `json:"types"`
+	Labels      []string  `json:"labels"`
+	StartedAt   time.Time `json:"started_at"`
+	HeartbeatAt time.Time `json:"heartbeat_at"`
+	Active      bool      `json:"active"`
+}
+
+// Serves tells whether the worker is active and consumes the queues of jobType.
+func (w WorkerInfo) Serves(jobType string) bool {
+	return w.Active && containsString(w.Types, jobType)
+}
+
+// WorkerRegistry keeps track of the running workers, so the API only accepts the job types some worker serves.
+type WorkerRegistry interface {
+	// Register adds the worker or refreshes its heartbeat
+	Register(ctx context.Context, worker WorkerInfo) error
+	Unregister(ctx context.Context, id string) error
+	// Workers lists the registered workers, those whose heartbeat expired are inactive
+	Workers(ctx context.Context) ([]WorkerInfo, error)
+}
+
+// ServedJobTypes returns the job types of a worker started with types and labels.
+// Without types the worker serves the default type, labels add the types which require one of them, see JOB_TYPE_LABELS.
+func ServedJobTypes(types []string, labels []string, typeLabels map[string]string) ([]string, error) {
+	served := []string{DefaultJobType}
+	if len(types) > 0 {
+		served = nil
+	}
+
+	for _, jobType := range types {
+		if label, ok := typeLabels[jobType]; ok && !containsString(labels, label) {
+			return nil, fmt.Errorf("job type %s requires a worker with label %s", jobType, label)
+		}
+
+		if !containsString(served, jobType) {
+			served = append(served, jobType)
+		}
+	}
+
+	for jobType, label := range typeLabels {
+		if containsString(labels, label) && !containsString(served, jobType) {
+			served = append(served, jobType)
+		}
+	}
+
+	sort.Strings(served)
+	return served, nil
+}
+
+type WorkerRegistryImpl struct {
+	db orm.DB
+}
+
+func NewWorkerRegistry(db orm.DB) *WorkerRegistryImpl {
+	return &WorkerRegistryImpl{
+		db: db,
+	}
+}
+
+type pgWorker struct {
+	Id          string    `pg:"id"`
+	Hostname    string    `pg:"hostname"`
+	Types       []string  `pg:"types,array"`
+	Labels      []string  `pg:"labels,array"`
+	StartedAt   time.Time `pg:"started_at"`
+	HeartbeatAt time.Time `pg:"heartbeat_at"`
+	Active      bool      `pg:"active"`
+}
+
+func (r *WorkerRegistryImpl) Register(ctx context.Context, worker WorkerInfo) error {
+	_, err := r.db.ExecContext(ctx, `INSERT INTO job_workers (id, hostname, types, labels, started_at, heartbeat_at)
+		VALUES (?, ?, ?, ?, ?, `+pgNow+`)
+		ON CONFLICT (id) DO UPDATE SET types = EXCLUDED.types, labels = EXCLUDED.labels, heartbeat_at = EXCLUDED.heartbeat_at`,
+		worker.Id, worker.Hostname, pg.Array(worker.Types), pg.Array(worker.Labels), worker.StartedAt)
+
+	return err
+}
+
+func (r *WorkerRegistryImpl) Unregister(ctx context.Context, id string) error {
+	_, err := r.db.ExecContext(ctx, `DELETE FROM job_workers WHERE id = ?`, id)
+	return err
+}
+
+func (r *WorkerRegistryImpl) Workers(ctx context.Context) ([]WorkerInfo, error) {
+	var rows []pgWorker
+	_, err := r.db.QueryContext(ctx, &rows, `SELECT id, hostname, types, labels, started_at, heartbeat_at,
+		heartbeat_at > `+pgNow+` - ? * interval '1 second' AS active
+		FROM job_workers ORDER BY id`, WorkerHeartbeatTTL.Seconds())
+	if err != nil {
+		return nil, err
+	}
+
+	workers := make([]WorkerInfo, 0, len(rows))
+	for _, row := range rows {
+		worker := WorkerInfo(row)
+		worker.StartedAt = worker.StartedAt.UTC()
+		worker.HeartbeatAt = worker.HeartbeatAt.UTC()
+		workers = append(workers, worker)
+	}
+
+	return workers, nil
+}
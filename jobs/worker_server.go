@@ -0,0 +1,62 @@
+package jobs
+
+import (
+	"context"
+	"errors"
+	"expvar"
+	"fmt"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"github.com/labstack/echo/v4/middleware"
+	"github.com/sirupsen/logrus"
+
+	"github.com/tuyentv96/hasty-challenge/config"
+)
+
+// WorkerServer is the admin HTTP server of a worker process, it serves its health checks and metrics.
+// GET /health/live fails once a consumer is stuck, so the worker gets restarted.
+type WorkerServer struct {
+	config config.Config
+	logger *logrus.Entry
+	routes *echo.Echo
+	worker Worker
+	checks HealthChecks
+}
+
+func NewWorkerServer(cfg config.Config, logger *logrus.Entry, worker Worker, checks HealthChecks) *WorkerServer {
+	s := WorkerServer{
+		config: cfg,
+		logger: logger.WithField("tag", "worker-http"),
+		worker: worker,
+		checks: checks,
+	}
+
+	s.routes = echo.New()
+	s.routes.HideBanner = true
+	s.routes.HidePort = true
+	s.routes.Use(middleware.Recover())
+
+	healthRoutes(s.routes, func() HealthReport {
+		return consumersReport(s.worker.Consumers())
+	}, s.checks)
+	s.routes.GET("/metrics", echo.WrapHandler(expvar.Handler()))
+
+	return &s
+}
+
+// Serve listens on WORKER_HTTP_PORT until Shutdown is called
+func (s *WorkerServer) Serve() error {
+	s.logger.Infof("Serving health checks on port %d", s.config.WorkerHTTPPort)
+	err := s.routes.Start(fmt.Sprintf(":%d", s.config.WorkerHTTPPort))
+	if errors.Is(err, http.ErrServerClosed) {
+		return nil
+	}
+
+	return err
+}
+
+// Shutdown stops accepting requests and waits for the pending ones
+func (s *WorkerServer) Shutdown(ctx context.Context) error {
+	return s.routes.Shutdown(ctx)
+}
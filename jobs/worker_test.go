@@ -1,11 +1,14 @@
 package jobs
 
 import (
+	"context"
+	"encoding/json"
 	"testing"
 	"time"
 
 	"github.com/benbjohnson/clock"
 	"github.com/brianvoe/gofakeit/v6"
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/tuyentv96/hasty-challenge/config"
@@ -13,8 +16,7 @@ import (
 )
 
 func initTestWorker(t *testing.T, cfg config.Config, svc Service, queueName string, clock clock.Clock, random utils.Random) *WorkerImpl {
-	queue := initTestQueue(t, queueName)
-	return NewWorker(cfg, testLogger, svc, testRmqConnection, queue, clock, random, testTransaction)
+	return NewWorker(cfg, testLogger, svc, testBroker, initTestQueues(queueName), testWorkers, clock, random, testTransaction, NewLocalSemaphore(), testJobLogs, testArtifacts, testSettings)
 }
 
 func TestWorkerStartAndStop(t *testing.T) {
@@ -41,3 +43,75 @@ func TestWorkerStartAndStop(t *testing.T) {
 	err := worker.Start()
 	require.NoError(t, err)
 }
+
+func TestServedJobTypes(t *testing.T) {
+	typeLabels := map[string]string{"report": "large-cache", "render": "gpu"}
+
+	types, err := ServedJobTypes(nil, nil, typeLabels)
+	require.NoError(t, err)
+	assert.Equal(t, []string{DefaultJobType}, types)
+
+	types, err = ServedJobTypes(nil, []string{"large-cache"}, typeLabels)
+	require.NoError(t, err)
+	assert.Equal(t, []string{DefaultJobType, "report"}, types)
+
+	types, err = ServedJobTypes([]string{"export"}, []string{"gpu"}, typeLabels)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"export", "render"}, types)
+
+	_, err = ServedJobTypes([]string{"report"}, nil, typeLabels)
+	assert.Error(t, err, "report requires the large-cache label")
+}
+
+func TestWorkerRuntimeSettings(t *testing.T) {
+	ctx := context.Background()
+	clock := initTestClock()
+	cfg := config.Config{
+		JobConfig: config.JobConfig{
+			TimeoutInSeconds: 30,
+			JobPrefetch:      5,
+		},
+	}
+	queueName := gofakeit.UUID()
+	svc := initTestService(t, queueName, clock)
+	worker := initTestWorker(t, cfg, svc, queueName, clock, utils.NewMockRandomImpl())
+
+	settings := testSettings
+	reset := func() {
+		for _, key := range SettingKeys {
+			_, err := settings.PutSetting(ctx, Setting{Key: key, UpdatedBy: "test"})
+			require.NoError(t, err)
+		}
+	}
+	reset()
+	t.Cleanup(reset)
+
+	worker.queueTypes = map[string]string{"job-queue": DefaultJobType, "job-queue.report": "report"}
+	worker.scaleConsumers(int(cfg.JobPrefetch))
+	defer func() {
+		worker.scheduler.close()
+		worker.running.Wait()
+	}()
+
+	for key, value := range map[string]string{SettingJobPrefetch: `2`, SettingJobTimeout: `45`, SettingPausedTypes: `["report"]`} {
+		_, err := settings.PutSetting(ctx, Setting{Key: key, Value: json.RawMessage(value), UpdatedBy: "alice"})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, worker.reloadSettings(ctx))
+	assert.Len(t, worker.consumers, 2)
+	assert.Equal(t, 45, worker.settings.get().JobTimeout)
+	assert.True(t, worker.settings.get().IsPaused("report"))
+	assert.Equal(t, []string{"job-queue.report"}, worker.paused)
+
+	consumer := NewConsumer(cfg, testLogger, svc, clock, utils.NewMockRandomImpl(), testTransaction, NewLocalSemaphore(), testJobLogs, testArtifacts)
+	consumer.settings = worker.settings
+	assert.Equal(t, 45, consumer.jobConfig().TenantTimeout(DefaultTenantId))
+
+	reset()
+	require.NoError(t, worker.reloadSettings(ctx))
+	assert.Len(t, worker.consumers, 5, "the reset settings fall back to the config")
+	assert.Equal(t, 30, worker.settings.get().JobTimeout)
+	assert.False(t, worker.settings.get().IsPaused("report"))
+	assert.Empty(t, worker.paused)
+}
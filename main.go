@@ -11,28 +11,17 @@ import (
 )
 
 func main() {
-	ctx := context.Background()
-	cli, cleanup, err := cmd.InitApplication(ctx)
-	if err != nil {
-		log.Fatalln(err.Error())
-	}
-
-	handleSigterm(cleanup)
+	// Commands stop gracefully on Ctrl+C or SIGTERM, a second signal exits immediately
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	go func() {
+		<-ctx.Done()
+		stop()
+	}()
 
-	err = cli.Commands().Run(os.Args)
+	app := cmd.NewApplication(ctx)
+	err := app.Commands().Run(os.Args)
+	app.Close()
 	if err != nil {
 		log.Fatalln(err.Error())
 	}
 }
-
-// handleSigterm -- Handles Ctrl+C or most other means of "controlled" shutdown gracefully.
-// Invokes the supplied func before exiting.
-func handleSigterm(handleExit func()) {
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, syscall.SIGINT, syscall.SIGTERM)
-	go func() {
-		<-c
-		handleExit()
-		os.Exit(1)
-	}()
-}
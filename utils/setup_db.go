@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"log"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
@@ -17,6 +18,16 @@ import (
 	migration "github.com/tuyentv96/hasty-challenge/db"
 )
 
+// DockerAvailable tells whether the containers of the Setup functions can be started.
+func DockerAvailable() bool {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		return false
+	}
+
+	return pool.Client.Ping() == nil
+}
+
 func SetupDBTest() (dbClient *pg.DB, closeFunc func() error) {
 	cfg := struct {
 		Address  string `json:"addr"`
@@ -41,6 +52,8 @@ func SetupDBTest() (dbClient *pg.DB, closeFunc func() error) {
 			"postgres",
 			"-c", "log_statement=all",
 			"-c", "log_destination=stderr",
+			// a server time zone other than UTC, the sessions must not depend on it
+			"-c", "timezone=Asia/Ho_Chi_Minh",
 		},
 		Env: []string{
 			"POSTGRES_USER=" + cfg.Username,
@@ -81,10 +94,11 @@ func SetupDBTest() (dbClient *pg.DB, closeFunc func() error) {
 
 	if err := pool.Retry(func() error {
 		dbClient = pg.Connect(&pg.Options{
-			Addr:     cfg.Address,
-			Database: cfg.Database,
-			User:     cfg.Username,
-			Password: cfg.Password,
+			Addr:      cfg.Address,
+			Database:  cfg.Database,
+			User:      cfg.Username,
+			Password:  cfg.Password,
+			OnConnect: SetSessionUTC,
 		})
 
 		_, err := dbClient.ExecContext(context.Background(), "SELECT 1")
@@ -101,7 +115,7 @@ func SetupDBTest() (dbClient *pg.DB, closeFunc func() error) {
 }
 
 func handleInterrupt(pool *dockertest.Pool, container *dockertest.Resource) {
-	c := make(chan os.Signal)
+	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 	go func() {
 		<-c
@@ -120,7 +134,7 @@ func SetupRedisTest() (redisClient *redis.Client, closeFunc func() error) {
 
 	runCfg := &dockertest.RunOptions{
 		Repository: "redis",
-		Tag:        "5.0.13-alpine3.14",
+		Tag:        "6.2.6-alpine",
 	}
 
 	resource, err := pool.RunWithOptions(runCfg, func(hostConfig *docker.HostConfig) {
@@ -153,3 +167,63 @@ func SetupRedisTest() (redisClient *redis.Client, closeFunc func() error) {
 
 	return
 }
+
+// MinioAccessKey and MinioSecretKey are the credentials of the container of SetupMinioTest.
+const (
+	MinioAccessKey = "minio"
+	MinioSecretKey = "minio123456"
+)
+
+// SetupMinioTest starts MinIO, an S3 compatible storage, and returns its endpoint, e.g. http://localhost:49153.
+func SetupMinioTest() (endpoint string, closeFunc func() error) {
+	pool, err := dockertest.NewPool("")
+	if err != nil {
+		log.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	runCfg := &dockertest.RunOptions{
+		Repository: "minio/minio",
+		Tag:        "RELEASE.2022-10-24T18-35-07Z",
+		Cmd:        []string{"server", "/data"},
+		Env: []string{
+			"MINIO_ROOT_USER=" + MinioAccessKey,
+			"MINIO_ROOT_PASSWORD=" + MinioSecretKey,
+		},
+	}
+
+	resource, err := pool.RunWithOptions(runCfg, func(hostConfig *docker.HostConfig) {
+		// set AutoRemove to true so that stopped container goes away by itself
+		hostConfig.AutoRemove = true
+		hostConfig.RestartPolicy = docker.RestartPolicy{
+			Name: "no",
+		}
+	})
+
+	closeFunc = resource.Close
+	if err != nil {
+		log.Fatalf("Could not start resource: %s", err)
+	}
+
+	resource.Expire(1000)
+	handleInterrupt(pool, resource)
+
+	endpoint = "http://" + net.JoinHostPort("localhost", resource.GetPort("9000/tcp"))
+
+	if err := pool.Retry(func() error {
+		resp, err := http.Get(endpoint + "/minio/health/live")
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+
+		if resp.StatusCode != http.StatusOK {
+			return fmt.Errorf("minio is not live: %s", resp.Status)
+		}
+
+		return nil
+	}); err != nil {
+		log.Fatalf("Could not connect to docker: %s", err)
+	}
+
+	return
+}
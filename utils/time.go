@@ -1,11 +1,57 @@
 package utils
 
-import "time"
+import (
+	"time"
+
+	"github.com/benbjohnson/clock"
+	"github.com/go-pg/pg/v9"
+)
+
+// Clock is the time source of the application, its Now is always in UTC
+// so the stored times and the durations computed from them do not depend on the TZ of the host.
+type Clock struct {
+	clock.Clock
+}
+
+// NewClock returns a Clock of the wall time.
+func NewClock() Clock {
+	return UTCClock(clock.New())
+}
+
+// UTCClock wraps c, e.g. a clock.Mock of a test, so its Now returns UTC times.
+func UTCClock(c clock.Clock) Clock {
+	if utc, ok := c.(Clock); ok {
+		return utc
+	}
+
+	return Clock{Clock: c}
+}
+
+func (c Clock) Now() time.Time {
+	return c.Clock.Now().UTC()
+}
 
 func TimeToPtr(t time.Time) *time.Time {
 	return &t
 }
 
+// TimeNow returns the current time in UTC, for the code without a Clock.
 func TimeNow() time.Time {
 	return time.Now().UTC()
 }
+
+// TimePtrToUTC converts t to UTC, nil stays nil.
+func TimePtrToUTC(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	return TimeToPtr(t.UTC())
+}
+
+// SetSessionUTC is the pg.Options OnConnect of every connection: timestamptz values are read
+// and now() is computed in UTC whatever the time zone of the Postgres server is.
+func SetSessionUTC(conn *pg.Conn) error {
+	_, err := conn.Exec("SET TIME ZONE 'UTC'")
+	return err
+}